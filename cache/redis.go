@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+)
+
+// RedisOptions contains connection settings for redis cache
+type RedisOptions struct {
+	// Servers is a list of host:port addresses. Single address means standalone server,
+	// several addresses without MasterName are treated as cluster seed nodes.
+	Servers []string
+	// MasterName is a name of the master monitored by sentinel. If specified, Servers should be sentinel addresses.
+	MasterName string
+	Password   string
+	DB         int
+	// Timeout limits duration of every single cache operation
+	Timeout time.Duration
+}
+
+func NewRedis(prefix string, opts RedisOptions) BytesCache {
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = 50 * time.Millisecond
+	}
+
+	client := redis.NewUniversalClient(&redis.UniversalOptions{
+		Addrs:        opts.Servers,
+		MasterName:   opts.MasterName,
+		Password:     opts.Password,
+		DB:           opts.DB,
+		DialTimeout:  timeout,
+		ReadTimeout:  timeout,
+		WriteTimeout: timeout,
+		PoolTimeout:  timeout,
+		MaxRetries:   -1,
+	})
+
+	return &RedisCache{prefix: prefix, client: client, timeout: timeout}
+}
+
+type RedisCache struct {
+	prefix   string
+	client   redis.UniversalClient
+	timeout  time.Duration
+	timeouts uint64
+}
+
+func (r *RedisCache) key(k string) string {
+	key := sha1.Sum([]byte(k))
+	return r.prefix + hex.EncodeToString(key[:])
+}
+
+func (r *RedisCache) Get(k string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	cmd := redis.NewStringCmd("get", r.key(k))
+	err := r.client.ProcessContext(ctx, cmd)
+	if err != nil {
+		if err == redis.Nil {
+			return nil, ErrNotFound
+		}
+		if isTimeout(err) {
+			atomic.AddUint64(&r.timeouts, 1)
+			return nil, ErrTimeout
+		}
+		return nil, err
+	}
+
+	return cmd.Bytes()
+}
+
+func (r *RedisCache) Set(k string, v []byte, expire int32) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+		defer cancel()
+
+		var cmd *redis.StatusCmd
+		if expire > 0 {
+			cmd = redis.NewStatusCmd("set", r.key(k), v, "ex", expire)
+		} else {
+			cmd = redis.NewStatusCmd("set", r.key(k), v)
+		}
+		if err := r.client.ProcessContext(ctx, cmd); err != nil && isTimeout(err) {
+			atomic.AddUint64(&r.timeouts, 1)
+		}
+	}()
+}
+
+func (r *RedisCache) Timeouts() uint64 {
+	return atomic.LoadUint64(&r.timeouts)
+}
+
+func isTimeout(err error) bool {
+	if err == context.DeadlineExceeded {
+		return true
+	}
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return true
+	}
+	return false
+}
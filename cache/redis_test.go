@@ -0,0 +1,200 @@
+package cache
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis is a minimal in-process server that speaks enough of RESP protocol for RedisCache
+type fakeRedis struct {
+	listener net.Listener
+
+	sync.Mutex
+	data  map[string][]byte
+	ttl   map[string]int
+	delay time.Duration
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	srv := &fakeRedis{
+		listener: l,
+		data:     make(map[string][]byte),
+		ttl:      make(map[string]int),
+	}
+	go srv.serve()
+	return srv
+}
+
+func (srv *fakeRedis) Addr() string {
+	return srv.listener.Addr().String()
+}
+
+func (srv *fakeRedis) Close() {
+	_ = srv.listener.Close()
+}
+
+func (srv *fakeRedis) setDelay(d time.Duration) {
+	srv.Lock()
+	srv.delay = d
+	srv.Unlock()
+}
+
+func (srv *fakeRedis) get(k string) ([]byte, int, bool) {
+	srv.Lock()
+	defer srv.Unlock()
+	v, ok := srv.data[k]
+	return v, srv.ttl[k], ok
+}
+
+func (srv *fakeRedis) serve() {
+	for {
+		conn, err := srv.listener.Accept()
+		if err != nil {
+			return
+		}
+		go srv.handle(conn)
+	}
+}
+
+func (srv *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+
+		srv.Lock()
+		delay := srv.delay
+		srv.Unlock()
+		time.Sleep(delay)
+
+		var reply string
+		switch strings.ToLower(args[0]) {
+		case "ping":
+			reply = "+PONG\r\n"
+		case "get":
+			srv.Lock()
+			v, ok := srv.data[args[1]]
+			srv.Unlock()
+			if ok {
+				reply = fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+			} else {
+				reply = "$-1\r\n"
+			}
+		case "set":
+			ttl := 0
+			if len(args) == 5 && strings.ToLower(args[3]) == "ex" {
+				ttl, _ = strconv.Atoi(args[4])
+			}
+			srv.Lock()
+			srv.data[args[1]] = []byte(args[2])
+			srv.ttl[args[1]] = ttl
+			srv.Unlock()
+			reply = "+OK\r\n"
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[0] != '*' {
+		return nil, fmt.Errorf("unexpected line %q", line)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		line, err = r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		l, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, l+2)
+		if _, err = io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:l]))
+	}
+	return args, nil
+}
+
+func waitForKey(srv *fakeRedis, key string) bool {
+	for i := 0; i < 100; i++ {
+		if _, _, ok := srv.get(key); ok {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestRedisCache(t *testing.T) {
+	srv := newFakeRedis(t)
+	defer srv.Close()
+
+	c := NewRedis("capi-test", RedisOptions{Servers: []string{srv.Addr()}, Timeout: time.Second}).(*RedisCache)
+
+	if _, err := c.Get("missing"); err != ErrNotFound {
+		t.Fatalf("unexpected error for missing key: got %v, want %v", err, ErrNotFound)
+	}
+
+	c.Set("key", []byte("value"), 60)
+	if !waitForKey(srv, c.key("key")) {
+		t.Fatalf("key was not set")
+	}
+	if !strings.HasPrefix(c.key("key"), "capi-test") {
+		t.Errorf("key %q doesn't have a prefix", c.key("key"))
+	}
+	if _, ttl, _ := srv.get(c.key("key")); ttl != 60 {
+		t.Errorf("unexpected ttl: got %d, want 60", ttl)
+	}
+
+	v, err := c.Get("key")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(v) != "value" {
+		t.Errorf("unexpected value: got %q, want %q", v, "value")
+	}
+}
+
+func TestRedisCacheTimeout(t *testing.T) {
+	srv := newFakeRedis(t)
+	defer srv.Close()
+
+	c := NewRedis("capi-test", RedisOptions{Servers: []string{srv.Addr()}, Timeout: 20 * time.Millisecond}).(*RedisCache)
+
+	srv.setDelay(100 * time.Millisecond)
+	if _, err := c.Get("key"); err != ErrTimeout {
+		t.Fatalf("unexpected error: got %v, want %v", err, ErrTimeout)
+	}
+	if c.Timeouts() != 1 {
+		t.Errorf("unexpected timeouts counter: got %d, want 1", c.Timeouts())
+	}
+}
@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"sync/atomic"
+)
+
+// NewTwoTier creates a cache that checks fast local cache (l1) before the shared one (l2).
+// Values found in l2 are copied to l1 for l1Expire seconds. l1Expire also limits lifetime of the values in l1 on Set,
+// so local copies won't outlive shared ones for too long.
+func NewTwoTier(l1, l2 BytesCache, l1Expire int32) BytesCache {
+	return &TwoTierCache{l1: l1, l2: l2, l1Expire: l1Expire}
+}
+
+type TwoTierCache struct {
+	l1       BytesCache
+	l2       BytesCache
+	l1Expire int32
+
+	l1Hits   uint64
+	l1Misses uint64
+	l2Hits   uint64
+	l2Misses uint64
+}
+
+func (c *TwoTierCache) Get(k string) ([]byte, error) {
+	v, err := c.l1.Get(k)
+	if err == nil {
+		atomic.AddUint64(&c.l1Hits, 1)
+		return v, nil
+	}
+	atomic.AddUint64(&c.l1Misses, 1)
+
+	v, err = c.l2.Get(k)
+	if err != nil {
+		atomic.AddUint64(&c.l2Misses, 1)
+		return nil, err
+	}
+	atomic.AddUint64(&c.l2Hits, 1)
+
+	c.l1.Set(k, v, c.l1Expire)
+	return v, nil
+}
+
+func (c *TwoTierCache) Set(k string, v []byte, expire int32) {
+	l1Expire := expire
+	if c.l1Expire > 0 && (l1Expire <= 0 || l1Expire > c.l1Expire) {
+		l1Expire = c.l1Expire
+	}
+	c.l1.Set(k, v, l1Expire)
+	c.l2.Set(k, v, expire)
+}
+
+// L1 returns local cache
+func (c *TwoTierCache) L1() BytesCache { return c.l1 }
+
+// L2 returns shared cache
+func (c *TwoTierCache) L2() BytesCache { return c.l2 }
+
+func (c *TwoTierCache) L1Hits() uint64 { return atomic.LoadUint64(&c.l1Hits) }
+
+func (c *TwoTierCache) L1Misses() uint64 { return atomic.LoadUint64(&c.l1Misses) }
+
+func (c *TwoTierCache) L2Hits() uint64 { return atomic.LoadUint64(&c.l2Hits) }
+
+func (c *TwoTierCache) L2Misses() uint64 { return atomic.LoadUint64(&c.l2Misses) }
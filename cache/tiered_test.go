@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"testing"
+)
+
+func TestTwoTierCache(t *testing.T) {
+	l1 := NewExpireCache(0)
+	l2 := NewExpireCache(0)
+	c := NewTwoTier(l1, l2, 10).(*TwoTierCache)
+
+	if _, err := c.Get("key"); err != ErrNotFound {
+		t.Fatalf("unexpected error for missing key: got %v, want %v", err, ErrNotFound)
+	}
+
+	// value that exists only in the shared cache should be copied to the local one
+	l2.Set("key", []byte("value"), 60)
+	v, err := c.Get("key")
+	if err != nil || string(v) != "value" {
+		t.Fatalf("unexpected result: got %q, %v", v, err)
+	}
+	if v, err = l1.Get("key"); err != nil || string(v) != "value" {
+		t.Fatalf("value wasn't copied to l1: got %q, %v", v, err)
+	}
+
+	v, err = c.Get("key")
+	if err != nil || string(v) != "value" {
+		t.Fatalf("unexpected result: got %q, %v", v, err)
+	}
+
+	c.Set("key2", []byte("value2"), 60)
+	for name, tier := range map[string]BytesCache{"l1": l1, "l2": l2} {
+		if v, err = tier.Get("key2"); err != nil || string(v) != "value2" {
+			t.Errorf("value wasn't set to %s: got %q, %v", name, v, err)
+		}
+	}
+
+	counters := []struct {
+		name string
+		got  uint64
+		want uint64
+	}{
+		{"l1Hits", c.L1Hits(), 1},
+		{"l1Misses", c.L1Misses(), 2},
+		{"l2Hits", c.L2Hits(), 1},
+		{"l2Misses", c.L2Misses(), 1},
+	}
+	for _, cnt := range counters {
+		if cnt.got != cnt.want {
+			t.Errorf("unexpected %s: got %d, want %d", cnt.name, cnt.got, cnt.want)
+		}
+	}
+}
+
+func TestTwoTierCacheL1Expire(t *testing.T) {
+	tests := []struct {
+		l1Expire int32
+		expire   int32
+		want     int32
+	}{
+		{l1Expire: 10, expire: 60, want: 10},
+		{l1Expire: 10, expire: 5, want: 5},
+		{l1Expire: 10, expire: 0, want: 10},
+		{l1Expire: 0, expire: 60, want: 60},
+	}
+
+	for _, tt := range tests {
+		l1 := &recordingCache{}
+		c := NewTwoTier(l1, NullCache{}, tt.l1Expire)
+		c.Set("key", []byte("value"), tt.expire)
+		if l1.expire != tt.want {
+			t.Errorf("l1Expire=%d, expire=%d: got %d, want %d", tt.l1Expire, tt.expire, l1.expire, tt.want)
+		}
+	}
+}
+
+type recordingCache struct {
+	NullCache
+	expire int32
+}
+
+func (r *recordingCache) Set(k string, v []byte, expire int32) {
+	r.expire = expire
+}
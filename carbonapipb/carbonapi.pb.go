@@ -30,6 +30,8 @@ type AccessLogDetails struct {
 	URI                           string            `json:"uri,omitempty"`
 	FromCache                     bool              `json:"from_cache"`
 	UsedBackendCache              bool              `json:"used_backend_cache"`
+	Coalesced                     bool              `json:"coalesced,omitempty"`
+	Stale                         bool              `json:"stale,omitempty"`
 	ZipperRequests                int64             `json:"zipper_requests,omitempty"`
 	TotalMetricsCount             int64             `json:"total_metrics_count,omitempty"`
 	RequestHeaders                map[string]string `json:"request_headers"`
@@ -0,0 +1,102 @@
+package carbonapipb
+
+import (
+	"context"
+
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"github.com/golang/protobuf/proto"
+
+	"google.golang.org/grpc"
+)
+
+// CarbonAPI service allows to evaluate graphite expressions over gRPC, same as /render does over HTTP. Code below is
+// equivalent of what protoc-gen-gogo generates for
+//
+//	message RenderRequest {
+//	    repeated string targets = 1;
+//	    string from = 2;
+//	    string until = 3;
+//	    string tz = 4;
+//	    int64 max_data_points = 5;
+//	    bool no_cache = 6;
+//	}
+//
+//	service CarbonAPI {
+//	    rpc Render (RenderRequest) returns (carbonapi_v3_pb.MultiFetchResponse) {}
+//	}
+const renderMethod = "/carbonapipb.CarbonAPI/Render"
+
+// RenderRequest contains parameters of /render request. From, Until and Tz accept the same values as HTTP API does
+type RenderRequest struct {
+	Targets       []string `protobuf:"bytes,1,rep,name=targets,proto3" json:"targets,omitempty"`
+	From          string   `protobuf:"bytes,2,opt,name=from,proto3" json:"from,omitempty"`
+	Until         string   `protobuf:"bytes,3,opt,name=until,proto3" json:"until,omitempty"`
+	Tz            string   `protobuf:"bytes,4,opt,name=tz,proto3" json:"tz,omitempty"`
+	MaxDataPoints int64    `protobuf:"varint,5,opt,name=max_data_points,json=maxDataPoints,proto3" json:"max_data_points,omitempty"`
+	NoCache       bool     `protobuf:"varint,6,opt,name=no_cache,json=noCache,proto3" json:"no_cache,omitempty"`
+}
+
+func (m *RenderRequest) Reset()         { *m = RenderRequest{} }
+func (m *RenderRequest) String() string { return proto.CompactTextString(m) }
+func (*RenderRequest) ProtoMessage()    {}
+
+// CarbonAPIServer is the server API for CarbonAPI service
+type CarbonAPIServer interface {
+	Render(context.Context, *RenderRequest) (*pb.MultiFetchResponse, error)
+}
+
+func renderHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RenderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CarbonAPIServer).Render(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: renderMethod,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CarbonAPIServer).Render(ctx, req.(*RenderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var carbonAPIServiceDesc = grpc.ServiceDesc{
+	ServiceName: "carbonapipb.CarbonAPI",
+	HandlerType: (*CarbonAPIServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Render",
+			Handler:    renderHandler,
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+// RegisterCarbonAPIServer registers CarbonAPI service on the server
+func RegisterCarbonAPIServer(s *grpc.Server, srv CarbonAPIServer) {
+	s.RegisterService(&carbonAPIServiceDesc, srv)
+}
+
+// CarbonAPIClient is the client API for CarbonAPI service
+type CarbonAPIClient interface {
+	Render(ctx context.Context, in *RenderRequest, opts ...grpc.CallOption) (*pb.MultiFetchResponse, error)
+}
+
+type carbonAPIClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewCarbonAPIClient(cc *grpc.ClientConn) CarbonAPIClient {
+	return &carbonAPIClient{cc}
+}
+
+func (c *carbonAPIClient) Render(ctx context.Context, in *RenderRequest, opts ...grpc.CallOption) (*pb.MultiFetchResponse, error) {
+	out := new(pb.MultiFetchResponse)
+	if err := c.cc.Invoke(ctx, renderMethod, in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/go-graphite/carbonapi/cache"
 	"github.com/go-graphite/carbonapi/cmd/carbonapi/interfaces"
+	"github.com/go-graphite/carbonapi/expr/seriescache"
 	"github.com/go-graphite/carbonapi/limiter"
 	zipperCfg "github.com/go-graphite/carbonapi/zipper/config"
 	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
@@ -23,10 +24,25 @@ var DefaultLoggerConfig = zapwriter.Config{
 }
 
 type CacheConfig struct {
-	Type              string   `mapstructure:"type"`
-	Size              int      `mapstructure:"size_mb"`
-	MemcachedServers  []string `mapstructure:"memcachedServers"`
-	DefaultTimeoutSec int32    `mapstructure:"defaultTimeoutSec"`
+	Type              string        `mapstructure:"type"`
+	Size              int           `mapstructure:"size_mb"`
+	MemcachedServers  []string      `mapstructure:"memcachedServers"`
+	RedisServers      []string      `mapstructure:"redisServers"`
+	RedisMasterName   string        `mapstructure:"redisMasterName"`
+	RedisPassword     string        `mapstructure:"redisPassword" json:"-"`
+	RedisDB           int           `mapstructure:"redisDB"`
+	RedisTimeout      time.Duration `mapstructure:"redisTimeout"`
+	Prefix            string        `mapstructure:"prefix"`
+	DefaultTimeoutSec int32         `mapstructure:"defaultTimeoutSec"`
+	L2Type            string        `mapstructure:"l2Type"`
+	L1TimeoutSec      int32         `mapstructure:"l1TimeoutSec"`
+	StaleTimeoutSec   int32         `mapstructure:"staleTimeoutSec"`
+	ChunkSec          int64         `mapstructure:"chunkSec"`
+}
+
+type EventsConfig struct {
+	Type string `mapstructure:"type"`
+	Path string `mapstructure:"path"`
 }
 
 type GraphiteConfig struct {
@@ -51,10 +67,13 @@ type ConfigType struct {
 	ExtrapolateExperiment      bool               `mapstructure:"extrapolateExperiment"`
 	Logger                     []zapwriter.Config `mapstructure:"logger"`
 	Listen                     string             `mapstructure:"listen"`
+	GRPCListen                 string             `mapstructure:"grpcListen"`
 	Buckets                    int                `mapstructure:"buckets"`
 	Concurency                 int                `mapstructure:"concurency"`
 	ResponseCacheConfig        CacheConfig        `mapstructure:"cache"`
 	BackendCacheConfig         CacheConfig        `mapstructure:"backendCache"`
+	SeriesCacheConfig          CacheConfig        `mapstructure:"seriesCache"`
+	Events                     EventsConfig       `mapstructure:"events"`
 	Cpus                       int                `mapstructure:"cpus"`
 	TimezoneString             string             `mapstructure:"tz"`
 	UnicodeRangeTables         []string           `mapstructure:"unicodeRangeTables"`
@@ -82,6 +101,9 @@ type ConfigType struct {
 	ResponseCache cache.BytesCache `mapstructure:"-" json:"-"`
 	BackendCache  cache.BytesCache `mapstructure:"-" json:"-"`
 
+	// SeriesCache stores fetched series in time-aligned chunks, nil if disabled
+	SeriesCache *seriescache.SeriesCache `mapstructure:"-" json:"-"`
+
 	DefaultTimeZone *time.Location `mapstructure:"-" json:"-"`
 
 	// ZipperInstance is API entry to carbonzipper
@@ -115,6 +137,14 @@ var Config = ConfigType{
 		Type:              "null",
 		DefaultTimeoutSec: 0,
 	},
+	SeriesCacheConfig: CacheConfig{
+		Type:              "null",
+		DefaultTimeoutSec: 86400,
+		ChunkSec:          3600,
+	},
+	Events: EventsConfig{
+		Type: "null",
+	},
 	TimezoneString: "",
 	Graphite: GraphiteConfig{
 		Pattern:  "{prefix}.{fqdn}",
@@ -14,10 +14,12 @@ import (
 	"github.com/ansel1/merry"
 	"github.com/facebookgo/pidfile"
 	"github.com/go-graphite/carbonapi/cache"
+	"github.com/go-graphite/carbonapi/events"
 	"github.com/go-graphite/carbonapi/expr/functions"
 	"github.com/go-graphite/carbonapi/expr/functions/cairo/png"
 	"github.com/go-graphite/carbonapi/expr/helper"
 	"github.com/go-graphite/carbonapi/expr/rewrite"
+	"github.com/go-graphite/carbonapi/expr/seriescache"
 	"github.com/go-graphite/carbonapi/limiter"
 	"github.com/go-graphite/carbonapi/pkg/parser"
 	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
@@ -31,6 +33,10 @@ var graphTemplates map[string]png.PictureParams
 func SetUpConfig(logger *zap.Logger, BuildVersion string) {
 	Config.ResponseCacheConfig.MemcachedServers = viper.GetStringSlice("cache.memcachedServers")
 	Config.BackendCacheConfig.MemcachedServers = viper.GetStringSlice("backendCache.memcachedServers")
+	Config.ResponseCacheConfig.RedisServers = viper.GetStringSlice("cache.redisServers")
+	Config.BackendCacheConfig.RedisServers = viper.GetStringSlice("backendCache.redisServers")
+	Config.SeriesCacheConfig.MemcachedServers = viper.GetStringSlice("seriesCache.memcachedServers")
+	Config.SeriesCacheConfig.RedisServers = viper.GetStringSlice("seriesCache.redisServers")
 	if n := viper.GetString("logger.logger"); n != "" {
 		Config.Logger[0].Logger = n
 	}
@@ -158,6 +164,43 @@ func SetUpConfig(logger *zap.Logger, BuildVersion string) {
 
 	Config.ResponseCache = createCache(logger, "cache", Config.ResponseCacheConfig)
 	Config.BackendCache = createCache(logger, "backendCache", Config.BackendCacheConfig)
+	if Config.SeriesCacheConfig.Type != "null" {
+		if Config.SeriesCacheConfig.ChunkSec <= 0 {
+			logger.Fatal("seriesCache: chunkSec must be positive",
+				zap.Int64("chunk_sec", Config.SeriesCacheConfig.ChunkSec),
+			)
+		}
+		Config.SeriesCache = seriescache.New(
+			createCache(logger, "seriesCache", Config.SeriesCacheConfig),
+			Config.SeriesCacheConfig.ChunkSec,
+			Config.SeriesCacheConfig.DefaultTimeoutSec,
+		)
+	}
+
+	switch Config.Events.Type {
+	case "file":
+		if Config.Events.Path == "" {
+			logger.Fatal("events: file store requested but no path provided")
+		}
+		store, err := events.NewFileStore(Config.Events.Path)
+		if err != nil {
+			logger.Fatal("events: failed to open file store",
+				zap.String("path", Config.Events.Path),
+				zap.Error(err),
+			)
+		}
+		events.SetStore(store)
+		logger.Info("events: file store configured",
+			zap.String("path", Config.Events.Path),
+		)
+	case "null", "":
+		// events are disabled
+	default:
+		logger.Fatal("events: unknown store type",
+			zap.String("type", Config.Events.Type),
+			zap.Strings("known_types", []string{"null", "file"}),
+		)
+	}
 
 	if Config.TimezoneString != "" {
 		fields := strings.Split(Config.TimezoneString, ",")
@@ -248,6 +291,11 @@ func SetUpConfig(logger *zap.Logger, BuildVersion string) {
 }
 
 func createCache(logger *zap.Logger, cacheName string, cacheConfig CacheConfig) cache.BytesCache {
+	prefix := cacheConfig.Prefix
+	if prefix == "" {
+		prefix = "capi-" + cacheName
+	}
+
 	switch cacheConfig.Type {
 	case "memcache":
 		if len(cacheConfig.MemcachedServers) == 0 {
@@ -257,17 +305,57 @@ func createCache(logger *zap.Logger, cacheName string, cacheConfig CacheConfig)
 		logger.Info(cacheName+": memcached configured",
 			zap.Strings("servers", cacheConfig.MemcachedServers),
 		)
-		return cache.NewMemcached("capi-"+cacheName, cacheConfig.MemcachedServers...)
+		return cache.NewMemcached(prefix, cacheConfig.MemcachedServers...)
+	case "redis":
+		if len(cacheConfig.RedisServers) == 0 {
+			logger.Fatal(cacheName + ": redis cache requested but no redis servers provided")
+		}
+
+		logger.Info(cacheName+": redis configured",
+			zap.Strings("servers", cacheConfig.RedisServers),
+			zap.String("master_name", cacheConfig.RedisMasterName),
+			zap.Duration("timeout", cacheConfig.RedisTimeout),
+		)
+		return cache.NewRedis(prefix, cache.RedisOptions{
+			Servers:    cacheConfig.RedisServers,
+			MasterName: cacheConfig.RedisMasterName,
+			Password:   cacheConfig.RedisPassword,
+			DB:         cacheConfig.RedisDB,
+			Timeout:    cacheConfig.RedisTimeout,
+		})
 	case "mem":
 		logger.Info(cacheName + ": in-memory cache configured")
 		return cache.NewExpireCache(uint64(cacheConfig.Size * 1024 * 1024))
+	case "tiered":
+		l2Config := cacheConfig
+		l2Config.Type = cacheConfig.L2Type
+		switch l2Config.Type {
+		case "memcache", "redis":
+		default:
+			logger.Fatal(cacheName+": tiered cache requires shared l2Type",
+				zap.String("l2_type", cacheConfig.L2Type),
+				zap.Strings("known_l2_types", []string{"memcache", "redis"}),
+			)
+		}
+
+		l1Expire := cacheConfig.L1TimeoutSec
+		if l1Expire <= 0 {
+			l1Expire = cacheConfig.DefaultTimeoutSec
+		}
+
+		l2 := createCache(logger, cacheName, l2Config)
+		logger.Info(cacheName+": tiered cache configured",
+			zap.String("l2_type", cacheConfig.L2Type),
+			zap.Int32("l1_timeout_sec", l1Expire),
+		)
+		return cache.NewTwoTier(cache.NewExpireCache(uint64(cacheConfig.Size*1024*1024)), l2, l1Expire)
 	case "null":
 		// defaults
 		return cache.NullCache{}
 	default:
 		logger.Error(cacheName+": unknown cache type",
 			zap.String("cache_type", cacheConfig.Type),
-			zap.Strings("known_cache_types", []string{"null", "mem", "memcache"}),
+			zap.Strings("known_cache_types", []string{"null", "mem", "memcache", "redis", "tiered"}),
 		)
 		return nil
 	}
@@ -314,6 +402,7 @@ func SetUpViper(logger *zap.Logger, configPath *string, viperPrefix string) {
 	viper.SetDefault("cache.size_mb", 0)
 	viper.SetDefault("cache.defaultTimeoutSec", 60)
 	viper.SetDefault("cache.memcachedServers", []string{})
+	viper.SetDefault("cache.redisServers", []string{})
 	viper.SetDefault("cpus", 0)
 	viper.SetDefault("tz", "")
 	viper.SetDefault("sendGlobsAsIs", nil)
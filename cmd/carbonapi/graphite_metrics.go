@@ -47,6 +47,7 @@ func setupGraphiteMetrics(logger *zap.Logger) {
 		graphite.Register(fmt.Sprintf("%s.requests", pattern), http.ApiMetrics.Requests)
 		graphite.Register(fmt.Sprintf("%s.request_cache_hits", pattern), http.ApiMetrics.RequestCacheHits)
 		graphite.Register(fmt.Sprintf("%s.request_cache_misses", pattern), http.ApiMetrics.RequestCacheMisses)
+		graphite.Register(fmt.Sprintf("%s.request_cache_stale_hits", pattern), http.ApiMetrics.RequestCacheStaleHits)
 		graphite.Register(fmt.Sprintf("%s.request_cache_overhead_ns", pattern), http.ApiMetrics.RenderCacheOverheadNS)
 		graphite.Register(fmt.Sprintf("%s.backend_cache_hits", pattern), http.ApiMetrics.BackendCacheHits)
 		graphite.Register(fmt.Sprintf("%s.backend_cache_misses", pattern), http.ApiMetrics.BackendCacheMisses)
@@ -57,16 +58,40 @@ func setupGraphiteMetrics(logger *zap.Logger) {
 
 		graphite.Register(fmt.Sprintf("%s.find_requests", pattern), http.ApiMetrics.FindRequests)
 		graphite.Register(fmt.Sprintf("%s.render_requests", pattern), http.ApiMetrics.RenderRequests)
+		graphite.Register(fmt.Sprintf("%s.render_coalesced_requests", pattern), http.ApiMetrics.RenderCoalescedRequests)
 
 		if http.ApiMetrics.MemcacheTimeouts != nil {
 			graphite.Register(fmt.Sprintf("%s.memcache_timeouts", pattern), http.ApiMetrics.MemcacheTimeouts)
 		}
 
+		if http.ApiMetrics.RedisTimeouts != nil {
+			graphite.Register(fmt.Sprintf("%s.redis_timeouts", pattern), http.ApiMetrics.RedisTimeouts)
+		}
+
 		if http.ApiMetrics.CacheSize != nil {
 			graphite.Register(fmt.Sprintf("%s.cache_size", pattern), http.ApiMetrics.CacheSize)
 			graphite.Register(fmt.Sprintf("%s.cache_items", pattern), http.ApiMetrics.CacheItems)
 		}
 
+		if http.ApiMetrics.RequestCacheL1Hits != nil {
+			graphite.Register(fmt.Sprintf("%s.request_cache_l1_hits", pattern), http.ApiMetrics.RequestCacheL1Hits)
+			graphite.Register(fmt.Sprintf("%s.request_cache_l1_misses", pattern), http.ApiMetrics.RequestCacheL1Misses)
+			graphite.Register(fmt.Sprintf("%s.request_cache_l2_hits", pattern), http.ApiMetrics.RequestCacheL2Hits)
+			graphite.Register(fmt.Sprintf("%s.request_cache_l2_misses", pattern), http.ApiMetrics.RequestCacheL2Misses)
+		}
+
+		if http.ApiMetrics.BackendCacheL1Hits != nil {
+			graphite.Register(fmt.Sprintf("%s.backend_cache_l1_hits", pattern), http.ApiMetrics.BackendCacheL1Hits)
+			graphite.Register(fmt.Sprintf("%s.backend_cache_l1_misses", pattern), http.ApiMetrics.BackendCacheL1Misses)
+			graphite.Register(fmt.Sprintf("%s.backend_cache_l2_hits", pattern), http.ApiMetrics.BackendCacheL2Hits)
+			graphite.Register(fmt.Sprintf("%s.backend_cache_l2_misses", pattern), http.ApiMetrics.BackendCacheL2Misses)
+		}
+
+		if http.ApiMetrics.SeriesCacheHits != nil {
+			graphite.Register(fmt.Sprintf("%s.series_cache_hits", pattern), http.ApiMetrics.SeriesCacheHits)
+			graphite.Register(fmt.Sprintf("%s.series_cache_misses", pattern), http.ApiMetrics.SeriesCacheMisses)
+		}
+
 		graphite.Register(fmt.Sprintf("%s.zipper.find_requests", pattern), http.ZipperMetrics.FindRequests)
 		graphite.Register(fmt.Sprintf("%s.zipper.find_errors", pattern), http.ZipperMetrics.FindErrors)
 
@@ -81,6 +106,9 @@ func setupGraphiteMetrics(logger *zap.Logger) {
 		graphite.Register(fmt.Sprintf("%s.zipper.cache_hits", pattern), http.ZipperMetrics.CacheHits)
 		graphite.Register(fmt.Sprintf("%s.zipper.cache_misses", pattern), http.ZipperMetrics.CacheMisses)
 
+		graphite.Register(fmt.Sprintf("%s.zipper.hedges_sent", pattern), http.ZipperMetrics.HedgesSent)
+		graphite.Register(fmt.Sprintf("%s.zipper.hedges_won", pattern), http.ZipperMetrics.HedgesWon)
+
 		go mstats.Start(config.Config.Graphite.Interval)
 
 		graphite.Register(fmt.Sprintf("%s.alloc", pattern), &mstats.Alloc)
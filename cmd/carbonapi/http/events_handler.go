@@ -0,0 +1,205 @@
+package http
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-graphite/carbonapi/carbonapipb"
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/date"
+	"github.com/go-graphite/carbonapi/events"
+	utilctx "github.com/go-graphite/carbonapi/util/ctx"
+	"github.com/lomik/zapwriter"
+)
+
+// eventRequest is a body of the POST request that creates an event. Tags could be either a list or a space separated
+// string, as graphite-web accepts both.
+type eventRequest struct {
+	What string          `json:"what"`
+	Data string          `json:"data"`
+	When *float64        `json:"when"`
+	Tags json.RawMessage `json:"tags"`
+}
+
+func (r *eventRequest) tags() ([]string, error) {
+	if len(r.Tags) == 0 {
+		return nil, nil
+	}
+
+	var tags []string
+	if err := json.Unmarshal(r.Tags, &tags); err == nil {
+		return tags, nil
+	}
+
+	var s string
+	if err := json.Unmarshal(r.Tags, &s); err != nil {
+		return nil, err
+	}
+	return strings.Fields(s), nil
+}
+
+// eventsHandler implements graphite-web compatible events API:
+//
+//	GET    /events/get_data?from=...&until=...&tags=...&set=union|intersection - find events
+//	GET    /events/ - same as get_data
+//	POST   /events/ - create new event
+//	GET    /events/<id>/ - get event
+//	DELETE /events/<id>/ - delete event
+func eventsHandler(w http.ResponseWriter, r *http.Request) {
+	t0 := time.Now()
+	username, _, _ := r.BasicAuth()
+
+	srcIP, srcPort := splitRemoteAddr(r.RemoteAddr)
+
+	accessLogger := zapwriter.Logger("access")
+	var accessLogDetails = &carbonapipb.AccessLogDetails{
+		Handler:        "events",
+		Username:       username,
+		URL:            r.URL.RequestURI(),
+		PeerIP:         srcIP,
+		PeerPort:       srcPort,
+		Host:           r.Host,
+		Referer:        r.Referer(),
+		URI:            r.RequestURI,
+		RequestHeaders: utilctx.GetLogHeaders(r.Context()),
+	}
+
+	logAsError := false
+	defer func() {
+		deferredAccessLogging(accessLogger, accessLogDetails, t0, logAsError)
+	}()
+
+	ApiMetrics.Requests.Add(1)
+
+	store := events.GetStore()
+	if store == nil {
+		setError(w, accessLogDetails, events.ErrNotConfigured.Error(), http.StatusNotFound)
+		logAsError = true
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		setError(w, accessLogDetails, err.Error(), http.StatusBadRequest)
+		logAsError = true
+		return
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, config.Config.Prefix+"/events"), "/")
+
+	var (
+		res    interface{}
+		status int
+		msg    string
+	)
+	switch {
+	case path == "" && r.Method == http.MethodPost:
+		res, status, msg = createEvent(r, store)
+	case (path == "" || path == "get_data") && r.Method == http.MethodGet:
+		res, status, msg = findEvents(r, store)
+	default:
+		id, err := strconv.ParseInt(path, 10, 64)
+		if err != nil {
+			setError(w, accessLogDetails, "unknown path: "+path, http.StatusNotFound)
+			logAsError = true
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			res, err = store.Get(id)
+		case http.MethodDelete:
+			err = store.Delete(id)
+			res = map[string]int64{"id": id}
+		default:
+			setError(w, accessLogDetails, "method not allowed: "+r.Method, http.StatusMethodNotAllowed)
+			logAsError = true
+			return
+		}
+		status, msg = eventsErrorStatus(err)
+	}
+
+	if status != http.StatusOK {
+		setError(w, accessLogDetails, msg, status)
+		logAsError = true
+		return
+	}
+
+	var b []byte
+	if r.FormValue("pretty") == "1" {
+		b, err = json.MarshalIndent(res, "", "\t")
+	} else {
+		b, err = json.Marshal(res)
+	}
+	if err != nil {
+		setError(w, accessLogDetails, err.Error(), http.StatusInternalServerError)
+		logAsError = true
+		return
+	}
+
+	writeResponse(w, http.StatusOK, b, jsonFormat, r.FormValue("jsonp"))
+}
+
+func eventsErrorStatus(err error) (int, string) {
+	switch err {
+	case nil:
+		return http.StatusOK, ""
+	case events.ErrNotFound:
+		return http.StatusNotFound, err.Error()
+	default:
+		return http.StatusInternalServerError, err.Error()
+	}
+}
+
+func createEvent(r *http.Request, store events.Store) (interface{}, int, string) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, http.StatusBadRequest, "failed to read request body: " + err.Error()
+	}
+
+	var req eventRequest
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		return nil, http.StatusBadRequest, "failed to parse event: " + err.Error()
+	}
+
+	if req.What == "" {
+		return nil, http.StatusBadRequest, "missing field `what`"
+	}
+
+	tags, err := req.tags()
+	if err != nil {
+		return nil, http.StatusBadRequest, "tags must be a list or a space separated string"
+	}
+
+	when := timeNow().Unix()
+	if req.When != nil {
+		when = int64(*req.When)
+	}
+
+	e, err := store.Add(events.Event{
+		When: when,
+		What: req.What,
+		Data: req.Data,
+		Tags: tags,
+	})
+	status, msg := eventsErrorStatus(err)
+	return e, status, msg
+}
+
+func findEvents(r *http.Request, store events.Store) (interface{}, int, string) {
+	qtz := r.FormValue("tz")
+	q := events.Query{
+		From:         date.DateParamToEpoch(r.FormValue("from"), qtz, 0, config.Config.DefaultTimeZone),
+		Until:        date.DateParamToEpoch(r.FormValue("until"), qtz, timeNow().Unix(), config.Config.DefaultTimeZone),
+		Tags:         strings.Fields(r.FormValue("tags")),
+		SetOperation: r.FormValue("set"),
+	}
+
+	res, err := store.Find(q)
+	status, msg := eventsErrorStatus(err)
+	return res, status, msg
+}
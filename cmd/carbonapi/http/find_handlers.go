@@ -14,6 +14,7 @@ import (
 	"github.com/go-graphite/carbonapi/carbonapipb"
 	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
 	"github.com/go-graphite/carbonapi/date"
+	"github.com/go-graphite/carbonapi/expr/types"
 	"github.com/go-graphite/carbonapi/intervalset"
 	utilctx "github.com/go-graphite/carbonapi/util/ctx"
 	pbv2 "github.com/go-graphite/protocol/carbonapi_v2_pb"
@@ -22,6 +23,7 @@ import (
 	"github.com/lomik/zapwriter"
 	"github.com/maruel/natural"
 	uuid "github.com/satori/go.uuid"
+	"github.com/tinylib/msgp/msgp"
 )
 
 // Find handler and it's helper functions
@@ -171,6 +173,42 @@ func findList(multiGlobs *pbv3.MultiGlobResponse) ([]byte, error) {
 	return b.Bytes(), nil
 }
 
+// findMsgpack marshals matches the same way graphite-web 1.1 does, only leaves have intervals
+func findMsgpack(multiGlobs *pbv3.MultiGlobResponse) ([]byte, error) {
+	var matches []pbv3.GlobMatch
+	for _, globs := range multiGlobs.Metrics {
+		for _, m := range globs.Matches {
+			if strings.HasPrefix(m.Path, "_tag") {
+				continue
+			}
+			matches = append(matches, m)
+		}
+	}
+
+	// Tell graphite-web that we have everything
+	now := time.Now().Unix() + 60
+	b := msgp.AppendArrayHeader(nil, uint32(len(matches)))
+	for _, m := range matches {
+		if m.IsLeaf {
+			b = msgp.AppendMapHeader(b, 3)
+		} else {
+			b = msgp.AppendMapHeader(b, 2)
+		}
+		b = msgp.AppendString(b, "path")
+		b = msgp.AppendString(b, m.Path)
+		b = msgp.AppendString(b, "is_leaf")
+		b = msgp.AppendBool(b, m.IsLeaf)
+		if m.IsLeaf {
+			b = msgp.AppendString(b, "intervals")
+			b = msgp.AppendArrayHeader(b, 1)
+			b = msgp.AppendArrayHeader(b, 2)
+			b = types.AppendMsgpackInt(b, 0)
+			b = types.AppendMsgpackInt(b, now)
+		}
+	}
+	return b, nil
+}
+
 func findHandler(w http.ResponseWriter, r *http.Request) {
 	t0 := time.Now()
 	uid := uuid.NewV4()
@@ -324,6 +362,9 @@ func findHandler(w http.ResponseWriter, r *http.Request) {
 	case protoV3Format:
 		b, err2 = multiGlobs.Marshal()
 		err = merry.Wrap(err2)
+	case msgpackFormat:
+		b, err2 = findMsgpack(multiGlobs)
+		err = merry.Wrap(err2)
 	case pickleFormat:
 		var result []map[string]interface{}
 		now := int32(time.Now().Unix() + 60)
@@ -0,0 +1,276 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-graphite/carbonapi/carbonapipb"
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/date"
+	utilctx "github.com/go-graphite/carbonapi/util/ctx"
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"github.com/lomik/zapwriter"
+	uuid "github.com/satori/go.uuid"
+	"go.uber.org/zap"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// InitGRPCServer creates gRPC server with render API. Headers are taken from the request metadata.
+func InitGRPCServer(headersToPass, headersToLog []string) *grpc.Server {
+	s := grpc.NewServer()
+	carbonapipb.RegisterCarbonAPIServer(s, &grpcServer{
+		headersToPass: headersToPass,
+		headersToLog:  headersToLog,
+	})
+
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	healthServer.SetServingStatus("carbonapipb.CarbonAPI", healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(s, healthServer)
+
+	return s
+}
+
+type grpcServer struct {
+	headersToPass []string
+	headersToLog  []string
+}
+
+// enrichContext does the same as enrichContextWithHeaders, but headers are taken from gRPC metadata
+func (s *grpcServer) enrichContext(ctx context.Context) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	headers := func(names []string) map[string]string {
+		m := make(map[string]string)
+		for _, name := range names {
+			if v := md.Get(name); len(v) > 0 && v[0] != "" {
+				m[name] = v[0]
+			}
+		}
+		return m
+	}
+
+	ctx = utilctx.SetPassHeaders(ctx, headers(s.headersToPass))
+	return utilctx.SetLogHeaders(ctx, headers(s.headersToLog))
+}
+
+// grpcCode converts http status code of the render response to gRPC one
+func grpcCode(httpCode int) codes.Code {
+	switch httpCode {
+	case http.StatusOK:
+		return codes.OK
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	}
+	if httpCode >= 500 {
+		return codes.Internal
+	}
+	return codes.Unknown
+}
+
+func setGRPCError(accessLogDetails *carbonapipb.AccessLogDetails, msg string, httpCode int) error {
+	accessLogDetails.Reason = msg
+	accessLogDetails.HTTPCode = int32(httpCode)
+	return status.Error(grpcCode(httpCode), msg)
+}
+
+// grpcResponseCacheKey is built from the same parameters as key of the HTTP request would be. Prefix makes sure that
+// it never matches the key of HTTP request, as targets of carbonapi_v3_pb requests are not a part of it.
+func grpcResponseCacheKey(in *carbonapipb.RenderRequest) string {
+	v := url.Values{
+		"target": in.Targets,
+		"from":   []string{in.From},
+		"until":  []string{in.Until},
+		"format": []string{protoV3Format.String()},
+	}
+	if in.Tz != "" {
+		v.Set("tz", in.Tz)
+	}
+	if in.MaxDataPoints != 0 {
+		v.Set("maxDataPoints", strconv.FormatInt(in.MaxDataPoints, 10))
+	}
+	return "grpc:" + v.Encode()
+}
+
+// Render evaluates targets the same way /render does with format=carbonapi_v3_pb, including response cache and
+// coalescing of identical requests
+func (s *grpcServer) Render(ctx context.Context, in *carbonapipb.RenderRequest) (response *pb.MultiFetchResponse, err error) {
+	t0 := time.Now()
+	uid := uuid.NewV4()
+
+	ctx = utilctx.SetUUID(s.enrichContext(ctx), uid.String())
+	requestHeaders := utilctx.GetLogHeaders(ctx)
+
+	logger := zapwriter.Logger("render_grpc").With(
+		zap.String("carbonapi_uuid", uid.String()),
+		zap.Any("request_headers", requestHeaders),
+	)
+
+	var srcIP, srcPort string
+	if p, ok := peer.FromContext(ctx); ok {
+		srcIP, srcPort = splitRemoteAddr(p.Addr.String())
+	}
+
+	accessLogger := zapwriter.Logger("access")
+	var accessLogDetails = &carbonapipb.AccessLogDetails{
+		Handler:        "render_grpc",
+		CarbonapiUUID:  uid.String(),
+		PeerIP:         srcIP,
+		PeerPort:       srcPort,
+		Format:         protoV3Format.String(),
+		RequestHeaders: requestHeaders,
+	}
+
+	logAsError := false
+	defer func() {
+		deferredAccessLogging(accessLogger, accessLogDetails, t0, logAsError)
+	}()
+
+	ApiMetrics.Requests.Add(1)
+
+	ctx = utilctx.SetMaxDatapoints(ctx, in.MaxDataPoints)
+	useCache := !in.NoCache
+	responseCacheTimeout := config.Config.ResponseCacheConfig.DefaultTimeoutSec
+	backendCacheTimeout := config.Config.BackendCacheConfig.DefaultTimeoutSec
+	responseCacheKey := grpcResponseCacheKey(in)
+
+	from32 := date.DateParamToEpoch(in.From, in.Tz, timeNow().Add(-24*time.Hour).Unix(), config.Config.DefaultTimeZone)
+	until32 := date.DateParamToEpoch(in.Until, in.Tz, timeNow().Unix(), config.Config.DefaultTimeZone)
+	ctx = utilctx.SetTimeZone(ctx, date.Location(in.Tz, config.Config.DefaultTimeZone))
+
+	accessLogDetails.UseCache = useCache
+	accessLogDetails.FromRaw = in.From
+	accessLogDetails.From = from32
+	accessLogDetails.UntilRaw = in.Until
+	accessLogDetails.Until = until32
+	accessLogDetails.Tz = in.Tz
+	accessLogDetails.CacheTimeout = responseCacheTimeout
+	accessLogDetails.Targets = in.Targets
+	accessLogDetails.MaxDataPoints = in.MaxDataPoints
+
+	if len(in.Targets) == 0 {
+		logAsError = true
+		return nil, setGRPCError(accessLogDetails, "no targets specified", http.StatusBadRequest)
+	}
+
+	render := func(ctx context.Context, r *http.Request) renderResponse {
+		return renderTargets(ctx, logger, r, renderRequest{
+			targets:              in.Targets,
+			from:                 in.From,
+			until:                in.Until,
+			from32:               from32,
+			until32:              until32,
+			format:               protoV3Format,
+			maxDataPoints:        in.MaxDataPoints,
+			timestampMultiplier:  1,
+			useCache:             useCache,
+			responseCacheKey:     responseCacheKey,
+			responseCacheTimeout: responseCacheTimeout,
+			backendCacheTimeout:  backendCacheTimeout,
+		})
+	}
+
+	if useCache {
+		tc := time.Now()
+		body, stale, err := responseCacheGet(responseCacheKey)
+		td := time.Since(tc).Nanoseconds()
+		ApiMetrics.RenderCacheOverheadNS.Add(td)
+
+		if err == nil && stale <= int64(config.Config.ResponseCacheConfig.StaleTimeoutSec) {
+			response = &pb.MultiFetchResponse{}
+			if err = response.Unmarshal(body); err == nil {
+				ApiMetrics.RequestCacheHits.Add(1)
+				accessLogDetails.FromCache = true
+				accessLogDetails.CarbonapiResponseSizeBytes = int64(len(body))
+				if stale > 0 {
+					ApiMetrics.RequestCacheStaleHits.Add(1)
+					accessLogDetails.Stale = true
+					refreshInBackground(ctx, logger, nil, responseCacheKey, render)
+				}
+				return response, nil
+			}
+			logger.Error("failed to unmarshal cached response",
+				zap.String("cache_key", responseCacheKey),
+				zap.Error(err),
+			)
+		}
+		ApiMetrics.RequestCacheMisses.Add(1)
+	}
+
+	if from32 == until32 {
+		logAsError = true
+		return nil, setGRPCError(accessLogDetails, "Invalid or empty time range", http.StatusBadRequest)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("panic during eval:",
+				zap.String("cache_key", responseCacheKey),
+				zap.Any("reason", r),
+				zap.Stack("stack"),
+			)
+			logAsError = true
+			response, err = nil, setGRPCError(accessLogDetails, "panic during eval", http.StatusInternalServerError)
+		}
+	}()
+
+	var result renderResponse
+	if useCache {
+		var coalesced bool
+		result, coalesced = coalescedRender(ctx, logger, nil, responseCacheKey, render)
+		if coalesced {
+			ApiMetrics.RenderCoalescedRequests.Add(1)
+			accessLogDetails.Coalesced = true
+		}
+	} else {
+		result = render(ctx, nil)
+	}
+
+	accessLogDetails.UsedBackendCache = result.usedBackendCache
+	if result.errMsg != "" {
+		logAsError = true
+		return nil, setGRPCError(accessLogDetails, result.errMsg, result.returnCode)
+	}
+	// notFoundStatusCode is for HTTP clients only, gRPC clients always get NotFound
+	if result.notFound {
+		logAsError = true
+		return nil, setGRPCError(accessLogDetails, "no data in response", http.StatusNotFound)
+	}
+	if result.returnCode != http.StatusOK {
+		logAsError = true
+		return nil, setGRPCError(accessLogDetails, http.StatusText(result.returnCode), result.returnCode)
+	}
+
+	response = &pb.MultiFetchResponse{}
+	if err = response.Unmarshal(result.body); err != nil {
+		logAsError = true
+		return nil, setGRPCError(accessLogDetails, err.Error(), http.StatusInternalServerError)
+	}
+
+	accessLogDetails.Metrics = in.Targets
+	accessLogDetails.CarbonzipperResponseSizeBytes = int64(result.size)
+	accessLogDetails.CarbonapiResponseSizeBytes = int64(len(result.body))
+	accessLogDetails.HaveNonFatalErrors = result.haveNonFatalErrors
+
+	return response, nil
+}
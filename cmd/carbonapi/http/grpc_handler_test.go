@@ -0,0 +1,145 @@
+package http
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/go-graphite/carbonapi/carbonapipb"
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/expr/types"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"github.com/stretchr/testify/assert"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func startGRPCServer(t *testing.T) (carbonapipb.CarbonAPIClient, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	srv := InitGRPCServer(nil, nil)
+	go func() {
+		_ = srv.Serve(listener)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cc, err := grpc.DialContext(ctx, listener.Addr().String(), grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		srv.Stop()
+		t.Fatalf("failed to connect: %v", err)
+	}
+
+	return carbonapipb.NewCarbonAPIClient(cc), func() {
+		_ = cc.Close()
+		srv.Stop()
+	}
+}
+
+func TestGRPCRender(t *testing.T) {
+	client, stop := startGRPCServer(t)
+	defer stop()
+
+	hits := ApiMetrics.RequestCacheHits.Value()
+	for i := 0; i < 2; i++ {
+		response, err := client.Render(context.Background(), &carbonapipb.RenderRequest{
+			Targets: []string{"fallbackSeries(foo.bar,foo.baz)"},
+			From:    "-10minutes",
+		})
+		if !assert.NoError(t, err) {
+			return
+		}
+		if !assert.Len(t, response.Metrics, 1) {
+			return
+		}
+
+		m := response.Metrics[0]
+		assert.Equal(t, "foo.bar", m.Name)
+		assert.Equal(t, int64(1510913280), m.StartTime)
+		assert.Equal(t, int64(60), m.StepTime)
+		if assert.Len(t, m.Values, 3) {
+			assert.True(t, math.IsNaN(m.Values[0]))
+			assert.Equal(t, []float64{1510913759, 1510913818}, m.Values[1:])
+		}
+	}
+	assert.Equal(t, hits+1, ApiMetrics.RequestCacheHits.Value(), "second response should be served from cache")
+}
+
+func TestGRPCRenderErrors(t *testing.T) {
+	client, stop := startGRPCServer(t)
+	defer stop()
+
+	tests := []struct {
+		name    string
+		request *carbonapipb.RenderRequest
+	}{
+		{"no targets", &carbonapipb.RenderRequest{From: "-10minutes"}},
+		{"parse error", &carbonapipb.RenderRequest{Targets: []string{"sum(foo.bar"}, From: "-10minutes"}},
+		{"empty time range", &carbonapipb.RenderRequest{Targets: []string{"foo.bar"}, From: "-10minutes", Until: "-10minutes"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.Render(context.Background(), tt.request)
+			assert.Equal(t, codes.InvalidArgument, status.Code(err), "unexpected error %v", err)
+		})
+	}
+}
+
+type failingCarbonZipper struct {
+	mockCarbonZipper
+	err merry.Error
+}
+
+func (z failingCarbonZipper) Render(ctx context.Context, request pb.MultiFetchRequest) ([]*types.MetricData, *zipperTypes.Stats, merry.Error) {
+	return nil, nil, z.err
+}
+
+func TestGRPCRenderNoResults(t *testing.T) {
+	client, stop := startGRPCServer(t)
+	defer stop()
+
+	savedZipper := config.Config.ZipperInstance
+	savedNotFoundStatusCode := config.Config.NotFoundStatusCode
+	defer func() {
+		config.Config.ZipperInstance = savedZipper
+		config.Config.NotFoundStatusCode = savedNotFoundStatusCode
+	}()
+
+	tests := []struct {
+		name               string
+		err                merry.Error
+		notFoundStatusCode int
+		code               codes.Code
+	}{
+		{"not found", merry.New("not found").WithHTTPCode(http.StatusNotFound), http.StatusNotFound, codes.NotFound},
+		// notFoundStatusCode is for HTTP clients only
+		{"not found with status code override", merry.New("not found").WithHTTPCode(http.StatusNotFound), http.StatusOK, codes.NotFound},
+		{"bad request", merry.New("bad request").WithHTTPCode(http.StatusBadRequest), http.StatusNotFound, codes.InvalidArgument},
+		{"forbidden", merry.New("forbidden").WithHTTPCode(http.StatusForbidden), http.StatusNotFound, codes.PermissionDenied},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Config.ZipperInstance = failingCarbonZipper{err: tt.err}
+			config.Config.NotFoundStatusCode = tt.notFoundStatusCode
+
+			// unique target makes sure response isn't cached by previous runs
+			_, err := client.Render(context.Background(), &carbonapipb.RenderRequest{
+				Targets: []string{"foo.bar.no_results" + strconv.Itoa(i)},
+				From:    "-10minutes",
+			})
+			assert.Equal(t, tt.code, status.Code(err), "unexpected error %v", err)
+		})
+	}
+}
@@ -9,6 +9,8 @@ import (
 
 	"github.com/go-graphite/carbonapi/carbonapipb"
 	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/expr/functions/cairo/png"
+	"github.com/go-graphite/carbonapi/expr/types"
 	"github.com/go-graphite/carbonapi/pkg/parser"
 	"github.com/lomik/zapwriter"
 	"go.uber.org/zap"
@@ -30,6 +32,9 @@ const (
 	protoV3Format
 	pickleFormat
 	completerFormat
+	pdfFormat
+	msgpackFormat
+	arrowFormat
 )
 
 func (r responseFormat) String() string {
@@ -54,6 +59,12 @@ func (r responseFormat) String() string {
 		return "svg"
 	case completerFormat:
 		return "completer"
+	case pdfFormat:
+		return "pdf"
+	case msgpackFormat:
+		return "msgpack"
+	case arrowFormat:
+		return "arrow"
 	default:
 		return "unknown"
 	}
@@ -77,6 +88,8 @@ func (r responseFormat) ValidFindFormat() bool {
 		return true
 	case treejsonFormat:
 		return true
+	case msgpackFormat:
+		return true
 	default:
 		return false
 	}
@@ -96,10 +109,16 @@ func (r responseFormat) ValidRenderFormat() bool {
 		return true
 	case svgFormat:
 		return true
+	case pdfFormat:
+		return png.HavePDFSupport
 	case csvFormat:
 		return true
 	case rawFormat:
 		return true
+	case msgpackFormat:
+		return true
+	case arrowFormat:
+		return true
 	default:
 		return false
 	}
@@ -117,7 +136,10 @@ var knownFormats = map[string]responseFormat{
 	"csv":             csvFormat,
 	"raw":             rawFormat,
 	"svg":             svgFormat,
+	"pdf":             pdfFormat,
 	"completer":       completerFormat,
+	"msgpack":         msgpackFormat,
+	"arrow":           arrowFormat,
 }
 
 const (
@@ -129,6 +151,9 @@ const (
 	contentTypePNG        = "image/png"
 	contentTypeCSV        = "text/csv"
 	contentTypeSVG        = "image/svg+xml"
+	contentTypePDF        = "application/pdf"
+	contentTypeMsgpack    = "application/x-msgpack"
+	contentTypeArrow      = "application/vnd.apache.arrow.stream"
 )
 
 func getFormat(r *http.Request, defaultFormat responseFormat) (responseFormat, bool, string) {
@@ -185,9 +210,24 @@ func writeResponse(w http.ResponseWriter, returnCode int, b []byte, format respo
 		w.Header().Set("Content-Type", contentTypeSVG)
 		w.WriteHeader(returnCode)
 		_, _ = w.Write(b)
+	case pdfFormat:
+		w.Header().Set("Content-Type", contentTypePDF)
+		w.WriteHeader(returnCode)
+		_, _ = w.Write(b)
+	case msgpackFormat:
+		w.Header().Set("Content-Type", contentTypeMsgpack)
+		w.WriteHeader(returnCode)
+		_, _ = w.Write(b)
 	}
 }
 
+// writeArrowResponse streams results as Arrow IPC stream, it returns number of bytes written
+func writeArrowResponse(w http.ResponseWriter, returnCode int, results []*types.MetricData, timestampMultiplier int64) (int64, error) {
+	w.Header().Set("Content-Type", contentTypeArrow)
+	w.WriteHeader(returnCode)
+	return types.WriteArrow(w, results, timestampMultiplier)
+}
+
 func bucketRequestTimes(req *http.Request, t time.Duration) {
 	logger := zapwriter.Logger("slow")
 
@@ -1,20 +1,33 @@
 package http
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"math"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/ansel1/merry"
 	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/events"
+	"github.com/go-graphite/carbonapi/expr/functions/cairo/png"
 	"github.com/go-graphite/carbonapi/expr/types"
 	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
 	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
 	"github.com/lomik/zapwriter"
 	"github.com/stretchr/testify/assert"
+	"github.com/tinylib/msgp/msgp"
 )
 
 type mockCarbonZipper struct{}
@@ -75,6 +88,8 @@ func getMultiFetchResponse() pb.MultiFetchResponse {
 		StopTime:       1510913880,
 		StepTime:       60,
 		Values:         []float64{math.NaN(), 1510913759, 1510913818},
+		// consolidation is needed for maxDataPoints
+		ConsolidationFunc: "average",
 	}
 
 	result := pb.MultiFetchResponse{Metrics: []pb.FetchResponse{mfr}}
@@ -163,6 +178,86 @@ func TestFindHandler(t *testing.T) {
 	}
 }
 
+func TestMsgpackFormat(t *testing.T) {
+	req, rr := setUpRequest(t, "/render/?target=foo.bar&from=-10minutes&format=msgpack")
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, contentTypeMsgpack, rr.Header().Get("Content-Type"))
+
+	v, _, err := msgp.ReadIntfBytes(rr.Body.Bytes())
+	assert.NoError(t, err)
+	series := v.([]interface{})
+	if assert.Len(t, series, 1) {
+		s := series[0].(map[string]interface{})
+		assert.Equal(t, "foo.bar", s["name"])
+		assert.Equal(t, int64(60), s["step"])
+		assert.Equal(t, []interface{}{nil, 1510913759.0, 1510913818.0}, s["values"])
+	}
+
+	// values are consolidated to maxDataPoints, step is the step of consolidated values. Series covers 10 minutes, so
+	// each point consolidates 5 minutes
+	req, rr = setUpRequest(t, "/render/?target=foo.bar&from=-10minutes&format=msgpack&maxDataPoints=2")
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	v, _, err = msgp.ReadIntfBytes(rr.Body.Bytes())
+	assert.NoError(t, err)
+	series = v.([]interface{})
+	if assert.Len(t, series, 1) {
+		s := series[0].(map[string]interface{})
+		assert.Equal(t, uint64(300), s["step"])
+		assert.Equal(t, int64(1), s["valuesPerPoint"])
+		assert.Equal(t, []interface{}{1510913788.5}, s["values"])
+	}
+
+	req, rr = setUpRequest(t, "/metrics/find/?query=foo.bar&format=msgpack")
+	findHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, contentTypeMsgpack, rr.Header().Get("Content-Type"))
+
+	v, _, err = msgp.ReadIntfBytes(rr.Body.Bytes())
+	assert.NoError(t, err)
+	matches := v.([]interface{})
+	if assert.Len(t, matches, 1) {
+		m := matches[0].(map[string]interface{})
+		assert.Equal(t, "foo.bar", m["path"])
+		assert.Equal(t, true, m["is_leaf"])
+		assert.Len(t, m["intervals"], 1)
+	}
+}
+
+func TestArrowFormat(t *testing.T) {
+	req, rr := setUpRequest(t, "/render/?target=foo.bar&from=-10minutes&format=arrow")
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, contentTypeArrow, rr.Header().Get("Content-Type"))
+
+	// stream starts with the schema message and ends with end-of-stream marker
+	body := rr.Body.Bytes()
+	if assert.True(t, len(body) > 16) {
+		assert.Equal(t, []byte{0xFF, 0xFF, 0xFF, 0xFF}, body[:4])
+		assert.Equal(t, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0, 0, 0, 0}, body[len(body)-8:])
+	}
+	assert.True(t, bytes.Contains(body, []byte("foo.bar")))
+
+	req, rr = setUpRequest(t, "/metrics/find/?query=foo.bar&format=arrow")
+	findHandler(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestPDFFormat(t *testing.T) {
+	req, rr := setUpRequest(t, "/render/?target=foo.bar&from=-10minutes&format=pdf")
+	renderHandler(rr, req)
+	if !png.HavePDFSupport {
+		// only cairo can render PDF
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		return
+	}
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, contentTypePDF, rr.Header().Get("Content-Type"))
+	assert.True(t, bytes.HasPrefix(rr.Body.Bytes(), []byte("%PDF-")))
+}
+
 func TestInfoHandler(t *testing.T) {
 	req, rr := setUpRequest(t, "/info/?target=foo.bar&format=json")
 	infoHandler(rr, req)
@@ -184,3 +279,339 @@ func TestInfoHandler(t *testing.T) {
 		t.Error("Http response should be same.")
 	}
 }
+
+type blockingCarbonZipper struct {
+	mockCarbonZipper
+	renders int64
+	// ctx of the first render, set before started is closed
+	ctx     context.Context
+	started chan struct{}
+	release chan struct{}
+}
+
+func (z *blockingCarbonZipper) Render(ctx context.Context, request pb.MultiFetchRequest) ([]*types.MetricData, *zipperTypes.Stats, merry.Error) {
+	if atomic.AddInt64(&z.renders, 1) == 1 {
+		z.ctx = ctx
+		close(z.started)
+	}
+	select {
+	case <-z.release:
+	case <-ctx.Done():
+		return nil, nil, merry.Wrap(ctx.Err())
+	}
+	return z.mockCarbonZipper.Render(ctx, request)
+}
+
+// hookRenderJoined replaces renderJoined hook, returned channel receives cache key of every request that waits for
+// shared evaluation of the response
+func hookRenderJoined(requests int) (chan string, func()) {
+	joined := make(chan string, requests)
+	renderJoined = func(responseCacheKey string) {
+		select {
+		case joined <- responseCacheKey:
+		default:
+		}
+	}
+	return joined, func() { renderJoined = func(string) {} }
+}
+
+// waitJoined waits until n requests are waiting for shared evaluation
+func waitJoined(joined <-chan string, n int) error {
+	deadline := time.After(5 * time.Second)
+	for i := 0; i < n; i++ {
+		select {
+		case <-joined:
+		case <-deadline:
+			return fmt.Errorf("only %d of %d requests are waiting for evaluation", i, n)
+		}
+	}
+	return nil
+}
+
+func TestRenderHandlerCoalescing(t *testing.T) {
+	const requests = 5
+
+	joined, unhook := hookRenderJoined(requests)
+	defer unhook()
+
+	zipper := &blockingCarbonZipper{
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	savedZipper := config.Config.ZipperInstance
+	config.Config.ZipperInstance = zipper
+	defer func() { config.Config.ZipperInstance = savedZipper }()
+
+	coalesced := ApiMetrics.RenderCoalescedRequests.Value()
+
+	// unique parameter makes sure response isn't cached by previous runs
+	url := "/render/?target=foo.bar&from=-10minutes&format=json&coalescing=" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	var wg sync.WaitGroup
+	responses := make([]*httptest.ResponseRecorder, requests)
+	for i := range responses {
+		req, rr := setUpRequest(t, url)
+		responses[i] = rr
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			renderHandler(rr, req)
+		}()
+	}
+
+	// backend is blocked until every request missed the cache and is waiting for the first one
+	err := waitJoined(joined, requests)
+	close(zipper.release)
+	wg.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `[{"target":"foo.bar","datapoints":[[null,1510913280],[1510913759,1510913340],[1510913818,1510913400]],"tags":{}}]`
+	for _, rr := range responses {
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, expected, rr.Body.String())
+	}
+	assert.Equal(t, int64(1), atomic.LoadInt64(&zipper.renders), "backend should be queried only once")
+	assert.Equal(t, int64(requests-1), ApiMetrics.RenderCoalescedRequests.Value()-coalesced)
+}
+
+func TestRenderHandlerCoalescingLeaderCanceled(t *testing.T) {
+	zipper := &blockingCarbonZipper{
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	savedZipper := config.Config.ZipperInstance
+	config.Config.ZipperInstance = zipper
+	defer func() { config.Config.ZipperInstance = savedZipper }()
+
+	joined, unhook := hookRenderJoined(2)
+	defer unhook()
+
+	url := "/render/?target=foo.bar&from=-10minutes&format=json&canceled=" + strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leaderReq, leaderRR := setUpRequest(t, url)
+	leaderReq = leaderReq.WithContext(ctx)
+	followerReq, followerRR := setUpRequest(t, url)
+
+	var wg sync.WaitGroup
+	// finish unblocks backend and waits for handlers, so failed test doesn't leave them running
+	finish := func() {
+		close(zipper.release)
+		wg.Wait()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		renderHandler(leaderRR, leaderReq)
+	}()
+	if err := waitJoined(joined, 1); err != nil {
+		finish()
+		t.Fatal(err)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		renderHandler(followerRR, followerReq)
+	}()
+	if err := waitJoined(joined, 1); err != nil {
+		finish()
+		t.Fatal(err)
+	}
+
+	// client of the first request goes away, evaluation must continue for the second one
+	cancel()
+	select {
+	case <-zipper.started:
+	case <-time.After(5 * time.Second):
+		finish()
+		t.Fatal("backend wasn't queried")
+	}
+	err := zipper.ctx.Err()
+	finish()
+	assert.NoError(t, err, "backend request must not be canceled with the first request")
+
+	expected := `[{"target":"foo.bar","datapoints":[[null,1510913280],[1510913759,1510913340],[1510913818,1510913400]],"tags":{}}]`
+	assert.Equal(t, http.StatusOK, followerRR.Code)
+	assert.Equal(t, expected, followerRR.Body.String())
+	assert.Equal(t, int64(1), atomic.LoadInt64(&zipper.renders), "backend should be queried only once")
+}
+
+func TestSharedRenderContext(t *testing.T) {
+	type key struct{}
+	parent, cancel := context.WithCancel(context.WithValue(context.Background(), key{}, "value"))
+	ctx, cancelShared := sharedRenderContext(parent)
+	defer cancelShared()
+
+	cancel()
+	assert.NoError(t, ctx.Err(), "shared context must not be canceled with the request")
+	assert.Equal(t, "value", ctx.Value(key{}))
+	deadline, ok := ctx.Deadline()
+	assert.True(t, ok, "shared context must be limited by the render timeout")
+	assert.WithinDuration(t, time.Now().Add(config.Config.Upstreams.Timeouts.Render), deadline, time.Minute)
+}
+
+type countingCarbonZipper struct {
+	mockCarbonZipper
+	renders int64
+}
+
+func (z *countingCarbonZipper) Render(ctx context.Context, request pb.MultiFetchRequest) ([]*types.MetricData, *zipperTypes.Stats, merry.Error) {
+	atomic.AddInt64(&z.renders, 1)
+	return z.mockCarbonZipper.Render(ctx, request)
+}
+
+func TestRenderHandlerStaleWhileRevalidate(t *testing.T) {
+	zipper := &countingCarbonZipper{}
+	savedZipper := config.Config.ZipperInstance
+	config.Config.ZipperInstance = zipper
+	config.Config.ResponseCacheConfig.StaleTimeoutSec = 60
+	now := time.Now()
+	defer func() {
+		config.Config.ZipperInstance = savedZipper
+		config.Config.ResponseCacheConfig.StaleTimeoutSec = 0
+		timeNow = time.Now
+	}()
+
+	url := "/render/?target=foo.bar&from=-10minutes&format=json&cacheTimeout=10&swr=" + strconv.FormatInt(now.UnixNano(), 10)
+	expected := `[{"target":"foo.bar","datapoints":[[null,1510913280],[1510913759,1510913340],[1510913818,1510913400]],"tags":{}}]`
+	staleHits := ApiMetrics.RequestCacheStaleHits.Value()
+
+	tests := []struct {
+		name      string
+		offset    time.Duration
+		maxStale  string
+		renders   int64
+		staleHits int64
+	}{
+		{name: "miss", offset: 0, renders: 1},
+		{name: "fresh", offset: 5 * time.Second, renders: 1},
+		// stale response is returned and refreshed in background
+		{name: "stale", offset: 30 * time.Second, renders: 2, staleHits: 1},
+		// refreshed response is fresh until offset+cacheTimeout
+		{name: "refreshed", offset: 35 * time.Second, renders: 2, staleHits: 1},
+		// response is 5 seconds stale, but client doesn't accept stale responses
+		{name: "maxStale", offset: 45 * time.Second, maxStale: "0", renders: 3, staleHits: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timeNow = func() time.Time { return now.Add(tt.offset) }
+
+			u := url
+			if tt.maxStale != "" {
+				u += "&maxStale=" + tt.maxStale
+			}
+			req, rr := setUpRequest(t, u)
+			renderHandler(rr, req)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, expected, rr.Body.String())
+
+			// wait for background refresh, cleaned up request form is the cache key
+			for i := 0; i < 1000; i++ {
+				if _, stale, err := responseCacheGet(req.Form.Encode()); err == nil && stale == 0 {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+			assert.Equal(t, tt.renders, atomic.LoadInt64(&zipper.renders))
+			assert.Equal(t, tt.staleHits, ApiMetrics.RequestCacheStaleHits.Value()-staleHits)
+		})
+	}
+}
+
+func TestRefreshInBackgroundTimeout(t *testing.T) {
+	savedTimeout := config.Config.Upstreams.Timeouts.Render
+	config.Config.Upstreams.Timeouts.Render = 50 * time.Millisecond
+	defer func() { config.Config.Upstreams.Timeouts.Render = savedTimeout }()
+
+	key := "refresh-timeout-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	done := make(chan error, 1)
+	refreshInBackground(context.Background(), zapwriter.Logger("test"), nil, key, func(ctx context.Context, r *http.Request) renderResponse {
+		// backend hangs until the request is canceled
+		<-ctx.Done()
+		done <- ctx.Err()
+		return renderResponse{}
+	})
+
+	select {
+	case err := <-done:
+		assert.Equal(t, context.DeadlineExceeded, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("background refresh wasn't canceled by the render timeout")
+	}
+
+	// key is released right after the refresh returns, so next evaluations aren't joined to the stuck one
+	var v interface{}
+	for i := 0; i < 1000; i++ {
+		var shared bool
+		v, _, shared = renderGroup.Do(key, func() (interface{}, error) {
+			return renderResponse{returnCode: http.StatusOK}, nil
+		})
+		if !shared {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, http.StatusOK, v.(renderResponse).returnCode)
+}
+
+func TestEventsHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "carbonapi-events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := events.NewFileStore(filepath.Join(dir, "events.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	events.SetStore(store)
+	defer events.SetStore(nil)
+
+	do := func(method, url, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		eventsHandler(rr, req)
+		return rr
+	}
+
+	rr := do("POST", "/events/", `{"what": "deploy", "tags": "deploy api", "data": "v1.2.3", "when": 1510913280}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `{"id":1,"when":1510913280,"what":"deploy","data":"v1.2.3","tags":["deploy","api"]}`, rr.Body.String())
+
+	rr = do("POST", "/events", `{"what": "outage", "tags": ["outage"], "when": 1510913340}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = do("POST", "/events/", `{"tags": ["outage"]}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = do("GET", "/events/get_data?from=1510913000&until=1510914000&tags=api", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `[{"id":1,"when":1510913280,"what":"deploy","data":"v1.2.3","tags":["deploy","api"]}]`, rr.Body.String())
+
+	rr = do("GET", "/events/get_data?from=1510913000&until=1510914000&tags=api+outage&set=union", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var found []events.Event
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &found))
+	assert.Equal(t, 2, len(found))
+
+	rr = do("GET", "/events/2/", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `{"id":2,"when":1510913340,"what":"outage","data":"","tags":["outage"]}`, rr.Body.String())
+
+	rr = do("DELETE", "/events/2/", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = do("GET", "/events/2", "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = do("GET", "/events/unknown", "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
@@ -12,30 +12,48 @@ import (
 )
 
 var ApiMetrics = struct {
-	Requests              *expvar.Int
-	RenderRequests        *expvar.Int
-	RequestCacheHits      *expvar.Int
-	RequestCacheMisses    *expvar.Int
-	BackendCacheHits      *expvar.Int
-	BackendCacheMisses    *expvar.Int
-	RenderCacheOverheadNS *expvar.Int
-	RequestBuckets        expvar.Func
+	Requests                *expvar.Int
+	RenderRequests          *expvar.Int
+	RequestCacheHits        *expvar.Int
+	RequestCacheMisses      *expvar.Int
+	RequestCacheStaleHits   *expvar.Int
+	BackendCacheHits        *expvar.Int
+	BackendCacheMisses      *expvar.Int
+	RenderCacheOverheadNS   *expvar.Int
+	RenderCoalescedRequests *expvar.Int
+	RequestBuckets          expvar.Func
 
 	FindRequests *expvar.Int
 
 	MemcacheTimeouts expvar.Func
+	RedisTimeouts    expvar.Func
 
 	CacheSize  expvar.Func
 	CacheItems expvar.Func
+
+	RequestCacheL1Hits   expvar.Func
+	RequestCacheL1Misses expvar.Func
+	RequestCacheL2Hits   expvar.Func
+	RequestCacheL2Misses expvar.Func
+
+	BackendCacheL1Hits   expvar.Func
+	BackendCacheL1Misses expvar.Func
+	BackendCacheL2Hits   expvar.Func
+	BackendCacheL2Misses expvar.Func
+
+	SeriesCacheHits   expvar.Func
+	SeriesCacheMisses expvar.Func
 }{
 	Requests: expvar.NewInt("requests"),
 	// TODO: request_cache -> render_cache
-	RenderRequests:        expvar.NewInt("render_requests"),
-	RequestCacheHits:      expvar.NewInt("request_cache_hits"),
-	RequestCacheMisses:    expvar.NewInt("request_cache_misses"),
-	BackendCacheHits:      expvar.NewInt("backend_cache_hits"),
-	BackendCacheMisses:    expvar.NewInt("backend_cache_misses"),
-	RenderCacheOverheadNS: expvar.NewInt("render_cache_overhead_ns"),
+	RenderRequests:          expvar.NewInt("render_requests"),
+	RequestCacheHits:        expvar.NewInt("request_cache_hits"),
+	RequestCacheMisses:      expvar.NewInt("request_cache_misses"),
+	RequestCacheStaleHits:   expvar.NewInt("request_cache_stale_hits"),
+	BackendCacheHits:        expvar.NewInt("backend_cache_hits"),
+	BackendCacheMisses:      expvar.NewInt("backend_cache_misses"),
+	RenderCacheOverheadNS:   expvar.NewInt("render_cache_overhead_ns"),
+	RenderCoalescedRequests: expvar.NewInt("render_coalesced_requests"),
 
 	FindRequests: expvar.NewInt("find_requests"),
 }
@@ -61,6 +79,9 @@ var ZipperMetrics = struct {
 	CacheItems  expvar.Func
 	CacheMisses *expvar.Int
 	CacheHits   *expvar.Int
+
+	HedgesSent *expvar.Int
+	HedgesWon  *expvar.Int
 }{
 	FindRequests: expvar.NewInt("zipper_find_requests"),
 	FindTimeouts: expvar.NewInt("zipper_find_timeouts"),
@@ -80,6 +101,9 @@ var ZipperMetrics = struct {
 
 	CacheHits:   expvar.NewInt("zipper_cache_hits"),
 	CacheMisses: expvar.NewInt("zipper_cache_misses"),
+
+	HedgesSent: expvar.NewInt("zipper_hedges_sent"),
+	HedgesWon:  expvar.NewInt("zipper_hedges_won"),
 }
 
 func ZipperStats(stats *zipperTypes.Stats) {
@@ -99,6 +123,8 @@ func ZipperStats(stats *zipperTypes.Stats) {
 	ZipperMetrics.SearchRequests.Add(stats.SearchRequests)
 	ZipperMetrics.CacheMisses.Add(stats.CacheMisses)
 	ZipperMetrics.CacheHits.Add(stats.CacheHits)
+	ZipperMetrics.HedgesSent.Add(stats.HedgesSent)
+	ZipperMetrics.HedgesWon.Add(stats.HedgesWon)
 }
 
 type BucketEntry int
@@ -114,31 +140,75 @@ func RenderTimeBuckets() interface{} {
 }
 
 func SetupMetrics(logger *zap.Logger) {
-	switch config.Config.ResponseCacheConfig.Type {
-	case "memcache":
-		mcache := config.Config.ResponseCache.(*cache.MemcachedCache)
+	responseCache := config.Config.ResponseCache
+	if tcache, ok := responseCache.(*cache.TwoTierCache); ok {
+		ApiMetrics.RequestCacheL1Hits, ApiMetrics.RequestCacheL1Misses, ApiMetrics.RequestCacheL2Hits, ApiMetrics.RequestCacheL2Misses = publishTieredCacheMetrics("request_cache", tcache)
+		// size and timeouts are reported for underlying caches
+		responseCache = tcache.L1()
+		setupCacheMetrics(tcache.L2())
+	}
+	setupCacheMetrics(responseCache)
+
+	if tcache, ok := config.Config.BackendCache.(*cache.TwoTierCache); ok {
+		ApiMetrics.BackendCacheL1Hits, ApiMetrics.BackendCacheL1Misses, ApiMetrics.BackendCacheL2Hits, ApiMetrics.BackendCacheL2Misses = publishTieredCacheMetrics("backend_cache", tcache)
+	}
+
+	if scache := config.Config.SeriesCache; scache != nil {
+		ApiMetrics.SeriesCacheHits = expvar.Func(func() interface{} {
+			return scache.Hits()
+		})
+		expvar.Publish("series_cache_hits", ApiMetrics.SeriesCacheHits)
+
+		ApiMetrics.SeriesCacheMisses = expvar.Func(func() interface{} {
+			return scache.Misses()
+		})
+		expvar.Publish("series_cache_misses", ApiMetrics.SeriesCacheMisses)
+	}
 
+	// +1 to track every over the number of buckets we track
+	TimeBuckets = make([]int64, config.Config.Buckets+1)
+	expvar.Publish("requestBuckets", expvar.Func(RenderTimeBuckets))
+}
+
+func setupCacheMetrics(c cache.BytesCache) {
+	switch c := c.(type) {
+	case *cache.MemcachedCache:
 		ApiMetrics.MemcacheTimeouts = expvar.Func(func() interface{} {
-			return mcache.Timeouts()
+			return c.Timeouts()
 		})
 		expvar.Publish("memcache_timeouts", ApiMetrics.MemcacheTimeouts)
 
-	case "mem":
-		qcache := config.Config.ResponseCache.(*cache.ExpireCache)
+	case *cache.RedisCache:
+		ApiMetrics.RedisTimeouts = expvar.Func(func() interface{} {
+			return c.Timeouts()
+		})
+		expvar.Publish("redis_timeouts", ApiMetrics.RedisTimeouts)
 
+	case *cache.ExpireCache:
 		ApiMetrics.CacheSize = expvar.Func(func() interface{} {
-			return qcache.Size()
+			return c.Size()
 		})
 		expvar.Publish("cache_size", ApiMetrics.CacheSize)
 
 		ApiMetrics.CacheItems = expvar.Func(func() interface{} {
-			return qcache.Items()
+			return c.Items()
 		})
 		expvar.Publish("cache_items", ApiMetrics.CacheItems)
 	default:
 	}
+}
 
-	// +1 to track every over the number of buckets we track
-	TimeBuckets = make([]int64, config.Config.Buckets+1)
-	expvar.Publish("requestBuckets", expvar.Func(RenderTimeBuckets))
+// publishTieredCacheMetrics publishes hit/miss counters for every tier of the cache as <name>_l1_hits, <name>_l1_misses and so on
+func publishTieredCacheMetrics(name string, c *cache.TwoTierCache) (l1Hits, l1Misses, l2Hits, l2Misses expvar.Func) {
+	l1Hits = expvar.Func(func() interface{} { return c.L1Hits() })
+	l1Misses = expvar.Func(func() interface{} { return c.L1Misses() })
+	l2Hits = expvar.Func(func() interface{} { return c.L2Hits() })
+	l2Misses = expvar.Func(func() interface{} { return c.L2Misses() })
+
+	expvar.Publish(name+"_l1_hits", l1Hits)
+	expvar.Publish(name+"_l1_misses", l1Misses)
+	expvar.Publish(name+"_l2_hits", l2Hits)
+	expvar.Publish(name+"_l2_misses", l2Misses)
+
+	return l1Hits, l1Misses, l2Hits, l2Misses
 }
@@ -2,6 +2,7 @@ package http
 
 import (
 	"bytes"
+	"context"
 	"encoding/gob"
 	"errors"
 	"io/ioutil"
@@ -23,6 +24,7 @@ import (
 	"github.com/lomik/zapwriter"
 	uuid "github.com/satori/go.uuid"
 	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
 )
 
 func cleanupParams(r *http.Request) {
@@ -36,6 +38,9 @@ func cleanupParams(r *http.Request) {
 	r.Form.Del("_salt")
 	r.Form.Del("_ts")
 	r.Form.Del("_t") // Used by jquery.graphite.js
+
+	// it only controls how cached response could be used
+	r.Form.Del("maxStale")
 }
 
 func setError(w http.ResponseWriter, accessLogDetails *carbonapipb.AccessLogDetails, msg string, status int) {
@@ -146,6 +151,7 @@ func renderHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	responseCacheTimeout := getCacheTimeout(logger, r, config.Config.ResponseCacheConfig.DefaultTimeoutSec)
+	maxStale := getMaxStale(logger, r, config.Config.ResponseCacheConfig.StaleTimeoutSec)
 	backendCacheTimeout := getCacheTimeout(logger, r, config.Config.BackendCacheConfig.DefaultTimeoutSec)
 
 	cleanupParams(r)
@@ -156,6 +162,7 @@ func renderHandler(w http.ResponseWriter, r *http.Request) {
 	qtz := r.FormValue("tz")
 	from32 := date.DateParamToEpoch(from, qtz, timeNow().Add(-24*time.Hour).Unix(), config.Config.DefaultTimeZone)
 	until32 := date.DateParamToEpoch(until, qtz, timeNow().Unix(), config.Config.DefaultTimeZone)
+	ctx = utilctx.SetTimeZone(ctx, date.Location(qtz, config.Config.DefaultTimeZone))
 
 	accessLogDetails.UseCache = useCache
 	accessLogDetails.FromRaw = from
@@ -200,19 +207,44 @@ func renderHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	if useCache {
+	render := func(ctx context.Context, r *http.Request) renderResponse {
+		return renderTargets(ctx, logger, r, renderRequest{
+			targets:              targets,
+			from:                 from,
+			until:                until,
+			from32:               from32,
+			until32:              until32,
+			template:             template,
+			format:               format,
+			maxDataPoints:        maxDataPoints,
+			timestampMultiplier:  timestampMultiplier,
+			noNullPoints:         noNullPoints,
+			useCache:             useCache,
+			responseCacheKey:     responseCacheKey,
+			responseCacheTimeout: responseCacheTimeout,
+			backendCacheTimeout:  backendCacheTimeout,
+		})
+	}
+
+	// arrow responses are streamed and never stored in the response cache
+	if useCache && format != arrowFormat {
 		tc := time.Now()
-		response, err := config.Config.ResponseCache.Get(responseCacheKey)
+		response, stale, err := responseCacheGet(responseCacheKey)
 		td := time.Since(tc).Nanoseconds()
 		ApiMetrics.RenderCacheOverheadNS.Add(td)
 
 		accessLogDetails.CarbonzipperResponseSizeBytes = 0
 		accessLogDetails.CarbonapiResponseSizeBytes = int64(len(response))
 
-		if err == nil {
+		if err == nil && stale <= int64(maxStale) {
 			ApiMetrics.RequestCacheHits.Add(1)
 			writeResponse(w, http.StatusOK, response, format, jsonp)
 			accessLogDetails.FromCache = true
+			if stale > 0 {
+				ApiMetrics.RequestCacheStaleHits.Add(1)
+				accessLogDetails.Stale = true
+				refreshInBackground(ctx, logger, r, responseCacheKey, render)
+			}
 			return
 		}
 		ApiMetrics.RequestCacheMisses.Add(1)
@@ -234,28 +266,168 @@ func renderHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
+	var response renderResponse
+	// protoV3 requests are not coalesced as their targets are passed in the body and are not part of the cache key
+	if useCache && format != protoV3Format {
+		var coalesced bool
+		response, coalesced = coalescedRender(ctx, logger, r, responseCacheKey, render)
+		if coalesced {
+			ApiMetrics.RenderCoalescedRequests.Add(1)
+			accessLogDetails.Coalesced = true
+		}
+	} else {
+		response = render(ctx, r)
+	}
+
+	accessLogDetails.UsedBackendCache = response.usedBackendCache
+	if response.errMsg != "" {
+		setError(w, accessLogDetails, response.errMsg, response.returnCode)
+		logAsError = true
+		return
+	}
+
+	if format == jsonFormat && maxDataPoints != 0 {
+		accessLogDetails.MaxDataPoints = maxDataPoints
+	}
+	accessLogDetails.Metrics = targets
+	accessLogDetails.CarbonzipperResponseSizeBytes = int64(response.size)
+	accessLogDetails.CarbonapiResponseSizeBytes = int64(len(response.body))
+
+	if format == arrowFormat {
+		n, err := writeArrowResponse(w, response.returnCode, response.results, timestampMultiplier)
+		accessLogDetails.CarbonapiResponseSizeBytes = n
+		if err != nil {
+			logger.Warn("failed to write arrow response", zap.Error(err))
+		}
+	} else {
+		writeResponse(w, response.returnCode, response.body, format, jsonp)
+	}
+
+	accessLogDetails.HaveNonFatalErrors = response.haveNonFatalErrors
+}
+
+// renderGroup coalesces concurrent render requests with the same response cache key
+var renderGroup singleflight.Group
+
+// sharedRenderContext returns context for evaluation which is shared between requests. It isn't canceled when the
+// request which started evaluation is done, but evaluation is limited by the render timeout.
+func sharedRenderContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(detachedContext{parent: ctx}, config.Config.Upstreams.Timeouts.Render)
+}
+
+// for testing, called when request is waiting for the shared evaluation of the response
+var renderJoined = func(responseCacheKey string) {}
+
+// coalescedRender evaluates response once for all concurrent render requests with the same key. coalesced is true if
+// response was evaluated for another request.
+func coalescedRender(ctx context.Context, logger *zap.Logger, r *http.Request, responseCacheKey string, render func(context.Context, *http.Request) renderResponse) (response renderResponse, coalesced bool) {
+	leader := false
+	eval := sharedRender(ctx, logger, r, responseCacheKey, render)
+	ch := renderGroup.DoChan(responseCacheKey, func() (interface{}, error) {
+		leader = true
+		return eval()
+	})
+	renderJoined(responseCacheKey)
+	res := <-ch
+	return res.Val.(renderResponse), res.Shared && !leader
+}
+
+// refreshInBackground re-evaluates outdated cached response. Refresh is shared with all concurrent render requests for
+// the same key, so there is at most one refresh per key in flight.
+func refreshInBackground(ctx context.Context, logger *zap.Logger, r *http.Request, responseCacheKey string, render func(context.Context, *http.Request) renderResponse) {
+	renderGroup.DoChan(responseCacheKey, sharedRender(ctx, logger, r, responseCacheKey, render))
+}
+
+// sharedRender returns evaluation of the response for renderGroup. Evaluation is shared, so it must not be canceled if
+// the client of the first request goes away, but hung backends must not block the key forever. It runs in its own
+// goroutine, so panics are returned as errors.
+func sharedRender(ctx context.Context, logger *zap.Logger, r *http.Request, responseCacheKey string, render func(context.Context, *http.Request) renderResponse) func() (interface{}, error) {
+	return func() (response interface{}, err error) {
+		ctx, cancel := sharedRenderContext(ctx)
+		defer cancel()
+		// request is nil for gRPC render requests
+		if r != nil {
+			r = r.Clone(ctx)
+		}
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Error("panic during eval:",
+					zap.String("cache_key", responseCacheKey),
+					zap.Any("reason", r),
+					zap.Stack("stack"),
+				)
+				response = renderResponse{
+					returnCode: http.StatusInternalServerError,
+					errMsg:     "panic during eval",
+				}
+			}
+		}()
+		return render(ctx, r), nil
+	}
+}
+
+type renderRequest struct {
+	targets  []string
+	from     string
+	until    string
+	from32   int64
+	until32  int64
+	template string
+
+	format              responseFormat
+	maxDataPoints       int64
+	timestampMultiplier int64
+	noNullPoints        bool
+
+	useCache             bool
+	responseCacheKey     string
+	responseCacheTimeout int32
+	backendCacheTimeout  int32
+}
+
+// renderResponse is the result of render request evaluation. It's shared between all coalesced requests, so it must not be modified.
+type renderResponse struct {
+	body       []byte
+	returnCode int
+	// errMsg is set if request failed and should be reported with returnCode
+	errMsg string
+	// notFound is set if no series were found, returnCode of such response is notFoundStatusCode
+	notFound bool
+	// results are set instead of body for formats which are streamed directly from results
+	results []*types.MetricData
+
+	size               int
+	usedBackendCache   bool
+	haveNonFatalErrors bool
+}
+
+// renderTargets fetches and evaluates requested targets, marshals them to requested format and stores result in response cache
+func renderTargets(ctx context.Context, logger *zap.Logger, r *http.Request, req renderRequest) renderResponse {
+	var response renderResponse
+
 	errors := make(map[string]merry.Error)
-	backendCacheKey := backendCacheComputeKey(from, until, targets)
-	results, err := backendCacheFetchResults(logger, useCache, backendCacheKey, accessLogDetails)
+	backendCacheKey := backendCacheComputeKey(req.from, req.until, req.targets)
+	results, err := backendCacheFetchResults(logger, req.useCache, backendCacheKey)
 
-	if err != nil {
+	if err == nil {
+		response.usedBackendCache = true
+	} else {
 		ApiMetrics.BackendCacheMisses.Add(1)
 
 		results = make([]*types.MetricData, 0)
 		values := make(map[parser.MetricRequest][]*types.MetricData)
 
-		for _, target := range targets {
+		for _, target := range req.targets {
 			exp, e, err := parser.ParseExpr(target)
 			if err != nil || e != "" {
-				msg := buildParseErrorString(target, e, err)
-				setError(w, accessLogDetails, msg, http.StatusBadRequest)
-				logAsError = true
-				return
+				response.errMsg = buildParseErrorString(target, e, err)
+				response.returnCode = http.StatusBadRequest
+				return response
 			}
 
 			ApiMetrics.RenderRequests.Add(1)
 
-			result, err := expr.FetchAndEvalExp(ctx, exp, from32, until32, values)
+			result, err := expr.FetchAndEvalExp(ctx, exp, req.from32, req.until32, values)
 			if err != nil {
 				errors[target] = merry.Wrap(err)
 			}
@@ -268,94 +440,97 @@ func renderHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		if len(errors) == 0 {
-			backendCacheStoreResults(logger, backendCacheKey, results, backendCacheTimeout)
+			backendCacheStoreResults(logger, backendCacheKey, results, req.backendCacheTimeout)
 		}
 	}
 
-	size := 0
 	for _, result := range results {
-		size += result.Size()
+		response.size += result.Size()
 	}
 
-	var body []byte
-
-	returnCode := http.StatusOK
+	response.returnCode = http.StatusOK
 	if len(results) == 0 {
 		// Obtain error code from the errors
 		// In case we have only "Not Found" errors, result should be 404
 		// Otherwise it should be 500
-		returnCode = http.StatusNotFound
+		response.returnCode = http.StatusNotFound
 		errMsgs := make([]string, 0)
 		for _, err := range errors {
 			if merry.HTTPCode(err) == 404 || merry.Is(err, parser.ErrSeriesDoesNotExist) {
 				continue
 			}
 			errMsgs = append(errMsgs, err.Error())
-			if returnCode < 500 {
-				returnCode = merry.HTTPCode(err)
+			if response.returnCode < 500 {
+				response.returnCode = merry.HTTPCode(err)
 			}
 		}
 		logger.Debug("error response or no response", zap.Strings("error", errMsgs))
 		// Allow override status code for 404-not-found replies.
-		if returnCode == 404 {
-			returnCode = config.Config.NotFoundStatusCode
+		if response.returnCode == 404 {
+			response.notFound = true
+			response.returnCode = config.Config.NotFoundStatusCode
 		}
-		if returnCode >= 500 {
-			setError(w, accessLogDetails, "error or no response: "+strings.Join(errMsgs, ","), returnCode)
-			logAsError = true
-			return
+		if response.returnCode >= 500 {
+			response.errMsg = "error or no response: " + strings.Join(errMsgs, ",")
+			return response
 		}
 	}
 
-	switch format {
+	switch req.format {
 	case jsonFormat:
-		if maxDataPoints != 0 {
-			types.ConsolidateJSON(maxDataPoints, results)
-			accessLogDetails.MaxDataPoints = maxDataPoints
+		if req.maxDataPoints != 0 {
+			types.ConsolidateJSON(req.maxDataPoints, results)
 		}
 
-		body = types.MarshalJSON(results, timestampMultiplier, noNullPoints)
+		response.body = types.MarshalJSON(results, req.timestampMultiplier, req.noNullPoints)
 	case protoV2Format:
-		body, err = types.MarshalProtobufV2(results)
+		response.body, err = types.MarshalProtobufV2(results)
 		if err != nil {
-			setError(w, accessLogDetails, err.Error(), http.StatusInternalServerError)
-			logAsError = true
-			return
+			response.errMsg = err.Error()
+			response.returnCode = http.StatusInternalServerError
+			return response
 		}
 	case protoV3Format:
-		body, err = types.MarshalProtobufV3(results)
+		response.body, err = types.MarshalProtobufV3(results)
 		if err != nil {
-			setError(w, accessLogDetails, err.Error(), http.StatusInternalServerError)
-			logAsError = true
-			return
+			response.errMsg = err.Error()
+			response.returnCode = http.StatusInternalServerError
+			return response
 		}
 	case rawFormat:
-		body = types.MarshalRaw(results)
+		response.body = types.MarshalRaw(results)
 	case csvFormat:
-		body = types.MarshalCSV(results)
+		response.body = types.MarshalCSV(results)
 	case pickleFormat:
-		body = types.MarshalPickle(results)
+		response.body = types.MarshalPickle(results)
+	case msgpackFormat:
+		if req.maxDataPoints != 0 {
+			types.ConsolidateJSON(req.maxDataPoints, results)
+		}
+		response.body = types.MarshalMsgpack(results)
 	case pngFormat:
-		body = png.MarshalPNGRequest(r, results, template)
+		response.body = png.MarshalPNGRequest(r, results, req.template)
 	case svgFormat:
-		body = png.MarshalSVGRequest(r, results, template)
+		response.body = png.MarshalSVGRequest(r, results, req.template)
+	case pdfFormat:
+		response.body = png.MarshalPDFRequest(r, results, req.template)
+	case arrowFormat:
+		// values are aggregated here, so results are read-only when coalesced requests stream them concurrently
+		for _, result := range results {
+			result.AggregatedValues()
+		}
+		response.results = results
 	}
 
-	accessLogDetails.Metrics = targets
-	accessLogDetails.CarbonzipperResponseSizeBytes = int64(size)
-	accessLogDetails.CarbonapiResponseSizeBytes = int64(len(body))
-
-	writeResponse(w, returnCode, body, format, jsonp)
-
-	if len(results) != 0 {
+	if len(results) != 0 && req.format != arrowFormat {
 		tc := time.Now()
-		config.Config.ResponseCache.Set(responseCacheKey, body, responseCacheTimeout)
+		responseCacheSet(req.responseCacheKey, response.body, req.responseCacheTimeout)
 		td := time.Since(tc).Nanoseconds()
 		ApiMetrics.RenderCacheOverheadNS.Add(td)
 	}
 
-	gotErrors := len(errors) > 0
-	accessLogDetails.HaveNonFatalErrors = gotErrors
+	response.haveNonFatalErrors = len(errors) > 0
+	return response
 }
 
 func backendCacheComputeKey(from, until string, targets []string) string {
@@ -369,7 +544,7 @@ func backendCacheComputeKey(from, until string, targets []string) string {
 	return backendCacheKey.String()
 }
 
-func backendCacheFetchResults(logger *zap.Logger, useCache bool, backendCacheKey string, accessLogDetails *carbonapipb.AccessLogDetails) ([]*types.MetricData, error) {
+func backendCacheFetchResults(logger *zap.Logger, useCache bool, backendCacheKey string) ([]*types.MetricData, error) {
 	if !useCache {
 		return nil, errors.New("useCache is false")
 	}
@@ -390,7 +565,6 @@ func backendCacheFetchResults(logger *zap.Logger, useCache bool, backendCacheKey
 		return nil, err
 	}
 
-	accessLogDetails.UsedBackendCache = true
 	ApiMetrics.BackendCacheHits.Add(1)
 
 	return results, nil
@@ -0,0 +1,96 @@
+package http
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"go.uber.org/zap"
+)
+
+// When stale-while-revalidate is enabled, response cache entries are prefixed with the time (unix timestamp, big endian)
+// until which they are considered fresh, and are kept in cache for staleTimeoutSec more.
+const responseCacheHeaderSize = 8
+
+var errBadCacheEntry = errors.New("malformed response cache entry")
+
+// getMaxStale returns for how long (in seconds) client agrees to get outdated response, limited by staleTimeoutSec from the config
+func getMaxStale(logger *zap.Logger, r *http.Request, staleTimeout int32) int32 {
+	if staleTimeout <= 0 {
+		return 0
+	}
+
+	if str := r.FormValue("maxStale"); str != "" {
+		maxStale, err := strconv.Atoi(str)
+		if err != nil {
+			logger.Error("failed to parse maxStale",
+				zap.String("max_stale_string", str),
+				zap.Error(err),
+			)
+		} else if maxStale < int(staleTimeout) {
+			if maxStale < 0 {
+				return 0
+			}
+			return int32(maxStale)
+		}
+	}
+
+	return staleTimeout
+}
+
+// responseCacheGet returns cached response and for how long (in seconds) it's outdated. Zero means that response is fresh.
+func responseCacheGet(key string) ([]byte, int64, error) {
+	v, err := config.Config.ResponseCache.Get(key)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if config.Config.ResponseCacheConfig.StaleTimeoutSec <= 0 {
+		return v, 0, nil
+	}
+
+	if len(v) < responseCacheHeaderSize {
+		return nil, 0, errBadCacheEntry
+	}
+
+	freshUntil := int64(binary.BigEndian.Uint64(v))
+	stale := timeNow().Unix() - freshUntil
+	if stale < 0 {
+		stale = 0
+	}
+
+	return v[responseCacheHeaderSize:], stale, nil
+}
+
+// responseCacheSet stores response in cache. If stale-while-revalidate is enabled, entry will be kept in cache for staleTimeoutSec after it expires
+func responseCacheSet(key string, body []byte, timeout int32) {
+	staleTimeout := config.Config.ResponseCacheConfig.StaleTimeoutSec
+	if staleTimeout <= 0 {
+		config.Config.ResponseCache.Set(key, body, timeout)
+		return
+	}
+
+	v := make([]byte, responseCacheHeaderSize+len(body))
+	binary.BigEndian.PutUint64(v, uint64(timeNow().Unix()+int64(timeout)))
+	copy(v[responseCacheHeaderSize:], body)
+
+	config.Config.ResponseCache.Set(key, v, timeout+staleTimeout)
+}
+
+// detachedContext keeps values of the parent context, but is never canceled. It's used for evaluations shared between
+// requests and for the background refresh of stale cache entries, that should outlive the request that triggered them.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+func (detachedContext) Done() <-chan struct{} { return nil }
+
+func (detachedContext) Err() error { return nil }
+
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
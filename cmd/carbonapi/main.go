@@ -4,6 +4,7 @@ import (
 	"expvar"
 	"flag"
 	"log"
+	"net"
 	"net/http"
 	"net/http/pprof"
 	_ "net/http/pprof"
@@ -105,5 +106,28 @@ func main() {
 		wg.Done()
 	}()
 
+	if config.Config.GRPCListen != "" {
+		listener, err := net.Listen("tcp", config.Config.GRPCListen)
+		if err != nil {
+			logger.Fatal("failed to listen for gRPC",
+				zap.String("grpc_listen", config.Config.GRPCListen),
+				zap.Error(err),
+			)
+		}
+		srv := carbonapiHttp.InitGRPCServer(config.Config.HeadersToPass, config.Config.HeadersToLog)
+
+		wg.Add(1)
+		go func() {
+			err := srv.Serve(listener)
+			if err != nil {
+				logger.Fatal("gRPC server failed",
+					zap.Error(err),
+				)
+			}
+
+			wg.Done()
+		}()
+	}
+
 	wg.Wait()
 }
@@ -2,31 +2,121 @@ package main
 
 import (
 	"context"
-	"fmt"
 	"net"
+	"net/http"
+	"sort"
 	"time"
 
+	"github.com/ansel1/merry"
+	util "github.com/go-graphite/carbonapi/util/ctx"
+	"github.com/go-graphite/carbonapi/zipper/protocols/v3grpc"
+	"github.com/go-graphite/carbonapi/zipper/types"
 	protov3grpc "github.com/go-graphite/protocol/carbonapi_v3_grpc"
 	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
 	gpb "github.com/golang/protobuf/ptypes/empty"
-
 	"github.com/lomik/zapwriter"
+	"github.com/satori/go.uuid"
 	"go.uber.org/zap"
+
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 )
 
-var errNotImplementedYet = fmt.Errorf("feature not implemented yet")
-var errNoDataInResponse = fmt.Errorf("no data in response")
+var errNoDataInResponse = status.Error(codes.NotFound, "no data in response")
+
+// streamPartSize is approximate size of a single message of streaming fetch
+const streamPartSize = 1024 * 1024
 
 type GRPCServer struct {
 	listener net.Listener
 	server   *grpc.Server
+	health   *health.Server
 }
 
 func (srv *GRPCServer) serve() {
 	_ = srv.server.Serve(srv.listener)
 }
 
+// grpcRequest keeps common state of the request, so gRPC handlers do the same access logging as http handlers
+type grpcRequest struct {
+	t0           time.Time
+	ctx          context.Context
+	logger       *zap.Logger
+	accessLogger *zap.Logger
+}
+
+func newGRPCRequest(ctx context.Context, handler string) *grpcRequest {
+	t0 := time.Now()
+	carbonapiUUID := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(util.HeaderUUIDAPI); len(v) > 0 {
+			carbonapiUUID = v[0]
+		}
+	}
+	uuid := uuid.NewV4()
+	ctx = util.SetUUID(ctx, uuid.String())
+
+	return &grpcRequest{
+		t0:  t0,
+		ctx: ctx,
+		logger: zapwriter.Logger("grpc_"+handler).With(
+			zap.String("handler", handler),
+			zap.String("carbonzipper_uuid", uuid.String()),
+			zap.String("carbonapi_uuid", carbonapiUUID),
+		),
+		accessLogger: zapwriter.Logger("access").With(
+			zap.String("handler", handler),
+			zap.String("format", "grpc"),
+			zap.String("carbonzipper_uuid", uuid.String()),
+			zap.String("carbonapi_uuid", carbonapiUUID),
+		),
+	}
+}
+
+// grpcError converts error of the zipper to gRPC status
+func grpcError(err merry.Error) error {
+	code := codes.Internal
+	switch {
+	case merry.Is(err, types.ErrTimeoutExceeded):
+		code = codes.DeadlineExceeded
+	case merry.Is(err, types.ErrNotSupportedByBackend), merry.Is(err, types.ErrNotImplementedYet):
+		code = codes.Unimplemented
+	case merry.Is(err, types.ErrNotFound), merry.HTTPCode(err) == http.StatusNotFound:
+		code = codes.NotFound
+	}
+	return status.Error(code, err.Error())
+}
+
+// isFatal tells if request failed. Errors of some of the backends are not fatal if others have returned the data.
+func isFatal(err merry.Error, haveData bool) bool {
+	if err == nil || err == types.ErrNonFatalErrors {
+		return false
+	}
+	return !haveData || merry.HTTPCode(err) != http.StatusOK
+}
+
+func (r *grpcRequest) failed(err error, fields ...zap.Field) error {
+	r.accessLogger.Error("request failed", append(fields,
+		zap.String("grpc_code", status.Code(err).String()),
+		zap.String("reason", err.Error()),
+		zap.Duration("runtime_seconds", time.Since(r.t0)),
+	)...)
+	return err
+}
+
+func (r *grpcRequest) served(haveNonFatalErrors bool, fields ...zap.Field) {
+	r.accessLogger.Info("request served", append(fields,
+		zap.Bool("have_non_fatal_errors", haveNonFatalErrors),
+		zap.String("grpc_code", codes.OK.String()),
+		zap.Duration("runtime_seconds", time.Since(r.t0)),
+	)...)
+}
+
 func (srv GRPCServer) GetVersion(ctx context.Context, in *gpb.Empty) (*protov3grpc.ProtocolVersionResponse, error) {
 	return &protov3grpc.ProtocolVersionResponse{
 		Version: 1,
@@ -34,105 +124,183 @@ func (srv GRPCServer) GetVersion(ctx context.Context, in *gpb.Empty) (*protov3gr
 }
 
 func (srv GRPCServer) FetchMetrics(ctx context.Context, in *pb.MultiFetchRequest) (*pb.MultiFetchResponse, error) {
-	t0 := time.Now()
-	memoryUsage := 0
-	logger := zapwriter.Logger("grpc_find").With(
-		zap.String("handler", "find"),
-	)
-	logger.Debug("got find request",
-		zap.String("request", "grpc"),
-	)
-
-	Metrics.FindRequests.Add(1)
+	return fetchMetrics(newGRPCRequest(ctx, "render"), in)
+}
 
-	grpcLogger := zapwriter.Logger("grpc_access").With(
-		zap.String("handler", "render"),
-		zap.String("format", "grpc"),
-	)
+// GRPCStreamServer sends response of fetch request by parts
+type GRPCStreamServer struct{}
 
-	ctx, cancel := context.WithTimeout(ctx, config.Timeouts.Render)
-	defer cancel()
+func (srv GRPCStreamServer) FetchMetrics(in *pb.MultiFetchRequest, stream v3grpc.CarbonV1Stream_FetchMetricsServer) error {
+	response, err := fetchMetrics(newGRPCRequest(stream.Context(), "render_stream"), in)
+	if err != nil {
+		return err
+	}
+	return v3grpc.SendFetchResponse(stream, response, streamPartSize)
+}
 
-	grpcLogger.Debug("got render request",
+func fetchMetrics(r *grpcRequest, in *pb.MultiFetchRequest) (*pb.MultiFetchResponse, error) {
+	r.logger.Debug("got render request",
 		zap.Any("request", in.Metrics),
 	)
 
 	Metrics.RenderRequests.Add(1)
 
+	ctx, cancel := context.WithTimeout(r.ctx, config.Timeouts.Render)
+	defer cancel()
+
+	targets := make([]string, 0, len(in.Metrics))
+	for _, m := range in.Metrics {
+		targets = append(targets, m.PathExpression)
+	}
+
 	response, stats, err := config.zipper.FetchProtoV3(ctx, in)
 	sendStats(stats)
-	if err != nil {
-		grpcLogger.Error("failed to fetch data",
-			zap.Int("memory_usage_bytes", memoryUsage),
-			zap.Error(err),
-			zap.Any("request", in),
-			zap.Duration("runtime_seconds", time.Since(t0)),
-		)
-		return nil, err
+	haveData := response != nil && len(response.Metrics) > 0
+	if isFatal(err, haveData) {
+		return nil, r.failed(grpcError(err), zap.Strings("targets", targets))
 	}
-
-	if len(response.Metrics) == 0 {
-		return nil, errNoDataInResponse
+	if !haveData {
+		return nil, r.failed(errNoDataInResponse, zap.Strings("targets", targets))
 	}
 
-	grpcLogger.Info("request served",
-		zap.Int("memory_usage_bytes", memoryUsage),
-		zap.Duration("runtime_seconds", time.Since(t0)),
-	)
-
+	r.served(err != nil, zap.Strings("targets", targets), zap.Int("memory_usage_bytes", response.Size()))
 	return response, nil
 }
 
 func (srv GRPCServer) FindMetrics(ctx context.Context, in *pb.MultiGlobRequest) (*pb.MultiGlobResponse, error) {
-	t0 := time.Now()
-	logger := zapwriter.Logger("grpc_find").With(
-		zap.String("handler", "find"),
-	)
-	logger.Debug("got find request",
-		zap.String("request", "grpc"),
+	r := newGRPCRequest(ctx, "find")
+	r.logger.Debug("got find request",
+		zap.Strings("query", in.Metrics),
 	)
 
 	Metrics.FindRequests.Add(1)
 
-	grpcLogger := zapwriter.Logger("grpc_access").With(
-		zap.String("handler", "find"),
-		zap.String("format", "grpc"),
-	)
-
-	ctx, cancel := context.WithTimeout(ctx, config.Timeouts.Find)
+	ctx, cancel := context.WithTimeout(r.ctx, config.Timeouts.Find)
 	defer cancel()
 
 	response, stats, err := config.zipper.FindProtoV3(ctx, in)
 	sendStats(stats)
-	if err != nil {
-		grpcLogger.Error("find error",
-			zap.Strings("query", in.Metrics),
-			zap.String("reason", err.Error()),
-			zap.Duration("runtime_seconds", time.Since(t0)),
-		)
-		return nil, err
+	haveData := response != nil && len(response.Metrics) > 0
+	if isFatal(err, haveData) {
+		return nil, r.failed(grpcError(err), zap.Strings("query", in.Metrics))
 	}
-
-	if len(response.Metrics) == 0 {
-		return nil, errNoDataInResponse
+	if !haveData {
+		return nil, r.failed(errNoDataInResponse, zap.Strings("query", in.Metrics))
 	}
-	grpcLogger.Info("request served",
-		zap.Duration("runtime_seconds", time.Since(t0)),
-	)
 
+	r.served(err != nil, zap.Strings("query", in.Metrics))
 	return response, nil
 }
 
 func (srv GRPCServer) MetricsInfo(ctx context.Context, in *pb.MultiMetricsInfoRequest) (*pb.MultiMetricsInfoResponse, error) {
-	return nil, errNotImplementedYet
+	r := newGRPCRequest(ctx, "info")
+	r.logger.Debug("got info request",
+		zap.Strings("targets", in.Names),
+	)
+
+	Metrics.InfoRequests.Add(1)
+
+	ctx, cancel := context.WithTimeout(r.ctx, config.Timeouts.Find)
+	defer cancel()
+
+	result, stats, err := config.zipper.InfoProtoV3(ctx, &pb.MultiGlobRequest{Metrics: in.Names})
+	sendStats(stats)
+	haveData := result != nil && len(result.Info) > 0
+	if isFatal(err, haveData) {
+		return nil, r.failed(grpcError(err), zap.Strings("targets", in.Names))
+	}
+	if !haveData {
+		return nil, r.failed(errNoDataInResponse, zap.Strings("targets", in.Names))
+	}
+
+	// response of each of the groups is a separate entry of the map, gRPC API returns all of them together
+	groups := make([]string, 0, len(result.Info))
+	for group := range result.Info {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+
+	response := &pb.MultiMetricsInfoResponse{}
+	for _, group := range groups {
+		response.Metrics = append(response.Metrics, result.Info[group].Metrics...)
+	}
+
+	r.served(err != nil, zap.Strings("targets", in.Names))
+	return response, nil
 }
 
 func (srv GRPCServer) ListMetrics(ctx context.Context, in *gpb.Empty) (*pb.ListMetricsResponse, error) {
-	return nil, errNotImplementedYet
+	r := newGRPCRequest(ctx, "list")
+	r.logger.Debug("got list request")
+
+	Metrics.ListRequests.Add(1)
+
+	ctx, cancel := context.WithTimeout(r.ctx, config.Timeouts.Find)
+	defer cancel()
+
+	response, stats, err := config.zipper.ListProtoV3(ctx)
+	sendStats(stats)
+	haveData := response != nil && len(response.Metrics) > 0
+	if isFatal(err, haveData) {
+		Metrics.ListErrors.Add(1)
+		return nil, r.failed(grpcError(err))
+	}
+	if !haveData {
+		return nil, r.failed(errNoDataInResponse)
+	}
+
+	r.served(err != nil)
+	return response, nil
 }
 
 func (srv GRPCServer) Stats(ctx context.Context, in *gpb.Empty) (*pb.MetricDetailsResponse, error) {
-	return nil, errNotImplementedYet
+	r := newGRPCRequest(ctx, "stats")
+	r.logger.Debug("got stats request")
+
+	Metrics.StatsRequests.Add(1)
+
+	ctx, cancel := context.WithTimeout(r.ctx, config.Timeouts.Find)
+	defer cancel()
+
+	response, stats, err := config.zipper.StatsProtoV3(ctx)
+	sendStats(stats)
+	haveData := response != nil && len(response.Metrics) > 0
+	if isFatal(err, haveData) {
+		Metrics.StatsErrors.Add(1)
+		return nil, r.failed(grpcError(err))
+	}
+	if !haveData {
+		return nil, r.failed(errNoDataInResponse)
+	}
+
+	r.served(err != nil)
+	return response, nil
+}
+
+func (srv GRPCServer) TagNames(ctx context.Context, in *v3grpc.TagsRequest) (*v3grpc.TagsResponse, error) {
+	return tagQuery(newGRPCRequest(ctx, "tagNames"), in, config.zipper.TagNames)
+}
+
+func (srv GRPCServer) TagValues(ctx context.Context, in *v3grpc.TagsRequest) (*v3grpc.TagsResponse, error) {
+	return tagQuery(newGRPCRequest(ctx, "tagValues"), in, config.zipper.TagValues)
+}
+
+func tagQuery(r *grpcRequest, in *v3grpc.TagsRequest, f func(ctx context.Context, query string, limit int64) ([]string, merry.Error)) (*v3grpc.TagsResponse, error) {
+	r.logger.Debug("got tags request",
+		zap.String("query", in.Query),
+		zap.Int64("limit", in.Limit),
+	)
+
+	ctx, cancel := context.WithTimeout(r.ctx, config.Timeouts.Find)
+	defer cancel()
+
+	values, err := f(ctx, in.Query, in.Limit)
+	if isFatal(err, len(values) > 0) {
+		return nil, r.failed(grpcError(err), zap.String("query", in.Query))
+	}
+
+	r.served(err != nil, zap.String("query", in.Query))
+	return &v3grpc.TagsResponse{Values: values}, nil
 }
 
 func NewGRPCServer(address string) (*GRPCServer, error) {
@@ -144,9 +312,19 @@ func NewGRPCServer(address string) (*GRPCServer, error) {
 	srv := GRPCServer{
 		listener: listener,
 		server:   grpc.NewServer(),
+		health:   health.NewServer(),
 	}
 
 	protov3grpc.RegisterCarbonV1Server(srv.server, srv)
+	v3grpc.RegisterCarbonV1StreamServer(srv.server, GRPCStreamServer{})
+	v3grpc.RegisterCarbonV1TagsServer(srv.server, srv)
+	healthpb.RegisterHealthServer(srv.server, srv.health)
+	reflection.Register(srv.server)
+
+	// empty name is overall status of the server
+	for _, service := range []string{"", "carbonapi_v3_grpc.CarbonV1", "carbonapi_v3_grpc.CarbonV1Stream", "carbonapi_v3_grpc.CarbonV1Tags"} {
+		srv.health.SetServingStatus(service, healthpb.HealthCheckResponse_SERVING)
+	}
 
 	go srv.serve()
 
@@ -118,6 +118,12 @@ var Metrics = struct {
 	InfoRequests *expvar.Int
 	InfoErrors   *expvar.Int
 
+	ListRequests *expvar.Int
+	ListErrors   *expvar.Int
+
+	StatsRequests *expvar.Int
+	StatsErrors   *expvar.Int
+
 	Timeouts *expvar.Int
 
 	CacheSize         expvar.Func
@@ -128,6 +134,9 @@ var Metrics = struct {
 	SearchCacheItems  expvar.Func
 	SearchCacheMisses *expvar.Int
 	SearchCacheHits   *expvar.Int
+
+	HedgesSent *expvar.Int
+	HedgesWon  *expvar.Int
 }{
 	FindRequests: expvar.NewInt("find_requests"),
 	FindErrors:   expvar.NewInt("find_errors"),
@@ -140,12 +149,21 @@ var Metrics = struct {
 	InfoRequests: expvar.NewInt("info_requests"),
 	InfoErrors:   expvar.NewInt("info_errors"),
 
+	ListRequests: expvar.NewInt("list_requests"),
+	ListErrors:   expvar.NewInt("list_errors"),
+
+	StatsRequests: expvar.NewInt("stats_requests"),
+	StatsErrors:   expvar.NewInt("stats_errors"),
+
 	Timeouts: expvar.NewInt("timeouts"),
 
 	CacheHits:         expvar.NewInt("cache_hits"),
 	CacheMisses:       expvar.NewInt("cache_misses"),
 	SearchCacheHits:   expvar.NewInt("search_cache_hits"),
 	SearchCacheMisses: expvar.NewInt("search_cache_misses"),
+
+	HedgesSent: expvar.NewInt("hedges_sent"),
+	HedgesWon:  expvar.NewInt("hedges_won"),
 }
 
 // BuildVersion is defined at build and reported at startup and as expvar
@@ -763,6 +781,12 @@ func main() {
 		graphite.Register(fmt.Sprintf("%s.info_requests", pattern), Metrics.InfoRequests)
 		graphite.Register(fmt.Sprintf("%s.info_errors", pattern), Metrics.InfoErrors)
 
+		graphite.Register(fmt.Sprintf("%s.list_requests", pattern), Metrics.ListRequests)
+		graphite.Register(fmt.Sprintf("%s.list_errors", pattern), Metrics.ListErrors)
+
+		graphite.Register(fmt.Sprintf("%s.stats_requests", pattern), Metrics.StatsRequests)
+		graphite.Register(fmt.Sprintf("%s.stats_errors", pattern), Metrics.StatsErrors)
+
 		graphite.Register(fmt.Sprintf("%s.timeouts", pattern), Metrics.Timeouts)
 
 		for i := 0; i <= config.Buckets; i++ {
@@ -783,6 +807,9 @@ func main() {
 		graphite.Register(fmt.Sprintf("%s.search_cache_hits", pattern), Metrics.SearchCacheHits)
 		graphite.Register(fmt.Sprintf("%s.search_cache_misses", pattern), Metrics.SearchCacheMisses)
 
+		graphite.Register(fmt.Sprintf("%s.hedges_sent", pattern), Metrics.HedgesSent)
+		graphite.Register(fmt.Sprintf("%s.hedges_won", pattern), Metrics.HedgesWon)
+
 		go mstats.Start(config.Graphite.Interval)
 
 		graphite.Register(fmt.Sprintf("%s.alloc", pattern), &mstats.Alloc)
@@ -867,4 +894,6 @@ func sendStats(stats *types.Stats) {
 	Metrics.SearchCacheMisses.Add(stats.SearchCacheMisses)
 	Metrics.CacheMisses.Add(stats.CacheMisses)
 	Metrics.CacheHits.Add(stats.CacheHits)
+	Metrics.HedgesSent.Add(stats.HedgesSent)
+	Metrics.HedgesWon.Add(stats.HedgesWon)
 }
@@ -10,6 +10,8 @@ import (
 	"math"
 	"math/rand"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -35,6 +37,10 @@ func (r responseFormat) String() string {
 		return "pickle"
 	case protoV2Format:
 		return "carbonapi_v2_pb"
+	case protoV3Format:
+		return "carbonapi_v3_pb"
+	case treeJSONFormat:
+		return "treejson"
 	default:
 		return "unknown"
 	}
@@ -45,6 +51,7 @@ const (
 	pickleFormat
 	protoV2Format
 	protoV3Format
+	treeJSONFormat
 )
 
 type Metric struct {
@@ -85,6 +92,9 @@ type Config struct {
 	ShuffleResults bool                `yaml:"shuffleResults"`
 	EmptyBody      bool                `yaml:"emptyBody"`
 	Expressions    map[string]Response `yaml:"expressions"`
+	// VictoriaMetrics mimics Graphite API of VictoriaMetrics: json is returned in graphite-web format and names of
+	// tagged series are passed without tags
+	VictoriaMetrics bool `yaml:"victoriaMetrics"`
 }
 
 func copyResponse(src Response) Response {
@@ -126,6 +136,7 @@ var knownFormats = map[string]responseFormat{
 	"protobuf3":       protoV2Format,
 	"carbonapi_v2_pb": protoV2Format,
 	"carbonapi_v3_pb": protoV3Format,
+	"treejson":        treeJSONFormat,
 }
 
 func getFormat(req *http.Request) (responseFormat, error) {
@@ -309,6 +320,29 @@ func (cfg *listener) findHandler(wr http.ResponseWriter, req *http.Request) {
 		pEnc := pickle.NewEncoder(p)
 		err = merry.Wrap(pEnc.Encode(result))
 		b = p.Bytes()
+	case treeJSONFormat:
+		result := make([]treeJSONNode, 0)
+		for _, globs := range multiGlobs.Metrics {
+			if globs.Name != query[0] {
+				continue
+			}
+			for _, metric := range globs.Matches {
+				parts := strings.Split(metric.Path, ".")
+				node := treeJSONNode{
+					ID:      metric.Path,
+					Text:    parts[len(parts)-1],
+					Context: map[string]string{},
+				}
+				if metric.IsLeaf {
+					node.Leaf = 1
+				} else {
+					node.AllowChildren = 1
+					node.Expandable = 1
+				}
+				result = append(result, node)
+			}
+		}
+		b, err = json.Marshal(result)
 	}
 
 	if err != nil {
@@ -318,7 +352,7 @@ func (cfg *listener) findHandler(wr http.ResponseWriter, req *http.Request) {
 	}
 
 	switch format {
-	case jsonFormat:
+	case jsonFormat, treeJSONFormat:
 		wr.Header().Set("Content-Type", contentTypeJSON)
 	case protoV3Format, protoV2Format:
 		wr.Header().Set("Content-Type", contentTypeProtobuf)
@@ -545,11 +579,20 @@ func (cfg *listener) renderHandler(wr http.ResponseWriter, req *http.Request) {
 		if cfg.EmptyBody {
 			break
 		}
-		logger.Info("request will be served",
-			zap.String("format", "json"),
-			zap.Any("content", multiv2),
-		)
-		d, err = json.Marshal(multiv2)
+		if cfg.VictoriaMetrics {
+			response := graphiteWebResponses(multiv3)
+			logger.Info("request will be served",
+				zap.String("format", "json"),
+				zap.Any("content", response),
+			)
+			d, err = json.Marshal(response)
+		} else {
+			logger.Info("request will be served",
+				zap.String("format", "json"),
+				zap.Any("content", multiv2),
+			)
+			d, err = json.Marshal(multiv2)
+		}
 		if err != nil {
 			wr.WriteHeader(http.StatusBadGateway)
 			_, _ = wr.Write([]byte(err.Error()))
@@ -564,6 +607,122 @@ func (cfg *listener) renderHandler(wr http.ResponseWriter, req *http.Request) {
 	_, _ = wr.Write(d)
 }
 
+// treeJSONNode is a single node of find response in treejson format
+type treeJSONNode struct {
+	ID            string            `json:"id"`
+	Text          string            `json:"text"`
+	AllowChildren int               `json:"allowChildren"`
+	Expandable    int               `json:"expandable"`
+	Leaf          int               `json:"leaf"`
+	Context       map[string]string `json:"context"`
+}
+
+// graphiteWebResponse is a single series of render response in graphite-web json format
+type graphiteWebResponse struct {
+	Target     string            `json:"target"`
+	Tags       map[string]string `json:"tags"`
+	Datapoints [][2]*float64     `json:"datapoints"`
+}
+
+// splitTags splits name of tagged series to the name itself and tags, name is also returned as "name" tag
+func splitTags(metricName string) (string, map[string]string) {
+	parts := strings.Split(metricName, ";")
+	tags := map[string]string{"name": parts[0]}
+	for _, p := range parts[1:] {
+		kv := strings.SplitN(p, "=", 2)
+		if len(kv) == 2 {
+			tags[kv[0]] = kv[1]
+		}
+	}
+	return parts[0], tags
+}
+
+func graphiteWebResponses(multiv3 protov3.MultiFetchResponse) []graphiteWebResponse {
+	response := make([]graphiteWebResponse, 0, len(multiv3.Metrics))
+	for _, metric := range multiv3.Metrics {
+		name, tags := splitTags(metric.Name)
+		r := graphiteWebResponse{
+			Target:     name,
+			Tags:       tags,
+			Datapoints: make([][2]*float64, len(metric.Values)),
+		}
+		for i, v := range metric.Values {
+			ts := float64(metric.StartTime + int64(i)*metric.StepTime)
+			r.Datapoints[i][1] = &ts
+			if !math.IsNaN(v) {
+				v := v
+				r.Datapoints[i][0] = &v
+			}
+		}
+		response = append(response, r)
+	}
+	return response
+}
+
+// tagsHandler answers tag autocomplete requests with tags of all known series
+func (cfg *listener) tagsHandler(wr http.ResponseWriter, req *http.Request) {
+	_ = req.ParseForm()
+	logger := cfg.logger.With(
+		zap.String("function", "tagsHandler"),
+		zap.String("path", req.URL.Path),
+		zap.Any("form", req.Form),
+	)
+	logger.Info("got request")
+
+	if cfg.Code != http.StatusOK {
+		wr.WriteHeader(cfg.Code)
+		return
+	}
+
+	isTagName := strings.HasSuffix(req.URL.Path, "/tags")
+	tag := req.FormValue("tag")
+	prefix := req.FormValue("tagPrefix")
+	if !isTagName {
+		prefix = req.FormValue("valuePrefix")
+	}
+
+	unique := make(map[string]struct{})
+	for _, r := range cfg.Expressions {
+		for _, m := range r.Data {
+			_, tags := splitTags(m.MetricName)
+			for k, v := range tags {
+				if isTagName && strings.HasPrefix(k, prefix) {
+					unique[k] = struct{}{}
+				} else if !isTagName && k == tag && strings.HasPrefix(v, prefix) {
+					unique[v] = struct{}{}
+				}
+			}
+		}
+	}
+
+	result := make([]string, 0, len(unique))
+	for v := range unique {
+		result = append(result, v)
+	}
+	sort.Strings(result)
+
+	if limit, err := strconv.Atoi(req.FormValue("limit")); err == nil && limit > 0 && limit < len(result) {
+		result = result[:limit]
+	}
+
+	logger.Info("will return", zap.Strings("response", result))
+	b, _ := json.Marshal(result)
+	wr.Header().Set("Content-Type", contentTypeJSON)
+	_, _ = wr.Write(b)
+}
+
+// mux returns handlers of the listener
+func (cfg *listener) mux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/render", cfg.renderHandler)
+	mux.HandleFunc("/render/", cfg.renderHandler)
+	mux.HandleFunc("/metrics/find", cfg.findHandler)
+	mux.HandleFunc("/metrics/find/", cfg.findHandler)
+	mux.HandleFunc("/tags/autoComplete/tags", cfg.tagsHandler)
+	mux.HandleFunc("/tags/autoComplete/values", cfg.tagsHandler)
+	return mux
+}
+
 func main() {
 	config := flag.String("config", "average.yaml", "yaml where it would be possible to get data")
 	flag.Parse()
@@ -608,11 +767,7 @@ func main() {
 			zap.Any("config", c),
 		)
 
-		mux := http.NewServeMux()
-		mux.HandleFunc("/render", listener.renderHandler)
-		mux.HandleFunc("/render/", listener.renderHandler)
-		mux.HandleFunc("/metrics/find", listener.findHandler)
-		mux.HandleFunc("/metrics/find/", listener.findHandler)
+		mux := listener.mux()
 
 		wg.Add(1)
 		go func() {
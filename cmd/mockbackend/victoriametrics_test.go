@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/limiter"
+	"github.com/go-graphite/carbonapi/zipper/protocols/victoriametrics"
+	"github.com/go-graphite/carbonapi/zipper/types"
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v2"
+)
+
+// newVictoriaMetricsBackend starts the first listener of victoriametrics.yaml and returns victoriametrics group that
+// uses it
+func newVictoriaMetricsBackend(t *testing.T) (*httptest.Server, types.BackendServer) {
+	d, err := ioutil.ReadFile("victoriametrics.yaml")
+	if err != nil {
+		t.Fatalf("failed to read config: %v", err)
+	}
+	var config MultiListenerConfig
+	if err = yaml.Unmarshal(d, &config); err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+
+	l := listener{
+		Config: config.Listeners[0],
+		logger: zap.NewNop(),
+	}
+	if l.Code == 0 {
+		l.Code = http.StatusOK
+	}
+	srv := httptest.NewServer(l.mux())
+
+	concurrencyLimit := 10
+	keepAlive := time.Second
+	maxIdle := 10
+	maxTries := 1
+	maxBatchSize := 0
+	c, e := victoriametrics.NewWithLimiter(zap.NewNop(), types.BackendV2{
+		GroupName:           "victoriametrics",
+		Protocol:            "victoriametrics",
+		Servers:             []string{srv.URL},
+		ConcurrencyLimit:    &concurrencyLimit,
+		KeepAliveInterval:   &keepAlive,
+		MaxIdleConnsPerHost: &maxIdle,
+		MaxTries:            &maxTries,
+		MaxBatchSize:        &maxBatchSize,
+		Timeouts: &types.Timeouts{
+			Find:    time.Second,
+			Render:  time.Second,
+			Connect: time.Second,
+		},
+	}, false, limiter.NoopLimiter{})
+	if e != nil {
+		srv.Close()
+		t.Fatalf("failed to create group: %v", e)
+	}
+	return srv, c
+}
+
+func TestVictoriaMetricsFetch(t *testing.T) {
+	srv, c := newVictoriaMetricsBackend(t)
+	defer srv.Close()
+
+	nan := math.NaN()
+	tests := []struct {
+		target string
+		names  []string
+		values [][]float64
+	}{
+		{
+			target: "a.b.*",
+			names:  []string{"a.b.c", "a.b.d"},
+			values: [][]float64{{1, 2, nan, 4, 5}, {2, 3, 4, 5, 6}},
+		},
+		{
+			// names of tagged series are built from tags, as VictoriaMetrics returns them without tags
+			target: "seriesByTag('name=cpu.usage')",
+			names:  []string{"cpu.usage;dc=dc1;host=host1", "cpu.usage;dc=dc1;host=host2"},
+			values: [][]float64{{10, 20, 30, 40, 50}, {15, 25, 35, 45, 55}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			res, _, err := c.Fetch(context.Background(), &protov3.MultiFetchRequest{
+				Metrics: []protov3.FetchRequest{{Name: tt.target, PathExpression: tt.target, StartTime: 1, StopTime: 6}},
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(res.Metrics) != len(tt.names) {
+				t.Fatalf("got %v series, want %v", len(res.Metrics), len(tt.names))
+			}
+			for i, m := range res.Metrics {
+				if m.Name != tt.names[i] || m.PathExpression != tt.target || m.StartTime != 1 || m.StopTime != 6 || m.StepTime != 1 {
+					t.Errorf("unexpected series %v: %+v", i, m)
+					continue
+				}
+				if len(m.Values) != len(tt.values[i]) {
+					t.Errorf("series %v: got values %v, want %v", m.Name, m.Values, tt.values[i])
+					continue
+				}
+				for j, v := range tt.values[i] {
+					if m.Values[j] != v && !(math.IsNaN(m.Values[j]) && math.IsNaN(v)) {
+						t.Errorf("series %v: got values %v, want %v", m.Name, m.Values, tt.values[i])
+						break
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestVictoriaMetricsFetchNotFound(t *testing.T) {
+	srv, c := newVictoriaMetricsBackend(t)
+	defer srv.Close()
+
+	res, _, err := c.Fetch(context.Background(), &protov3.MultiFetchRequest{
+		Metrics: []protov3.FetchRequest{{Name: "x.y", PathExpression: "x.y", StartTime: 1, StopTime: 6}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(res.Metrics) != 0 {
+		t.Errorf("got %+v, want no series", res.Metrics)
+	}
+}
+
+func TestVictoriaMetricsFind(t *testing.T) {
+	srv, c := newVictoriaMetricsBackend(t)
+	defer srv.Close()
+
+	res, _, err := c.Find(context.Background(), &protov3.MultiGlobRequest{Metrics: []string{"a.b.*"}, StartTime: 1, StopTime: 6})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(res.Metrics) != 1 {
+		t.Fatalf("got %v responses, want 1", len(res.Metrics))
+	}
+	matches := res.Metrics[0].Matches
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Path < matches[j].Path })
+	want := []protov3.GlobMatch{{Path: "a.b.c", IsLeaf: true}, {Path: "a.b.d", IsLeaf: true}}
+	if res.Metrics[0].Name != "a.b.*" || !reflect.DeepEqual(matches, want) {
+		t.Errorf("got %+v, want %+v", res.Metrics[0], want)
+	}
+}
+
+func TestVictoriaMetricsTags(t *testing.T) {
+	srv, c := newVictoriaMetricsBackend(t)
+	defer srv.Close()
+
+	names, err := c.TagNames(context.Background(), "tagPrefix=", -1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"dc", "host", "name"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got tags %v, want %v", names, want)
+	}
+
+	values, err := c.TagValues(context.Background(), "tag=host&valuePrefix=host", 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"host1"}; !reflect.DeepEqual(values, want) {
+		t.Errorf("got values %v, want %v", values, want)
+	}
+}
@@ -45,6 +45,30 @@ func parseTime(s string) (hour, minute int, err error) {
 
 var TimeFormats = []string{"20060102", "01/02/06"}
 
+// Location returns the time zone named by qtz, or defaultTimeZone if qtz is empty or is not a valid time zone name
+func Location(qtz string, defaultTimeZone *time.Location) *time.Location {
+	if qtz != "" {
+		if z, err := time.LoadLocation(qtz); err == nil {
+			return z
+		}
+	}
+	return defaultTimeZone
+}
+
+// IsDST reports whether t is in daylight saving time in its location, i.e. whether its offset is greater than the
+// standard offset of the year
+func IsDST(t time.Time) bool {
+	yy := t.Year()
+	_, winter := time.Date(yy, time.January, 1, 0, 0, 0, 0, t.Location()).Zone()
+	_, summer := time.Date(yy, time.July, 1, 0, 0, 0, 0, t.Location()).Zone()
+	standard := winter
+	if summer < standard {
+		standard = summer
+	}
+	_, offset := t.Zone()
+	return offset > standard
+}
+
 // DateParamToEpoch turns a passed string parameter into a unix epoch
 func DateParamToEpoch(s string, qtz string, d int64, defaultTimeZone *time.Location) int64 {
 
@@ -63,13 +87,17 @@ func DateParamToEpoch(s string, qtz string, d int64, defaultTimeZone *time.Locat
 		return timeNow().Add(time.Duration(offset) * time.Second).Unix()
 	}
 
+	// all the calendar arithmetic is done in the requested time zone, so DST transitions are handled the same way as
+	// graphite-web does
+	tz := Location(qtz, defaultTimeZone)
+
 	switch s {
 	case "now":
 		return timeNow().Unix()
 	case "midnight", "noon", "teatime":
-		yy, mm, dd := timeNow().Date()
+		yy, mm, dd := timeNow().In(tz).Date()
 		hh, min, _ := parseTime(s) // error ignored, we know it's valid
-		dt := time.Date(yy, mm, dd, hh, min, 0, 0, defaultTimeZone)
+		dt := time.Date(yy, mm, dd, hh, min, 0, 0, tz)
 		return dt.Unix()
 	}
 
@@ -93,23 +121,16 @@ func DateParamToEpoch(s string, qtz string, d int64, defaultTimeZone *time.Locat
 		return d
 	}
 
-	var tz = defaultTimeZone
-	if qtz != "" {
-		if z, err := time.LoadLocation(qtz); err != nil {
-			tz = z
-		}
-	}
-
 	var t time.Time
 dateStringSwitch:
 	switch ds {
 	case "today":
-		t = timeNow()
+		t = timeNow().In(tz)
 		// nothing
 	case "yesterday":
-		t = timeNow().AddDate(0, 0, -1)
+		t = timeNow().In(tz).AddDate(0, 0, -1)
 	case "tomorrow":
-		t = timeNow().AddDate(0, 0, 1)
+		t = timeNow().In(tz).AddDate(0, 0, 1)
 	default:
 		for _, format := range TimeFormats {
 			t, err = time.ParseInLocation(format, ds, tz)
@@ -128,7 +149,7 @@ dateStringSwitch:
 	}
 
 	yy, mm, dd := t.Date()
-	t = time.Date(yy, mm, dd, hour, minute, 0, 0, defaultTimeZone)
+	t = time.Date(yy, mm, dd, hour, minute, 0, 0, tz)
 
 	return t.Unix()
 }
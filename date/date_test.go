@@ -47,3 +47,59 @@ func TestDateParamToEpoch(t *testing.T) {
 		}
 	}
 }
+
+func TestDateParamToEpochDST(t *testing.T) {
+	tz, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone data is not available: %v", err)
+	}
+
+	timeNow = func() time.Time {
+		// 1 Nov 2020 10:00 EST, DST ended at 2:00 this day
+		return time.Date(2020, time.November, 1, 15, 0, 0, 0, time.UTC)
+	}
+
+	var tests = []struct {
+		input  string
+		qtz    string
+		output time.Time
+	}{
+		{"midnight", "America/New_York", time.Date(2020, time.November, 1, 4, 0, 0, 0, time.UTC)},
+		{"noon", "America/New_York", time.Date(2020, time.November, 1, 17, 0, 0, 0, time.UTC)},
+		{"yesterday", "America/New_York", time.Date(2020, time.October, 31, 4, 0, 0, 0, time.UTC)},
+		{"00:00_20200308", "America/New_York", time.Date(2020, time.March, 8, 5, 0, 0, 0, time.UTC)},
+		{"12:00_20200308", "America/New_York", time.Date(2020, time.March, 8, 16, 0, 0, 0, time.UTC)},
+		{"12:00_20200308", "", time.Date(2020, time.March, 8, 16, 0, 0, 0, time.UTC)},
+		{"12:00_20200308", "UTC", time.Date(2020, time.March, 8, 12, 0, 0, 0, time.UTC)},
+		{"12:00_20200308", "Invalid/Zone", time.Date(2020, time.March, 8, 16, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		got := DateParamToEpoch(tt.input, tt.qtz, 0, tz)
+		if want := tt.output.Unix(); got != want {
+			t.Errorf("DateParamToEpoch(%q, %q)=%v, want %v", tt.input, tt.qtz, time.Unix(got, 0).UTC(), tt.output)
+		}
+	}
+}
+
+func TestIsDST(t *testing.T) {
+	tz, err := time.LoadLocation("Australia/Sydney")
+	if err != nil {
+		t.Skipf("time zone data is not available: %v", err)
+	}
+
+	var tests = []struct {
+		t    time.Time
+		want bool
+	}{
+		{time.Date(2020, time.January, 15, 12, 0, 0, 0, tz), true},
+		{time.Date(2020, time.July, 15, 12, 0, 0, 0, tz), false},
+		{time.Date(2020, time.July, 15, 12, 0, 0, 0, time.UTC), false},
+	}
+
+	for _, tt := range tests {
+		if got := IsDST(tt.t); got != tt.want {
+			t.Errorf("IsDST(%v)=%v, want %v", tt.t, got, tt.want)
+		}
+	}
+}
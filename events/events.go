@@ -0,0 +1,119 @@
+package events
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// ErrNotFound is returned when requested event doesn't exist
+var ErrNotFound = errors.New("event not found")
+
+// ErrNotConfigured is returned when events store is not configured
+var ErrNotConfigured = errors.New("events store is not configured")
+
+// Set operations that could be used to match tags of the event
+const (
+	SetUnion        = "union"
+	SetIntersection = "intersection"
+)
+
+// Event is a tagged annotation at specific point of time, e.x. deploy or outage, compatible with graphite-web events
+type Event struct {
+	ID   int64    `json:"id"`
+	When int64    `json:"when"`
+	What string   `json:"what"`
+	Data string   `json:"data"`
+	Tags []string `json:"tags"`
+}
+
+// Query describes which events should be returned by Find
+type Query struct {
+	// From and Until limit time of the events, From is inclusive and Until is exclusive. 0 means no limit.
+	From  int64
+	Until int64
+	// Tags of the events, empty list means any tags
+	Tags []string
+	// SetOperation is either SetUnion (any of the tags) or SetIntersection (all of the tags). Same as graphite-web,
+	// events that have all of the tags are returned by default.
+	SetOperation string
+}
+
+// Match checks if event matches the query
+func (q *Query) Match(e *Event) bool {
+	if q.From != 0 && e.When < q.From {
+		return false
+	}
+	if q.Until != 0 && e.When >= q.Until {
+		return false
+	}
+	if len(q.Tags) == 0 {
+		return true
+	}
+
+	if q.SetOperation == SetUnion {
+		for _, t := range q.Tags {
+			if hasTag(e, t) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, t := range q.Tags {
+		if !hasTag(e, t) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasTag(e *Event, tag string) bool {
+	for _, t := range e.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Store is a storage for events
+type Store interface {
+	// Add stores new event, ID of the event is assigned by the store
+	Add(e Event) (Event, error)
+	// Get returns event by ID or ErrNotFound
+	Get(id int64) (Event, error)
+	// Delete removes event by ID or returns ErrNotFound
+	Delete(id int64) error
+	// Find returns events that match the query, sorted by time
+	Find(q Query) ([]Event, error)
+}
+
+var (
+	storeMu sync.RWMutex
+	store   Store
+)
+
+// SetStore sets store that is used by events API and functions
+func SetStore(s Store) {
+	storeMu.Lock()
+	store = s
+	storeMu.Unlock()
+}
+
+// GetStore returns store that is used by events API and functions or nil if it's not configured
+func GetStore() Store {
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	return store
+}
+
+// sortEvents sorts events by time, events with the same time are sorted by ID
+func sortEvents(events []Event) {
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].When == events[j].When {
+			return events[i].ID < events[j].ID
+		}
+		return events[i].When < events[j].When
+	})
+}
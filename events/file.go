@@ -0,0 +1,159 @@
+package events
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileStore keeps events in memory and persists them to the single JSON file on every change. It's meant for
+// relatively small amount of events, e.x. deploy annotations.
+type FileStore struct {
+	mu     sync.RWMutex
+	path   string
+	lastID int64
+	events map[int64]Event
+}
+
+type fileStoreData struct {
+	LastID int64   `json:"last_id"`
+	Events []Event `json:"events"`
+}
+
+// NewFileStore creates store backed by the file. File is created on first change if it doesn't exist.
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{
+		path:   path,
+		events: make(map[int64]Event),
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, err
+	}
+
+	var data fileStoreData
+	err = json.Unmarshal(b, &data)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lastID = data.LastID
+	for _, e := range data.Events {
+		s.events[e.ID] = e
+		if e.ID > s.lastID {
+			s.lastID = e.ID
+		}
+	}
+
+	return s, nil
+}
+
+// Add stores new event
+func (s *FileStore) Add(e Event) (Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastID++
+	e.ID = s.lastID
+	s.events[e.ID] = e
+	if err := s.save(); err != nil {
+		delete(s.events, e.ID)
+		s.lastID--
+		return Event{}, err
+	}
+
+	return e, nil
+}
+
+// Get returns event by ID
+func (s *FileStore) Get(id int64) (Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	e, ok := s.events[id]
+	if !ok {
+		return Event{}, ErrNotFound
+	}
+	return e, nil
+}
+
+// Delete removes event by ID
+func (s *FileStore) Delete(id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.events[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	delete(s.events, id)
+	if err := s.save(); err != nil {
+		s.events[id] = e
+		return err
+	}
+
+	return nil
+}
+
+// Find returns events that match the query
+func (s *FileStore) Find(q Query) ([]Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	res := make([]Event, 0)
+	for _, e := range s.events {
+		if q.Match(&e) {
+			res = append(res, e)
+		}
+	}
+	sortEvents(res)
+
+	return res, nil
+}
+
+// save writes all events to the temporary file and renames it, so file is never left half-written. Must be called
+// with the lock held.
+func (s *FileStore) save() error {
+	data := fileStoreData{
+		LastID: s.lastID,
+		Events: make([]Event, 0, len(s.events)),
+	}
+	for _, e := range s.events {
+		data.Events = append(data.Events, e)
+	}
+	sortEvents(data.Events)
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(b)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+
+	err = os.Rename(tmp.Name(), s.path)
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
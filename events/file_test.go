@@ -0,0 +1,90 @@
+package events
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "carbonapi-events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "events.json")
+
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	for _, e := range []Event{
+		{When: 300, What: "deploy", Tags: []string{"deploy", "api"}},
+		{When: 100, What: "outage", Tags: []string{"outage"}},
+		{When: 200, What: "deploy", Tags: []string{"deploy", "web"}},
+	} {
+		if _, err := s.Add(e); err != nil {
+			t.Fatalf("failed to add event: %v", err)
+		}
+	}
+
+	if err := s.Delete(2); err != nil {
+		t.Fatalf("failed to delete event: %v", err)
+	}
+	if err := s.Delete(2); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound on second delete, got %v", err)
+	}
+
+	// reopen the store to make sure everything was persisted
+	s, err = NewFileStore(path)
+	if err != nil {
+		t.Fatalf("failed to reopen store: %v", err)
+	}
+
+	e, err := s.Add(Event{When: 400, What: "deploy", Tags: []string{"api"}})
+	if err != nil {
+		t.Fatalf("failed to add event: %v", err)
+	}
+	if e.ID != 4 {
+		t.Errorf("IDs must not be reused after reopen, got %d", e.ID)
+	}
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []int64
+	}{
+		{"all", Query{}, []int64{3, 1, 4}},
+		{"time range", Query{From: 200, Until: 400}, []int64{3, 1}},
+		{"union", Query{Tags: []string{"web", "api"}, SetOperation: SetUnion}, []int64{3, 1, 4}},
+		{"intersection", Query{Tags: []string{"deploy", "api"}, SetOperation: SetIntersection}, []int64{1}},
+		{"all tags by default", Query{Tags: []string{"deploy", "api"}}, []int64{1}},
+		{"unknown tag", Query{Tags: []string{"outage"}}, []int64{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := s.Find(tt.query)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			ids := make([]int64, 0, len(res))
+			for _, e := range res {
+				ids = append(ids, e.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("got %v, want %v", ids, tt.want)
+			}
+		})
+	}
+
+	if _, err := s.Get(2); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound for deleted event, got %v", err)
+	}
+	if e, err := s.Get(3); err != nil || e.What != "deploy" || e.When != 200 {
+		t.Errorf("unexpected event %+v, error %v", e, err)
+	}
+}
@@ -10,7 +10,7 @@ import (
 )
 
 // ConsolidationToFunc contains a map of graphite-compatible consolidation functions definitions to actual functions that can do aggregation
-// TODO(civil): take into account xFilesFactor
+// xFilesFactor is not handled here, callers should check it with XFilesFactor or XFilesFactorValues before calling the function
 var ConsolidationToFunc = map[string]func([]float64) float64{
 	"average":  AggMean,
 	"avg_zero": AggMeanZero,
@@ -30,6 +30,26 @@ var ConsolidationToFunc = map[string]func([]float64) float64{
 	"last":     AggLast,
 }
 
+// XFilesFactor returns true if ratio of non-null points to total points is big enough to produce a value
+// It follows graphite-web's xff semantics: if there are no non-null points at all, result is always false
+func XFilesFactor(nonNull, total int, xFilesFactor float32) bool {
+	if nonNull == 0 || total == 0 {
+		return false
+	}
+	return float32(nonNull)/float32(total) >= xFilesFactor
+}
+
+// XFilesFactorValues checks xFilesFactor for a list of values, where NaN is treated as a null point
+func XFilesFactorValues(values []float64, xFilesFactor float32) bool {
+	nonNull := 0
+	for _, v := range values {
+		if !math.IsNaN(v) {
+			nonNull++
+		}
+	}
+	return XFilesFactor(nonNull, len(values), xFilesFactor)
+}
+
 var AvailableSummarizers = []string{"sum", "total", "avg", "average", "avg_zero", "max", "min", "last", "range", "median", "multiply", "diff", "count", "stddev"}
 
 // AvgValue returns average of list of values
@@ -109,3 +109,58 @@ func TestSummarizeValues(t *testing.T) {
 	}
 
 }
+
+func TestXFilesFactorValues(t *testing.T) {
+	tests := []struct {
+		name         string
+		values       []float64
+		xFilesFactor float32
+		expected     bool
+	}{
+		{
+			name:         "no values",
+			values:       []float64{},
+			xFilesFactor: 0,
+			expected:     false,
+		},
+		{
+			name:         "only nulls",
+			values:       []float64{math.NaN(), math.NaN()},
+			xFilesFactor: 0,
+			expected:     false,
+		},
+		{
+			name:         "single value with default xFilesFactor",
+			values:       []float64{math.NaN(), 1, math.NaN(), math.NaN()},
+			xFilesFactor: 0,
+			expected:     true,
+		},
+		{
+			name:         "exactly half",
+			values:       []float64{math.NaN(), 1, math.NaN(), 2},
+			xFilesFactor: 0.5,
+			expected:     true,
+		},
+		{
+			name:         "less than half",
+			values:       []float64{math.NaN(), 1, math.NaN(), math.NaN()},
+			xFilesFactor: 0.5,
+			expected:     false,
+		},
+		{
+			name:         "all values required",
+			values:       []float64{1, 2, 3, math.NaN()},
+			xFilesFactor: 1,
+			expected:     false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := XFilesFactorValues(tt.values, tt.xFilesFactor)
+			if actual != tt.expected {
+				t.Errorf("actual %v, expected %v", actual, tt.expected)
+			}
+		})
+	}
+}
@@ -57,7 +57,15 @@ func (eval evaluator) FetchAndEvalExp(ctx context.Context, exp parser.Expr, from
 	}
 
 	if len(multiFetchRequest.Metrics) > 0 {
-		metrics, _, err := config.Config.ZipperInstance.Render(ctx, multiFetchRequest)
+		var (
+			metrics []*types.MetricData
+			err     merry.Error
+		)
+		if config.Config.SeriesCache != nil {
+			metrics, _, err = config.Config.SeriesCache.Render(ctx, multiFetchRequest, config.Config.ZipperInstance.Render)
+		} else {
+			metrics, _, err = config.Config.ZipperInstance.Render(ctx, multiFetchRequest)
+		}
 		// If we had only partial result, we want to do our best to actually do our job
 		if err != nil && merry.HTTPCode(err) >= 400 {
 			return nil, err
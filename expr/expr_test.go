@@ -3,6 +3,7 @@ package expr
 import (
 	"context"
 	"fmt"
+	"math"
 	"testing"
 	"time"
 	"unicode"
@@ -263,6 +264,63 @@ func TestEvalExpression(t *testing.T) {
 				types.MakeMetricData("devops.service.server2.filter.received.reduce.asPercent.count", []float64{25, 100, 400}, 1, now32),
 			},
 		},
+		{
+			"sumSeries(xFilesFactor(metric[123],0.5))",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric[123]", 0, 1}: {
+					types.MakeMetricData("metric1", []float64{1, math.NaN(), 2, 3, math.NaN()}, 1, now32),
+					types.MakeMetricData("metric2", []float64{2, math.NaN(), math.NaN(), 4, math.NaN()}, 1, now32),
+					types.MakeMetricData("metric3", []float64{3, 4, math.NaN(), math.NaN(), 5}, 1, now32),
+				},
+			},
+			[]*types.MetricData{
+				types.MakeMetricData("sumSeries(xFilesFactor(metric[123],0.5))", []float64{6, math.NaN(), math.NaN(), 7, math.NaN()}, 1, now32),
+			},
+		},
+		{
+			"summarize(setXFilesFactor(metric1,0.5),'3s','avg')",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {
+					types.MakeMetricData("metric1", []float64{1, math.NaN(), 2, 3, math.NaN(), math.NaN()}, 1, 0),
+				},
+			},
+			[]*types.MetricData{
+				types.MakeMetricData("summarize(metric1,'3s','avg')", []float64{1.5, math.NaN()}, 3, 0),
+			},
+		},
+		{
+			"unique(interpolate(metric1),aggregateWithWildcards(metric[12],\"sum\"),metric1)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {
+					types.MakeMetricData("metric1", []float64{1, math.NaN(), 3}, 1, now32),
+				},
+				{"metric[12]", 0, 1}: {
+					types.MakeMetricData("metric1", []float64{1, math.NaN(), 3}, 1, now32),
+					types.MakeMetricData("metric2", []float64{2, 2, 2}, 1, now32),
+				},
+			},
+			[]*types.MetricData{
+				types.MakeMetricData("interpolate(metric1)", []float64{1, 2, 3}, 1, now32),
+				types.MakeMetricData("metric1", []float64{1, math.NaN(), 3}, 1, now32),
+				types.MakeMetricData("metric2", []float64{2, 2, 2}, 1, now32),
+			},
+		},
+		{
+			"movingWindow(removeBetweenPercentile(metric[1234],70),2,\"max\")",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric[1234]", 0, 1}: {
+					types.MakeMetricData("metric1", []float64{1, 1, 1, 1}, 1, now32),
+					types.MakeMetricData("metric2", []float64{2, 2, 2, 2}, 1, now32),
+					types.MakeMetricData("metric3", []float64{3, 3, 3, 3}, 1, now32),
+					types.MakeMetricData("metric4", []float64{4, 5, 6, 7}, 1, now32),
+				},
+			},
+			[]*types.MetricData{
+				types.MakeMetricData("movingMax(metric1,2)", []float64{math.NaN(), math.NaN(), 1, 1}, 1, now32),
+				types.MakeMetricData("movingMax(metric2,2)", []float64{math.NaN(), math.NaN(), 2, 2}, 1, now32),
+				types.MakeMetricData("movingMax(metric4,2)", []float64{math.NaN(), math.NaN(), 5, 6}, 1, now32),
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -460,6 +518,32 @@ func TestEvalCustomFromUntil(t *testing.T) {
 			4200,
 			4350,
 		},
+		{
+			"identity(\"fooidentity\")",
+			map[parser.MetricRequest][]*types.MetricData{},
+			[]float64{4200.0, 4260.0, 4320.0},
+			"fooidentity",
+			4200,
+			4350,
+		},
+		{
+			"sin(\"foosin\",2,30)",
+			map[parser.MetricRequest][]*types.MetricData{},
+			[]float64{2 * math.Sin(4200), 2 * math.Sin(4230), 2 * math.Sin(4260), 2 * math.Sin(4290), 2 * math.Sin(4320)},
+			"foosin",
+			4200,
+			4350,
+		},
+		{
+			"timeSlice(metric1,4260,4320)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 4200, 4350}: {types.MakeMetricData("metric1", []float64{1, 2, 3}, 60, 4200)},
+			},
+			[]float64{math.NaN(), 2, 3},
+			"timeSlice(metric1, 4260, 4320)",
+			4200,
+			4350,
+		},
 	}
 
 	for _, tt := range tests {
@@ -49,13 +49,24 @@ func (f *aggregate) Do(ctx context.Context, e parser.Expr, from, until int64, va
 		}
 	}
 
-	// TODO: Implement xFilesFactor
-	/*
-		xFilesFactor, err := e.GetFloatArgDefault(2, 0)
+	if len(args) == 0 {
+		return nil, nil
+	}
+
+	// If xFilesFactor is not specified explicitly, the one that series carries will be used
+	xFilesFactor := args[0].XFilesFactor
+	_, xffOk := e.NamedArgs()["xFilesFactor"]
+	if !xffOk && e.Target() == "aggregate" {
+		xffOk = len(e.Args()) > 2
+	}
+	if xffOk {
+		xff, err := e.GetFloatNamedOrPosArgDefault("xFilesFactor", 2, 0)
 		if err != nil {
-			return false, nil, err
+			return nil, err
 		}
-	*/
+		xFilesFactor = float32(xff)
+	}
+
 	aggFunc, ok := consolidations.ConsolidationToFunc[callback]
 	if !ok {
 		return nil, fmt.Errorf("unsupported consolidation function %s", callback)
@@ -64,7 +75,7 @@ func (f *aggregate) Do(ctx context.Context, e parser.Expr, from, until int64, va
 
 	e.SetTarget(target)
 	e.SetRawArgs(e.Args()[0].Target())
-	return helper.AggregateSeries(e, args, aggFunc)
+	return helper.AggregateSeriesWithXFilesFactor(e, args, aggFunc, xFilesFactor)
 }
 
 // Description is auto-generated description, based on output of https://github.com/graphite-project/graphite-web
@@ -88,12 +99,10 @@ func (f *aggregate) Description() map[string]types.FunctionDescription {
 					Required: true,
 					Options:  consolidations.AvailableConsolidationFuncs(),
 				},
-				/*
-					{
-						Name: "xFilesFactor",
-						Type: types.Float,
-					},
-				*/
+				{
+					Name: "xFilesFactor",
+					Type: types.Float,
+				},
 			},
 		},
 	}
@@ -182,6 +182,42 @@ func TestAverageSeries(t *testing.T) {
 			[]*types.MetricData{types.MakeMetricData("stddevSeries(metric[123])",
 				[]float64{0.4714045207910317, 0.9428090415820634, 1.4142135623730951, 1.8856180831641267, 2.357022603955158}, 1, now32)},
 		},
+		{
+			`aggregate(metric[123], "sum", 0.5)`,
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric[123]", 0, 1}: {
+					types.MakeMetricData("metric1", []float64{1, math.NaN(), 2, 3, math.NaN(), 6}, 1, now32),
+					types.MakeMetricData("metric2", []float64{2, math.NaN(), 3, math.NaN(), math.NaN(), 5}, 1, now32),
+					types.MakeMetricData("metric3", []float64{3, math.NaN(), math.NaN(), 5, 6, math.NaN()}, 1, now32),
+				},
+			},
+			[]*types.MetricData{types.MakeMetricData("sumSeries(metric[123])",
+				[]float64{6, math.NaN(), 5, 8, math.NaN(), 11}, 1, now32)},
+		},
+		{
+			`aggregate(metric[123], "avg", xFilesFactor=1)`,
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric[123]", 0, 1}: {
+					types.MakeMetricData("metric1", []float64{1, math.NaN(), 2, 3, math.NaN(), 6}, 1, now32),
+					types.MakeMetricData("metric2", []float64{2, math.NaN(), 3, math.NaN(), math.NaN(), 5}, 1, now32),
+					types.MakeMetricData("metric3", []float64{3, math.NaN(), 4, 5, 6, math.NaN()}, 1, now32),
+				},
+			},
+			[]*types.MetricData{types.MakeMetricData("avgSeries(metric[123])",
+				[]float64{2, math.NaN(), 3, math.NaN(), math.NaN(), math.NaN()}, 1, now32)},
+		},
+		{
+			`aggregate(metric[123], "max")`,
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric[123]", 0, 1}: {
+					withXFilesFactor(types.MakeMetricData("metric1", []float64{1, math.NaN(), 2, 3, math.NaN(), 6}, 1, now32), 0.6),
+					withXFilesFactor(types.MakeMetricData("metric2", []float64{2, math.NaN(), 3, math.NaN(), math.NaN(), 5}, 1, now32), 0.6),
+					withXFilesFactor(types.MakeMetricData("metric3", []float64{3, math.NaN(), 4, 5, 6, math.NaN()}, 1, now32), 0.6),
+				},
+			},
+			[]*types.MetricData{types.MakeMetricData("maxSeries(metric[123])",
+				[]float64{3, math.NaN(), 4, 5, math.NaN(), 6}, 1, now32)},
+		},
 	}
 
 	for _, tt := range tests {
@@ -192,3 +228,8 @@ func TestAverageSeries(t *testing.T) {
 	}
 
 }
+
+func withXFilesFactor(m *types.MetricData, xFilesFactor float32) *types.MetricData {
+	m.XFilesFactor = xFilesFactor
+	return m
+}
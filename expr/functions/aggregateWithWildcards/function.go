@@ -0,0 +1,122 @@
+package aggregateWithWildcards
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-graphite/carbonapi/expr/consolidations"
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/interfaces"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+type aggregateWithWildcards struct {
+	interfaces.FunctionBase
+}
+
+func GetOrder() interfaces.Order {
+	return interfaces.Any
+}
+
+func New(configFile string) []interfaces.FunctionMetadata {
+	res := make([]interfaces.FunctionMetadata, 0)
+	f := &aggregateWithWildcards{}
+	functions := []string{"aggregateWithWildcards"}
+	for _, n := range functions {
+		res = append(res, interfaces.FunctionMetadata{Name: n, F: f})
+	}
+	return res
+}
+
+// aggregateWithWildcards(seriesList, func, *positions)
+func (f *aggregateWithWildcards) Do(ctx context.Context, e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+	args, err := helper.GetSeriesArg(e.Args()[0], from, until, values)
+	if err != nil {
+		return nil, err
+	}
+
+	callback, err := e.GetStringArg(1)
+	if err != nil {
+		return nil, err
+	}
+
+	aggFunc, ok := consolidations.ConsolidationToFunc[callback]
+	if !ok {
+		return nil, fmt.Errorf("unsupported consolidation function %s", callback)
+	}
+
+	var fields []int
+	if len(e.Args()) > 2 {
+		fields, err = e.GetIntArgs(2)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var results []*types.MetricData
+
+	nodeList := []string{}
+	groups := make(map[string][]*types.MetricData)
+
+	for _, a := range args {
+		metric := helper.ExtractMetric(a.Name)
+		nodes := strings.Split(metric, ".")
+		var s []string
+		for i, n := range nodes {
+			if !helper.Contains(fields, i) {
+				s = append(s, n)
+			}
+		}
+
+		node := strings.Join(s, ".")
+
+		if len(groups[node]) == 0 {
+			nodeList = append(nodeList, node)
+		}
+
+		groups[node] = append(groups[node], a)
+	}
+
+	for _, node := range nodeList {
+		r, err := helper.AggregateSeries(e, groups[node], aggFunc)
+		if err != nil {
+			return nil, err
+		}
+		r[0].Name = node
+		results = append(results, r...)
+	}
+	return results, nil
+}
+
+// Description is auto-generated description, based on output of https://github.com/graphite-project/graphite-web
+func (f *aggregateWithWildcards) Description() map[string]types.FunctionDescription {
+	return map[string]types.FunctionDescription{
+		"aggregateWithWildcards": {
+			Description: "Call aggregator after inserting wildcards at the given position(s).\n\nExample:\n\n.. code-block:: none\n\n  &target=aggregateWithWildcards(host.cpu-[0-7}.cpu-{user,system}.value, \"sum\", 1)\n\nThis would be the equivalent of\n\n.. code-block:: none\n\n  &target=sumSeries(host.cpu-[0-7}.cpu-user.value)&target=sumSeries(host.cpu-[0-7}.cpu-system.value)\n  # or\n  &target=aggregate(host.cpu-[0-7}.cpu-user.value,\"sum\")&target=aggregate(host.cpu-[0-7}.cpu-system.value,\"sum\")\n\nThis function can be used with all aggregation functions supported by\n:py:func:`aggregate <aggregate>`: ``average``, ``median``, ``sum``, ``min``, ``max``, ``diff``,\n``stddev``, ``range`` & ``multiply``.\n\nThis complements :py:func:`groupByNodes <groupByNodes>` which takes a list of nodes that must match in each group.",
+			Function:    "aggregateWithWildcards(seriesList, func, *positions)",
+			Group:       "Combine",
+			Module:      "graphite.render.functions",
+			Name:        "aggregateWithWildcards",
+			Params: []types.FunctionParam{
+				{
+					Name:     "seriesList",
+					Required: true,
+					Type:     types.SeriesList,
+				},
+				{
+					Name:     "func",
+					Required: true,
+					Options:  consolidations.AvailableConsolidationFuncs(),
+					Type:     types.AggFunc,
+				},
+				{
+					Multiple: true,
+					Name:     "positions",
+					Type:     types.Node,
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,69 @@
+package aggregateWithWildcards
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/metadata"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	th "github.com/go-graphite/carbonapi/tests"
+)
+
+func init() {
+	md := New("")
+	evaluator := th.EvaluatorFromFunc(md[0].F)
+	metadata.SetEvaluator(evaluator)
+	helper.SetEvaluator(evaluator)
+	for _, m := range md {
+		metadata.RegisterFunction(m.Name, m.F)
+	}
+}
+
+func TestAggregateWithWildcards(t *testing.T) {
+	now32 := int64(time.Now().Unix())
+
+	tests := []th.MultiReturnEvalTestItem{
+		{
+			`aggregateWithWildcards(metric1.foo.*.*,"sum",1,2)`,
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1.foo.*.*", 0, 1}: {
+					types.MakeMetricData("metric1.foo.bar1.baz", []float64{1, 2, 3, 4, 5}, 1, now32),
+					types.MakeMetricData("metric1.foo.bar1.qux", []float64{6, 7, 8, 9, 10}, 1, now32),
+					types.MakeMetricData("metric1.foo.bar2.baz", []float64{11, 12, 13, 14, 15}, 1, now32),
+					types.MakeMetricData("metric1.foo.bar2.qux", []float64{7, 8, 9, 10, math.NaN()}, 1, now32),
+				},
+			},
+			"aggregateWithWildcards",
+			map[string][]*types.MetricData{
+				"metric1.baz": {types.MakeMetricData("metric1.baz", []float64{12, 14, 16, 18, 20}, 1, now32)},
+				"metric1.qux": {types.MakeMetricData("metric1.qux", []float64{13, 15, 17, 19, 10}, 1, now32)},
+			},
+		},
+		{
+			`aggregateWithWildcards(metric1.foo.*.*,"max",2)`,
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1.foo.*.*", 0, 1}: {
+					types.MakeMetricData("metric1.foo.bar1.baz", []float64{1, 2, 3, 4, 5}, 1, now32),
+					types.MakeMetricData("metric1.foo.bar1.qux", []float64{6, 7, 8, 9, 10}, 1, now32),
+					types.MakeMetricData("metric1.foo.bar2.baz", []float64{11, 12, 13, 14, 15}, 1, now32),
+					types.MakeMetricData("metric1.foo.bar2.qux", []float64{7, 8, 9, 10, math.NaN()}, 1, now32),
+				},
+			},
+			"aggregateWithWildcards",
+			map[string][]*types.MetricData{
+				"metric1.foo.baz": {types.MakeMetricData("metric1.foo.baz", []float64{11, 12, 13, 14, 15}, 1, now32)},
+				"metric1.foo.qux": {types.MakeMetricData("metric1.foo.qux", []float64{7, 8, 9, 10, 10}, 1, now32)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		testName := tt.Target
+		t.Run(testName, func(t *testing.T) {
+			th.TestMultiReturnEvalExpr(t, &tt)
+		})
+	}
+}
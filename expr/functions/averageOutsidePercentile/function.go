@@ -0,0 +1,88 @@
+package averageOutsidePercentile
+
+import (
+	"context"
+
+	"github.com/go-graphite/carbonapi/expr/consolidations"
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/interfaces"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+type averageOutsidePercentile struct {
+	interfaces.FunctionBase
+}
+
+func GetOrder() interfaces.Order {
+	return interfaces.Any
+}
+
+func New(configFile string) []interfaces.FunctionMetadata {
+	res := make([]interfaces.FunctionMetadata, 0)
+	f := &averageOutsidePercentile{}
+	functions := []string{"averageOutsidePercentile"}
+	for _, n := range functions {
+		res = append(res, interfaces.FunctionMetadata{Name: n, F: f})
+	}
+	return res
+}
+
+// averageOutsidePercentile(seriesList, n)
+func (f *averageOutsidePercentile) Do(ctx context.Context, e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+	args, err := helper.GetSeriesArg(e.Args()[0], from, until, values)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := e.GetFloatArg(1)
+	if err != nil {
+		return nil, err
+	}
+	if n < 50 {
+		n = 100 - n
+	}
+
+	averages := make([]float64, 0, len(args))
+	for _, a := range args {
+		averages = append(averages, consolidations.AvgValue(a.Values))
+	}
+
+	lowPercentile := consolidations.Percentile(averages, 100-n, false)
+	highPercentile := consolidations.Percentile(averages, n, false)
+
+	var results []*types.MetricData
+	for i, a := range args {
+		if lowPercentile < averages[i] && averages[i] < highPercentile {
+			continue
+		}
+		results = append(results, a)
+	}
+
+	return results, nil
+}
+
+// Description is auto-generated description, based on output of https://github.com/graphite-project/graphite-web
+func (f *averageOutsidePercentile) Description() map[string]types.FunctionDescription {
+	return map[string]types.FunctionDescription{
+		"averageOutsidePercentile": {
+			Description: "Removes series lying inside an average percentile interval",
+			Function:    "averageOutsidePercentile(seriesList, n)",
+			Group:       "Filter Series",
+			Module:      "graphite.render.functions",
+			Name:        "averageOutsidePercentile",
+			Params: []types.FunctionParam{
+				{
+					Name:     "seriesList",
+					Required: true,
+					Type:     types.SeriesList,
+				},
+				{
+					Name:     "n",
+					Required: true,
+					Type:     types.Integer,
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,72 @@
+package averageOutsidePercentile
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/metadata"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	th "github.com/go-graphite/carbonapi/tests"
+)
+
+func init() {
+	md := New("")
+	evaluator := th.EvaluatorFromFunc(md[0].F)
+	metadata.SetEvaluator(evaluator)
+	helper.SetEvaluator(evaluator)
+	for _, m := range md {
+		metadata.RegisterFunction(m.Name, m.F)
+	}
+}
+
+func TestAverageOutsidePercentile(t *testing.T) {
+	now32 := int64(time.Now().Unix())
+
+	input := map[parser.MetricRequest][]*types.MetricData{
+		{"metric[1234567]", 0, 1}: {
+			types.MakeMetricData("metric1", []float64{1, 1, 1, 1}, 1, now32),
+			types.MakeMetricData("metric2", []float64{2, 2, 2, 2}, 1, now32),
+			types.MakeMetricData("metric3", []float64{3, math.NaN(), 3, 3}, 1, now32),
+			types.MakeMetricData("metric4", []float64{4, 4, 4, 4}, 1, now32),
+			types.MakeMetricData("metric5", []float64{5, 5, 5, math.NaN()}, 1, now32),
+			types.MakeMetricData("metric6", []float64{6, 6, 6, 6}, 1, now32),
+			types.MakeMetricData("metric7", []float64{7, 7, 7, 7}, 1, now32),
+		},
+	}
+
+	tests := []th.EvalTestItem{
+		{
+			"averageOutsidePercentile(metric[1234567],75)",
+			input,
+			[]*types.MetricData{
+				types.MakeMetricData("metric1", []float64{1, 1, 1, 1}, 1, now32),
+				types.MakeMetricData("metric2", []float64{2, 2, 2, 2}, 1, now32),
+				types.MakeMetricData("metric3", []float64{3, math.NaN(), 3, 3}, 1, now32),
+				types.MakeMetricData("metric6", []float64{6, 6, 6, 6}, 1, now32),
+				types.MakeMetricData("metric7", []float64{7, 7, 7, 7}, 1, now32),
+			},
+		},
+		{
+			// n < 50 is the same as 100 - n
+			"averageOutsidePercentile(metric[1234567],25)",
+			input,
+			[]*types.MetricData{
+				types.MakeMetricData("metric1", []float64{1, 1, 1, 1}, 1, now32),
+				types.MakeMetricData("metric2", []float64{2, 2, 2, 2}, 1, now32),
+				types.MakeMetricData("metric3", []float64{3, math.NaN(), 3, 3}, 1, now32),
+				types.MakeMetricData("metric6", []float64{6, 6, 6, 6}, 1, now32),
+				types.MakeMetricData("metric7", []float64{7, 7, 7, 7}, 1, now32),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		testName := tt.Target
+		t.Run(testName, func(t *testing.T) {
+			th.TestEvalExpr(t, &tt)
+		})
+	}
+}
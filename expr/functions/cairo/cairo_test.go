@@ -1,8 +1,7 @@
-// +build cairo
-
 package cairo
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -10,6 +9,7 @@ import (
 	"github.com/go-graphite/carbonapi/expr/types"
 	"github.com/go-graphite/carbonapi/pkg/parser"
 	th "github.com/go-graphite/carbonapi/tests"
+	utilctx "github.com/go-graphite/carbonapi/util/ctx"
 )
 
 func init() {
@@ -78,3 +78,82 @@ func TestEvalExpressionGraph(t *testing.T) {
 		th.TestEvalExpr(t, &tt)
 	}
 }
+
+func TestVerticalLine(t *testing.T) {
+	const (
+		from  = 1000000000
+		until = 1000003600
+	)
+
+	tests := []struct {
+		target  string
+		name    string
+		start   int64
+		color   string
+		wantErr bool
+	}{
+		{
+			target: `verticalLine("1000001800")`,
+			name:   "1000001800",
+			start:  1000001800,
+		},
+		{
+			target: `verticalLine("1000001800","event","blue")`,
+			name:   "event",
+			start:  1000001800,
+			color:  "blue",
+		},
+		{
+			target:  `verticalLine("1000007200")`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			exp, _, err := parser.ParseExpr(tt.target)
+			if err != nil {
+				t.Fatalf("failed to parse %s: %v", tt.target, err)
+			}
+
+			g, err := metadata.GetEvaluator().Eval(context.Background(), exp, from, until, map[parser.MetricRequest][]*types.MetricData{})
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected error for %s", tt.target)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to eval %s: %v", tt.target, err)
+			}
+			if len(g) != 1 {
+				t.Fatalf("unexpected number of results: %d", len(g))
+			}
+			if g[0].Name != tt.name || g[0].StartTime != tt.start || g[0].Color != tt.color || !g[0].DrawAsInfinite {
+				t.Errorf("unexpected result: %+v", g[0])
+			}
+		})
+	}
+}
+
+func TestVerticalLineTimeZone(t *testing.T) {
+	tz, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skipf("time zone data is not available: %v", err)
+	}
+	ctx := utilctx.SetTimeZone(context.Background(), tz)
+
+	// timestamp is in the time zone of the request, not in the local one of the server
+	want := time.Date(2020, time.January, 1, 12, 0, 0, 0, tz).Unix()
+	exp, _, err := parser.ParseExpr(`verticalLine("12:00_20200101")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := metadata.GetEvaluator().Eval(ctx, exp, want-3600, want+3600, map[parser.MetricRequest][]*types.MetricData{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g) != 1 || g[0].StartTime != want {
+		t.Errorf("unexpected result: %+v, want start %d", g, want)
+	}
+}
@@ -1,26 +1,23 @@
-// +build cairo
-
 package png
 
 import (
-	"bytes"
+	"context"
 	"fmt"
 	"image/color"
-	"io/ioutil"
 	"math"
 	"net/http"
-	"os"
 	"sort"
 	"strings"
 	"time"
 
+	"github.com/go-graphite/carbonapi/date"
 	"github.com/go-graphite/carbonapi/expr/helper"
 	"github.com/go-graphite/carbonapi/expr/types"
 	"github.com/go-graphite/carbonapi/pkg/parser"
+	utilctx "github.com/go-graphite/carbonapi/util/ctx"
 	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
 
 	"bitbucket.org/tebeka/strftime"
-	"github.com/evmar/gocairo/cairo"
 )
 
 const HaveGraphSupport = true
@@ -361,19 +358,19 @@ var xAxisConfigs = []xAxisStruct{
 // create any visible effects.
 const floatEpsilon = 0.00000000001
 
-func getCairoFontItalic(s FontSlant) cairo.FontSlant {
+func getCairoFontItalic(s FontSlant) cairoFontSlant {
 	if s == FontSlantItalic {
-		return cairo.FontSlantItalic
+		return cairoFontSlantItalic
 	}
-	return cairo.FontSlantNormal
+	return cairoFontSlantNormal
 }
 
-func getCairoFontWeight(weight FontWeight) cairo.FontWeight {
+func getCairoFontWeight(weight FontWeight) cairoFontWeight {
 	if weight == FontWeightBold {
-		return cairo.FontWeightBold
+		return cairoFontWeightBold
 	}
 
-	return cairo.FontWeightNormal
+	return cairoFontWeightNormal
 }
 
 type Area struct {
@@ -395,8 +392,8 @@ type Params struct {
 	minorLine  color.RGBA
 	fontName   string
 	fontSize   float64
-	fontBold   cairo.FontWeight
-	fontItalic cairo.FontSlant
+	fontBold   cairoFontWeight
+	fontItalic cairoFontSlant
 
 	graphOnly   bool
 	hideLegend  bool
@@ -413,14 +410,19 @@ type Params struct {
 	startTime   int64
 	endTime     int64
 
-	lineMode       LineMode
-	areaMode       AreaMode
-	areaAlpha      float64
-	pieMode        PieMode
-	colorList      []string
-	lineWidth      float64
-	connectedLimit int
-	hasStack       bool
+	lineMode         LineMode
+	areaMode         AreaMode
+	areaAlpha        float64
+	pieMode          PieMode
+	graphType        GraphType
+	pieLabels        PieLabels
+	valueLabels      ValueLabels
+	valueLabelsMin   float64
+	valueLabelsColor color.RGBA
+	colorList        []string
+	lineWidth        float64
+	connectedLimit   int
+	hasStack         bool
 
 	yMin   float64
 	yMax   float64
@@ -486,7 +488,7 @@ type Params struct {
 
 	area        Area
 	isPng       bool // TODO: png and svg use the same code
-	fontExtents cairo.FontExtents
+	fontExtents cairoFontExtents
 
 	uniqueLegend   bool
 	secondYAxis    bool
@@ -663,11 +665,33 @@ func Description() map[string]types.FunctionDescription {
 			Function:    "threshold(value, label=None, color=None)",
 			Group:       "Graph",
 		},
+		"verticalLine": {
+			Name: "verticalLine",
+			Params: []types.FunctionParam{
+				{
+					Name:     "ts",
+					Required: true,
+					Type:     types.Date,
+				},
+				{
+					Name: "label",
+					Type: types.String,
+				},
+				{
+					Name: "color",
+					Type: types.String,
+				},
+			},
+			Module:      "graphite.render.functions",
+			Description: "Takes a timestamp string ts.\n\nDraws a vertical line at the designated timestamp with optional\n'label' and 'color'. Supported timestamp formats include both\nrelative (e.g. -3h) and absolute (e.g. 16:00_20110501) strings,\nsuch as those used with ``from`` and ``until`` parameters. When\nset, the 'label' will appear in the graph legend.\n\nNote: Any timestamps defined outside the requested range will\nraise a 'ValueError' exception.\n\nExample:\n\n.. code-block:: none\n\n  &target=verticalLine(\"12:3420131108\",\"event\",\"blue\")\n  &target=verticalLine(\"16:00_20110501\",\"event\")\n  &target=verticalLine(\"-5mins\")",
+			Function:    "verticalLine(ts, label=None, color=None)",
+			Group:       "Graph",
+		},
 	}
 }
 
 // TODO(civil): Split this into several separate functions.
-func EvalExprGraph(e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+func EvalExprGraph(ctx context.Context, e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
 
 	switch e.Target() {
 
@@ -859,6 +883,50 @@ func EvalExprGraph(e parser.Expr, from, until int64, values map[parser.MetricReq
 
 		return []*types.MetricData{&p}, nil
 
+	case "verticalLine": // verticalLine(ts, label=None, color=None)
+		tsString, err := e.GetStringArg(0)
+		if err != nil {
+			return nil, err
+		}
+
+		ts := date.DateParamToEpoch(tsString, "", math.MinInt64, utilctx.GetTimeZone(ctx))
+		if ts == math.MinInt64 {
+			return nil, fmt.Errorf("verticalLine(): invalid timestamp %q", tsString)
+		}
+		if ts < from {
+			return nil, fmt.Errorf("verticalLine(): timestamp %d exists before start of range", ts)
+		}
+		if ts > until {
+			return nil, fmt.Errorf("verticalLine(): timestamp %d exists after end of range", ts)
+		}
+
+		name, err := e.GetStringNamedOrPosArgDefault("label", 1, tsString)
+		if err != nil {
+			return nil, err
+		}
+
+		color, err := e.GetStringNamedOrPosArgDefault("color", 2, "")
+		if err != nil {
+			return nil, err
+		}
+
+		p := types.MetricData{
+			FetchResponse: pb.FetchResponse{
+				Name:              name,
+				StartTime:         ts,
+				StopTime:          ts + 1,
+				StepTime:          1,
+				Values:            []float64{1, 1},
+				ConsolidationFunc: "average",
+			},
+			GraphOptions: types.GraphOptions{
+				Color:          color,
+				DrawAsInfinite: true,
+			},
+		}
+
+		return []*types.MetricData{&p}, nil
+
 	}
 
 	return nil, helper.ErrUnknownFunction(e.Target())
@@ -880,7 +948,15 @@ func MarshalPNGRequest(r *http.Request, results []*types.MetricData, templateNam
 	return marshalCairo(GetPictureParamsWithTemplate(r, templateName, results), results, cairoPNG)
 }
 
-func marshalCairo(p PictureParams, results []*types.MetricData, backend cairoBackend) []byte {
+func MarshalPDF(params PictureParams, results []*types.MetricData) []byte {
+	return MarshalPDFPages([]PDFPage{{Params: params, Results: results}})
+}
+
+func MarshalPDFRequest(r *http.Request, results []*types.MetricData, templateName string) []byte {
+	return MarshalPDF(GetPictureParamsWithTemplate(r, templateName, results), results)
+}
+
+func newParams(p PictureParams) Params {
 	var params = Params{
 		pixelRatio:     p.PixelRatio,
 		width:          p.Width,
@@ -907,7 +983,14 @@ func marshalCairo(p PictureParams, results []*types.MetricData, backend cairoBac
 		areaMode:       p.AreaMode,
 		areaAlpha:      p.AreaAlpha,
 		pieMode:        p.PieMode,
-		lineWidth:      p.LineWidth,
+
+		graphType:        p.GraphType,
+		pieLabels:        p.PieLabels,
+		valueLabels:      p.ValueLabels,
+		valueLabelsMin:   p.ValueLabelsMin,
+		valueLabelsColor: string2RGBA(p.ValueLabelsColor),
+
+		lineWidth: p.LineWidth,
 
 		rightWidth:  p.RightWidth,
 		rightDashed: p.RightDashed,
@@ -959,57 +1042,23 @@ func marshalCairo(p PictureParams, results []*types.MetricData, backend cairoBac
 	params.area.ymin = margin
 	params.area.ymax = params.height - margin
 
-	var surface *cairo.Surface
-	var tmpfile *os.File
-	switch backend {
-	case cairoSVG:
-		var err error
-		tmpfile, err = ioutil.TempFile("/dev/shm", "cairosvg")
-		if err != nil {
-			return nil
-		}
-		defer os.Remove(tmpfile.Name())
-		s := svgSurfaceCreate(tmpfile.Name(), params.width, params.height, params.pixelRatio)
-		surface = s.Surface
-	case cairoPNG:
-		s := imageSurfaceCreate(cairo.FormatARGB32, params.width, params.height, params.pixelRatio)
-		surface = s.Surface
-	}
-	cr := createContext(surface, params.pixelRatio)
+	return params
+}
 
+// drawPicture draws background and the graph
+func drawPicture(cr *cairoSurfaceContext, params *Params, results []*types.MetricData) {
 	// Setting font parameters
 
-	fontOpts := cairo.FontOptionsCreate()
-	fontOpts.SetAntialias(cairo.AntialiasNone)
-	cr.context.SetFontOptions(fontOpts)
+	cr.context.SetFontOptions(fontOptionsNoAntialias())
 
 	setColor(cr, params.bgColor)
-	drawRectangle(cr, &params, 0, 0, params.width, params.height, true)
-
-	drawGraph(cr, &params, results)
-
-	surface.Flush()
+	drawRectangle(cr, params, 0, 0, params.width, params.height, true)
 
-	var b []byte
-
-	switch backend {
-	case cairoPNG:
-		var buf bytes.Buffer
-		surface.WriteToPNG(&buf)
-		surface.Finish()
-		b = buf.Bytes()
-	case cairoSVG:
-		surface.Finish()
-		b, _ = ioutil.ReadFile(tmpfile.Name())
-		// NOTE(dgryski): This is the dumbest thing ever, but needed
-		// for compatibility.  I'm not doing the rest of the svg
-		// munging that graphite does.
-		// We could speed this up with Index(`pt"`) and overwriting the
-		// `t` twice
-		b = bytes.Replace(b, []byte(`pt"`), []byte(`px"`), 2)
+	if params.graphType == GraphTypePie {
+		drawPie(cr, params, results)
+		return
 	}
-
-	return b
+	drawGraph(cr, params, results)
 }
 
 func drawGraph(cr *cairoSurfaceContext, params *Params, results []*types.MetricData) {
@@ -1766,24 +1815,24 @@ func setupYAxis(cr *cairoSurfaceContext, params *Params, results []*types.Metric
 	}
 }
 
-func getFontExtents(cr *cairoSurfaceContext) cairo.FontExtents {
+func getFontExtents(cr *cairoSurfaceContext) cairoFontExtents {
 	// TODO(dgryski): allow font options
 	/*
 	   if fontOptions:
 	     self.setFont(**fontOptions)
 	*/
-	var F cairo.FontExtents
+	var F cairoFontExtents
 	cr.context.FontExtents(&F)
 	return F
 }
 
-func getTextExtents(cr *cairoSurfaceContext, text string) cairo.TextExtents {
+func getTextExtents(cr *cairoSurfaceContext, text string) cairoTextExtents {
 	// TODO(dgryski): allow font options
 	/*
 	   if fontOptions:
 	     self.setFont(**fontOptions)
 	*/
-	var T cairo.TextExtents
+	var T cairoTextExtents
 	cr.context.TextExtents(text, &T)
 	return T
 }
@@ -2139,28 +2188,28 @@ func drawGridLines(cr *cairoSurfaceContext, params *Params, results []*types.Met
 	cr.context.Stroke()
 }
 
-func str2linecap(s string) cairo.LineCap {
+func str2linecap(s string) cairoLineCap {
 	switch s {
 	case "butt":
-		return cairo.LineCapButt
+		return cairoLineCapButt
 	case "round":
-		return cairo.LineCapRound
+		return cairoLineCapRound
 	case "square":
-		return cairo.LineCapSquare
+		return cairoLineCapSquare
 	}
-	return cairo.LineCapButt
+	return cairoLineCapButt
 }
 
-func str2linejoin(s string) cairo.LineJoin {
+func str2linejoin(s string) cairoLineJoin {
 	switch s {
 	case "miter":
-		return cairo.LineJoinMiter
+		return cairoLineJoinMiter
 	case "round":
-		return cairo.LineJoinRound
+		return cairoLineJoinRound
 	case "bevel":
-		return cairo.LineJoinBevel
+		return cairoLineJoinBevel
 	}
-	return cairo.LineJoinMiter
+	return cairoLineJoinMiter
 }
 
 func getYCoord(params *Params, value float64, side YCoordSide) (y float64) {
@@ -2449,7 +2498,7 @@ func drawLegend(cr *cairoSurfaceContext, params *Params, results []*types.Metric
 
 	rightSideLabels := false
 	testSizeName := longestName + " " + longestName
-	var textExtents cairo.TextExtents
+	var textExtents cairoTextExtents
 	cr.context.TextExtents(testSizeName, &textExtents)
 	testWidth := textExtents.XAdvance + 2*(params.fontExtents.Height+padding)
 	if testWidth+50 < params.width {
@@ -2586,9 +2635,9 @@ func radians(angle float64) float64 {
 
 func drawText(cr *cairoSurfaceContext, params *Params, text string, x, y float64, align HAlign, valign VAlign, rotate float64) {
 	var hAlign, vAlign float64
-	var textExtents cairo.TextExtents
-	var fontExtents cairo.FontExtents
-	var origMatrix cairo.Matrix
+	var textExtents cairoTextExtents
+	var fontExtents cairoFontExtents
+	var origMatrix cairoMatrix
 	cr.context.TextExtents(text, &textExtents)
 	cr.context.FontExtents(&fontExtents)
 
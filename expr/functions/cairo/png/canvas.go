@@ -0,0 +1,332 @@
+// +build !cairo
+
+package png
+
+import (
+	"math"
+	"unicode/utf8"
+)
+
+type point struct {
+	x, y float64
+}
+
+// subpath is a polyline in device coordinates
+type subpath struct {
+	points []point
+	closed bool
+}
+
+// textRun is a text added to the path by TextPath, it's kept as is so SVG can output real text
+type textRun struct {
+	text   string
+	origin point
+	// matrix maps font units to device space, translation is not used
+	matrix cairoMatrix
+	size   float64
+	family string
+	slant  cairoFontSlant
+	weight cairoFontWeight
+}
+
+type cairoPath struct {
+	subpaths []subpath
+	texts    []textRun
+}
+
+func (p *cairoPath) copy() *cairoPath {
+	res := &cairoPath{
+		subpaths: make([]subpath, len(p.subpaths)),
+		texts:    append([]textRun(nil), p.texts...),
+	}
+	for i, s := range p.subpaths {
+		res.subpaths[i] = subpath{points: append([]point(nil), s.points...), closed: s.closed}
+	}
+	return res
+}
+
+// painter is an output of the canvas, all coordinates it gets are device coordinates
+type painter interface {
+	fill(path *cairoPath, state *gstate)
+	stroke(path *cairoPath, state *gstate)
+	// clip intersects clip with the given id with the path and returns id of the new clip, 0 means no clip
+	clip(path *cairoPath, state *gstate) int
+}
+
+// gstate is a graphics state saved and restored by Save and Restore, as in cairo it doesn't include the path
+type gstate struct {
+	r, g, b, a float64
+
+	lineWidth  float64
+	dashes     []float64
+	dashOffset float64
+	lineCap    cairoLineCap
+	lineJoin   cairoLineJoin
+
+	matrix cairoMatrix
+
+	fontFamily string
+	fontSlant  cairoFontSlant
+	fontWeight cairoFontWeight
+	fontSize   float64
+
+	clip int
+}
+
+// canvas implements cairoContext on top of painter
+type canvas struct {
+	gstate
+	stack []gstate
+
+	path       cairoPath
+	current    point
+	hasCurrent bool
+	// start of the last subpath, current point after ClosePath
+	start point
+
+	painter painter
+}
+
+func newCanvas(p painter, pixelRatio float64) *canvas {
+	scale := 1.0
+	if !isDefaultRatio(pixelRatio) {
+		scale = pixelRatio
+	}
+	return &canvas{
+		gstate: gstate{
+			a:         1,
+			lineWidth: 2,
+			matrix:    cairoMatrix{Xx: scale, Yy: scale},
+			fontSize:  10,
+		},
+		painter: p,
+	}
+}
+
+func (c *canvas) moveToDevice(p point) {
+	// consecutive moves replace each other
+	if n := len(c.path.subpaths); n > 0 && len(c.path.subpaths[n-1].points) == 1 && !c.path.subpaths[n-1].closed {
+		c.path.subpaths[n-1].points[0] = p
+	} else {
+		c.path.subpaths = append(c.path.subpaths, subpath{points: []point{p}})
+	}
+	c.current = p
+	c.start = p
+	c.hasCurrent = true
+}
+
+func (c *canvas) lineToDevice(p point) {
+	n := len(c.path.subpaths)
+	if !c.hasCurrent {
+		c.moveToDevice(p)
+		return
+	}
+	if n == 0 || c.path.subpaths[n-1].closed {
+		c.moveToDevice(c.current)
+		n = len(c.path.subpaths)
+	}
+	s := &c.path.subpaths[n-1]
+	s.points = append(s.points, p)
+	c.current = p
+}
+
+func (c *canvas) MoveTo(x, y float64) {
+	dx, dy := c.matrix.transformPoint(x, y)
+	c.moveToDevice(point{dx, dy})
+}
+
+func (c *canvas) RelMoveTo(dx, dy float64) {
+	ddx, ddy := c.matrix.transformDistance(dx, dy)
+	c.moveToDevice(point{c.current.x + ddx, c.current.y + ddy})
+}
+
+func (c *canvas) LineTo(x, y float64) {
+	dx, dy := c.matrix.transformPoint(x, y)
+	c.lineToDevice(point{dx, dy})
+}
+
+func (c *canvas) Rectangle(x, y, width, height float64) {
+	c.MoveTo(x, y)
+	c.LineTo(x+width, y)
+	c.LineTo(x+width, y+height)
+	c.LineTo(x, y+height)
+	c.ClosePath()
+}
+
+func (c *canvas) Arc(xc, yc, radius, angle1, angle2 float64) {
+	for angle2 < angle1 {
+		angle2 += 2 * math.Pi
+	}
+	// segments are short enough to look smooth at any reasonable radius
+	segments := int(math.Ceil((angle2 - angle1) * radius * c.matrix.scale() / 2))
+	if segments < 4 {
+		segments = 4
+	}
+	for i := 0; i <= segments; i++ {
+		angle := angle1 + (angle2-angle1)*float64(i)/float64(segments)
+		sin, cos := math.Sincos(angle)
+		c.LineTo(xc+radius*cos, yc+radius*sin)
+	}
+}
+
+func (c *canvas) ClosePath() {
+	n := len(c.path.subpaths)
+	if n == 0 || c.path.subpaths[n-1].closed {
+		return
+	}
+	c.path.subpaths[n-1].closed = true
+	c.current = c.start
+}
+
+func (c *canvas) newPath() {
+	c.path = cairoPath{}
+	c.hasCurrent = false
+}
+
+func (c *canvas) CopyPath() *cairoPath {
+	return c.path.copy()
+}
+
+func (c *canvas) AppendPath(path *cairoPath) {
+	p := path.copy()
+	c.path.subpaths = append(c.path.subpaths, p.subpaths...)
+	c.path.texts = append(c.path.texts, p.texts...)
+	if n := len(p.subpaths); n > 0 {
+		last := p.subpaths[n-1]
+		c.start = last.points[0]
+		c.current = last.points[len(last.points)-1]
+		if last.closed {
+			c.current = c.start
+		}
+		c.hasCurrent = true
+	}
+}
+
+func (c *canvas) Fill() {
+	c.painter.fill(&c.path, &c.gstate)
+	c.newPath()
+}
+
+func (c *canvas) FillPreserve() {
+	c.painter.fill(&c.path, &c.gstate)
+}
+
+func (c *canvas) Stroke() {
+	c.painter.stroke(&c.path, &c.gstate)
+	c.newPath()
+}
+
+func (c *canvas) Clip() {
+	c.clip = c.painter.clip(&c.path, &c.gstate)
+	c.newPath()
+}
+
+func (c *canvas) Save() {
+	s := c.gstate
+	s.dashes = append([]float64(nil), c.dashes...)
+	c.stack = append(c.stack, s)
+}
+
+func (c *canvas) Restore() {
+	n := len(c.stack)
+	if n == 0 {
+		return
+	}
+	c.gstate = c.stack[n-1]
+	c.stack = c.stack[:n-1]
+}
+
+func (c *canvas) GetLineWidth() float64 {
+	return c.lineWidth
+}
+
+func (c *canvas) SetLineWidth(width float64) {
+	c.lineWidth = width
+}
+
+func (c *canvas) SetDash(dashes []float64, offset float64) {
+	c.dashes = append([]float64(nil), dashes...)
+	c.dashOffset = offset
+}
+
+func (c *canvas) SetLineCap(lineCap cairoLineCap) {
+	c.lineCap = lineCap
+}
+
+func (c *canvas) SetLineJoin(lineJoin cairoLineJoin) {
+	c.lineJoin = lineJoin
+}
+
+func (c *canvas) SetSourceRGBA(red, green, blue, alpha float64) {
+	c.r, c.g, c.b, c.a = red, green, blue, alpha
+}
+
+func (c *canvas) Rotate(angle float64) {
+	sin, cos := math.Sincos(angle)
+	m := c.matrix
+	c.matrix.Xx = cos*m.Xx + sin*m.Xy
+	c.matrix.Yx = cos*m.Yx + sin*m.Yy
+	c.matrix.Xy = -sin*m.Xx + cos*m.Xy
+	c.matrix.Yy = -sin*m.Yx + cos*m.Yy
+}
+
+func (c *canvas) GetMatrix(matrix *cairoMatrix) {
+	*matrix = c.matrix
+}
+
+func (c *canvas) SetMatrix(matrix *cairoMatrix) {
+	c.matrix = *matrix
+}
+
+func (c *canvas) SetFontOptions(options *cairoFontOptions) {}
+
+func (c *canvas) SelectFontFace(family string, slant cairoFontSlant, weight cairoFontWeight) {
+	c.fontFamily = family
+	c.fontSlant = slant
+	c.fontWeight = weight
+}
+
+func (c *canvas) SetFontSize(size float64) {
+	c.fontSize = size
+}
+
+func (c *canvas) FontExtents(extents *cairoFontExtents) {
+	u := c.fontSize / glyphUnits
+	*extents = cairoFontExtents{
+		Ascent:      glyphAscent * u,
+		Descent:     glyphDescent * u,
+		Height:      (glyphAscent + glyphDescent + 1) * u,
+		MaxXAdvance: glyphAdvance * u,
+	}
+}
+
+func (c *canvas) TextExtents(text string, extents *cairoTextExtents) {
+	u := c.fontSize / glyphUnits
+	n := float64(utf8.RuneCountInString(text))
+	*extents = cairoTextExtents{
+		YBearing: -glyphRows * u,
+		Height:   (glyphRows + glyphDescent) * u,
+		XAdvance: n * glyphAdvance * u,
+	}
+	if n > 0 {
+		extents.Width = (n*glyphAdvance - 1) * u
+	}
+}
+
+func (c *canvas) TextPath(text string) {
+	u := c.fontSize / glyphUnits
+	m := c.matrix
+	m.Xx, m.Yx, m.Xy, m.Yy = m.Xx*u, m.Yx*u, m.Xy*u, m.Yy*u
+	c.path.texts = append(c.path.texts, textRun{
+		text:   text,
+		origin: c.current,
+		matrix: m,
+		size:   c.fontSize,
+		family: c.fontFamily,
+		slant:  c.fontSlant,
+		weight: c.fontWeight,
+	})
+	dx, dy := m.transformDistance(float64(utf8.RuneCountInString(text))*glyphAdvance, 0)
+	c.current = point{c.current.x + dx, c.current.y + dy}
+	c.hasCurrent = true
+}
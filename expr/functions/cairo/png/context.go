@@ -0,0 +1,45 @@
+package png
+
+// interface with all used cairo.Context methods, implemented by cairo itself and by the pure-Go renderer
+type cairoContext interface {
+	Rectangle(x, y, width, height float64)      // pixel ratio required
+	GetLineWidth() float64                      // pixel ratio required
+	LineTo(x, y float64)                        // pixel ratio required
+	Arc(xc, yc, radius, angle1, angle2 float64) // pixel ratio required
+	MoveTo(x, y float64)                        // pixel ratio required
+	SetLineWidth(width float64)                 // pixel ratio required
+	SetFontSize(size float64)                   // pixel ratio required
+	SetFontOptions(options *cairoFontOptions)
+	Stroke()
+	SetDash(dashes []float64, offset float64)           // pixel ratio required
+	TextExtents(utf8 string, extents *cairoTextExtents) // pixel ratio required
+	FontExtents(extents *cairoFontExtents)              // pixel ratio required
+	Rotate(angle float64)
+	SetLineCap(lineCap cairoLineCap)
+	SetLineJoin(lineJoin cairoLineJoin)
+	RelMoveTo(dx, dy float64) // pixel ratio required
+	SetSourceRGBA(red, green, blue, alpha float64)
+	SetMatrix(matrix *cairoMatrix) // pixel ratio required
+	GetMatrix(matrix *cairoMatrix) // pixel ratio required
+	Clip()
+	Fill()
+	ClosePath()
+	SelectFontFace(family string, slant cairoFontSlant, weight cairoFontWeight) // pixel ratio required
+	TextPath(utf8 string)
+	Save()
+	Restore()
+	FillPreserve()
+	AppendPath(path *cairoPath)
+	CopyPath() *cairoPath
+}
+
+type cairoSurfaceContext struct {
+	context cairoContext
+}
+
+func isDefaultRatio(pixelRatio float64) bool {
+	if pixelRatio > 0.9999 && pixelRatio < 1.0001 {
+		return true
+	}
+	return false
+}
@@ -0,0 +1,162 @@
+// +build !cairo
+
+package png
+
+import "strings"
+
+// Text is drawn with the built-in 5x7 bitmap font, so output doesn't depend on fonts installed in the system.
+// Glyph pixels are font units, font size is glyphUnits font units.
+const (
+	glyphUnits   = 10
+	glyphColumns = 5
+	glyphRows    = 7 // rows above the baseline
+	glyphAscent  = 8
+	glyphDescent = 2
+	glyphAdvance = glyphColumns + 1
+)
+
+// glyphData has ASCII glyphs starting with space, rows are separated by '|', rows after glyphRows are descenders
+var glyphData = [...]string{
+	"",
+	"..#..|..#..|..#..|..#..|..#..|.....|..#..",
+	".#.#.|.#.#.|.#.#.",
+	".#.#.|.#.#.|#####|.#.#.|#####|.#.#.|.#.#.",
+	"..#..|.####|#.#..|.###.|..#.#|####.|..#..",
+	"##...|##..#|...#.|..#..|.#...|#..##|...##",
+	".##..|#..#.|#.#..|.#...|#.#.#|#..#.|.##.#",
+	"..#..|..#..|..#..",
+	"...#.|..#..|.#...|.#...|.#...|..#..|...#.",
+	".#...|..#..|...#.|...#.|...#.|..#..|.#...",
+	".....|..#..|#.#.#|.###.|#.#.#|..#..|.....",
+	".....|..#..|..#..|#####|..#..|..#..|.....",
+	".....|.....|.....|.....|.....|..#..|..#..|.#...",
+	".....|.....|.....|#####|.....|.....|.....",
+	".....|.....|.....|.....|.....|.##..|.##..",
+	".....|....#|...#.|..#..|.#...|#....|.....",
+	".###.|#...#|#..##|#.#.#|##..#|#...#|.###.",
+	"..#..|.##..|..#..|..#..|..#..|..#..|.###.",
+	".###.|#...#|....#|...#.|..#..|.#...|#####",
+	"#####|...#.|..#..|...#.|....#|#...#|.###.",
+	"...#.|..##.|.#.#.|#..#.|#####|...#.|...#.",
+	"#####|#....|####.|....#|....#|#...#|.###.",
+	"..##.|.#...|#....|####.|#...#|#...#|.###.",
+	"#####|....#|...#.|..#..|.#...|.#...|.#...",
+	".###.|#...#|#...#|.###.|#...#|#...#|.###.",
+	".###.|#...#|#...#|.####|....#|...#.|.##..",
+	".....|.##..|.##..|.....|.##..|.##..|.....",
+	".....|.##..|.##..|.....|.##..|..#..|.#...",
+	"...#.|..#..|.#...|#....|.#...|..#..|...#.",
+	".....|.....|#####|.....|#####|.....|.....",
+	".#...|..#..|...#.|....#|...#.|..#..|.#...",
+	".###.|#...#|....#|...#.|..#..|.....|..#..",
+	".###.|#...#|....#|.##.#|#.#.#|#.#.#|.###.",
+	".###.|#...#|#...#|#...#|#####|#...#|#...#",
+	"####.|#...#|#...#|####.|#...#|#...#|####.",
+	".###.|#...#|#....|#....|#....|#...#|.###.",
+	"###..|#..#.|#...#|#...#|#...#|#..#.|###..",
+	"#####|#....|#....|####.|#....|#....|#####",
+	"#####|#....|#....|####.|#....|#....|#....",
+	".###.|#...#|#....|#.###|#...#|#...#|.####",
+	"#...#|#...#|#...#|#####|#...#|#...#|#...#",
+	".###.|..#..|..#..|..#..|..#..|..#..|.###.",
+	"..###|...#.|...#.|...#.|...#.|#..#.|.##..",
+	"#...#|#..#.|#.#..|##...|#.#..|#..#.|#...#",
+	"#....|#....|#....|#....|#....|#....|#####",
+	"#...#|##.##|#.#.#|#.#.#|#...#|#...#|#...#",
+	"#...#|#...#|##..#|#.#.#|#..##|#...#|#...#",
+	".###.|#...#|#...#|#...#|#...#|#...#|.###.",
+	"####.|#...#|#...#|####.|#....|#....|#....",
+	".###.|#...#|#...#|#...#|#.#.#|#..#.|.##.#",
+	"####.|#...#|#...#|####.|#.#..|#..#.|#...#",
+	".####|#....|#....|.###.|....#|....#|####.",
+	"#####|..#..|..#..|..#..|..#..|..#..|..#..",
+	"#...#|#...#|#...#|#...#|#...#|#...#|.###.",
+	"#...#|#...#|#...#|#...#|#...#|.#.#.|..#..",
+	"#...#|#...#|#...#|#.#.#|#.#.#|#.#.#|.#.#.",
+	"#...#|#...#|.#.#.|..#..|.#.#.|#...#|#...#",
+	"#...#|#...#|#...#|.#.#.|..#..|..#..|..#..",
+	"#####|....#|...#.|..#..|.#...|#....|#####",
+	".###.|.#...|.#...|.#...|.#...|.#...|.###.",
+	".....|#....|.#...|..#..|...#.|....#|.....",
+	".###.|...#.|...#.|...#.|...#.|...#.|.###.",
+	"..#..|.#.#.|#...#",
+	".....|.....|.....|.....|.....|.....|#####",
+	".#...|..#..|...#.",
+	".....|.....|.###.|....#|.####|#...#|.####",
+	"#....|#....|#.##.|##..#|#...#|#...#|####.",
+	".....|.....|.###.|#....|#....|#...#|.###.",
+	"....#|....#|.##.#|#..##|#...#|#...#|.####",
+	".....|.....|.###.|#...#|#####|#....|.###.",
+	"..##.|.#..#|.#...|###..|.#...|.#...|.#...",
+	".....|.....|.####|#...#|#...#|#...#|.####|....#|.###.",
+	"#....|#....|#.##.|##..#|#...#|#...#|#...#",
+	"..#..|.....|.##..|..#..|..#..|..#..|.###.",
+	"...#.|.....|..##.|...#.|...#.|...#.|...#.|#..#.|.##..",
+	"#....|#....|#..#.|#.#..|##...|#.#..|#..#.",
+	".##..|..#..|..#..|..#..|..#..|..#..|.###.",
+	".....|.....|##.#.|#.#.#|#.#.#|#.#.#|#.#.#",
+	".....|.....|#.##.|##..#|#...#|#...#|#...#",
+	".....|.....|.###.|#...#|#...#|#...#|.###.",
+	".....|.....|####.|#...#|#...#|#...#|####.|#....|#....",
+	".....|.....|.####|#...#|#...#|#...#|.####|....#|....#",
+	".....|.....|#.##.|##..#|#....|#....|#....",
+	".....|.....|.####|#....|.###.|....#|####.",
+	".#...|.#...|###..|.#...|.#...|.#..#|..##.",
+	".....|.....|#...#|#...#|#...#|#..##|.##.#",
+	".....|.....|#...#|#...#|#...#|.#.#.|..#..",
+	".....|.....|#...#|#...#|#.#.#|#.#.#|.#.#.",
+	".....|.....|#...#|.#.#.|..#..|.#.#.|#...#",
+	".....|.....|#...#|#...#|#...#|#...#|.####|....#|.###.",
+	".....|.....|#####|...#.|..#..|.#...|#####",
+	"...#.|..#..|..#..|.#...|..#..|..#..|...#.",
+	"..#..|..#..|..#..|..#..|..#..|..#..|..#..",
+	".#...|..#..|..#..|...#.|..#..|..#..|.#...",
+	".....|.....|.#...|#.#.#|...#.|.....|.....",
+}
+
+// glyphRect is a horizontal run of glyph pixels in font units, y grows down from the baseline
+type glyphRect struct {
+	x0, y0, x1, y1 float64
+}
+
+// glyphs has runs of every glyph relative to its origin on the baseline
+var glyphs [len(glyphData)][]glyphRect
+
+func init() {
+	for i, g := range glyphData {
+		if g == "" {
+			continue
+		}
+		for row, line := range strings.Split(g, "|") {
+			y := float64(row - glyphRows)
+			for col := 0; col < len(line); col++ {
+				if line[col] != '#' {
+					continue
+				}
+				end := col
+				for end < len(line) && line[end] == '#' {
+					end++
+				}
+				glyphs[i] = append(glyphs[i], glyphRect{x0: float64(col), y0: y, x1: float64(end), y1: y + 1})
+				col = end
+			}
+		}
+	}
+}
+
+// textRects returns runs of all glyphs of the text, characters without glyphs are drawn as '?'
+func textRects(text string) []glyphRect {
+	var res []glyphRect
+	var x float64
+	for _, r := range text {
+		idx := int(r) - ' '
+		if idx < 0 || idx >= len(glyphs) {
+			idx = '?' - ' '
+		}
+		for _, g := range glyphs[idx] {
+			res = append(res, glyphRect{x0: g.x0 + x, y0: g.y0, x1: g.x1 + x, y1: g.y1})
+		}
+		x += glyphAdvance
+	}
+	return res
+}
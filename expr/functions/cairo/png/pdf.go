@@ -0,0 +1,83 @@
+// +build cairo
+
+package png
+
+/*
+#cgo pkg-config: cairo
+#include <cairo.h>
+#include <cairo-pdf.h>
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"io/ioutil"
+	"os"
+	"unsafe"
+
+	"github.com/evmar/gocairo/cairo"
+)
+
+// pdfSurfaceCreate creates PDF surface that writes the document to filename, size is the size of the first page
+func pdfSurfaceCreate(filename string, widthInPoints, heightInPoints float64, pixelRatio float64) *cairo.Surface {
+	if !isDefaultRatio(pixelRatio) {
+		widthInPoints *= pixelRatio
+		heightInPoints *= pixelRatio
+	}
+	cFilename := C.CString(filename)
+	defer C.free(unsafe.Pointer(cFilename))
+	p := C.cairo_pdf_surface_create(cFilename, C.double(widthInPoints), C.double(heightInPoints))
+	if status := C.cairo_surface_status(p); status != C.CAIRO_STATUS_SUCCESS {
+		C.cairo_surface_destroy(p)
+		return nil
+	}
+	return cairo.WrapSurface(unsafe.Pointer(p))
+}
+
+// pdfSurfaceSetSize changes size of the next page, must be called before anything is drawn on it
+func pdfSurfaceSetSize(surface *cairo.Surface, widthInPoints, heightInPoints float64, pixelRatio float64) {
+	if !isDefaultRatio(pixelRatio) {
+		widthInPoints *= pixelRatio
+		heightInPoints *= pixelRatio
+	}
+	C.cairo_pdf_surface_set_size((*C.cairo_surface_t)(unsafe.Pointer(surface.Ptr)), C.double(widthInPoints), C.double(heightInPoints))
+}
+
+// HavePDFSupport is true if format=pdf can be rendered, PDF surfaces are provided only by cairo
+const HavePDFSupport = true
+
+// MarshalPDFPages renders PDF document with every graph on a separate page, size of each page is the size of its graph
+func MarshalPDFPages(pages []PDFPage) []byte {
+	if len(pages) == 0 {
+		return nil
+	}
+
+	tmpfile, err := ioutil.TempFile("/dev/shm", "cairopdf")
+	if err != nil {
+		return nil
+	}
+	tmpfile.Close()
+	defer os.Remove(tmpfile.Name())
+
+	var surface *cairo.Surface
+	for _, page := range pages {
+		params := newParams(page.Params)
+		if surface == nil {
+			surface = pdfSurfaceCreate(tmpfile.Name(), params.width, params.height, params.pixelRatio)
+			if surface == nil {
+				return nil
+			}
+		}
+		pdfSurfaceSetSize(surface, params.width, params.height, params.pixelRatio)
+
+		cr := createContext(surface, params.pixelRatio)
+		drawPicture(cr, &params, page.Results)
+		surface.ShowPage()
+	}
+
+	surface.Flush()
+	surface.Finish()
+
+	b, _ := ioutil.ReadFile(tmpfile.Name())
+	return b
+}
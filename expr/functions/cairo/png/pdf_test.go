@@ -0,0 +1,35 @@
+// +build cairo
+
+package png
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-graphite/carbonapi/expr/types"
+)
+
+func TestMarshalPDF(t *testing.T) {
+	results := []*types.MetricData{
+		types.MakeMetricData("metric1", []float64{1, 2, 3, 4}, 60, 600),
+		types.MakeMetricData("metric2", []float64{4, 3, 2, 1}, 60, 600),
+	}
+	r := httptest.NewRequest("GET", "/render/?format=pdf&width=400&height=300&title=report", nil)
+	params := GetPictureParams(r, results)
+
+	b := MarshalPDF(params, results)
+	if !bytes.HasPrefix(b, []byte("%PDF-")) {
+		t.Fatalf("not a PDF document: %q", b[:10])
+	}
+
+	wide := params
+	wide.Width = 800
+	b = MarshalPDFPages([]PDFPage{
+		{Params: params, Results: results[:1]},
+		{Params: wide, Results: results[1:]},
+	})
+	if !bytes.Contains(b, []byte("/Count 2")) {
+		t.Error("document should have 2 pages")
+	}
+}
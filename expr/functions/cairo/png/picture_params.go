@@ -83,6 +83,61 @@ func getPieMode(s string, def PieMode) PieMode {
 	return PieModeAverage
 }
 
+type GraphType int
+
+const (
+	GraphTypeLine GraphType = iota
+	GraphTypePie
+)
+
+func getGraphType(s string, def GraphType) GraphType {
+	if s == "" {
+		return def
+	}
+	if s == "pie" {
+		return GraphTypePie
+	}
+	return GraphTypeLine
+}
+
+type PieLabels int
+
+const (
+	PieLabelsHorizontal PieLabels = iota
+	PieLabelsRotated
+)
+
+func getPieLabels(s string, def PieLabels) PieLabels {
+	if s == "" {
+		return def
+	}
+	if s == "rotated" {
+		return PieLabelsRotated
+	}
+	return PieLabelsHorizontal
+}
+
+type ValueLabels int
+
+const (
+	ValueLabelsPercent ValueLabels = iota
+	ValueLabelsNumber
+	ValueLabelsNone
+)
+
+func getValueLabels(s string, def ValueLabels) ValueLabels {
+	if s == "" {
+		return def
+	}
+	switch s {
+	case "number":
+		return ValueLabelsNumber
+	case "none":
+		return ValueLabelsNone
+	}
+	return ValueLabelsPercent
+}
+
 func getLineMode(s string, def LineMode) LineMode {
 	if s == "" {
 		return def
@@ -168,6 +223,12 @@ type PictureParams struct {
 	LineWidth      float64
 	ColorList      []string
 
+	GraphType        GraphType
+	PieLabels        PieLabels
+	ValueLabels      ValueLabels
+	ValueLabelsMin   float64
+	ValueLabelsColor string
+
 	YMin    float64
 	YMax    float64
 	XMin    float64
@@ -204,6 +265,12 @@ type PictureParams struct {
 	MajorGridLineColor string
 }
 
+// PDFPage is a graph on a separate page of PDF document
+type PDFPage struct {
+	Params  PictureParams
+	Results []*types.MetricData
+}
+
 // GetPictureParams returns PictureParams with default settings
 func GetPictureParams(r *http.Request, metricData []*types.MetricData) PictureParams {
 	return GetPictureParamsWithTemplate(r, "default", metricData)
@@ -252,6 +319,12 @@ func GetPictureParamsWithTemplate(r *http.Request, template string, metricData [
 		LineWidth:      getFloat64(r.FormValue("lineWidth"), t.LineWidth),
 		ColorList:      getStringArray(r.FormValue("colorList"), t.ColorList),
 
+		GraphType:        getGraphType(r.FormValue("graphType"), t.GraphType),
+		PieLabels:        getPieLabels(r.FormValue("pieLabels"), t.PieLabels),
+		ValueLabels:      getValueLabels(r.FormValue("valueLabels"), t.ValueLabels),
+		ValueLabelsMin:   getFloat64(r.FormValue("valueLabelsMin"), t.ValueLabelsMin),
+		ValueLabelsColor: getString(r.FormValue("valueLabelsColor"), t.ValueLabelsColor),
+
 		YMin:    getFloat64(r.FormValue("yMin"), t.YMin),
 		YMax:    getFloat64(r.FormValue("yMax"), t.YMax),
 		YStep:   getFloat64(r.FormValue("yStep"), t.YStep),
@@ -382,6 +455,12 @@ var DefaultParams = PictureParams{
 	LineWidth:      1.2,
 	ColorList:      DefaultColorList,
 
+	GraphType:        GraphTypeLine,
+	PieLabels:        PieLabelsHorizontal,
+	ValueLabels:      ValueLabelsPercent,
+	ValueLabelsMin:   5,
+	ValueLabelsColor: "black",
+
 	YMin:    math.NaN(),
 	YMax:    math.NaN(),
 	YStep:   math.NaN(),
@@ -455,6 +534,12 @@ var templates = map[string]PictureParams{
 		LineWidth:      1.2,
 		ColorList:      DefaultColorList,
 
+		GraphType:        GraphTypeLine,
+		PieLabels:        PieLabelsHorizontal,
+		ValueLabels:      ValueLabelsPercent,
+		ValueLabelsMin:   5,
+		ValueLabelsColor: "black",
+
 		YMin:    math.NaN(),
 		YMax:    math.NaN(),
 		YStep:   math.NaN(),
@@ -0,0 +1,177 @@
+package png
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/go-graphite/carbonapi/expr/types"
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+)
+
+// pieSlice is a series of the pie graph, same as in graphite-web's PieGraph
+type pieSlice struct {
+	name     string
+	color    string
+	value    float64
+	percent  float64
+	midAngle float64
+}
+
+// pieValue consolidates series into a single value according to pieMode, absent values are ignored
+func pieValue(mode PieMode, values []float64) float64 {
+	var res float64
+	var n int
+	for _, v := range values {
+		if math.IsNaN(v) {
+			continue
+		}
+		switch {
+		case n == 0:
+			res = v
+		case mode == PieModeMaximum:
+			res = math.Max(res, v)
+		case mode == PieModeMinimum:
+			res = math.Min(res, v)
+		default:
+			res += v
+		}
+		n++
+	}
+	if n == 0 {
+		return 0
+	}
+	if mode != PieModeMaximum && mode != PieModeMinimum {
+		res /= float64(n)
+	}
+	return res
+}
+
+// pieSlices computes slices of the pie, colors are assigned by drawPie
+func pieSlices(mode PieMode, results []*types.MetricData) []pieSlice {
+	slices := make([]pieSlice, 0, len(results))
+	var total float64
+	for _, res := range results {
+		s := pieSlice{
+			name:  res.Name,
+			value: pieValue(mode, res.Values),
+		}
+		total += s.value
+		slices = append(slices, s)
+	}
+	if total != 0 {
+		for i := range slices {
+			slices[i].percent = slices[i].value / total
+		}
+	}
+	return slices
+}
+
+// pieValueLabel returns label of the slice or false if slice is too small to be labeled
+func pieValueLabel(s pieSlice, valueLabels ValueLabels, valueLabelsMin float64) (string, bool) {
+	if valueLabels == ValueLabelsNone {
+		return "", false
+	}
+	if valueLabels == ValueLabelsNumber {
+		if s.value < valueLabelsMin {
+			return "", false
+		}
+		if s.value < 10 && s.value != math.Trunc(s.value) {
+			return fmt.Sprintf("%.2f", s.value), true
+		}
+		return strconv.FormatInt(int64(s.value), 10), true
+	}
+	// valueLabelsMin is compared with the percent the same way it's compared with the value in number mode
+	percent := s.percent * 100
+	if percent < valueLabelsMin {
+		return "", false
+	}
+	return fmt.Sprintf("%.2f%%", percent), true
+}
+
+// drawPie draws pie graph the same way graphite-web's PieGraph does
+func drawPie(cr *cairoSurfaceContext, params *Params, results []*types.MetricData) {
+	slices := pieSlices(params.pieMode, results)
+	// series that have color set keep it, others get next color of the colorList
+	var colorsCur int
+	for i, res := range results {
+		slices[i].color = res.Color
+		if slices[i].color == "" {
+			slices[i].color = params.colorList[colorsCur]
+			colorsCur = (colorsCur + 1) % len(params.colorList)
+		}
+	}
+	if len(slices) == 0 {
+		x := params.width / 2.0
+		y := params.height / 2.0
+		setColor(cr, string2RGBA("red"))
+		fontSize := math.Log(params.width * params.height)
+		setFont(cr, params, fontSize)
+		drawText(cr, params, "No Data", x, y, HAlignCenter, VAlignTop, 0)
+		return
+	}
+
+	if params.title != "" {
+		titleSize := params.fontSize + math.Floor(math.Log(params.fontSize))
+		setColor(cr, params.fgColor)
+		setFont(cr, params, titleSize)
+		drawTitle(cr, params)
+	}
+
+	setFont(cr, params, params.fontSize)
+	if !params.hideLegend {
+		legend := make([]*types.MetricData, 0, len(slices))
+		for _, s := range slices {
+			legend = append(legend, &types.MetricData{
+				FetchResponse: pb.FetchResponse{Name: s.name},
+				GraphOptions:  types.GraphOptions{Color: s.color},
+			})
+		}
+		drawLegend(cr, params, legend)
+	}
+
+	alpha := 1.0
+	if !math.IsNaN(params.areaAlpha) {
+		alpha = params.areaAlpha
+	}
+
+	halfX := (params.area.xmax - params.area.xmin) / 2.0
+	halfY := (params.area.ymax - params.area.ymin) / 2.0
+	x0 := params.area.xmin + halfX
+	y0 := params.area.ymin + halfY
+	radius := math.Min(halfX, halfY) * 0.95
+
+	theta := 3.0 * math.Pi / 2.0
+	for i := range slices {
+		s := &slices[i]
+		setColorAlpha(cr, string2RGBA(s.color), alpha)
+		cr.context.MoveTo(x0, y0)
+		phi := theta + 2*math.Pi*s.percent
+		cr.context.Arc(x0, y0, radius, theta, phi)
+		cr.context.LineTo(x0, y0)
+		cr.context.Fill()
+		s.midAngle = math.Mod((theta+phi)/2.0, 2.0*math.Pi)
+		theta = phi
+	}
+
+	setFont(cr, params, params.fontSize)
+	setColor(cr, params.valueLabelsColor)
+	for _, s := range slices {
+		label, ok := pieValueLabel(s, params.valueLabels, params.valueLabelsMin)
+		if !ok {
+			continue
+		}
+		theta := s.midAngle
+		x := x0 + radius/2.0*math.Cos(theta)
+		y := y0 + radius/2.0*math.Sin(theta)
+
+		var rotate float64
+		if params.pieLabels == PieLabelsRotated {
+			if theta > math.Pi/2.0 && theta <= 3.0*math.Pi/2.0 {
+				theta -= math.Pi
+			}
+			rotate = theta * 180 / math.Pi
+		}
+		drawText(cr, params, label, x, y, HAlignCenter, VAlignCenter, rotate)
+	}
+}
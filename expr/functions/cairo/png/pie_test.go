@@ -0,0 +1,95 @@
+package png
+
+import (
+	"math"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-graphite/carbonapi/expr/types"
+)
+
+func TestPieValue(t *testing.T) {
+	values := []float64{1, math.NaN(), 5, 3}
+	tests := []struct {
+		mode PieMode
+		want float64
+	}{
+		{PieModeAverage, 3},
+		{PieModeMaximum, 5},
+		{PieModeMinimum, 1},
+	}
+	for _, tt := range tests {
+		if got := pieValue(tt.mode, values); got != tt.want {
+			t.Errorf("mode %v: got %v, want %v", tt.mode, got, tt.want)
+		}
+	}
+
+	if got := pieValue(PieModeAverage, []float64{math.NaN()}); got != 0 {
+		t.Errorf("series without values should be 0, got %v", got)
+	}
+}
+
+func TestPieSlices(t *testing.T) {
+	results := []*types.MetricData{
+		types.MakeMetricData("a", []float64{1, 5}, 60, 0),
+		types.MakeMetricData("b", []float64{2, 2}, 60, 0),
+		types.MakeMetricData("c", []float64{6, math.NaN()}, 60, 0),
+		types.MakeMetricData("d", []float64{0, 0}, 60, 0),
+	}
+
+	slices := pieSlices(PieModeAverage, results)
+	want := []pieSlice{
+		{name: "a", value: 3, percent: 3.0 / 11},
+		{name: "b", value: 2, percent: 2.0 / 11},
+		{name: "c", value: 6, percent: 6.0 / 11},
+		{name: "d", value: 0, percent: 0},
+	}
+	if len(slices) != len(want) {
+		t.Fatalf("got %v slices, want %v", len(slices), len(want))
+	}
+	for i := range want {
+		if slices[i] != want[i] {
+			t.Errorf("slice %v: got %+v, want %+v", i, slices[i], want[i])
+		}
+	}
+}
+
+func TestPieValueLabel(t *testing.T) {
+	tests := []struct {
+		slice       pieSlice
+		valueLabels ValueLabels
+		min         float64
+		want        string
+		ok          bool
+	}{
+		{pieSlice{value: 30, percent: 0.299}, ValueLabelsPercent, 5, "29.90%", true},
+		// percent, not the value, is compared with valueLabelsMin
+		{pieSlice{value: 3, percent: 0.5}, ValueLabelsPercent, 5, "50.00%", true},
+		{pieSlice{value: 300, percent: 0.04}, ValueLabelsPercent, 5, "", false},
+		{pieSlice{value: 300, percent: 0.04}, ValueLabelsPercent, 0, "4.00%", true},
+		{pieSlice{value: 3}, ValueLabelsNumber, 5, "", false},
+		{pieSlice{value: 1234.5}, ValueLabelsNumber, 5, "1234", true},
+		{pieSlice{value: 7.125}, ValueLabelsNumber, 5, "7.12", true},
+		{pieSlice{value: 7}, ValueLabelsNumber, 5, "7", true},
+		{pieSlice{value: 30, percent: 0.3}, ValueLabelsNone, 5, "", false},
+	}
+	for _, tt := range tests {
+		got, ok := pieValueLabel(tt.slice, tt.valueLabels, tt.min)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%+v, %v: got %q, %v, want %q, %v", tt.slice, tt.valueLabels, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestPieParams(t *testing.T) {
+	r := httptest.NewRequest("GET", "/render/?graphType=pie&pieLabels=rotated&valueLabels=number&valueLabelsMin=0", nil)
+	p := GetPictureParams(r, nil)
+	if p.GraphType != GraphTypePie || p.PieLabels != PieLabelsRotated || p.ValueLabels != ValueLabelsNumber || p.ValueLabelsMin != 0 {
+		t.Errorf("unexpected params %+v", p)
+	}
+
+	p = GetPictureParams(httptest.NewRequest("GET", "/render/", nil), nil)
+	if p.GraphType != GraphTypeLine || p.ValueLabels != ValueLabelsPercent || p.ValueLabelsMin != 5 || p.ValueLabelsColor != "black" {
+		t.Errorf("unexpected defaults %+v", p)
+	}
+}
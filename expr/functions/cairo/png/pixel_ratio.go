@@ -4,54 +4,11 @@ package png
 
 import "github.com/evmar/gocairo/cairo"
 
-// interface with all used cairo.Context methods
-type cairoContext interface {
-	Rectangle(x, y, width, height float64) // pixel ratio required
-	GetLineWidth() float64                 // pixel ratio required
-	LineTo(x, y float64)                   // pixel ratio required
-	MoveTo(x, y float64)                   // pixel ratio required
-	SetLineWidth(width float64)            // pixel ratio required
-	SetFontSize(size float64)              // pixel ratio required
-	SetFontOptions(options *cairo.FontOptions)
-	Stroke()
-	SetDash(dashes []float64, offset float64)            // pixel ratio required
-	TextExtents(utf8 string, extents *cairo.TextExtents) // pixel ratio required
-	FontExtents(extents *cairo.FontExtents)              // pixel ratio required
-	Rotate(angle float64)
-	SetLineCap(lineCap cairo.LineCap)
-	SetLineJoin(lineJoin cairo.LineJoin)
-	RelMoveTo(dx, dy float64) // pixel ratio required
-	SetSourceRGBA(red, green, blue, alpha float64)
-	SetMatrix(matrix *cairo.Matrix) // pixel ratio required
-	GetMatrix(matrix *cairo.Matrix) // pixel ratio required
-	Clip()
-	Fill()
-	ClosePath()
-	SelectFontFace(family string, slant cairo.FontSlant, weight cairo.FontWeight) // pixel ratio required
-	TextPath(utf8 string)
-	Save()
-	Restore()
-	FillPreserve()
-	AppendPath(path *cairo.Path)
-	CopyPath() *cairo.Path
-}
-
 type pixelRatioContext struct {
 	*cairo.Context
 	pr float64 // pixel ratio
 }
 
-type cairoSurfaceContext struct {
-	context cairoContext
-}
-
-func isDefaultRatio(pixelRatio float64) bool {
-	if pixelRatio > 0.9999 && pixelRatio < 1.0001 {
-		return true
-	}
-	return false
-}
-
 func svgSurfaceCreate(filename string, widthInPoints, heightInPoints float64, pixelRatio float64) *cairo.SVGSurface {
 	if isDefaultRatio(pixelRatio) {
 		return cairo.SVGSurfaceCreate(filename, widthInPoints, heightInPoints)
@@ -91,6 +48,10 @@ func (c *pixelRatioContext) LineTo(x, y float64) {
 	c.Context.LineTo(c.pr*x, c.pr*y)
 }
 
+func (c *pixelRatioContext) Arc(xc, yc, radius, angle1, angle2 float64) {
+	c.Context.Arc(c.pr*xc, c.pr*yc, c.pr*radius, angle1, angle2)
+}
+
 func (c *pixelRatioContext) MoveTo(x, y float64) {
 	c.Context.MoveTo(c.pr*x, c.pr*y)
 }
@@ -0,0 +1,466 @@
+// +build !cairo
+
+package png
+
+import (
+	"image"
+	"math"
+	"sort"
+)
+
+// subsamples is a number of scanlines per pixel used for antialiasing
+const subsamples = 4
+
+// miterLimit is the same as cairo's default
+const miterLimit = 10.0
+
+// mask is a coverage of the rectangle of the image, values are in [0, 1]
+type mask struct {
+	x, y, w, h int
+	a          []float32
+}
+
+func (m *mask) at(x, y int) float32 {
+	if x < m.x || y < m.y || x >= m.x+m.w || y >= m.y+m.h {
+		return 0
+	}
+	return m.a[(y-m.y)*m.w+x-m.x]
+}
+
+// rasterPainter draws on the RGBA image with nonzero winding rule, same as cairo's default fill rule
+type rasterPainter struct {
+	img   *image.RGBA
+	clips []*mask
+}
+
+func newRasterPainter(width, height int) *rasterPainter {
+	return &rasterPainter{
+		img: image.NewRGBA(image.Rect(0, 0, width, height)),
+		// id 0 means no clip
+		clips: []*mask{nil},
+	}
+}
+
+func (p *rasterPainter) fill(path *cairoPath, state *gstate) {
+	if state.a <= 0 {
+		return
+	}
+	polys := pathPolygons(path)
+	for _, t := range path.texts {
+		polys = append(polys, textPolygons(t)...)
+	}
+	p.composite(p.rasterize(polys), state)
+}
+
+func (p *rasterPainter) stroke(path *cairoPath, state *gstate) {
+	if state.a <= 0 {
+		return
+	}
+	scale := state.matrix.scale()
+	hw := state.lineWidth * scale / 2
+	var dashes []float64
+	for _, d := range state.dashes {
+		dashes = append(dashes, d*scale)
+	}
+
+	var polys [][]point
+	for _, s := range path.subpaths {
+		points := s.points
+		closed := s.closed
+		if len(dashes) > 0 {
+			if closed {
+				points = append(append([]point(nil), points...), points[0])
+				closed = false
+			}
+			for _, dash := range dashPolyline(points, dashes, state.dashOffset*scale) {
+				polys = append(polys, strokePolygons(dash, false, hw, state.lineCap, state.lineJoin)...)
+			}
+			continue
+		}
+		polys = append(polys, strokePolygons(points, closed, hw, state.lineCap, state.lineJoin)...)
+	}
+	p.composite(p.rasterize(polys), state)
+}
+
+func (p *rasterPainter) clip(path *cairoPath, state *gstate) int {
+	b := p.img.Bounds()
+	res := &mask{w: b.Dx(), h: b.Dy(), a: make([]float32, b.Dx()*b.Dy())}
+	if m := p.rasterize(pathPolygons(path)); m != nil {
+		parent := p.clips[state.clip]
+		for y := m.y; y < m.y+m.h; y++ {
+			for x := m.x; x < m.x+m.w; x++ {
+				c := m.at(x, y)
+				if parent != nil {
+					c *= parent.at(x, y)
+				}
+				res.a[y*res.w+x] = c
+			}
+		}
+	}
+	p.clips = append(p.clips, res)
+	return len(p.clips) - 1
+}
+
+// composite blends source color over the image using coverage mask and the current clip
+func (p *rasterPainter) composite(m *mask, state *gstate) {
+	if m == nil {
+		return
+	}
+	clip := p.clips[state.clip]
+	r, g, b := state.r*255, state.g*255, state.b*255
+	for y := m.y; y < m.y+m.h; y++ {
+		for x := m.x; x < m.x+m.w; x++ {
+			c := float64(m.at(x, y))
+			if c <= 0 {
+				continue
+			}
+			if c > 1 {
+				c = 1
+			}
+			if clip != nil {
+				c *= float64(clip.at(x, y))
+			}
+			alpha := c * state.a
+			if alpha <= 0 {
+				continue
+			}
+			i := p.img.PixOffset(x, y)
+			pix := p.img.Pix[i : i+4 : i+4]
+			pix[0] = uint8(math.Round(r*alpha + float64(pix[0])*(1-alpha)))
+			pix[1] = uint8(math.Round(g*alpha + float64(pix[1])*(1-alpha)))
+			pix[2] = uint8(math.Round(b*alpha + float64(pix[2])*(1-alpha)))
+			pix[3] = uint8(math.Round(255*alpha + float64(pix[3])*(1-alpha)))
+		}
+	}
+}
+
+type edge struct {
+	x0, y0, x1, y1 float64
+	dir            int
+}
+
+type crossing struct {
+	x   float64
+	dir int
+}
+
+// rasterize computes coverage of polygons with nonzero winding rule
+func (p *rasterPainter) rasterize(polys [][]point) *mask {
+	b := p.img.Bounds()
+	var edges []edge
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, poly := range polys {
+		for i := range poly {
+			a, c := poly[i], poly[(i+1)%len(poly)]
+			if math.IsNaN(a.x) || math.IsNaN(a.y) || math.IsNaN(c.x) || math.IsNaN(c.y) || a.y == c.y {
+				continue
+			}
+			e := edge{x0: a.x, y0: a.y, x1: c.x, y1: c.y, dir: 1}
+			if a.y > c.y {
+				e = edge{x0: c.x, y0: c.y, x1: a.x, y1: a.y, dir: -1}
+			}
+			edges = append(edges, e)
+			minX, maxX = math.Min(minX, math.Min(a.x, c.x)), math.Max(maxX, math.Max(a.x, c.x))
+			minY, maxY = math.Min(minY, e.y0), math.Max(maxY, e.y1)
+		}
+	}
+	if len(edges) == 0 {
+		return nil
+	}
+
+	x0 := int(math.Max(math.Floor(minX), 0))
+	x1 := int(math.Min(math.Ceil(maxX), float64(b.Dx())))
+	y0 := int(math.Max(math.Floor(minY), 0))
+	y1 := int(math.Min(math.Ceil(maxY), float64(b.Dy())))
+	if x0 >= x1 || y0 >= y1 {
+		return nil
+	}
+	m := &mask{x: x0, y: y0, w: x1 - x0, h: y1 - y0}
+	m.a = make([]float32, m.w*m.h)
+
+	sort.Slice(edges, func(i, j int) bool { return edges[i].y0 < edges[j].y0 })
+	var active []edge
+	var crossings []crossing
+	next := 0
+	for y := y0; y < y1; y++ {
+		row := m.a[(y-y0)*m.w : (y-y0+1)*m.w]
+		for s := 0; s < subsamples; s++ {
+			sy := float64(y) + (float64(s)+0.5)/subsamples
+			for next < len(edges) && edges[next].y0 <= sy {
+				active = append(active, edges[next])
+				next++
+			}
+			crossings = crossings[:0]
+			n := 0
+			for _, e := range active {
+				if e.y1 <= sy {
+					continue
+				}
+				active[n] = e
+				n++
+				if e.y0 > sy {
+					continue
+				}
+				x := e.x0 + (sy-e.y0)*(e.x1-e.x0)/(e.y1-e.y0)
+				crossings = append(crossings, crossing{x: x, dir: e.dir})
+			}
+			active = active[:n]
+			sort.Slice(crossings, func(i, j int) bool { return crossings[i].x < crossings[j].x })
+
+			winding := 0
+			for i, c := range crossings {
+				winding += c.dir
+				if winding != 0 && i+1 < len(crossings) {
+					addSpan(row, c.x-float64(x0), crossings[i+1].x-float64(x0), 1.0/subsamples)
+				}
+			}
+		}
+	}
+	return m
+}
+
+// addSpan adds coverage of the horizontal span to the row, partially covered pixels get partial coverage
+func addSpan(row []float32, xa, xb float64, weight float32) {
+	xa = math.Max(xa, 0)
+	xb = math.Min(xb, float64(len(row)))
+	if xa >= xb {
+		return
+	}
+	ia, ib := int(xa), int(xb)
+	if ia == ib {
+		row[ia] += float32(xb-xa) * weight
+		return
+	}
+	row[ia] += float32(float64(ia+1)-xa) * weight
+	for i := ia + 1; i < ib; i++ {
+		row[i] += weight
+	}
+	if ib < len(row) {
+		row[ib] += float32(xb-float64(ib)) * weight
+	}
+}
+
+// pathPolygons returns subpaths as polygons, all of them are implicitly closed for filling
+func pathPolygons(path *cairoPath) [][]point {
+	polys := make([][]point, 0, len(path.subpaths))
+	for _, s := range path.subpaths {
+		if len(s.points) > 2 {
+			polys = append(polys, s.points)
+		}
+	}
+	return polys
+}
+
+// textPolygons converts glyph runs to device space, bitmap font is aligned to the pixel grid when text isn't rotated
+func textPolygons(t textRun) [][]point {
+	origin := t.origin
+	if t.matrix.Xy == 0 && t.matrix.Yx == 0 {
+		origin = point{math.Round(origin.x), math.Round(origin.y)}
+	}
+	var slant, bold float64
+	if t.slant == cairoFontSlantItalic {
+		slant = 0.2
+	}
+	if t.weight == cairoFontWeightBold {
+		bold = 0.5
+	}
+	transform := func(x, y float64) point {
+		dx, dy := t.matrix.transformDistance(x-y*slant, y)
+		return point{origin.x + dx, origin.y + dy}
+	}
+	rects := textRects(t.text)
+	polys := make([][]point, 0, len(rects))
+	for _, r := range rects {
+		polys = append(polys, []point{
+			transform(r.x0, r.y0),
+			transform(r.x1+bold, r.y0),
+			transform(r.x1+bold, r.y1),
+			transform(r.x0, r.y1),
+		})
+	}
+	return polys
+}
+
+// dashPolyline splits polyline into dashes, odd number of dashes is repeated as cairo does
+func dashPolyline(points []point, dashes []float64, offset float64) [][]point {
+	var total float64
+	for _, d := range dashes {
+		if d < 0 {
+			return [][]point{points}
+		}
+		total += d
+	}
+	if total <= 0 || len(points) < 2 {
+		return [][]point{points}
+	}
+	if len(dashes)%2 == 1 {
+		total *= 2
+	}
+
+	idx, on, remain := 0, true, dashes[0]
+	for offset = math.Mod(offset, total); offset > 0; {
+		if offset < remain {
+			remain -= offset
+			break
+		}
+		offset -= remain
+		idx = (idx + 1) % len(dashes)
+		on = !on
+		remain = dashes[idx]
+	}
+
+	var res [][]point
+	var cur []point
+	if on {
+		cur = []point{points[0]}
+	}
+	for i := 1; i < len(points); i++ {
+		a, b := points[i-1], points[i]
+		l := math.Hypot(b.x-a.x, b.y-a.y)
+		if l == 0 {
+			continue
+		}
+		for t := 0.0; t < l; {
+			step := math.Min(remain, l-t)
+			t += step
+			remain -= step
+			pt := point{a.x + (b.x-a.x)*t/l, a.y + (b.y-a.y)*t/l}
+			if on {
+				cur = append(cur, pt)
+			}
+			if remain <= 1e-9 {
+				if on {
+					if len(cur) > 1 {
+						res = append(res, cur)
+					}
+					cur = nil
+				} else {
+					cur = []point{pt}
+				}
+				on = !on
+				idx = (idx + 1) % len(dashes)
+				remain = dashes[idx]
+			}
+		}
+	}
+	if on && len(cur) > 1 {
+		res = append(res, cur)
+	}
+	return res
+}
+
+// strokePolygons returns outline of the polyline of the given half width, all polygons have the same orientation
+// so they are united by the nonzero winding rule
+func strokePolygons(points []point, closed bool, hw float64, lineCap cairoLineCap, lineJoin cairoLineJoin) [][]point {
+	pts := make([]point, 0, len(points)+1)
+	for _, pt := range points {
+		if math.IsNaN(pt.x) || math.IsNaN(pt.y) {
+			continue
+		}
+		if n := len(pts); n > 0 && math.Abs(pts[n-1].x-pt.x) < 1e-9 && math.Abs(pts[n-1].y-pt.y) < 1e-9 {
+			continue
+		}
+		pts = append(pts, pt)
+	}
+	if closed && len(pts) > 2 {
+		pts = append(pts, pts[0])
+	} else {
+		closed = false
+	}
+	if len(pts) < 2 || hw <= 0 {
+		return nil
+	}
+
+	segments := len(pts) - 1
+	dirs := make([]point, segments)
+	for i := 0; i < segments; i++ {
+		a, b := pts[i], pts[i+1]
+		l := math.Hypot(b.x-a.x, b.y-a.y)
+		dirs[i] = point{(b.x - a.x) / l, (b.y - a.y) / l}
+	}
+
+	polys := make([][]point, 0, 2*segments)
+	for i, d := range dirs {
+		a, b := pts[i], pts[i+1]
+		if !closed && lineCap != cairoLineCapButt {
+			if i == 0 {
+				a = point{a.x - d.x*hw, a.y - d.y*hw}
+			}
+			if i == segments-1 {
+				b = point{b.x + d.x*hw, b.y + d.y*hw}
+			}
+		}
+		n := point{-d.y * hw, d.x * hw}
+		polys = append(polys, orient([]point{
+			{a.x + n.x, a.y + n.y},
+			{b.x + n.x, b.y + n.y},
+			{b.x - n.x, b.y - n.y},
+			{a.x - n.x, a.y - n.y},
+		}))
+	}
+
+	join := func(at point, d1, d2 point) {
+		cross := d1.x*d2.y - d1.y*d2.x
+		if math.Abs(cross) < 1e-9 {
+			return
+		}
+		// join is on the outer side of the turn
+		k := hw
+		if cross > 0 {
+			k = -hw
+		}
+		o1 := point{-d1.y * k, d1.x * k}
+		o2 := point{-d2.y * k, d2.x * k}
+		p1 := point{at.x + o1.x, at.y + o1.y}
+		p2 := point{at.x + o2.x, at.y + o2.y}
+		switch lineJoin {
+		case cairoLineJoinRound:
+			a1, a2 := math.Atan2(o1.y, o1.x), math.Atan2(o2.y, o2.x)
+			for a2-a1 > math.Pi {
+				a2 -= 2 * math.Pi
+			}
+			for a1-a2 > math.Pi {
+				a2 += 2 * math.Pi
+			}
+			poly := []point{at}
+			for i := 0; i <= 8; i++ {
+				sin, cos := math.Sincos(a1 + (a2-a1)*float64(i)/8)
+				poly = append(poly, point{at.x + cos*hw, at.y + sin*hw})
+			}
+			polys = append(polys, orient(poly))
+			return
+		case cairoLineJoinMiter:
+			m := point{(o1.x + o2.x) / 2, (o1.y + o2.y) / 2}
+			l2 := m.x*m.x + m.y*m.y
+			if l2 > 0 && hw*hw/l2 <= miterLimit*miterLimit {
+				f := hw * hw / l2
+				polys = append(polys, orient([]point{at, p1, {at.x + m.x*f, at.y + m.y*f}, p2}))
+				return
+			}
+		}
+		polys = append(polys, orient([]point{at, p1, p2}))
+	}
+	for i := 1; i < segments; i++ {
+		join(pts[i], dirs[i-1], dirs[i])
+	}
+	if closed {
+		join(pts[0], dirs[segments-1], dirs[0])
+	}
+	return polys
+}
+
+// orient makes polygon's signed area positive
+func orient(poly []point) []point {
+	var area float64
+	for i := range poly {
+		a, b := poly[i], poly[(i+1)%len(poly)]
+		area += a.x*b.y - b.x*a.y
+	}
+	if area < 0 {
+		for i, j := 0, len(poly)-1; i < j; i, j = i+1, j-1 {
+			poly[i], poly[j] = poly[j], poly[i]
+		}
+	}
+	return poly
+}
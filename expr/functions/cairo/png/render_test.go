@@ -0,0 +1,258 @@
+// +build !cairo
+
+package png
+
+import (
+	"bytes"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-graphite/carbonapi/expr/types"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+func goldenSeries() []*types.MetricData {
+	var sin, cos, saw []float64
+	for i := 0; i < 60; i++ {
+		sin = append(sin, 10+5*math.Sin(float64(i)/5))
+		cos = append(cos, 8+3*math.Cos(float64(i)/7))
+		saw = append(saw, float64(i%13))
+	}
+	cos[20] = math.NaN()
+	return []*types.MetricData{
+		types.MakeMetricData("metric.sin", sin, 60, 1600000000),
+		types.MakeMetricData("metric.cos", cos, 60, 1600000000),
+		types.MakeMetricData("metric.saw", saw, 60, 1600000000),
+	}
+}
+
+func TestMarshalGolden(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		setup func(results []*types.MetricData)
+	}{
+		{
+			name:  "line",
+			query: "title=Requests&vtitle=rps&colorList=red,green,blue",
+		},
+		{
+			name:  "area_all",
+			query: "areaMode=all&areaAlpha=0.5&hideLegend=true&lineWidth=2",
+		},
+		{
+			name:  "stacked",
+			query: "areaMode=stacked&bgcolor=white&fgcolor=black",
+		},
+		{
+			name:  "second_y_axis",
+			query: "vtitleRight=saw&yMinRight=0",
+			setup: func(results []*types.MetricData) {
+				results[1].Color = "orange"
+				results[1].Dashed = 5
+				results[2].SecondYAxis = true
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for ext, marshal := range map[string]func(PictureParams, []*types.MetricData) []byte{
+				"png": MarshalPNG,
+				"svg": MarshalSVG,
+			} {
+				results := goldenSeries()
+				if tt.setup != nil {
+					tt.setup(results)
+				}
+				r := httptest.NewRequest("GET", "/render/?tz=UTC&"+tt.query, nil)
+				got := marshal(GetPictureParams(r, results), results)
+
+				golden := filepath.Join("testdata", tt.name+"."+ext)
+				if *update {
+					if err := ioutil.WriteFile(golden, got, 0644); err != nil {
+						t.Fatal(err)
+					}
+					continue
+				}
+				want, err := ioutil.ReadFile(golden)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if ext == "png" {
+					err = comparePNG(got, want)
+				} else {
+					err = compareSVG(got, want)
+				}
+				if err != nil {
+					t.Errorf("%s differs from the golden file: %v, run tests with -update if the change is expected", golden, err)
+				}
+			}
+		})
+	}
+}
+
+const (
+	// pngChannelTolerance is the difference of a color channel (0-255) that is allowed for antialiasing and rounding
+	pngChannelTolerance = 16
+	// pngPixelTolerance is the share of pixels that may differ more than pngChannelTolerance
+	pngPixelTolerance = 0.002
+	// svgNumberTolerance is the difference of coordinates and sizes that is allowed in SVG attributes
+	svgNumberTolerance = 0.05
+)
+
+// comparePNG compares decoded images, so that encoder settings and small rendering differences don't fail the test
+func comparePNG(got, want []byte) error {
+	gotImg, err := png.Decode(bytes.NewReader(got))
+	if err != nil {
+		return fmt.Errorf("failed to decode rendered image: %v", err)
+	}
+	wantImg, err := png.Decode(bytes.NewReader(want))
+	if err != nil {
+		return fmt.Errorf("failed to decode golden image: %v", err)
+	}
+	bounds := wantImg.Bounds()
+	if gotImg.Bounds() != bounds {
+		return fmt.Errorf("size is %v, want %v", gotImg.Bounds(), bounds)
+	}
+
+	var differ int
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r1, g1, b1, a1 := gotImg.At(x, y).RGBA()
+			r2, g2, b2, a2 := wantImg.At(x, y).RGBA()
+			for _, d := range []int{int(r1) - int(r2), int(g1) - int(g2), int(b1) - int(b2), int(a1) - int(a2)} {
+				// RGBA returns 16-bit channels
+				if d>>8 > pngChannelTolerance || -d>>8 > pngChannelTolerance {
+					differ++
+					break
+				}
+			}
+		}
+	}
+	if share := float64(differ) / float64(bounds.Dx()*bounds.Dy()); share > pngPixelTolerance {
+		return fmt.Errorf("%d pixels (%.2f%%) differ", differ, share*100)
+	}
+	return nil
+}
+
+var svgNumberRe = regexp.MustCompile(`-?[0-9]+(\.[0-9]+)?`)
+
+// compareSVG compares elements, attributes and text of the documents, numbers in attributes are compared with
+// svgNumberTolerance, so that formatting of coordinates doesn't matter
+func compareSVG(got, want []byte) error {
+	gotTokens, err := svgTokens(got)
+	if err != nil {
+		return fmt.Errorf("failed to parse rendered document: %v", err)
+	}
+	wantTokens, err := svgTokens(want)
+	if err != nil {
+		return fmt.Errorf("failed to parse golden document: %v", err)
+	}
+	if len(gotTokens) != len(wantTokens) {
+		return fmt.Errorf("document has %d elements, want %d", len(gotTokens), len(wantTokens))
+	}
+	for i := range wantTokens {
+		if !svgValuesEqual(gotTokens[i], wantTokens[i]) {
+			return fmt.Errorf("element %d is %q, want %q", i, gotTokens[i], wantTokens[i])
+		}
+	}
+	return nil
+}
+
+// svgTokens returns start elements with their attributes and text as strings, in the order of the document
+func svgTokens(b []byte) ([]string, error) {
+	var res []string
+	d := xml.NewDecoder(bytes.NewReader(b))
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return res, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			s := tok.Name.Local
+			for _, a := range tok.Attr {
+				s += " " + a.Name.Local + "=" + a.Value
+			}
+			res = append(res, s)
+		case xml.CharData:
+			if text := strings.TrimSpace(string(tok)); text != "" {
+				res = append(res, text)
+			}
+		}
+	}
+}
+
+func svgValuesEqual(got, want string) bool {
+	if svgNumberRe.ReplaceAllString(got, "0") != svgNumberRe.ReplaceAllString(want, "0") {
+		return false
+	}
+	gotNumbers := svgNumberRe.FindAllString(got, -1)
+	for i, w := range svgNumberRe.FindAllString(want, -1) {
+		g, _ := strconv.ParseFloat(gotNumbers[i], 64)
+		v, _ := strconv.ParseFloat(w, 64)
+		if math.Abs(g-v) > svgNumberTolerance {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRasterizeRectangle(t *testing.T) {
+	p := newRasterPainter(10, 10)
+	c := newCanvas(p, 1)
+	c.SetSourceRGBA(1, 0, 0, 1)
+	c.Rectangle(2, 2, 4, 2.5)
+	c.Fill()
+
+	tests := []struct {
+		x, y  int
+		alpha uint8
+	}{
+		{1, 2, 0},
+		{2, 2, 255},
+		{5, 3, 255},
+		{6, 3, 0},
+		{3, 4, 128},
+		{3, 5, 0},
+	}
+	for _, tt := range tests {
+		if got := p.img.RGBAAt(tt.x, tt.y).A; got != tt.alpha {
+			t.Errorf("pixel %v,%v: got alpha %v, want %v", tt.x, tt.y, got, tt.alpha)
+		}
+	}
+}
+
+func TestDashPolyline(t *testing.T) {
+	dashes := dashPolyline([]point{{0, 0}, {10, 0}}, []float64{3}, 1)
+	want := [][]point{
+		{{0, 0}, {2, 0}},
+		{{5, 0}, {8, 0}},
+	}
+	if len(dashes) != len(want) {
+		t.Fatalf("got %v dashes, want %v", dashes, want)
+	}
+	for i := range want {
+		for j := range want[i] {
+			if math.Abs(dashes[i][j].x-want[i][j].x) > 1e-9 || dashes[i][j].y != want[i][j].y {
+				t.Errorf("dash %v: got %v, want %v", i, dashes[i], want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,134 @@
+// +build !cairo
+
+package png
+
+import (
+	"bytes"
+	"image/png"
+	"math"
+
+	"github.com/go-graphite/carbonapi/expr/types"
+)
+
+// Without cairo graphs are drawn by the pure-Go renderer, which mimics the subset of cairo API that is used
+// by the graph code. Types below have the same fields as their cairo counterparts.
+
+type cairoFontExtents struct {
+	Ascent      float64
+	Descent     float64
+	Height      float64
+	MaxXAdvance float64
+	MaxYAdvance float64
+}
+
+type cairoTextExtents struct {
+	XBearing float64
+	YBearing float64
+	Width    float64
+	Height   float64
+	XAdvance float64
+	YAdvance float64
+}
+
+type cairoMatrix struct {
+	Xx float64
+	Yx float64
+	Xy float64
+	Yy float64
+	X0 float64
+	Y0 float64
+}
+
+// cairoFontOptions has nothing to configure, text is always drawn with the bitmap font
+type cairoFontOptions struct{}
+
+type cairoFontSlant int
+
+const (
+	cairoFontSlantNormal cairoFontSlant = iota
+	cairoFontSlantItalic
+)
+
+type cairoFontWeight int
+
+const (
+	cairoFontWeightNormal cairoFontWeight = iota
+	cairoFontWeightBold
+)
+
+type cairoLineCap int
+
+const (
+	cairoLineCapButt cairoLineCap = iota
+	cairoLineCapRound
+	cairoLineCapSquare
+)
+
+type cairoLineJoin int
+
+const (
+	cairoLineJoinMiter cairoLineJoin = iota
+	cairoLineJoinRound
+	cairoLineJoinBevel
+)
+
+func fontOptionsNoAntialias() *cairoFontOptions {
+	return &cairoFontOptions{}
+}
+
+func marshalCairo(p PictureParams, results []*types.MetricData, backend cairoBackend) []byte {
+	params := newParams(p)
+
+	width, height := params.width, params.height
+	if !isDefaultRatio(params.pixelRatio) {
+		width *= params.pixelRatio
+		height *= params.pixelRatio
+	}
+
+	var surface painter
+	switch backend {
+	case cairoSVG:
+		surface = newSVGPainter(width, height)
+	default:
+		surface = newRasterPainter(int(width), int(height))
+	}
+	cr := &cairoSurfaceContext{context: newCanvas(surface, params.pixelRatio)}
+
+	drawPicture(cr, &params, results)
+
+	switch s := surface.(type) {
+	case *svgPainter:
+		return s.bytes()
+	case *rasterPainter:
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, s.img); err != nil {
+			return nil
+		}
+		return buf.Bytes()
+	}
+	return nil
+}
+
+// HavePDFSupport is false as the pure-Go renderer can't produce PDF, format=pdf is rejected by carbonapi
+const HavePDFSupport = false
+
+// MarshalPDFPages is not supported by the pure-Go renderer
+// skipcq: CRT-P0003
+func MarshalPDFPages(pages []PDFPage) []byte {
+	return nil
+}
+
+// matrix helpers, same semantics as cairo_matrix_*
+
+func (m *cairoMatrix) transformPoint(x, y float64) (float64, float64) {
+	return m.Xx*x + m.Xy*y + m.X0, m.Yx*x + m.Yy*y + m.Y0
+}
+
+func (m *cairoMatrix) transformDistance(dx, dy float64) (float64, float64) {
+	return m.Xx*dx + m.Xy*dy, m.Yx*dx + m.Yy*dy
+}
+
+// scale returns how much lengths are scaled by the matrix, used for line widths and dashes
+func (m *cairoMatrix) scale() float64 {
+	return math.Sqrt(math.Abs(m.Xx*m.Yy - m.Xy*m.Yx))
+}
@@ -0,0 +1,170 @@
+// +build !cairo
+
+package png
+
+import (
+	"bytes"
+	"encoding/xml"
+	"math"
+	"strconv"
+)
+
+// svgPainter writes every drawing operation as SVG element, clips are clipPath elements which refer to their parents
+type svgPainter struct {
+	buf   bytes.Buffer
+	clips int
+}
+
+func newSVGPainter(width, height float64) *svgPainter {
+	p := &svgPainter{}
+	p.buf.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	p.buf.WriteString(`<svg xmlns="http://www.w3.org/2000/svg" width="` + svgNumber(width) + `px" height="` + svgNumber(height) +
+		`px" viewBox="0 0 ` + svgNumber(width) + " " + svgNumber(height) + `" version="1.1">` + "\n")
+	return p
+}
+
+func (p *svgPainter) bytes() []byte {
+	p.buf.WriteString("</svg>\n")
+	return p.buf.Bytes()
+}
+
+func (p *svgPainter) fill(path *cairoPath, state *gstate) {
+	if state.a <= 0 {
+		return
+	}
+	if d := svgPathData(path); d != "" {
+		p.buf.WriteString(`<path d="` + d + `" fill-rule="nonzero"`)
+		p.writePaint("fill", state)
+		p.writeClip(state.clip)
+		p.buf.WriteString("/>\n")
+	}
+	for _, t := range path.texts {
+		p.writeText(t, state)
+	}
+}
+
+func (p *svgPainter) stroke(path *cairoPath, state *gstate) {
+	d := svgPathData(path)
+	if state.a <= 0 || d == "" {
+		return
+	}
+	scale := state.matrix.scale()
+	p.buf.WriteString(`<path d="` + d + `" fill="none"`)
+	p.writePaint("stroke", state)
+	p.buf.WriteString(` stroke-width="` + svgNumber(state.lineWidth*scale) + `"`)
+	switch state.lineCap {
+	case cairoLineCapRound:
+		p.buf.WriteString(` stroke-linecap="round"`)
+	case cairoLineCapSquare:
+		p.buf.WriteString(` stroke-linecap="square"`)
+	}
+	switch state.lineJoin {
+	case cairoLineJoinRound:
+		p.buf.WriteString(` stroke-linejoin="round"`)
+	case cairoLineJoinBevel:
+		p.buf.WriteString(` stroke-linejoin="bevel"`)
+	}
+	if len(state.dashes) > 0 {
+		p.buf.WriteString(` stroke-dasharray="`)
+		for i, v := range state.dashes {
+			if i > 0 {
+				p.buf.WriteByte(',')
+			}
+			p.buf.WriteString(svgNumber(v * scale))
+		}
+		p.buf.WriteString(`" stroke-dashoffset="` + svgNumber(state.dashOffset*scale) + `"`)
+	}
+	p.writeClip(state.clip)
+	p.buf.WriteString("/>\n")
+}
+
+func (p *svgPainter) clip(path *cairoPath, state *gstate) int {
+	p.clips++
+	p.buf.WriteString(`<clipPath id="clip` + strconv.Itoa(p.clips) + `"`)
+	p.writeClip(state.clip)
+	p.buf.WriteString(`><path d="` + svgPathData(path) + `" clip-rule="nonzero"/></clipPath>` + "\n")
+	return p.clips
+}
+
+func (p *svgPainter) writePaint(attr string, state *gstate) {
+	p.buf.WriteString(` ` + attr + `="rgb(` + svgColor(state.r) + `,` + svgColor(state.g) + `,` + svgColor(state.b) + `)"`)
+	if a := svgNumber(state.a); a != "1" {
+		p.buf.WriteString(` ` + attr + `-opacity="` + a + `"`)
+	}
+}
+
+func (p *svgPainter) writeClip(id int) {
+	if id != 0 {
+		p.buf.WriteString(` clip-path="url(#clip` + strconv.Itoa(id) + `)"`)
+	}
+}
+
+func (p *svgPainter) writeText(t textRun, state *gstate) {
+	// matrix of the run is scaled to font units, SVG needs matrix of the user space
+	u := t.size / glyphUnits
+	m := cairoMatrix{Xx: t.matrix.Xx / u, Yx: t.matrix.Yx / u, Xy: t.matrix.Xy / u, Yy: t.matrix.Yy / u}
+
+	p.buf.WriteString(`<text`)
+	if m.Xy == 0 && m.Yx == 0 && m.Xx == m.Yy {
+		p.buf.WriteString(` x="` + svgNumber(t.origin.x) + `" y="` + svgNumber(t.origin.y) + `" font-size="` + svgNumber(t.size*m.Xx) + `"`)
+	} else {
+		p.buf.WriteString(` transform="matrix(` + svgNumber(m.Xx) + " " + svgNumber(m.Yx) + " " + svgNumber(m.Xy) + " " + svgNumber(m.Yy) + " " +
+			svgNumber(t.origin.x) + " " + svgNumber(t.origin.y) + `)" font-size="` + svgNumber(t.size) + `"`)
+	}
+	if t.family != "" {
+		p.buf.WriteString(` font-family="`)
+		xml.EscapeText(&p.buf, []byte(t.family))
+		p.buf.WriteString(`"`)
+	}
+	if t.weight == cairoFontWeightBold {
+		p.buf.WriteString(` font-weight="bold"`)
+	}
+	if t.slant == cairoFontSlantItalic {
+		p.buf.WriteString(` font-style="italic"`)
+	}
+	p.writePaint("fill", state)
+	p.writeClip(state.clip)
+	p.buf.WriteString(` xml:space="preserve">`)
+	xml.EscapeText(&p.buf, []byte(t.text))
+	p.buf.WriteString("</text>\n")
+}
+
+func svgPathData(path *cairoPath) string {
+	var buf bytes.Buffer
+	for _, s := range path.subpaths {
+		if len(s.points) < 2 && !s.closed {
+			continue
+		}
+		first := true
+		for _, pt := range s.points {
+			if math.IsNaN(pt.x) || math.IsNaN(pt.y) {
+				continue
+			}
+			if first {
+				first = false
+				buf.WriteString("M ")
+			} else {
+				buf.WriteString(" L ")
+			}
+			buf.WriteString(svgNumber(pt.x) + " " + svgNumber(pt.y))
+		}
+		if s.closed {
+			buf.WriteString(" Z")
+		}
+		buf.WriteByte(' ')
+	}
+	return string(bytes.TrimSpace(buf.Bytes()))
+}
+
+func svgNumber(v float64) string {
+	v = math.Round(v*100) / 100
+	if v == 0 {
+		// avoid negative zero
+		v = 0
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func svgColor(v float64) string {
+	return strconv.Itoa(int(math.Round(v * 255)))
+}
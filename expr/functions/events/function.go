@@ -0,0 +1,122 @@
+package events
+
+import (
+	"context"
+	"math"
+	"strings"
+
+	"github.com/go-graphite/carbonapi/events"
+	"github.com/go-graphite/carbonapi/expr/interfaces"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+)
+
+// maxPoints limits amount of points in the series, one day of one second points
+const maxPoints = 86400
+
+type eventsFunc struct {
+	interfaces.FunctionBase
+}
+
+func GetOrder() interfaces.Order {
+	return interfaces.Any
+}
+
+func New(configFile string) []interfaces.FunctionMetadata {
+	res := make([]interfaces.FunctionMetadata, 0)
+	f := &eventsFunc{}
+	functions := []string{"events"}
+	for _, n := range functions {
+		res = append(res, interfaces.FunctionMetadata{Name: n, F: f})
+	}
+	return res
+}
+
+// events(*tags)
+func (f *eventsFunc) Do(ctx context.Context, e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+	tags := make([]string, 0, len(e.Args()))
+	for i := range e.Args() {
+		tag, err := e.GetStringArg(i)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	store := events.GetStore()
+	if store == nil {
+		return nil, events.ErrNotConfigured
+	}
+	if until <= from {
+		return []*types.MetricData{}, nil
+	}
+
+	name := "events(\"" + strings.Join(tags, "\", \"") + "\")"
+
+	q := events.Query{
+		From:  from,
+		Until: until,
+		Tags:  tags,
+	}
+	if len(tags) == 1 && tags[0] == "*" {
+		q.Tags = nil
+	}
+
+	found, err := store.Find(q)
+	if err != nil {
+		return nil, err
+	}
+
+	// same as graphite-web, series has one second resolution and each point contains amount of events at that
+	// second, but step is increased for ranges longer than maxPoints seconds to keep the series small
+	step := (until - from + maxPoints - 1) / maxPoints
+	points := make([]float64, (until-from+step-1)/step)
+	for i := range points {
+		points[i] = math.NaN()
+	}
+	for _, ev := range found {
+		i := (ev.When - from) / step
+		if i < 0 || i >= int64(len(points)) {
+			continue
+		}
+		if math.IsNaN(points[i]) {
+			points[i] = 1
+		} else {
+			points[i]++
+		}
+	}
+
+	r := types.MetricData{FetchResponse: pb.FetchResponse{
+		Name:              name,
+		PathExpression:    name,
+		Values:            points,
+		StartTime:         from,
+		StopTime:          from + int64(len(points))*step,
+		StepTime:          step,
+		ConsolidationFunc: "sum",
+	}}
+
+	return []*types.MetricData{&r}, nil
+}
+
+// Description is auto-generated description, based on output of https://github.com/graphite-project/graphite-web
+func (f *eventsFunc) Description() map[string]types.FunctionDescription {
+	return map[string]types.FunctionDescription{
+		"events": {
+			Description: "Returns the number of events at this point in time. Usable with\ndrawAsInfinite.\n\nExample:\n\n.. code-block:: none\n\n  &target=events(\"tag-one\", \"tag-two\")\n  &target=events(\"*\")\n\nReturns all events tagged as \"tag-one\" and \"tag-two\" and the second one\nreturns all events.",
+			Function:    "events(*tags)",
+			Group:       "Special",
+			Module:      "graphite.render.functions",
+			Name:        "events",
+			Params: []types.FunctionParam{
+				{
+					Multiple: true,
+					Name:     "tags",
+					Required: true,
+					Type:     types.String,
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,127 @@
+package events
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-graphite/carbonapi/events"
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/metadata"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	th "github.com/go-graphite/carbonapi/tests"
+)
+
+func init() {
+	md := New("")
+	evaluator := th.EvaluatorFromFunc(md[0].F)
+	metadata.SetEvaluator(evaluator)
+	helper.SetEvaluator(evaluator)
+	for _, m := range md {
+		metadata.RegisterFunction(m.Name, m.F)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "carbonapi-events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := events.NewFileStore(filepath.Join(dir, "events.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []events.Event{
+		{When: 101, What: "deploy api", Tags: []string{"deploy", "api"}},
+		{When: 101, What: "deploy web", Tags: []string{"deploy", "web"}},
+		{When: 105, What: "deploy api", Tags: []string{"deploy", "api"}},
+		{When: 107, What: "outage", Tags: []string{"outage"}},
+		{When: 200, What: "deploy api", Tags: []string{"deploy", "api"}},
+	} {
+		if _, err := store.Add(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	events.SetStore(store)
+	defer events.SetStore(nil)
+
+	nan := math.NaN()
+	// one day range is split into 10 seconds steps
+	day := make([]float64, maxPoints)
+	for i := range day {
+		day[i] = nan
+	}
+	day[10] = 4
+	day[20] = 1
+
+	tests := []struct {
+		target string
+		from   int64
+		until  int64
+		want   *types.MetricData
+	}{
+		{
+			`events("deploy")`,
+			100, 110,
+			types.MakeMetricData(`events("deploy")`, []float64{nan, 2, nan, nan, nan, 1, nan, nan, nan, nan}, 1, 100),
+		},
+		{
+			`events("deploy", "api")`,
+			100, 110,
+			types.MakeMetricData(`events("deploy", "api")`, []float64{nan, 1, nan, nan, nan, 1, nan, nan, nan, nan}, 1, 100),
+		},
+		{
+			`events("*")`,
+			100, 110,
+			types.MakeMetricData(`events("*")`, []float64{nan, 2, nan, nan, nan, 1, nan, 1, nan, nan}, 1, 100),
+		},
+		{
+			`events("*")`,
+			0, 10 * maxPoints,
+			types.MakeMetricData(`events("*")`, day, 10, 0),
+		},
+		{
+			`events("*")`,
+			110, 100,
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			exp, _, err := parser.ParseExpr(tt.target)
+			if err != nil {
+				t.Fatalf("failed to parse %s: %v", tt.target, err)
+			}
+			g, err := metadata.GetEvaluator().Eval(context.Background(), exp, tt.from, tt.until, map[parser.MetricRequest][]*types.MetricData{})
+			if err != nil {
+				t.Fatalf("failed to eval %s: %v", tt.target, err)
+			}
+			if tt.want == nil {
+				if len(g) != 0 {
+					t.Fatalf("expected no series, got %d", len(g))
+				}
+				return
+			}
+			if len(g) != 1 {
+				t.Fatalf("expected 1 series, got %d", len(g))
+			}
+			if g[0].Name != tt.want.Name {
+				t.Errorf("bad name: got %s, want %s", g[0].Name, tt.want.Name)
+			}
+			if g[0].StepTime != tt.want.StepTime || g[0].StopTime != tt.want.StopTime || len(g[0].Values) != len(tt.want.Values) {
+				t.Errorf("bad step or length: got step %d, stop %d, %d points, want step %d, stop %d, %d points",
+					g[0].StepTime, g[0].StopTime, len(g[0].Values), tt.want.StepTime, tt.want.StopTime, len(tt.want.Values))
+			}
+			if !th.NearlyEqualMetrics(g[0], tt.want) {
+				t.Errorf("bad values: got %v, want %v", g[0].Values, tt.want.Values)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package exponentialMovingAverage
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/go-graphite/carbonapi/expr/consolidations"
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/interfaces"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+type exponentialMovingAverage struct {
+	interfaces.FunctionBase
+}
+
+func GetOrder() interfaces.Order {
+	return interfaces.Any
+}
+
+func New(configFile string) []interfaces.FunctionMetadata {
+	res := make([]interfaces.FunctionMetadata, 0)
+	f := &exponentialMovingAverage{}
+	functions := []string{"exponentialMovingAverage"}
+	for _, n := range functions {
+		res = append(res, interfaces.FunctionMetadata{Name: n, F: f})
+	}
+	return res
+}
+
+// exponentialMovingAverage(seriesList, windowSize)
+func (f *exponentialMovingAverage) Do(ctx context.Context, e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+	var n int
+	var err error
+
+	var scaleByStep bool
+
+	var argstr string
+
+	switch e.Args()[1].Type() {
+	case parser.EtConst:
+		n, err = e.GetIntArg(1)
+		argstr = strconv.Itoa(n)
+	case parser.EtString:
+		var n32 int32
+		n32, err = e.GetIntervalArg(1, 1)
+		argstr = fmt.Sprintf("%q", e.Args()[1].StringValue())
+		if n32 < 0 {
+			n32 = -n32
+		}
+		n = int(n32)
+		scaleByStep = true
+	default:
+		err = parser.ErrBadType
+	}
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		return nil, fmt.Errorf("windowSize can't be negative")
+	}
+
+	start := from
+	if scaleByStep {
+		start -= int64(n)
+	}
+
+	arg, err := helper.GetSeriesArg(e.Args()[0], start, until, values)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []*types.MetricData
+
+	for _, a := range arg {
+		windowPoints := n
+		// with interval window the series is fetched with extra data before `from`, which is used only to start the average
+		var offset int
+		if scaleByStep {
+			windowPoints /= int(a.StepTime)
+			offset = windowPoints
+		}
+		if offset > len(a.Values) {
+			offset = len(a.Values)
+		}
+
+		constant := 2 / (float64(windowPoints) + 1)
+
+		r := *a
+		r.Name = fmt.Sprintf("exponentialMovingAverage(%s,%s)", a.Name, argstr)
+		r.StartTime = a.StartTime + int64(offset)*a.StepTime
+
+		vals := make([]float64, len(a.Values))
+		for i := range vals {
+			vals[i] = math.NaN()
+		}
+
+		if windowPoints < len(a.Values) {
+			ema := consolidations.AvgValue(a.Values[:windowPoints])
+			vals[windowPoints] = round(ema)
+			if math.IsNaN(ema) {
+				ema = 0
+			}
+
+			for i := windowPoints; i < len(a.Values)-1; i++ {
+				if math.IsNaN(a.Values[i]) {
+					continue
+				}
+				ema = constant*a.Values[i] + (1-constant)*ema
+				vals[i+1] = round(ema)
+			}
+		}
+
+		r.Values = vals[offset:]
+		results = append(results, &r)
+	}
+
+	return results, nil
+}
+
+func round(v float64) float64 {
+	return math.Round(v*1e6) / 1e6
+}
+
+// Description is auto-generated description, based on output of https://github.com/graphite-project/graphite-web
+func (f *exponentialMovingAverage) Description() map[string]types.FunctionDescription {
+	return map[string]types.FunctionDescription{
+		"exponentialMovingAverage": {
+			Description: "Takes a series of values and a window size and produces an exponential moving\naverage utilizing the following formula:\n\n.. code-block:: none\n\n  ema(current) = constant * (Current Value) + (1 - constant) * ema(previous)\n\nThe Constant is calculated as:\n\n.. code-block:: none\n\n  constant = 2 / (windowSize + 1)\n\nThe first period EMA uses a simple moving average for its value.\n\nExample:\n\n.. code-block:: none\n\n  &target=exponentialMovingAverage(*.transactions.count, 10)\n  &target=exponentialMovingAverage(*.transactions.count, '-10s')",
+			Function:    "exponentialMovingAverage(seriesList, windowSize)",
+			Group:       "Calculate",
+			Module:      "graphite.render.functions",
+			Name:        "exponentialMovingAverage",
+			Params: []types.FunctionParam{
+				{
+					Name:     "seriesList",
+					Required: true,
+					Type:     types.SeriesList,
+				},
+				{
+					Name:     "windowSize",
+					Required: true,
+					Suggestions: types.NewSuggestions(
+						5,
+						7,
+						10,
+						"1min",
+						"5min",
+						"10min",
+						"30min",
+						"1hour",
+					),
+					Type: types.IntOrInterval,
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,66 @@
+package exponentialMovingAverage
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/metadata"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	th "github.com/go-graphite/carbonapi/tests"
+)
+
+func init() {
+	md := New("")
+	evaluator := th.EvaluatorFromFunc(md[0].F)
+	metadata.SetEvaluator(evaluator)
+	helper.SetEvaluator(evaluator)
+	for _, m := range md {
+		metadata.RegisterFunction(m.Name, m.F)
+	}
+}
+
+func TestExponentialMovingAverage(t *testing.T) {
+	now32 := int64(time.Now().Unix())
+
+	tests := []th.EvalTestItem{
+		{
+			"exponentialMovingAverage(metric1,3)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{1, 2, 3, 4, 5, 6}, 1, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData("exponentialMovingAverage(metric1,3)", []float64{math.NaN(), math.NaN(), math.NaN(), 2, 3, 4}, 1, now32)},
+		},
+		{
+			"exponentialMovingAverage(metric1,3)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{1, 2, 3, math.NaN(), 5, 6}, 1, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData("exponentialMovingAverage(metric1,3)", []float64{math.NaN(), math.NaN(), math.NaN(), 2, math.NaN(), 3.5}, 1, now32)},
+		},
+		{
+			"exponentialMovingAverage(metric1,2)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{1, 2, 4, 2, 1}, 1, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData("exponentialMovingAverage(metric1,2)", []float64{math.NaN(), math.NaN(), 1.5, 3.166667, 2.388889}, 1, now32)},
+		},
+		{
+			// data before `from` is fetched for the window and isn't returned
+			`exponentialMovingAverage(metric1,"3s")`,
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", -3, 1}: {types.MakeMetricData("metric1", []float64{1, 2, 3, 4, 5, 6}, 1, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData(`exponentialMovingAverage(metric1,"3s")`, []float64{2, 3, 4}, 1, now32+3)},
+		},
+	}
+
+	for _, tt := range tests {
+		testName := tt.Target
+		t.Run(testName, func(t *testing.T) {
+			th.TestEvalExpr(t, &tt)
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/go-graphite/carbonapi/expr/functions/absolute"
 	"github.com/go-graphite/carbonapi/expr/functions/aggregate"
 	"github.com/go-graphite/carbonapi/expr/functions/aggregateLine"
+	"github.com/go-graphite/carbonapi/expr/functions/aggregateWithWildcards"
 	"github.com/go-graphite/carbonapi/expr/functions/alias"
 	"github.com/go-graphite/carbonapi/expr/functions/aliasByMetric"
 	"github.com/go-graphite/carbonapi/expr/functions/aliasByNode"
@@ -14,6 +15,7 @@ import (
 	"github.com/go-graphite/carbonapi/expr/functions/aliasByTags"
 	"github.com/go-graphite/carbonapi/expr/functions/aliasSub"
 	"github.com/go-graphite/carbonapi/expr/functions/asPercent"
+	"github.com/go-graphite/carbonapi/expr/functions/averageOutsidePercentile"
 	"github.com/go-graphite/carbonapi/expr/functions/averageSeries"
 	"github.com/go-graphite/carbonapi/expr/functions/averageSeriesWithWildcards"
 	"github.com/go-graphite/carbonapi/expr/functions/below"
@@ -28,8 +30,10 @@ import (
 	"github.com/go-graphite/carbonapi/expr/functions/derivative"
 	"github.com/go-graphite/carbonapi/expr/functions/diffSeries"
 	"github.com/go-graphite/carbonapi/expr/functions/divideSeries"
+	"github.com/go-graphite/carbonapi/expr/functions/events"
 	"github.com/go-graphite/carbonapi/expr/functions/ewma"
 	"github.com/go-graphite/carbonapi/expr/functions/exclude"
+	"github.com/go-graphite/carbonapi/expr/functions/exponentialMovingAverage"
 	"github.com/go-graphite/carbonapi/expr/functions/fallbackSeries"
 	"github.com/go-graphite/carbonapi/expr/functions/fft"
 	"github.com/go-graphite/carbonapi/expr/functions/filter"
@@ -41,11 +45,14 @@ import (
 	"github.com/go-graphite/carbonapi/expr/functions/highestLowest"
 	"github.com/go-graphite/carbonapi/expr/functions/hitcount"
 	"github.com/go-graphite/carbonapi/expr/functions/holtWintersAberration"
+	"github.com/go-graphite/carbonapi/expr/functions/holtWintersConfidenceArea"
 	"github.com/go-graphite/carbonapi/expr/functions/holtWintersConfidenceBands"
 	"github.com/go-graphite/carbonapi/expr/functions/holtWintersForecast"
+	"github.com/go-graphite/carbonapi/expr/functions/identity"
 	"github.com/go-graphite/carbonapi/expr/functions/ifft"
 	"github.com/go-graphite/carbonapi/expr/functions/integral"
 	"github.com/go-graphite/carbonapi/expr/functions/integralByInterval"
+	"github.com/go-graphite/carbonapi/expr/functions/interpolate"
 	"github.com/go-graphite/carbonapi/expr/functions/invert"
 	"github.com/go-graphite/carbonapi/expr/functions/isNotNull"
 	"github.com/go-graphite/carbonapi/expr/functions/keepLastValue"
@@ -60,6 +67,7 @@ import (
 	"github.com/go-graphite/carbonapi/expr/functions/mostDeviant"
 	"github.com/go-graphite/carbonapi/expr/functions/moving"
 	"github.com/go-graphite/carbonapi/expr/functions/movingMedian"
+	"github.com/go-graphite/carbonapi/expr/functions/movingWindow"
 	"github.com/go-graphite/carbonapi/expr/functions/multiplySeries"
 	"github.com/go-graphite/carbonapi/expr/functions/multiplySeriesWithWildcards"
 	"github.com/go-graphite/carbonapi/expr/functions/nPercentile"
@@ -72,16 +80,20 @@ import (
 	"github.com/go-graphite/carbonapi/expr/functions/percentileOfSeries"
 	"github.com/go-graphite/carbonapi/expr/functions/polyfit"
 	"github.com/go-graphite/carbonapi/expr/functions/pow"
+	"github.com/go-graphite/carbonapi/expr/functions/powSeries"
 	"github.com/go-graphite/carbonapi/expr/functions/randomWalk"
 	"github.com/go-graphite/carbonapi/expr/functions/rangeOfSeries"
 	"github.com/go-graphite/carbonapi/expr/functions/reduce"
 	"github.com/go-graphite/carbonapi/expr/functions/removeBelowSeries"
+	"github.com/go-graphite/carbonapi/expr/functions/removeBetweenPercentile"
 	"github.com/go-graphite/carbonapi/expr/functions/removeEmptySeries"
 	"github.com/go-graphite/carbonapi/expr/functions/round"
 	"github.com/go-graphite/carbonapi/expr/functions/scale"
 	"github.com/go-graphite/carbonapi/expr/functions/scaleToSeconds"
 	"github.com/go-graphite/carbonapi/expr/functions/seriesByTag"
 	"github.com/go-graphite/carbonapi/expr/functions/seriesList"
+	"github.com/go-graphite/carbonapi/expr/functions/setXFilesFactor"
+	"github.com/go-graphite/carbonapi/expr/functions/sinFunction"
 	"github.com/go-graphite/carbonapi/expr/functions/smartSummarize"
 	"github.com/go-graphite/carbonapi/expr/functions/sortBy"
 	"github.com/go-graphite/carbonapi/expr/functions/sortByName"
@@ -94,9 +106,11 @@ import (
 	"github.com/go-graphite/carbonapi/expr/functions/summarize"
 	"github.com/go-graphite/carbonapi/expr/functions/timeFunction"
 	"github.com/go-graphite/carbonapi/expr/functions/timeShift"
+	"github.com/go-graphite/carbonapi/expr/functions/timeSlice"
 	"github.com/go-graphite/carbonapi/expr/functions/timeStack"
 	"github.com/go-graphite/carbonapi/expr/functions/transformNull"
 	"github.com/go-graphite/carbonapi/expr/functions/tukey"
+	"github.com/go-graphite/carbonapi/expr/functions/unique"
 	"github.com/go-graphite/carbonapi/expr/functions/weightedAverage"
 	"github.com/go-graphite/carbonapi/expr/interfaces"
 	"github.com/go-graphite/carbonapi/expr/metadata"
@@ -113,6 +127,7 @@ func New(configs map[string]string) {
 		{name: "absolute", order: absolute.GetOrder(), f: absolute.New},
 		{name: "aggregate", order: aggregate.GetOrder(), f: aggregate.New},
 		{name: "aggregateLine", order: aggregateLine.GetOrder(), f: aggregateLine.New},
+		{name: "aggregateWithWildcards", order: aggregateWithWildcards.GetOrder(), f: aggregateWithWildcards.New},
 		{name: "alias", order: alias.GetOrder(), f: alias.New},
 		{name: "aliasByMetric", order: aliasByMetric.GetOrder(), f: aliasByMetric.New},
 		{name: "aliasByNode", order: aliasByNode.GetOrder(), f: aliasByNode.New},
@@ -120,6 +135,7 @@ func New(configs map[string]string) {
 		{name: "aliasByTags", order: aliasByTags.GetOrder(), f: aliasByTags.New},
 		{name: "aliasSub", order: aliasSub.GetOrder(), f: aliasSub.New},
 		{name: "asPercent", order: asPercent.GetOrder(), f: asPercent.New},
+		{name: "averageOutsidePercentile", order: averageOutsidePercentile.GetOrder(), f: averageOutsidePercentile.New},
 		{name: "averageSeries", order: averageSeries.GetOrder(), f: averageSeries.New},
 		{name: "averageSeriesWithWildcards", order: averageSeriesWithWildcards.GetOrder(), f: averageSeriesWithWildcards.New},
 		{name: "below", order: below.GetOrder(), f: below.New},
@@ -134,8 +150,10 @@ func New(configs map[string]string) {
 		{name: "derivative", order: derivative.GetOrder(), f: derivative.New},
 		{name: "diffSeries", order: diffSeries.GetOrder(), f: diffSeries.New},
 		{name: "divideSeries", order: divideSeries.GetOrder(), f: divideSeries.New},
+		{name: "events", order: events.GetOrder(), f: events.New},
 		{name: "ewma", order: ewma.GetOrder(), f: ewma.New},
 		{name: "exclude", order: exclude.GetOrder(), f: exclude.New},
+		{name: "exponentialMovingAverage", order: exponentialMovingAverage.GetOrder(), f: exponentialMovingAverage.New},
 		{name: "fallbackSeries", order: fallbackSeries.GetOrder(), f: fallbackSeries.New},
 		{name: "fft", order: fft.GetOrder(), f: fft.New},
 		{name: "filter", order: filter.GetOrder(), f: filter.New},
@@ -147,11 +165,14 @@ func New(configs map[string]string) {
 		{name: "highestLowest", order: highestLowest.GetOrder(), f: highestLowest.New},
 		{name: "hitcount", order: hitcount.GetOrder(), f: hitcount.New},
 		{name: "holtWintersAberration", order: holtWintersAberration.GetOrder(), f: holtWintersAberration.New},
+		{name: "holtWintersConfidenceArea", order: holtWintersConfidenceArea.GetOrder(), f: holtWintersConfidenceArea.New},
 		{name: "holtWintersConfidenceBands", order: holtWintersConfidenceBands.GetOrder(), f: holtWintersConfidenceBands.New},
 		{name: "holtWintersForecast", order: holtWintersForecast.GetOrder(), f: holtWintersForecast.New},
+		{name: "identity", order: identity.GetOrder(), f: identity.New},
 		{name: "ifft", order: ifft.GetOrder(), f: ifft.New},
 		{name: "integral", order: integral.GetOrder(), f: integral.New},
 		{name: "integralByInterval", order: integralByInterval.GetOrder(), f: integralByInterval.New},
+		{name: "interpolate", order: interpolate.GetOrder(), f: interpolate.New},
 		{name: "invert", order: invert.GetOrder(), f: invert.New},
 		{name: "isNotNull", order: isNotNull.GetOrder(), f: isNotNull.New},
 		{name: "keepLastValue", order: keepLastValue.GetOrder(), f: keepLastValue.New},
@@ -166,6 +187,7 @@ func New(configs map[string]string) {
 		{name: "mostDeviant", order: mostDeviant.GetOrder(), f: mostDeviant.New},
 		{name: "moving", order: moving.GetOrder(), f: moving.New},
 		{name: "movingMedian", order: movingMedian.GetOrder(), f: movingMedian.New},
+		{name: "movingWindow", order: movingWindow.GetOrder(), f: movingWindow.New},
 		{name: "multiplySeries", order: multiplySeries.GetOrder(), f: multiplySeries.New},
 		{name: "multiplySeriesWithWildcards", order: multiplySeriesWithWildcards.GetOrder(), f: multiplySeriesWithWildcards.New},
 		{name: "nPercentile", order: nPercentile.GetOrder(), f: nPercentile.New},
@@ -178,16 +200,20 @@ func New(configs map[string]string) {
 		{name: "percentileOfSeries", order: percentileOfSeries.GetOrder(), f: percentileOfSeries.New},
 		{name: "polyfit", order: polyfit.GetOrder(), f: polyfit.New},
 		{name: "pow", order: pow.GetOrder(), f: pow.New},
+		{name: "powSeries", order: powSeries.GetOrder(), f: powSeries.New},
 		{name: "randomWalk", order: randomWalk.GetOrder(), f: randomWalk.New},
 		{name: "rangeOfSeries", order: rangeOfSeries.GetOrder(), f: rangeOfSeries.New},
 		{name: "reduce", order: reduce.GetOrder(), f: reduce.New},
 		{name: "removeBelowSeries", order: removeBelowSeries.GetOrder(), f: removeBelowSeries.New},
+		{name: "removeBetweenPercentile", order: removeBetweenPercentile.GetOrder(), f: removeBetweenPercentile.New},
 		{name: "removeEmptySeries", order: removeEmptySeries.GetOrder(), f: removeEmptySeries.New},
 		{name: "round", order: round.GetOrder(), f: round.New},
 		{name: "scale", order: scale.GetOrder(), f: scale.New},
 		{name: "scaleToSeconds", order: scaleToSeconds.GetOrder(), f: scaleToSeconds.New},
 		{name: "seriesByTag", order: seriesByTag.GetOrder(), f: seriesByTag.New},
 		{name: "seriesList", order: seriesList.GetOrder(), f: seriesList.New},
+		{name: "setXFilesFactor", order: setXFilesFactor.GetOrder(), f: setXFilesFactor.New},
+		{name: "sinFunction", order: sinFunction.GetOrder(), f: sinFunction.New},
 		{name: "smartSummarize", order: smartSummarize.GetOrder(), f: smartSummarize.New},
 		{name: "sortBy", order: sortBy.GetOrder(), f: sortBy.New},
 		{name: "sortByName", order: sortByName.GetOrder(), f: sortByName.New},
@@ -200,9 +226,11 @@ func New(configs map[string]string) {
 		{name: "summarize", order: summarize.GetOrder(), f: summarize.New},
 		{name: "timeFunction", order: timeFunction.GetOrder(), f: timeFunction.New},
 		{name: "timeShift", order: timeShift.GetOrder(), f: timeShift.New},
+		{name: "timeSlice", order: timeSlice.GetOrder(), f: timeSlice.New},
 		{name: "timeStack", order: timeStack.GetOrder(), f: timeStack.New},
 		{name: "transformNull", order: transformNull.GetOrder(), f: transformNull.New},
 		{name: "tukey", order: tukey.GetOrder(), f: tukey.New},
+		{name: "unique", order: unique.GetOrder(), f: unique.New},
 		{name: "weightedAverage", order: weightedAverage.GetOrder(), f: weightedAverage.New},
 	}
 
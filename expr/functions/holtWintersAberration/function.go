@@ -31,14 +31,28 @@ func New(configFile string) []interfaces.FunctionMetadata {
 	return res
 }
 
+// holtWintersAberration(seriesList, delta=3, bootstrapInterval='7d', seasonality='1d')
 func (f *holtWintersAberration) Do(ctx context.Context, e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
 	var results []*types.MetricData
-	args, err := helper.GetSeriesArg(e.Args()[0], from-7*86400, until, values)
+	delta, err := e.GetFloatNamedOrPosArgDefault("delta", 1, 3)
 	if err != nil {
 		return nil, err
 	}
 
-	delta, err := e.GetFloatNamedOrPosArgDefault("delta", 1, 3)
+	bootstrapInterval, err := e.GetIntervalNamedOrPosArgDefault("bootstrapInterval", 2, 1, holtwinters.DefaultBootstrapInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	seasonality, err := e.GetIntervalNamedOrPosArgDefault("seasonality", 3, 1, holtwinters.DefaultSeasonality)
+	if err != nil {
+		return nil, err
+	}
+
+	// same as in graphite-web, one more season before bootstrapInterval is fetched and skipped in the result
+	preview := bootstrapInterval + seasonality
+
+	args, err := helper.GetSeriesArg(e.Args()[0], from-preview, until, values)
 	if err != nil {
 		return nil, err
 	}
@@ -48,9 +62,9 @@ func (f *holtWintersAberration) Do(ctx context.Context, e parser.Expr, from, unt
 
 		stepTime := arg.StepTime
 
-		lowerBand, upperBand := holtwinters.HoltWintersConfidenceBands(arg.Values, stepTime, delta)
+		lowerBand, upperBand := holtwinters.HoltWintersConfidenceBands(arg.Values, stepTime, delta, preview, seasonality)
 
-		windowPoints := 7 * 86400 / stepTime
+		windowPoints := holtwinters.WindowPoints(len(arg.Values), stepTime, preview)
 		series := arg.Values[windowPoints:]
 
 		for i := range series {
@@ -69,7 +83,7 @@ func (f *holtWintersAberration) Do(ctx context.Context, e parser.Expr, from, unt
 			Name:              fmt.Sprintf("holtWintersAberration(%s)", arg.Name),
 			Values:            aberration,
 			StepTime:          arg.StepTime,
-			StartTime:         arg.StartTime + 7*86400,
+			StartTime:         arg.StartTime + int64(windowPoints)*stepTime,
 			StopTime:          arg.StopTime,
 			PathExpression:    fmt.Sprintf("holtWintersAberration(%s)", arg.Name),
 			ConsolidationFunc: arg.ConsolidationFunc,
@@ -86,7 +100,7 @@ func (f *holtWintersAberration) Description() map[string]types.FunctionDescripti
 	return map[string]types.FunctionDescription{
 		"holtWintersAberration": {
 			Description: "Performs a Holt-Winters forecast using the series as input data and plots the\npositive or negative deviation of the series data from the forecast.",
-			Function:    "holtWintersAberration(seriesList, delta=3, bootstrapInterval='7d')",
+			Function:    "holtWintersAberration(seriesList, delta=3, bootstrapInterval='7d', seasonality='1d')",
 			Group:       "Calculate",
 			Module:      "graphite.render.functions",
 			Name:        "holtWintersAberration",
@@ -110,6 +124,15 @@ func (f *holtWintersAberration) Description() map[string]types.FunctionDescripti
 					),
 					Type: types.Interval,
 				},
+				{
+					Default: types.NewSuggestion("1d"),
+					Name:    "seasonality",
+					Suggestions: types.NewSuggestions(
+						"1d",
+						"7d",
+					),
+					Type: types.Interval,
+				},
 			},
 		},
 	}
@@ -0,0 +1,19 @@
+package holtWintersConfidenceArea
+
+import "github.com/go-graphite/carbonapi/expr/types"
+
+// setArea makes lower band invisible and stacks upper band on top of it, same as areaBetween does
+func setArea(lower, upper *types.MetricData) {
+	lower.Stacked = true
+	lower.StackName = types.DefaultStackName
+	lower.Invisible = true
+
+	upper.Stacked = true
+	upper.StackName = types.DefaultStackName
+
+	vals := make([]float64, len(upper.Values))
+	for i, v := range upper.Values {
+		vals[i] = v - lower.Values[i]
+	}
+	upper.Values = vals
+}
@@ -0,0 +1,53 @@
+package holtWintersConfidenceArea
+
+import (
+	"testing"
+
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/metadata"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	th "github.com/go-graphite/carbonapi/tests"
+)
+
+func init() {
+	md := New("")
+	evaluator := th.EvaluatorFromFunc(md[0].F)
+	metadata.SetEvaluator(evaluator)
+	helper.SetEvaluator(evaluator)
+	for _, m := range md {
+		metadata.RegisterFunction(m.Name, m.F)
+	}
+}
+
+func TestHoltWintersConfidenceArea(t *testing.T) {
+	tests := []th.EvalTestItem{
+		{
+			"holtWintersConfidenceArea(metric1)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", -8 * 86400, 1}: {types.MakeMetricData("metric1", []float64{1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1}, 86400, -8*86400)},
+			},
+			[]*types.MetricData{
+				types.MakeMetricData("holtWintersConfidenceArea(metric1)", []float64{1, 1, 1}, 86400, 0),
+				types.MakeMetricData("holtWintersConfidenceArea(metric1)", []float64{0, 0, 0}, 86400, 0),
+			},
+		},
+		{
+			"holtWintersConfidenceArea(metric1,3,'2d','7d')",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", -9 * 86400, 1}: {types.MakeMetricData("metric1", []float64{1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1}, 86400, -9*86400)},
+			},
+			[]*types.MetricData{
+				types.MakeMetricData("holtWintersConfidenceArea(metric1)", []float64{1, 1}, 86400, 0),
+				types.MakeMetricData("holtWintersConfidenceArea(metric1)", []float64{0, 0}, 86400, 0),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		testName := tt.Target
+		t.Run(testName, func(t *testing.T) {
+			th.TestEvalExpr(t, &tt)
+		})
+	}
+}
@@ -30,14 +30,28 @@ func New(configFile string) []interfaces.FunctionMetadata {
 	return res
 }
 
+// holtWintersConfidenceBands(seriesList, delta=3, bootstrapInterval='7d', seasonality='1d')
 func (f *holtWintersConfidenceBands) Do(ctx context.Context, e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
 	var results []*types.MetricData
-	args, err := helper.GetSeriesArg(e.Args()[0], from-7*86400, until, values)
+	delta, err := e.GetFloatNamedOrPosArgDefault("delta", 1, 3)
 	if err != nil {
 		return nil, err
 	}
 
-	delta, err := e.GetFloatNamedOrPosArgDefault("delta", 1, 3)
+	bootstrapInterval, err := e.GetIntervalNamedOrPosArgDefault("bootstrapInterval", 2, 1, holtwinters.DefaultBootstrapInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	seasonality, err := e.GetIntervalNamedOrPosArgDefault("seasonality", 3, 1, holtwinters.DefaultSeasonality)
+	if err != nil {
+		return nil, err
+	}
+
+	// same as in graphite-web, one more season before bootstrapInterval is fetched and skipped in the result
+	preview := bootstrapInterval + seasonality
+
+	args, err := helper.GetSeriesArg(e.Args()[0], from-preview, until, values)
 	if err != nil {
 		return nil, err
 	}
@@ -45,13 +59,14 @@ func (f *holtWintersConfidenceBands) Do(ctx context.Context, e parser.Expr, from
 	for _, arg := range args {
 		stepTime := arg.StepTime
 
-		lowerBand, upperBand := holtwinters.HoltWintersConfidenceBands(arg.Values, stepTime, delta)
+		lowerBand, upperBand := holtwinters.HoltWintersConfidenceBands(arg.Values, stepTime, delta, preview, seasonality)
+		startTime := arg.StartTime + int64(holtwinters.WindowPoints(len(arg.Values), stepTime, preview))*stepTime
 
 		lowerSeries := types.MetricData{FetchResponse: pb.FetchResponse{
 			Name:              fmt.Sprintf("holtWintersConfidenceLower(%s)", arg.Name),
 			Values:            lowerBand,
 			StepTime:          arg.StepTime,
-			StartTime:         arg.StartTime + 7*86400,
+			StartTime:         startTime,
 			StopTime:          arg.StopTime,
 			ConsolidationFunc: arg.ConsolidationFunc,
 			XFilesFactor:      arg.XFilesFactor,
@@ -62,11 +77,11 @@ func (f *holtWintersConfidenceBands) Do(ctx context.Context, e parser.Expr, from
 			Name:              fmt.Sprintf("holtWintersConfidenceUpper(%s)", arg.Name),
 			Values:            upperBand,
 			StepTime:          arg.StepTime,
-			StartTime:         arg.StartTime + 7*86400,
+			StartTime:         startTime,
 			StopTime:          arg.StopTime,
 			ConsolidationFunc: arg.ConsolidationFunc,
 			XFilesFactor:      arg.XFilesFactor,
-			PathExpression:    fmt.Sprintf("holtWintersConfidenceLower(%s)", arg.Name),
+			PathExpression:    fmt.Sprintf("holtWintersConfidenceUpper(%s)", arg.Name),
 		}}
 
 		results = append(results, &lowerSeries, &upperSeries)
@@ -80,7 +95,7 @@ func (f *holtWintersConfidenceBands) Description() map[string]types.FunctionDesc
 	return map[string]types.FunctionDescription{
 		"holtWintersConfidenceBands": {
 			Description: "Performs a Holt-Winters forecast using the series as input data and plots\nupper and lower bands with the predicted forecast deviations.",
-			Function:    "holtWintersConfidenceBands(seriesList, delta=3, bootstrapInterval='7d')",
+			Function:    "holtWintersConfidenceBands(seriesList, delta=3, bootstrapInterval='7d', seasonality='1d')",
 			Group:       "Calculate",
 			Module:      "graphite.render.functions",
 			Name:        "holtWintersConfidenceBands",
@@ -104,6 +119,15 @@ func (f *holtWintersConfidenceBands) Description() map[string]types.FunctionDesc
 					),
 					Type: types.Interval,
 				},
+				{
+					Default: types.NewSuggestion("1d"),
+					Name:    "seasonality",
+					Suggestions: types.NewSuggestions(
+						"1d",
+						"7d",
+					),
+					Type: types.Interval,
+				},
 			},
 		},
 	}
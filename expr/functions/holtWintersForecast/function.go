@@ -30,9 +30,23 @@ func New(configFile string) []interfaces.FunctionMetadata {
 	return res
 }
 
+// holtWintersForecast(seriesList, bootstrapInterval='7d', seasonality='1d')
 func (f *holtWintersForecast) Do(ctx context.Context, e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
 	var results []*types.MetricData
-	args, err := helper.GetSeriesArgsAndRemoveNonExisting(e, from-7*86400, until, values)
+	bootstrapInterval, err := e.GetIntervalNamedOrPosArgDefault("bootstrapInterval", 1, 1, holtwinters.DefaultBootstrapInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	seasonality, err := e.GetIntervalNamedOrPosArgDefault("seasonality", 2, 1, holtwinters.DefaultSeasonality)
+	if err != nil {
+		return nil, err
+	}
+
+	// same as in graphite-web, one more season before bootstrapInterval is fetched and skipped in the result
+	preview := bootstrapInterval + seasonality
+
+	args, err := helper.GetSeriesArg(e.Args()[0], from-preview, until, values)
 	if err != nil {
 		return nil, err
 	}
@@ -40,16 +54,16 @@ func (f *holtWintersForecast) Do(ctx context.Context, e parser.Expr, from, until
 	for _, arg := range args {
 		stepTime := arg.StepTime
 
-		predictions, _ := holtwinters.HoltWintersAnalysis(arg.Values, stepTime)
+		predictions, _ := holtwinters.HoltWintersAnalysis(arg.Values, stepTime, seasonality)
 
-		windowPoints := 7 * 86400 / stepTime
+		windowPoints := holtwinters.WindowPoints(len(predictions), stepTime, preview)
 		predictionsOfInterest := predictions[windowPoints:]
 
 		r := types.MetricData{FetchResponse: pb.FetchResponse{
 			Name:              fmt.Sprintf("holtWintersForecast(%s)", arg.Name),
 			Values:            predictionsOfInterest,
 			StepTime:          arg.StepTime,
-			StartTime:         arg.StartTime + 7*86400,
+			StartTime:         arg.StartTime + int64(windowPoints)*stepTime,
 			StopTime:          arg.StopTime,
 			PathExpression:    fmt.Sprintf("holtWintersForecast(%s)", arg.Name),
 			XFilesFactor:      arg.XFilesFactor,
@@ -67,7 +81,7 @@ func (f *holtWintersForecast) Description() map[string]types.FunctionDescription
 	return map[string]types.FunctionDescription{
 		"holtWintersForecast": {
 			Description: "Performs a Holt-Winters forecast using the series as input data. Data from\n`bootstrapInterval` (one week by default) previous to the series is used to bootstrap the initial forecast.",
-			Function:    "holtWintersForecast(seriesList, bootstrapInterval='7d')",
+			Function:    "holtWintersForecast(seriesList, bootstrapInterval='7d', seasonality='1d')",
 			Group:       "Calculate",
 			Module:      "graphite.render.functions",
 			Name:        "holtWintersForecast",
@@ -86,6 +100,15 @@ func (f *holtWintersForecast) Description() map[string]types.FunctionDescription
 					),
 					Type: types.Interval,
 				},
+				{
+					Default: types.NewSuggestion("1d"),
+					Name:    "seasonality",
+					Suggestions: types.NewSuggestions(
+						"1d",
+						"7d",
+					),
+					Type: types.Interval,
+				},
 			},
 		},
 	}
@@ -0,0 +1,96 @@
+package interpolate
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/interfaces"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+type interpolate struct {
+	interfaces.FunctionBase
+}
+
+func GetOrder() interfaces.Order {
+	return interfaces.Any
+}
+
+func New(configFile string) []interfaces.FunctionMetadata {
+	res := make([]interfaces.FunctionMetadata, 0)
+	f := &interpolate{}
+	functions := []string{"interpolate"}
+	for _, n := range functions {
+		res = append(res, interfaces.FunctionMetadata{Name: n, F: f})
+	}
+	return res
+}
+
+// interpolate(seriesList, limit=inf)
+func (f *interpolate) Do(ctx context.Context, e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+	arg, err := helper.GetSeriesArg(e.Args()[0], from, until, values)
+	if err != nil {
+		return nil, err
+	}
+
+	limit, err := e.GetIntNamedOrPosArgDefault("limit", 1, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []*types.MetricData
+
+	for _, a := range arg {
+		r := *a
+		r.Name = fmt.Sprintf("interpolate(%s)", a.Name)
+		r.Values = make([]float64, len(a.Values))
+		copy(r.Values, a.Values)
+
+		// index of the last non-null value, gaps before the first one can't be filled
+		last := -1
+		for i, v := range a.Values {
+			if math.IsNaN(v) {
+				continue
+			}
+
+			missing := i - last - 1
+			if last >= 0 && missing > 0 && (limit < 0 || missing <= limit) {
+				lastValue := a.Values[last]
+				for j := last + 1; j < i; j++ {
+					r.Values[j] = lastValue + float64(j-last)*(v-lastValue)/float64(missing+1)
+				}
+			}
+			last = i
+		}
+		results = append(results, &r)
+	}
+	return results, nil
+}
+
+// Description is auto-generated description, based on output of https://github.com/graphite-project/graphite-web
+func (f *interpolate) Description() map[string]types.FunctionDescription {
+	return map[string]types.FunctionDescription{
+		"interpolate": {
+			Description: "Takes one metric or a wildcard seriesList, and optionally a limit to the number of 'None' values to skip over.\nContinues the line with the last received value when gaps ('None' values) appear in your data, rather than breaking your line.\n\nExample:\n\n.. code-block:: none\n\n  &target=interpolate(Server01.connections.handled)\n  &target=interpolate(Server01.connections.handled, 10)",
+			Function:    "interpolate(seriesList, limit=inf)",
+			Group:       "Transform",
+			Module:      "graphite.render.functions",
+			Name:        "interpolate",
+			Params: []types.FunctionParam{
+				{
+					Name:     "seriesList",
+					Required: true,
+					Type:     types.SeriesList,
+				},
+				{
+					Default: types.NewSuggestion("INF"),
+					Name:    "limit",
+					Type:    types.Integer,
+				},
+			},
+		},
+	}
+}
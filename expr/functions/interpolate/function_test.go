@@ -0,0 +1,58 @@
+package interpolate
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/metadata"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	th "github.com/go-graphite/carbonapi/tests"
+)
+
+func init() {
+	md := New("")
+	evaluator := th.EvaluatorFromFunc(md[0].F)
+	metadata.SetEvaluator(evaluator)
+	helper.SetEvaluator(evaluator)
+	for _, m := range md {
+		metadata.RegisterFunction(m.Name, m.F)
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	now32 := int64(time.Now().Unix())
+
+	tests := []th.EvalTestItem{
+		{
+			"interpolate(metric1)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{math.NaN(), 1, math.NaN(), 3, math.NaN(), math.NaN(), 6, math.NaN()}, 1, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData("interpolate(metric1)", []float64{math.NaN(), 1, 2, 3, 4, 5, 6, math.NaN()}, 1, now32)},
+		},
+		{
+			"interpolate(metric1,1)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{math.NaN(), 1, math.NaN(), 3, math.NaN(), math.NaN(), 6, math.NaN()}, 1, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData("interpolate(metric1)", []float64{math.NaN(), 1, 2, 3, math.NaN(), math.NaN(), 6, math.NaN()}, 1, now32)},
+		},
+		{
+			"interpolate(metric1,limit=2)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{1, math.NaN(), math.NaN(), 4, math.NaN(), math.NaN(), math.NaN(), 0}, 1, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData("interpolate(metric1)", []float64{1, 2, 3, 4, math.NaN(), math.NaN(), math.NaN(), 0}, 1, now32)},
+		},
+	}
+
+	for _, tt := range tests {
+		testName := tt.Target
+		t.Run(testName, func(t *testing.T) {
+			th.TestEvalExpr(t, &tt)
+		})
+	}
+}
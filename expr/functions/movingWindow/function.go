@@ -0,0 +1,190 @@
+package movingWindow
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/go-graphite/carbonapi/expr/consolidations"
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/interfaces"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+type movingWindow struct {
+	interfaces.FunctionBase
+}
+
+func GetOrder() interfaces.Order {
+	return interfaces.Any
+}
+
+func New(configFile string) []interfaces.FunctionMetadata {
+	res := make([]interfaces.FunctionMetadata, 0)
+	f := &movingWindow{}
+	functions := []string{"movingWindow"}
+	for _, n := range functions {
+		res = append(res, interfaces.FunctionMetadata{Name: n, F: f})
+	}
+	return res
+}
+
+// movingWindow(seriesList, windowSize, func='average', xFilesFactor=None)
+func (f *movingWindow) Do(ctx context.Context, e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+	var n int
+	var err error
+
+	var scaleByStep bool
+
+	var argstr string
+
+	switch e.Args()[1].Type() {
+	case parser.EtConst:
+		n, err = e.GetIntArg(1)
+		argstr = strconv.Itoa(n)
+	case parser.EtString:
+		var n32 int32
+		n32, err = e.GetIntervalArg(1, 1)
+		argstr = fmt.Sprintf("%q", e.Args()[1].StringValue())
+		if n32 < 0 {
+			n32 = -n32
+		}
+		n = int(n32)
+		scaleByStep = true
+	default:
+		err = parser.ErrBadType
+	}
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		return nil, fmt.Errorf("windowSize can't be negative")
+	}
+
+	callback, err := e.GetStringNamedOrPosArgDefault("func", 2, "average")
+	if err != nil {
+		return nil, err
+	}
+	aggFunc, ok := consolidations.ConsolidationToFunc[callback]
+	if !ok {
+		return nil, fmt.Errorf("unsupported consolidation function %s", callback)
+	}
+	target := "moving" + strings.ToUpper(callback[:1]) + callback[1:]
+
+	_, xffOk := e.NamedArgs()["xFilesFactor"]
+	if !xffOk {
+		xffOk = len(e.Args()) > 3
+	}
+	var xFilesFactor float64
+	if xffOk {
+		xFilesFactor, err = e.GetFloatNamedOrPosArgDefault("xFilesFactor", 3, 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	start := from
+	if scaleByStep {
+		start -= int64(n)
+	}
+
+	arg, err := helper.GetSeriesArg(e.Args()[0], start, until, values)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []*types.MetricData
+
+	for _, a := range arg {
+		windowSize := n
+		// with interval window the series is fetched with extra data before `from`, which is used only for the first windows
+		var offset int
+		if scaleByStep {
+			windowSize /= int(a.StepTime)
+			offset = windowSize
+		}
+		if offset > len(a.Values) {
+			offset = len(a.Values)
+		}
+
+		xff := a.XFilesFactor
+		if xffOk {
+			xff = float32(xFilesFactor)
+		}
+
+		r := *a
+		r.Name = fmt.Sprintf("%s(%s,%s)", target, a.Name, argstr)
+		r.StartTime = a.StartTime + int64(offset)*a.StepTime
+		r.Values = make([]float64, len(a.Values)-offset)
+
+		window := make([]float64, 0, windowSize)
+		for i := offset; i < len(a.Values); i++ {
+			ridx := i - offset
+			r.Values[ridx] = math.NaN()
+			if i < windowSize || windowSize == 0 {
+				continue
+			}
+
+			window = window[:0]
+			for _, v := range a.Values[i-windowSize : i] {
+				if !math.IsNaN(v) {
+					window = append(window, v)
+				}
+			}
+			if consolidations.XFilesFactor(len(window), windowSize, xff) {
+				r.Values[ridx] = aggFunc(window)
+			}
+		}
+		results = append(results, &r)
+	}
+
+	return results, nil
+}
+
+// Description is auto-generated description, based on output of https://github.com/graphite-project/graphite-web
+func (f *movingWindow) Description() map[string]types.FunctionDescription {
+	return map[string]types.FunctionDescription{
+		"movingWindow": {
+			Description: "Graphs a moving window function of a metric (or metrics) over a fixed number of\npast points, or a time interval.\n\nTakes one metric or a wildcard seriesList, a number N of datapoints\nor a quoted string with a length of time like '1hour' or '5min' (See ``from /\nuntil`` in the render\\_api_ for examples of time formats), a function to apply to the points\nin the window to produce the output, and an xFilesFactor value to specify how many points in the\nwindow must be non-null for the output to be considered valid. Graphs the\noutput of the function for the preceeding datapoints for each point on the graph.\n\nExample:\n\n.. code-block:: none\n\n  &target=movingWindow(Server.instance01.threads.busy,10)\n  &target=movingWindow(Server.instance*.threads.idle,'5min','median',0.5)\n\n.. note::\n\n  `xFilesFactor` follows the same semantics as in Whisper storage schemas.  Setting it to 0 (the\n  default) means that only a single value in a given interval needs to be non-null, setting it to\n  1 means that all values in the interval must be non-null.  A setting of 0.5 means that at least\n  half the values in the interval must be non-null.",
+			Function:    "movingWindow(seriesList, windowSize, func='average', xFilesFactor=None)",
+			Group:       "Calculate",
+			Module:      "graphite.render.functions",
+			Name:        "movingWindow",
+			Params: []types.FunctionParam{
+				{
+					Name:     "seriesList",
+					Required: true,
+					Type:     types.SeriesList,
+				},
+				{
+					Name:     "windowSize",
+					Required: true,
+					Suggestions: types.NewSuggestions(
+						5,
+						7,
+						10,
+						"1min",
+						"5min",
+						"10min",
+						"30min",
+						"1hour",
+					),
+					Type: types.IntOrInterval,
+				},
+				{
+					Default: types.NewSuggestion("average"),
+					Name:    "func",
+					Options: consolidations.AvailableConsolidationFuncs(),
+					Type:    types.AggFunc,
+				},
+				{
+					Name: "xFilesFactor",
+					Type: types.Float,
+				},
+			},
+		},
+	}
+}
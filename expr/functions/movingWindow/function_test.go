@@ -0,0 +1,80 @@
+package movingWindow
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/metadata"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	th "github.com/go-graphite/carbonapi/tests"
+)
+
+func init() {
+	md := New("")
+	evaluator := th.EvaluatorFromFunc(md[0].F)
+	metadata.SetEvaluator(evaluator)
+	helper.SetEvaluator(evaluator)
+	for _, m := range md {
+		metadata.RegisterFunction(m.Name, m.F)
+	}
+}
+
+func TestMovingWindow(t *testing.T) {
+	now32 := int64(time.Now().Unix())
+
+	tests := []th.EvalTestItem{
+		{
+			"movingWindow(metric1,2)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{1, 2, 3, 4, 5, 6}, 1, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData("movingAverage(metric1,2)", []float64{math.NaN(), math.NaN(), 1.5, 2.5, 3.5, 4.5}, 1, now32)},
+		},
+		{
+			`movingWindow(metric1,2,"sum")`,
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{1, 2, 3, 4, 5, 6}, 1, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData("movingSum(metric1,2)", []float64{math.NaN(), math.NaN(), 3, 5, 7, 9}, 1, now32)},
+		},
+		{
+			`movingWindow(metric1,3,"median")`,
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{1, 5, 2, 8, 3}, 1, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData("movingMedian(metric1,3)", []float64{math.NaN(), math.NaN(), math.NaN(), 2, 5}, 1, now32)},
+		},
+		{
+			`movingWindow(metric1,2,"average",1)`,
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{1, math.NaN(), 3, 4, 5}, 1, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData("movingAverage(metric1,2)", []float64{math.NaN(), math.NaN(), math.NaN(), math.NaN(), 3.5}, 1, now32)},
+		},
+		{
+			`movingWindow(metric1,2,xFilesFactor=0.5)`,
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{1, math.NaN(), 3, 4, 5}, 1, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData("movingAverage(metric1,2)", []float64{math.NaN(), math.NaN(), 1, 3, 3.5}, 1, now32)},
+		},
+		{
+			// data before `from` is fetched for the window and isn't returned
+			`movingWindow(metric1,"2s","max")`,
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", -2, 1}: {types.MakeMetricData("metric1", []float64{1, 2, 3, 4, 5, 6}, 1, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData(`movingMax(metric1,"2s")`, []float64{2, 3, 4, 5}, 1, now32+2)},
+		},
+	}
+
+	for _, tt := range tests {
+		testName := tt.Target
+		t.Run(testName, func(t *testing.T) {
+			th.TestEvalExpr(t, &tt)
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package powSeries
+
+import (
+	"context"
+	"math"
+
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/interfaces"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+type powSeries struct {
+	interfaces.FunctionBase
+}
+
+func GetOrder() interfaces.Order {
+	return interfaces.Any
+}
+
+func New(configFile string) []interfaces.FunctionMetadata {
+	res := make([]interfaces.FunctionMetadata, 0)
+	f := &powSeries{}
+	functions := []string{"powSeries"}
+	for _, n := range functions {
+		res = append(res, interfaces.FunctionMetadata{Name: n, F: f})
+	}
+	return res
+}
+
+// powSeries(*seriesLists)
+func (f *powSeries) Do(ctx context.Context, e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+	args, err := helper.GetSeriesArgsAndRemoveNonExisting(e, from, until, values)
+	if err != nil {
+		return nil, err
+	}
+
+	return helper.AggregateSeries(e, args, func(values []float64) float64 {
+		result := values[0]
+		for _, v := range values[1:] {
+			if math.IsNaN(result) || math.IsNaN(v) {
+				return math.NaN()
+			}
+			result = math.Pow(result, v)
+		}
+		if math.IsInf(result, 0) {
+			return math.NaN()
+		}
+		return result
+	})
+}
+
+// Description is auto-generated description, based on output of https://github.com/graphite-project/graphite-web
+func (f *powSeries) Description() map[string]types.FunctionDescription {
+	return map[string]types.FunctionDescription{
+		"powSeries": {
+			Description: "Takes two or more series and pows their points. A constant line may be\nused.\n\nExample:\n\n.. code-block:: none\n\n  &target=powSeries(Server.instance01.app.requests, Server.instance01.app.replies)",
+			Function:    "powSeries(*seriesLists)",
+			Group:       "Combine",
+			Module:      "graphite.render.functions",
+			Name:        "powSeries",
+			Params: []types.FunctionParam{
+				{
+					Multiple: true,
+					Name:     "seriesList",
+					Required: true,
+					Type:     types.SeriesList,
+				},
+			},
+		},
+	}
+}
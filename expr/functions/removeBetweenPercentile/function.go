@@ -0,0 +1,107 @@
+package removeBetweenPercentile
+
+import (
+	"context"
+	"math"
+
+	"github.com/go-graphite/carbonapi/expr/consolidations"
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/interfaces"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+type removeBetweenPercentile struct {
+	interfaces.FunctionBase
+}
+
+func GetOrder() interfaces.Order {
+	return interfaces.Any
+}
+
+func New(configFile string) []interfaces.FunctionMetadata {
+	res := make([]interfaces.FunctionMetadata, 0)
+	f := &removeBetweenPercentile{}
+	functions := []string{"removeBetweenPercentile"}
+	for _, n := range functions {
+		res = append(res, interfaces.FunctionMetadata{Name: n, F: f})
+	}
+	return res
+}
+
+// removeBetweenPercentile(seriesList, n)
+func (f *removeBetweenPercentile) Do(ctx context.Context, e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+	args, err := helper.GetSeriesArg(e.Args()[0], from, until, values)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := e.GetFloatArg(1)
+	if err != nil {
+		return nil, err
+	}
+	if n < 50 {
+		n = 100 - n
+	}
+
+	length := 0
+	for _, a := range args {
+		if len(a.Values) > length {
+			length = len(a.Values)
+		}
+	}
+
+	lowPercentiles := make([]float64, length)
+	highPercentiles := make([]float64, length)
+	column := make([]float64, len(args))
+	for i := 0; i < length; i++ {
+		for j, a := range args {
+			column[j] = math.NaN()
+			if i < len(a.Values) {
+				column[j] = a.Values[i]
+			}
+		}
+		lowPercentiles[i] = consolidations.Percentile(column, 100-n, false)
+		highPercentiles[i] = consolidations.Percentile(column, n, false)
+	}
+
+	var results []*types.MetricData
+	for _, a := range args {
+		for i, v := range a.Values {
+			if math.IsNaN(v) {
+				continue
+			}
+			if !(lowPercentiles[i] < v && v < highPercentiles[i]) {
+				results = append(results, a)
+				break
+			}
+		}
+	}
+
+	return results, nil
+}
+
+// Description is auto-generated description, based on output of https://github.com/graphite-project/graphite-web
+func (f *removeBetweenPercentile) Description() map[string]types.FunctionDescription {
+	return map[string]types.FunctionDescription{
+		"removeBetweenPercentile": {
+			Description: "Removes series that do not have an value lying in the x-percentile of all the values at a moment",
+			Function:    "removeBetweenPercentile(seriesList, n)",
+			Group:       "Filter Series",
+			Module:      "graphite.render.functions",
+			Name:        "removeBetweenPercentile",
+			Params: []types.FunctionParam{
+				{
+					Name:     "seriesList",
+					Required: true,
+					Type:     types.SeriesList,
+				},
+				{
+					Name:     "n",
+					Required: true,
+					Type:     types.Integer,
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,73 @@
+package removeBetweenPercentile
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/metadata"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	th "github.com/go-graphite/carbonapi/tests"
+)
+
+func init() {
+	md := New("")
+	evaluator := th.EvaluatorFromFunc(md[0].F)
+	metadata.SetEvaluator(evaluator)
+	helper.SetEvaluator(evaluator)
+	for _, m := range md {
+		metadata.RegisterFunction(m.Name, m.F)
+	}
+}
+
+func TestRemoveBetweenPercentile(t *testing.T) {
+	now32 := int64(time.Now().Unix())
+
+	tests := []th.EvalTestItem{
+		{
+			"removeBetweenPercentile(metric[12345],80)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric[12345]", 0, 1}: {
+					types.MakeMetricData("metric1", []float64{1, 1, 1}, 1, now32),
+					types.MakeMetricData("metric2", []float64{2, 2, 2}, 1, now32),
+					types.MakeMetricData("metric3", []float64{3, 3, 3}, 1, now32),
+					types.MakeMetricData("metric4", []float64{4, math.NaN(), 4}, 1, now32),
+					types.MakeMetricData("metric5", []float64{5, 5, 5}, 1, now32),
+				},
+			},
+			[]*types.MetricData{
+				types.MakeMetricData("metric1", []float64{1, 1, 1}, 1, now32),
+				types.MakeMetricData("metric2", []float64{2, 2, 2}, 1, now32),
+				types.MakeMetricData("metric5", []float64{5, 5, 5}, 1, now32),
+			},
+		},
+		{
+			// series is kept if any of its points lies outside of the interval
+			"removeBetweenPercentile(metric[12345],20)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric[12345]", 0, 1}: {
+					types.MakeMetricData("metric1", []float64{1, 1, 1}, 1, now32),
+					types.MakeMetricData("metric2", []float64{2, 2, 2}, 1, now32),
+					types.MakeMetricData("metric3", []float64{3, 3, 3}, 1, now32),
+					types.MakeMetricData("metric4", []float64{4, math.NaN(), 10}, 1, now32),
+					types.MakeMetricData("metric5", []float64{5, 5, 5}, 1, now32),
+				},
+			},
+			[]*types.MetricData{
+				types.MakeMetricData("metric1", []float64{1, 1, 1}, 1, now32),
+				types.MakeMetricData("metric2", []float64{2, 2, 2}, 1, now32),
+				types.MakeMetricData("metric4", []float64{4, math.NaN(), 10}, 1, now32),
+				types.MakeMetricData("metric5", []float64{5, 5, 5}, 1, now32),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		testName := tt.Target
+		t.Run(testName, func(t *testing.T) {
+			th.TestEvalExpr(t, &tt)
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"math"
 
+	"github.com/go-graphite/carbonapi/expr/consolidations"
 	"github.com/go-graphite/carbonapi/expr/helper"
 	"github.com/go-graphite/carbonapi/expr/interfaces"
 	"github.com/go-graphite/carbonapi/expr/types"
@@ -35,11 +36,18 @@ func (f *removeEmptySeries) Do(ctx context.Context, e parser.Expr, from, until i
 		return nil, err
 	}
 
-	// TODO: implement xFilesFactor
+	// graphite-web uses 0 if xFilesFactor is not specified, xFilesFactor of the series is ignored
+	xff, err := e.GetFloatNamedOrPosArgDefault("xFilesFactor", 1, 0)
+	if err != nil {
+		return nil, err
+	}
 
 	var results []*types.MetricData
 
 	for _, a := range args {
+		if !consolidations.XFilesFactorValues(a.Values, float32(xff)) {
+			continue
+		}
 		for _, v := range a.Values {
 			if !math.IsNaN(v) {
 				if e.Target() == "removeEmptySeries" || (v != 0) {
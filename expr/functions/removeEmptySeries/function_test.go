@@ -53,6 +53,44 @@ func TestFunction(t *testing.T) {
 				types.MakeMetricData("metric1", []float64{1, 2, -1, 7, 8, 20, 30, math.NaN()}, 1, now32),
 			},
 		},
+		{
+			"removeEmptySeries(metric*, 0.5)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric*", 0, 1}: {
+					types.MakeMetricData("metric1", []float64{1, 2, -1, 7, math.NaN(), math.NaN(), math.NaN(), math.NaN()}, 1, now32),
+					types.MakeMetricData("metric2", []float64{math.NaN(), math.NaN(), math.NaN(), math.NaN(), math.NaN(), math.NaN(), math.NaN(), 1}, 1, now32),
+					types.MakeMetricData("metric3", []float64{0, 0, 0, 0, 0, 0, 0, 0}, 1, now32),
+				},
+			},
+			[]*types.MetricData{
+				types.MakeMetricData("metric1", []float64{1, 2, -1, 7, math.NaN(), math.NaN(), math.NaN(), math.NaN()}, 1, now32),
+				types.MakeMetricData("metric3", []float64{0, 0, 0, 0, 0, 0, 0, 0}, 1, now32),
+			},
+		},
+		{
+			"removeZeroSeries(metric*, xFilesFactor=0.5)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric*", 0, 1}: {
+					types.MakeMetricData("metric1", []float64{1, 2, -1, 7, math.NaN(), math.NaN(), math.NaN(), math.NaN()}, 1, now32),
+					types.MakeMetricData("metric2", []float64{math.NaN(), math.NaN(), math.NaN(), math.NaN(), math.NaN(), math.NaN(), math.NaN(), 1}, 1, now32),
+					types.MakeMetricData("metric3", []float64{0, 0, 0, 0, 0, 0, 0, 0}, 1, now32),
+				},
+			},
+			[]*types.MetricData{
+				types.MakeMetricData("metric1", []float64{1, 2, -1, 7, math.NaN(), math.NaN(), math.NaN(), math.NaN()}, 1, now32),
+			},
+		},
+		{
+			"removeEmptySeries(metric*)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric*", 0, 1}: {
+					withXFilesFactor(types.MakeMetricData("metric1", []float64{1, math.NaN(), math.NaN(), math.NaN()}, 1, now32), 1),
+				},
+			},
+			[]*types.MetricData{
+				withXFilesFactor(types.MakeMetricData("metric1", []float64{1, math.NaN(), math.NaN(), math.NaN()}, 1, now32), 1),
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -63,3 +101,9 @@ func TestFunction(t *testing.T) {
 	}
 
 }
+
+// withXFilesFactor sets xFilesFactor carried by the series
+func withXFilesFactor(m *types.MetricData, xFilesFactor float32) *types.MetricData {
+	m.XFilesFactor = xFilesFactor
+	return m
+}
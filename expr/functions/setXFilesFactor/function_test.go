@@ -0,0 +1,92 @@
+package setXFilesFactor
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/metadata"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	th "github.com/go-graphite/carbonapi/tests"
+)
+
+func init() {
+	md := New("")
+	evaluator := th.EvaluatorFromFunc(md[0].F)
+	metadata.SetEvaluator(evaluator)
+	helper.SetEvaluator(evaluator)
+	for _, m := range md {
+		metadata.RegisterFunction(m.Name, m.F)
+	}
+}
+
+func TestSetXFilesFactor(t *testing.T) {
+	now32 := int64(time.Now().Unix())
+
+	tests := []struct {
+		target       string
+		xFilesFactor float32
+		tag          string
+		consolidated []float64
+	}{
+		{
+			target:       "setXFilesFactor(metric1,0.5)",
+			xFilesFactor: 0.5,
+			tag:          "0.5",
+			consolidated: []float64{1, math.NaN(), 3},
+		},
+		{
+			target:       "xFilesFactor(metric1,1)",
+			xFilesFactor: 1,
+			tag:          "1",
+			consolidated: []float64{math.NaN(), math.NaN(), 3},
+		},
+		{
+			target:       "xFilesFactor(metric1,0)",
+			xFilesFactor: 0,
+			tag:          "0",
+			consolidated: []float64{1, 2, 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			m := map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{1, 1, math.NaN(), 2, math.NaN(), math.NaN(), 3, 3}, 1, now32)},
+			}
+			originalMetrics := th.DeepClone(m)
+
+			exp, _, err := parser.ParseExpr(tt.target)
+			if err != nil {
+				t.Fatalf("failed to parse %s: %+v", tt.target, err)
+			}
+			g, err := metadata.GetEvaluator().Eval(context.Background(), exp, 0, 1, m)
+			if err != nil {
+				t.Fatalf("failed to eval %s: %+v", tt.target, err)
+			}
+			th.DeepEqual(t, tt.target, originalMetrics, m)
+
+			if len(g) != 1 {
+				t.Fatalf("unexpected number of results: %d", len(g))
+			}
+			if g[0].Name != "metric1" {
+				t.Errorf("unexpected name: got %s, want metric1", g[0].Name)
+			}
+			if g[0].XFilesFactor != tt.xFilesFactor {
+				t.Errorf("unexpected xFilesFactor: got %v, want %v", g[0].XFilesFactor, tt.xFilesFactor)
+			}
+			if g[0].Tags["xFilesFactor"] != tt.tag {
+				t.Errorf("unexpected xFilesFactor tag: got %v, want %v", g[0].Tags["xFilesFactor"], tt.tag)
+			}
+
+			g[0].ConsolidationFunc = "average"
+			g[0].SetValuesPerPoint(3)
+			if !th.NearlyEqual(g[0].AggregatedValues(), tt.consolidated) {
+				t.Errorf("unexpected consolidated values: got %v, want %v", g[0].AggregatedValues(), tt.consolidated)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package sinFunction
+
+import (
+	"context"
+	"errors"
+	"math"
+
+	"github.com/go-graphite/carbonapi/expr/interfaces"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+)
+
+type sinFunction struct {
+	interfaces.FunctionBase
+}
+
+func GetOrder() interfaces.Order {
+	return interfaces.Any
+}
+
+func New(configFile string) []interfaces.FunctionMetadata {
+	res := make([]interfaces.FunctionMetadata, 0)
+	f := &sinFunction{}
+	functions := []string{"sinFunction", "sin"}
+	for _, n := range functions {
+		res = append(res, interfaces.FunctionMetadata{Name: n, F: f})
+	}
+	return res
+}
+
+// sinFunction(name, amplitude=1, step=60)
+func (f *sinFunction) Do(ctx context.Context, e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+	name, err := e.GetStringArg(0)
+	if err != nil {
+		return nil, err
+	}
+
+	amplitude, err := e.GetFloatNamedOrPosArgDefault("amplitude", 1, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	stepInt, err := e.GetIntNamedOrPosArgDefault("step", 2, 60)
+	if err != nil {
+		return nil, err
+	}
+	if stepInt <= 0 {
+		return nil, errors.New("step can't be less than 0")
+	}
+	step := int64(stepInt)
+
+	newValues := make([]float64, (until-from-1+step)/step)
+	value := from
+	for i := 0; i < len(newValues); i++ {
+		newValues[i] = math.Sin(float64(value)) * amplitude
+		value += step
+	}
+
+	p := types.MetricData{
+		FetchResponse: pb.FetchResponse{
+			Name:              name,
+			StartTime:         from,
+			StopTime:          until,
+			StepTime:          step,
+			Values:            newValues,
+			ConsolidationFunc: "average",
+		},
+	}
+
+	return []*types.MetricData{&p}, nil
+}
+
+// Description is auto-generated description, based on output of https://github.com/graphite-project/graphite-web
+func (f *sinFunction) Description() map[string]types.FunctionDescription {
+	return map[string]types.FunctionDescription{
+		"sinFunction": {
+			Description: "Short Alias: sin()\n\nJust returns the sine of the current time. The optional amplitude parameter\nchanges the amplitude of the wave.\n\nExample:\n\n.. code-block:: none\n\n  &target=sin(\"The.time.series\", 2)\n\nThis would create a series named \"The.time.series\" that contains sin(x)*2.\nAccepts optional second argument as 'amplitude' parameter (default amplitude is 1)\nAccepts optional third argument as 'step' parameter (default step is 60 sec)",
+			Function:    "sinFunction(name, amplitude=1, step=60)",
+			Group:       "Transform",
+			Module:      "graphite.render.functions",
+			Name:        "sinFunction",
+			Params: []types.FunctionParam{
+				{
+					Name:     "name",
+					Required: true,
+					Type:     types.String,
+				},
+				{
+					Default: types.NewSuggestion(1),
+					Name:    "amplitude",
+					Type:    types.Integer,
+				},
+				{
+					Default: types.NewSuggestion(60),
+					Name:    "step",
+					Type:    types.Integer,
+				},
+			},
+		},
+		"sin": {
+			Description: "Short Alias: sin()\n\nJust returns the sine of the current time. The optional amplitude parameter\nchanges the amplitude of the wave.\n\nExample:\n\n.. code-block:: none\n\n  &target=sin(\"The.time.series\", 2)\n\nThis would create a series named \"The.time.series\" that contains sin(x)*2.\nAccepts optional second argument as 'amplitude' parameter (default amplitude is 1)\nAccepts optional third argument as 'step' parameter (default step is 60 sec)",
+			Function:    "sin(name, amplitude=1, step=60)",
+			Group:       "Transform",
+			Module:      "graphite.render.functions",
+			Name:        "sin",
+			Params: []types.FunctionParam{
+				{
+					Name:     "name",
+					Required: true,
+					Type:     types.String,
+				},
+				{
+					Default: types.NewSuggestion(1),
+					Name:    "amplitude",
+					Type:    types.Integer,
+				},
+				{
+					Default: types.NewSuggestion(60),
+					Name:    "step",
+					Type:    types.Integer,
+				},
+			},
+		},
+	}
+}
@@ -138,7 +138,10 @@ func (f *summarize) Do(ctx context.Context, e parser.Expr, from, until int64, va
 			}
 
 			if t >= bucketEnd {
-				rv := consolidations.SummarizeValues(summarizeFunction, values)
+				rv := math.NaN()
+				if consolidations.XFilesFactor(len(values), bucketItems, arg.XFilesFactor) {
+					rv = consolidations.SummarizeValues(summarizeFunction, values)
+				}
 
 				r.Values[ridx] = rv
 				ridx++
@@ -150,7 +153,10 @@ func (f *summarize) Do(ctx context.Context, e parser.Expr, from, until int64, va
 
 		// last partial bucket
 		if bucketItems > 0 {
-			rv := consolidations.SummarizeValues(summarizeFunction, values)
+			rv := math.NaN()
+			if consolidations.XFilesFactor(len(values), bucketItems, arg.XFilesFactor) {
+				rv = consolidations.SummarizeValues(summarizeFunction, values)
+			}
 			r.Values[ridx] = rv
 		}
 
@@ -199,9 +199,30 @@ func TestEvalSummarize(t *testing.T) {
 			tenThirtyTwo,
 			tenThirtyTwo + 25*60,
 		},
+		{
+			"summarize(metric1,'5s')",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {withXFilesFactor(types.MakeMetricData("metric1", []float64{
+					1, 1, 1, 1, 1,
+					2, math.NaN(), 2, math.NaN(), 2,
+					3, math.NaN(), math.NaN(), math.NaN(), 3,
+					math.NaN(), math.NaN(), math.NaN(), math.NaN(), math.NaN(),
+				}, 1, now32), 0.5)},
+			},
+			[]float64{5, 6, math.NaN(), math.NaN()},
+			"summarize(metric1,'5s')",
+			5,
+			now32,
+			now32 + 20,
+		},
 	}
 
 	for _, tt := range tests {
 		th.TestSummarizeEvalExpr(t, &tt)
 	}
 }
+
+func withXFilesFactor(m *types.MetricData, xFilesFactor float32) *types.MetricData {
+	m.XFilesFactor = xFilesFactor
+	return m
+}
@@ -3,11 +3,14 @@ package timeShift
 import (
 	"context"
 	"fmt"
+	"time"
 
+	"github.com/go-graphite/carbonapi/date"
 	"github.com/go-graphite/carbonapi/expr/helper"
 	"github.com/go-graphite/carbonapi/expr/interfaces"
 	"github.com/go-graphite/carbonapi/expr/types"
 	"github.com/go-graphite/carbonapi/pkg/parser"
+	utilctx "github.com/go-graphite/carbonapi/util/ctx"
 )
 
 type timeShift struct {
@@ -28,33 +31,105 @@ func New(configFile string) []interfaces.FunctionMetadata {
 	return res
 }
 
-// timeShift(seriesList, timeShift, resetEnd=True)
+// dstWindow is the amount of additional data fetched on each side of the interval when alignDST is requested, it must
+// be the same as in parser
+const dstWindow = 3600
+
+// timeShift(seriesList, timeShift, resetEnd=True, alignDST=False)
 func (f *timeShift) Do(ctx context.Context, e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
 	// FIXME(dgryski): support resetEnd=true
-	// FIXME(civil): support alignDst
 	offs, err := e.GetIntervalArg(1, -1)
 	if err != nil {
 		return nil, err
 	}
 
-	arg, err := helper.GetSeriesArg(e.Args()[0], from+int64(offs), until+int64(offs), values)
+	alignDST, err := e.GetBoolNamedOrPosArgDefault("alignDST", 3, false)
 	if err != nil {
 		return nil, err
 	}
+	if !alignDST {
+		alignDST, err = e.GetBoolNamedOrPosArgDefault("alignDst", 3, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !alignDST {
+		arg, err := helper.GetSeriesArg(e.Args()[0], from+int64(offs), until+int64(offs), values)
+		if err != nil {
+			return nil, err
+		}
+
+		var results []*types.MetricData
+
+		for _, a := range arg {
+			r := *a
+			r.Name = fmt.Sprintf("timeShift(%s,'%d')", a.Name, offs)
+			r.StartTime = a.StartTime - int64(offs)
+			r.StopTime = a.StopTime - int64(offs)
+			results = append(results, &r)
+		}
+
+		return results, nil
+	}
+
+	arg, err := helper.GetSeriesArg(e.Args()[0], from+int64(offs)-dstWindow, until+int64(offs)+dstWindow, values)
+	if err != nil {
+		return nil, err
+	}
+
+	shift := int64(offs) + dstOffset(from, until, int64(offs), utilctx.GetTimeZone(ctx))
 
 	var results []*types.MetricData
 
 	for _, a := range arg {
 		r := *a
 		r.Name = fmt.Sprintf("timeShift(%s,'%d')", a.Name, offs)
-		r.StartTime = a.StartTime - int64(offs)
-		r.StopTime = a.StopTime - int64(offs)
+		r.Values, r.StartTime = slice(a, from+shift, until+shift)
+		r.StartTime -= shift
+		r.StopTime = r.StartTime + int64(len(r.Values))*r.StepTime
 		results = append(results, &r)
 	}
 
 	return results, nil
 }
 
+// dstOffset returns the correction (in seconds) of the shift, needed to align series when only one of the intervals is
+// entirely in DST. Same as graphite-web, nothing is done if any of the intervals contains DST change.
+func dstOffset(from, until, offs int64, tz *time.Location) int64 {
+	reqStartDST := date.IsDST(time.Unix(from, 0).In(tz))
+	reqEndDST := date.IsDST(time.Unix(until, 0).In(tz))
+	shiftedStartDST := date.IsDST(time.Unix(from+offs, 0).In(tz))
+	shiftedEndDST := date.IsDST(time.Unix(until+offs, 0).In(tz))
+
+	switch {
+	case reqStartDST && reqEndDST && !shiftedStartDST && !shiftedEndDST:
+		return 3600
+	case !reqStartDST && !reqEndDST && shiftedStartDST && shiftedEndDST:
+		return -3600
+	}
+	return 0
+}
+
+// slice returns values of the series between from and until and the timestamp of the first of them
+func slice(a *types.MetricData, from, until int64) ([]float64, int64) {
+	start := 0
+	if from > a.StartTime {
+		start = int((from - a.StartTime + a.StepTime - 1) / a.StepTime)
+	}
+	end := len(a.Values)
+	if until < a.StopTime {
+		end = int((until - a.StartTime + a.StepTime - 1) / a.StepTime)
+	}
+	if start > len(a.Values) {
+		start = len(a.Values)
+	}
+	if end < start {
+		end = start
+	}
+	return a.Values[start:end], a.StartTime + int64(start)*a.StepTime
+}
+
 // Description is auto-generated description, based on output of https://github.com/graphite-project/graphite-web
 func (f *timeShift) Description() map[string]types.FunctionDescription {
 	return map[string]types.FunctionDescription{
@@ -90,13 +165,11 @@ func (f *timeShift) Description() map[string]types.FunctionDescription {
 					Name:    "resetEnd",
 					Type:    types.Boolean,
 				},
-				/*
-					{
-						Default: types.NewSuggestion(false),
-						Name:    "alignDst",
-						Type:    types.Boolean,
-					},
-				*/
+				{
+					Default: types.NewSuggestion(false),
+					Name:    "alignDST",
+					Type:    types.Boolean,
+				},
 			},
 		},
 	}
@@ -1,6 +1,7 @@
 package timeShift
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -9,6 +10,7 @@ import (
 	"github.com/go-graphite/carbonapi/expr/types"
 	"github.com/go-graphite/carbonapi/pkg/parser"
 	th "github.com/go-graphite/carbonapi/tests"
+	utilctx "github.com/go-graphite/carbonapi/util/ctx"
 )
 
 func init() {
@@ -59,3 +61,72 @@ func TestAbsolute(t *testing.T) {
 	}
 
 }
+
+func TestAlignDST(t *testing.T) {
+	tz, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("time zone data is not available: %v", err)
+	}
+	ctx := utilctx.SetTimeZone(context.Background(), tz)
+
+	tests := []struct {
+		target    string
+		from      int64
+		until     int64
+		want      []float64
+		wantStart int64
+	}{
+		{
+			// 2 Apr 2020 is in DST, week before DST change it was not, so the shift is one hour shorter
+			target:    `timeShift(metric1, "7d", alignDST=true)`,
+			from:      time.Date(2020, time.April, 2, 8, 0, 0, 0, tz).Unix(),
+			until:     time.Date(2020, time.April, 2, 11, 0, 0, 0, tz).Unix(),
+			want:      []float64{2, 3, 4},
+			wantStart: time.Date(2020, time.April, 2, 8, 0, 0, 0, tz).Unix(),
+		},
+		{
+			target:    `timeShift(metric1, "7d", true, True)`,
+			from:      time.Date(2020, time.October, 30, 8, 0, 0, 0, tz).Unix(),
+			until:     time.Date(2020, time.October, 30, 11, 0, 0, 0, tz).Unix(),
+			want:      []float64{0, 1, 2},
+			wantStart: time.Date(2020, time.October, 30, 8, 0, 0, 0, tz).Unix(),
+		},
+		{
+			target:    `timeShift(metric1, "1d", alignDst=true)`,
+			from:      time.Date(2020, time.June, 2, 8, 0, 0, 0, tz).Unix(),
+			until:     time.Date(2020, time.June, 2, 11, 0, 0, 0, tz).Unix(),
+			want:      []float64{1, 2, 3},
+			wantStart: time.Date(2020, time.June, 2, 8, 0, 0, 0, tz).Unix(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			exp, _, err := parser.ParseExpr(tt.target)
+			if err != nil {
+				t.Fatalf("failed to parse %s: %v", tt.target, err)
+			}
+
+			// series with one hour step, that contains one more hour on each side of the shifted interval
+			m := exp.Metrics()[0]
+			m.From += tt.from
+			m.Until += tt.until
+			series := types.MakeMetricData("metric1", []float64{0, 1, 2, 3, 4}, 3600, m.From)
+			values := map[parser.MetricRequest][]*types.MetricData{m: {series}}
+
+			g, err := metadata.GetEvaluator().Eval(ctx, exp, tt.from, tt.until, values)
+			if err != nil {
+				t.Fatalf("failed to eval %s: %v", tt.target, err)
+			}
+			if len(g) != 1 {
+				t.Fatalf("expected 1 series, got %d", len(g))
+			}
+			if g[0].StartTime != tt.wantStart {
+				t.Errorf("bad start time: got %v, want %v", time.Unix(g[0].StartTime, 0).In(tz), time.Unix(tt.wantStart, 0).In(tz))
+			}
+			if !th.NearlyEqual(g[0].Values, tt.want) {
+				t.Errorf("bad values: got %v, want %v", g[0].Values, tt.want)
+			}
+		})
+	}
+}
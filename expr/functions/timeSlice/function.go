@@ -0,0 +1,125 @@
+package timeSlice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/go-graphite/carbonapi/date"
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/interfaces"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	utilctx "github.com/go-graphite/carbonapi/util/ctx"
+)
+
+type timeSlice struct {
+	interfaces.FunctionBase
+}
+
+func GetOrder() interfaces.Order {
+	return interfaces.Any
+}
+
+func New(configFile string) []interfaces.FunctionMetadata {
+	res := make([]interfaces.FunctionMetadata, 0)
+	f := &timeSlice{}
+	functions := []string{"timeSlice"}
+	for _, n := range functions {
+		res = append(res, interfaces.FunctionMetadata{Name: n, F: f})
+	}
+	return res
+}
+
+// getTimeArg returns n-th argument as unix timestamp. It could be either a timestamp or a graphite time specification (e.x. "-1h" or "12:00_20200101")
+// in the time zone of the request
+func getTimeArg(ctx context.Context, e parser.Expr, n int, d string) (int64, error) {
+	if len(e.Args()) > n && e.Args()[n].Type() == parser.EtConst {
+		t, err := e.GetIntArg(n)
+		return int64(t), err
+	}
+
+	s, err := e.GetStringArgDefault(n, d)
+	if err != nil {
+		return 0, err
+	}
+
+	t := date.DateParamToEpoch(s, "", math.MinInt64, utilctx.GetTimeZone(ctx))
+	if t == math.MinInt64 {
+		return 0, fmt.Errorf("invalid time specification %q", s)
+	}
+	return t, nil
+}
+
+// timeSlice(seriesList, startSliceAt, endSliceAt='now')
+func (f *timeSlice) Do(ctx context.Context, e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+	arg, err := helper.GetSeriesArg(e.Args()[0], from, until, values)
+	if err != nil {
+		return nil, err
+	}
+
+	start, err := getTimeArg(ctx, e, 1, "")
+	if err != nil {
+		return nil, err
+	}
+
+	end, err := getTimeArg(ctx, e, 2, "now")
+	if err != nil {
+		return nil, err
+	}
+
+	if end < start {
+		return nil, errors.New("endSliceAt must be after startSliceAt")
+	}
+
+	var results []*types.MetricData
+
+	for _, a := range arg {
+		r := *a
+		r.Name = fmt.Sprintf("timeSlice(%s, %d, %d)", a.Name, start, end)
+		r.Values = make([]float64, len(a.Values))
+
+		t := a.StartTime
+		for i, v := range a.Values {
+			if t < start || t > end {
+				r.Values[i] = math.NaN()
+			} else {
+				r.Values[i] = v
+			}
+			t += a.StepTime
+		}
+		results = append(results, &r)
+	}
+	return results, nil
+}
+
+// Description is auto-generated description, based on output of https://github.com/graphite-project/graphite-web
+func (f *timeSlice) Description() map[string]types.FunctionDescription {
+	return map[string]types.FunctionDescription{
+		"timeSlice": {
+			Description: "Takes one metric or a wildcard metric, followed by a quoted string with the\ntime to start the line and another quoted string with the time to end the line.\nThe start and end times are inclusive. See ``from / until`` in the render\\_api_\nfor examples of time formats.\n\nUseful for filtering out a part of a series of data from a wider range of\ndata.\n\nExample:\n\n.. code-block:: none\n\n  &target=timeSlice(network.core.port1,\"00:00 20140101\",\"11:59 20140630\")\n  &target=timeSlice(network.core.port1,\"12:00 20140630\",\"now\")",
+			Function:    "timeSlice(seriesList, startSliceAt, endSliceAt='now')",
+			Group:       "Transform",
+			Module:      "graphite.render.functions",
+			Name:        "timeSlice",
+			Params: []types.FunctionParam{
+				{
+					Name:     "seriesList",
+					Required: true,
+					Type:     types.SeriesList,
+				},
+				{
+					Name:     "startSliceAt",
+					Required: true,
+					Type:     types.Date,
+				},
+				{
+					Default: types.NewSuggestion("now"),
+					Name:    "endSliceAt",
+					Type:    types.Date,
+				},
+			},
+		},
+	}
+}
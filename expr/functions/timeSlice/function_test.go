@@ -0,0 +1,71 @@
+package timeSlice
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/metadata"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	th "github.com/go-graphite/carbonapi/tests"
+	utilctx "github.com/go-graphite/carbonapi/util/ctx"
+)
+
+func init() {
+	md := New("")
+	evaluator := th.EvaluatorFromFunc(md[0].F)
+	metadata.SetEvaluator(evaluator)
+	helper.SetEvaluator(evaluator)
+	for _, m := range md {
+		metadata.RegisterFunction(m.Name, m.F)
+	}
+}
+
+func TestTimeSlice(t *testing.T) {
+	tests := []th.EvalTestItem{
+		{
+			"timeSlice(metric1,1000000120,1000000240)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{1, 2, 3, 4, 5, 6}, 60, 1000000000)},
+			},
+			[]*types.MetricData{types.MakeMetricData("timeSlice(metric1, 1000000120, 1000000240)",
+				[]float64{math.NaN(), math.NaN(), 3, 4, 5, math.NaN()}, 60, 1000000000)},
+		},
+	}
+
+	for _, tt := range tests {
+		testName := tt.Target
+		t.Run(testName, func(t *testing.T) {
+			th.TestEvalExpr(t, &tt)
+		})
+	}
+}
+
+func TestTimeSliceTimeZone(t *testing.T) {
+	tz, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skipf("time zone data is not available: %v", err)
+	}
+	ctx := utilctx.SetTimeZone(context.Background(), tz)
+
+	// time specifications are in the time zone of the request, not in the local one of the server
+	start := time.Date(2020, time.January, 1, 12, 0, 0, 0, tz).Unix()
+	exp, _, err := parser.ParseExpr(`timeSlice(metric1, "12:00_20200101", "12:02_20200101")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[parser.MetricRequest][]*types.MetricData{
+		{"metric1", start - 60, start + 240}: {types.MakeMetricData("metric1", []float64{1, 2, 3, 4, 5}, 60, start-60)},
+	}
+	g, err := metadata.GetEvaluator().Eval(ctx, exp, start-60, start+240, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []float64{math.NaN(), 2, 3, 4, math.NaN()}
+	if len(g) != 1 || !th.NearlyEqual(g[0].Values, want) {
+		t.Errorf("unexpected result: %+v, want %v", g, want)
+	}
+}
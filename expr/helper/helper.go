@@ -9,6 +9,7 @@ import (
 	"unicode"
 	"unicode/utf8"
 
+	"github.com/go-graphite/carbonapi/expr/consolidations"
 	"github.com/go-graphite/carbonapi/expr/interfaces"
 	"github.com/go-graphite/carbonapi/expr/types"
 	"github.com/go-graphite/carbonapi/pkg/parser"
@@ -208,13 +209,19 @@ func AlignSeries(args []*types.MetricData) []*types.MetricData {
 // AggregateFunc type that defined aggregate function
 type AggregateFunc func([]float64) float64
 
-// AggregateSeries aggregates series
+// AggregateSeries aggregates series, xFilesFactor of the first series is used to decide if point should be null
 func AggregateSeries(e parser.Expr, args []*types.MetricData, function AggregateFunc) ([]*types.MetricData, error) {
+	return AggregateSeriesWithXFilesFactor(e, args, function, args[0].XFilesFactor)
+}
+
+// AggregateSeriesWithXFilesFactor aggregates series, point will be null if ratio of non-null values in it is less than xFilesFactor
+func AggregateSeriesWithXFilesFactor(e parser.Expr, args []*types.MetricData, function AggregateFunc, xFilesFactor float32) ([]*types.MetricData, error) {
 	args = AlignSeries(args)
 	length := len(args[0].Values)
 	r := *args[0]
 	r.Name = fmt.Sprintf("%s(%s)", e.Target(), e.RawArgs())
 	r.Values = make([]float64, length)
+	r.XFilesFactor = xFilesFactor
 
 	for i := range args[0].Values {
 		var values []float64
@@ -223,7 +230,7 @@ func AggregateSeries(e parser.Expr, args []*types.MetricData, function Aggregate
 		}
 
 		r.Values[i] = math.NaN()
-		if len(values) > 0 {
+		if consolidations.XFilesFactorValues(values, xFilesFactor) {
 			r.Values[i] = function(values)
 		}
 	}
@@ -7,6 +7,13 @@ import (
 	"math"
 )
 
+const (
+	// DefaultBootstrapInterval is the default amount of data (in seconds) before the requested interval used to bootstrap the model
+	DefaultBootstrapInterval = 7 * 86400
+	// DefaultSeasonality is the default length of the season (in seconds)
+	DefaultSeasonality = 86400
+)
+
 func holtWintersIntercept(alpha, actual, lastSeason, lastIntercept, lastSlope float64) float64 {
 	return alpha*(actual-lastSeason) + (1-alpha)*(lastIntercept+lastSlope)
 }
@@ -26,16 +33,18 @@ func holtWintersDeviation(gamma, actual, prediction, lastSeasonalDev float64) fl
 	return gamma*math.Abs(actual-prediction) + (1-gamma)*lastSeasonalDev
 }
 
-// HoltWintersAnalysis do Holt-Winters Analysis
-func HoltWintersAnalysis(series []float64, step int64) ([]float64, []float64) {
+// HoltWintersAnalysis do Holt-Winters Analysis, seasonality is the length of the season in seconds
+func HoltWintersAnalysis(series []float64, step int64, seasonality int64) ([]float64, []float64) {
 	const (
 		alpha = 0.1
 		beta  = 0.0035
 		gamma = 0.1
 	)
 
-	// season is currently one day
-	seasonLength := 24 * 60 * 60 / int(step)
+	seasonLength := int(seasonality / step)
+	if seasonLength < 1 {
+		seasonLength = 1
+	}
 
 	var (
 		intercepts  []float64
@@ -96,13 +105,11 @@ func HoltWintersAnalysis(series []float64, step int64) ([]float64, []float64) {
 		}
 
 		lastSeasonal := getLastSeasonal(i)
-		nextLastSeasonal := getLastSeasonal(i + 1)
 		lastSeasonalDev := getLastDeviation(i)
 
 		intercept := holtWintersIntercept(alpha, actual, lastSeasonal, lastIntercept, lastSlope)
 		slope := holtWintersSlope(beta, intercept, lastIntercept, lastSlope)
 		seasonal := holtWintersSeasonal(gamma, actual, intercept, lastSeasonal)
-		nextPred = intercept + slope + nextLastSeasonal
 		deviation := holtWintersDeviation(gamma, actual, prediction, lastSeasonalDev)
 
 		intercepts = append(intercepts, intercept)
@@ -110,18 +117,22 @@ func HoltWintersAnalysis(series []float64, step int64) ([]float64, []float64) {
 		seasonals = append(seasonals, seasonal)
 		predictions = append(predictions, prediction)
 		deviations = append(deviations, deviation)
+
+		// seasonal for the next point could be the one just calculated if season is only one point long
+		nextPred = intercept + slope + getLastSeasonal(i+1)
 	}
 
 	return predictions, deviations
 }
 
-// HoltWintersConfidenceBands do Holt-Winters Confidence Bands
-func HoltWintersConfidenceBands(series []float64, step int64, delta float64) ([]float64, []float64) {
+// HoltWintersConfidenceBands do Holt-Winters Confidence Bands. First bootstrapInterval seconds of the series are used
+// only to bootstrap the model and are not included in the result.
+func HoltWintersConfidenceBands(series []float64, step int64, delta float64, bootstrapInterval int64, seasonality int64) ([]float64, []float64) {
 	var lowerBand, upperBand []float64
 
-	predictions, deviations := HoltWintersAnalysis(series, step)
+	predictions, deviations := HoltWintersAnalysis(series, step, seasonality)
 
-	windowPoints := 7 * 86400 / step
+	windowPoints := WindowPoints(len(series), step, bootstrapInterval)
 
 	predictionsOfInterest := predictions[windowPoints:]
 	deviationsOfInterest := deviations[windowPoints:]
@@ -139,3 +150,12 @@ func HoltWintersConfidenceBands(series []float64, step int64, delta float64) ([]
 
 	return lowerBand, upperBand
 }
+
+// WindowPoints returns amount of points used for bootstrap, limited by the length of the series
+func WindowPoints(length int, step int64, bootstrapInterval int64) int {
+	windowPoints := int(bootstrapInterval / step)
+	if windowPoints > length {
+		return length
+	}
+	return windowPoints
+}
@@ -0,0 +1,56 @@
+package holtwinters
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHoltWintersAnalysisSeasonality(t *testing.T) {
+	const step = 86400
+
+	// ten weeks of daily data with a weekly pattern: quiet weekends and busy weekdays
+	series := make([]float64, 10*7)
+	for i := range series {
+		if i%7 < 5 {
+			series[i] = 100
+		} else {
+			series[i] = 10
+		}
+	}
+
+	errorSum := func(seasonality int64) float64 {
+		predictions, _ := HoltWintersAnalysis(series, step, seasonality)
+		var sum float64
+		// only the last week is used, when model is already bootstrapped
+		for i := len(series) - 7; i < len(series); i++ {
+			sum += math.Abs(series[i] - predictions[i])
+		}
+		return sum
+	}
+
+	daily := errorSum(DefaultSeasonality)
+	weekly := errorSum(7 * 86400)
+	if weekly >= daily {
+		t.Errorf("weekly seasonality should fit weekly pattern better than daily one: weekly error %v, daily error %v", weekly, daily)
+	}
+}
+
+func TestHoltWintersConfidenceBandsBootstrap(t *testing.T) {
+	series := []float64{1, 1, 1, 1, 1, 1}
+
+	tests := []struct {
+		bootstrapInterval int64
+		want              int
+	}{
+		{bootstrapInterval: 2 * 60, want: 4},
+		{bootstrapInterval: 0, want: 6},
+		{bootstrapInterval: DefaultBootstrapInterval, want: 0},
+	}
+
+	for _, tt := range tests {
+		lower, upper := HoltWintersConfidenceBands(series, 60, 3, tt.bootstrapInterval, DefaultSeasonality)
+		if len(lower) != tt.want || len(upper) != tt.want {
+			t.Errorf("bootstrapInterval %d: got %d lower and %d upper points, want %d", tt.bootstrapInterval, len(lower), len(upper), tt.want)
+		}
+	}
+}
@@ -0,0 +1,363 @@
+package seriescache
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/go-graphite/carbonapi/cache"
+	"github.com/go-graphite/carbonapi/expr/types"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+)
+
+// settleTime is the time after the end of the chunk when it's considered complete, so late points had a chance to
+// reach the backends. Only complete chunks are cached.
+const settleTime = 60
+
+// for testing
+var timeNow = time.Now
+
+// RenderFunc fetches series from the backends, e.x. zipper's Render
+type RenderFunc func(ctx context.Context, request pb.MultiFetchRequest) ([]*types.MetricData, *zipperTypes.Stats, merry.Error)
+
+// SeriesCache stores fetched series split in time chunks, aligned to chunk size. Consecutive requests for moving time
+// window (e.x. "last 24 hours") get most of the data from the cache and fetch only the missing tail from the backends.
+type SeriesCache struct {
+	cache     cache.BytesCache
+	chunkSize int64
+	expire    int32
+
+	hits   uint64
+	misses uint64
+}
+
+// New creates series cache on top of c. Complete chunks of chunkSize seconds are stored for expire seconds.
+func New(c cache.BytesCache, chunkSize int64, expire int32) *SeriesCache {
+	return &SeriesCache{
+		cache:     c,
+		chunkSize: chunkSize,
+		expire:    expire,
+	}
+}
+
+// Hits returns amount of chunks found in cache
+func (c *SeriesCache) Hits() uint64 { return atomic.LoadUint64(&c.hits) }
+
+// Misses returns amount of complete chunks that had to be fetched from backends
+func (c *SeriesCache) Misses() uint64 { return atomic.LoadUint64(&c.misses) }
+
+// cachedRequest is a fetch request with complete chunks found in cache
+type cachedRequest struct {
+	request pb.FetchRequest
+	// cacheable is false if request can't be served from cache (e.x. it's for the latest data only) and is passed as is
+	cacheable bool
+	// start of the first chunk
+	start  int64
+	chunks [][]*types.MetricData
+	// start of the first chunk that wasn't found in cache
+	fetchFrom int64
+}
+
+// Render returns series for the request. Cached chunks are used for the beginning of the requested interval, the rest
+// is fetched with render and stored in cache for the next requests. If cached and fetched series can't be stitched
+// together (e.x. resolution was changed), series are fetched for the whole interval and cached chunks are replaced.
+func (c *SeriesCache) Render(ctx context.Context, request pb.MultiFetchRequest, render RenderFunc) ([]*types.MetricData, *zipperTypes.Stats, merry.Error) {
+	now := timeNow().Unix()
+
+	var tails pb.MultiFetchRequest
+	requests := make([]*cachedRequest, 0, len(request.Metrics))
+	for _, r := range request.Metrics {
+		cr := c.lookup(r, now)
+		requests = append(requests, cr)
+		if !cr.cacheable {
+			tails.Metrics = append(tails.Metrics, r)
+		} else if cr.fetchFrom < r.StopTime {
+			tail := r
+			// backends usually return points after the start of the interval, so we ask for the point at fetchFrom explicitly
+			tail.StartTime = cr.fetchFrom - 1
+			tails.Metrics = append(tails.Metrics, tail)
+		}
+	}
+
+	var (
+		fetched = make(map[string][]*types.MetricData)
+		stats   *zipperTypes.Stats
+		err     merry.Error
+	)
+	if len(tails.Metrics) > 0 {
+		var metrics []*types.MetricData
+		metrics, stats, err = render(ctx, tails)
+		if err != nil && merry.HTTPCode(err) >= 400 {
+			return nil, stats, err
+		}
+		for _, m := range metrics {
+			fetched[m.PathExpression] = append(fetched[m.PathExpression], m)
+		}
+	}
+
+	var (
+		results   []*types.MetricData
+		fallback  pb.MultiFetchRequest
+		refetched []*cachedRequest
+	)
+	for _, cr := range requests {
+		tail := fetched[cr.request.PathExpression]
+		if !cr.cacheable {
+			results = append(results, tail...)
+			continue
+		}
+
+		stitched, ok := stitch(cr, tail)
+		if !ok {
+			// cached chunks are replaced with the new ones
+			cr.chunks = nil
+			cr.fetchFrom = cr.start
+			r := cr.request
+			r.StartTime = cr.fetchFrom - 1
+			fallback.Metrics = append(fallback.Metrics, r)
+			refetched = append(refetched, cr)
+			continue
+		}
+		// partial responses are not cached, as they may miss some of the series
+		if err == nil {
+			c.store(cr, tail, now)
+		}
+		results = append(results, stitched...)
+	}
+
+	if len(fallback.Metrics) > 0 {
+		metrics, fallbackStats, fallbackErr := render(ctx, fallback)
+		if fallbackErr != nil && merry.HTTPCode(fallbackErr) >= 400 {
+			return nil, fallbackStats, fallbackErr
+		}
+		if stats == nil {
+			stats = fallbackStats
+		} else if fallbackStats != nil {
+			stats.Merge(fallbackStats)
+		}
+		if err == nil {
+			err = fallbackErr
+		}
+
+		fetched = make(map[string][]*types.MetricData)
+		for _, m := range metrics {
+			fetched[m.PathExpression] = append(fetched[m.PathExpression], m)
+		}
+		for _, cr := range refetched {
+			tail := fetched[cr.request.PathExpression]
+			stitched, ok := stitch(cr, tail)
+			if !ok {
+				results = append(results, tail...)
+				continue
+			}
+			if err == nil {
+				c.store(cr, tail, now)
+			}
+			results = append(results, stitched...)
+		}
+	}
+
+	return results, stats, err
+}
+
+// key identifies the chunk, filter functions are part of it as they change the series returned by backends
+func (c *SeriesCache) key(r pb.FetchRequest, chunkStart int64) string {
+	var b strings.Builder
+	b.WriteString(r.PathExpression)
+	b.WriteString("&from=")
+	b.WriteString(strconv.FormatInt(chunkStart, 10))
+	b.WriteString("&chunk=")
+	b.WriteString(strconv.FormatInt(c.chunkSize, 10))
+	for _, f := range r.FilterFunctions {
+		b.WriteString("&filter=")
+		b.WriteString(url.QueryEscape(f.Name))
+		for _, arg := range f.Arguments {
+			b.WriteString(",")
+			b.WriteString(url.QueryEscape(arg))
+		}
+	}
+	return b.String()
+}
+
+func (c *SeriesCache) complete(chunkStart, now int64) bool {
+	return chunkStart+c.chunkSize <= now-settleTime
+}
+
+// lookup finds consecutive cached chunks from the beginning of the requested interval
+func (c *SeriesCache) lookup(r pb.FetchRequest, now int64) *cachedRequest {
+	cr := &cachedRequest{
+		request: r,
+		start:   r.StartTime - r.StartTime%c.chunkSize,
+	}
+
+	// there is nothing to cache or to get from cache. Backends consolidate series to maxDataPoints, so step depends on
+	// the requested interval and tail can't be stitched with the cached chunks.
+	if r.HighPrecisionTimestamps || r.MaxDataPoints != 0 || r.StartTime <= 0 || r.StartTime >= r.StopTime || !c.complete(cr.start, now) {
+		return cr
+	}
+	cr.cacheable = true
+
+	chunkStart := cr.start
+	for ; chunkStart < r.StopTime && c.complete(chunkStart, now); chunkStart += c.chunkSize {
+		chunk, err := c.get(c.key(r, chunkStart))
+		if err != nil {
+			break
+		}
+		cr.chunks = append(cr.chunks, chunk)
+	}
+	cr.fetchFrom = chunkStart
+	atomic.AddUint64(&c.hits, uint64(len(cr.chunks)))
+
+	for ; chunkStart < r.StopTime && c.complete(chunkStart, now); chunkStart += c.chunkSize {
+		atomic.AddUint64(&c.misses, 1)
+	}
+
+	return cr
+}
+
+// store saves complete chunks of the fetched series
+func (c *SeriesCache) store(cr *cachedRequest, tail []*types.MetricData, now int64) {
+	for chunkStart := cr.fetchFrom; chunkStart < cr.request.StopTime && c.complete(chunkStart, now); chunkStart += c.chunkSize {
+		chunk := make([]*types.MetricData, 0, len(tail))
+		for _, m := range tail {
+			s, ok := slice(m, chunkStart, chunkStart+c.chunkSize)
+			if !ok {
+				return
+			}
+			chunk = append(chunk, s)
+		}
+		c.set(c.key(cr.request, chunkStart), chunk)
+	}
+}
+
+func (c *SeriesCache) get(key string) ([]*types.MetricData, error) {
+	v, err := c.cache.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var chunk []*types.MetricData
+	err = gob.NewDecoder(bytes.NewReader(v)).Decode(&chunk)
+	if err != nil {
+		return nil, err
+	}
+
+	return chunk, nil
+}
+
+func (c *SeriesCache) set(key string, chunk []*types.MetricData) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(chunk); err != nil {
+		return
+	}
+
+	c.cache.Set(key, buf.Bytes(), c.expire)
+}
+
+// slice returns part of the series for [from, until) interval. Result should be aligned with the interval, otherwise
+// it can't be stitched with other chunks.
+func slice(m *types.MetricData, from, until int64) (*types.MetricData, bool) {
+	step := m.StepTime
+	if step <= 0 || (until-from)%step != 0 || (m.StartTime-from)%step != 0 {
+		return nil, false
+	}
+
+	values := make([]float64, (until-from)/step)
+	for i := range values {
+		idx := (from - m.StartTime + int64(i)*step) / step
+		if idx < 0 || idx >= int64(len(m.Values)) {
+			values[i] = math.NaN()
+		} else {
+			values[i] = m.Values[idx]
+		}
+	}
+
+	r := *m
+	r.StartTime = from
+	r.StopTime = until
+	r.Values = values
+	r.SetValuesPerPoint(1)
+	return &r, true
+}
+
+// stitch joins cached chunks with fetched tail and trims result to the requested interval
+func stitch(cr *cachedRequest, tail []*types.MetricData) ([]*types.MetricData, bool) {
+	var (
+		names []string
+		parts = make(map[string][]*types.MetricData)
+	)
+	add := func(m *types.MetricData) {
+		if _, ok := parts[m.Name]; !ok {
+			names = append(names, m.Name)
+		}
+		parts[m.Name] = append(parts[m.Name], m)
+	}
+	for _, chunk := range cr.chunks {
+		for _, m := range chunk {
+			add(m)
+		}
+	}
+	for _, m := range tail {
+		add(m)
+	}
+
+	results := make([]*types.MetricData, 0, len(names))
+	for _, name := range names {
+		r, ok := join(parts[name], cr.start, cr.request.StartTime, cr.request.StopTime)
+		if !ok {
+			return nil, false
+		}
+		results = append(results, r)
+	}
+
+	return results, true
+}
+
+// join merges parts of the same series (ordered by time) to a single series with points in (from, until] interval
+func join(parts []*types.MetricData, start, from, until int64) (*types.MetricData, bool) {
+	last := parts[len(parts)-1]
+	step := last.StepTime
+	if step <= 0 {
+		return nil, false
+	}
+
+	// first point after from, aligned with the series
+	first := start + ((from-start)/step+1)*step
+	n := (until-first)/step + 1
+	if n <= 0 {
+		return nil, false
+	}
+
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = math.NaN()
+	}
+	for _, p := range parts {
+		if p.StepTime != step || (p.StartTime-first)%step != 0 {
+			return nil, false
+		}
+		for i, v := range p.Values {
+			idx := (p.StartTime-first)/step + int64(i)
+			if idx >= 0 && idx < n {
+				values[idx] = v
+			}
+		}
+	}
+
+	r := *last
+	r.StartTime = first
+	r.StopTime = first + n*step
+	r.RequestStartTime = from
+	r.RequestStopTime = until
+	r.Values = values
+	r.SetValuesPerPoint(1)
+	return &r, true
+}
@@ -0,0 +1,189 @@
+package seriescache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/go-graphite/carbonapi/cache"
+	"github.com/go-graphite/carbonapi/expr/types"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeBackend behaves like whisper: returns points in (from, until] interval, value of the point is its timestamp
+type fakeBackend struct {
+	step     int64
+	requests []pb.FetchRequest
+}
+
+func (b *fakeBackend) fetch(r pb.FetchRequest) []*types.MetricData {
+	var result []*types.MetricData
+	for _, name := range []string{"foo.bar", "foo.baz"} {
+		start := r.StartTime - r.StartTime%b.step + b.step
+		stop := r.StopTime - r.StopTime%b.step + b.step
+		values := make([]float64, 0, (stop-start)/b.step)
+		for t := start; t < stop; t += b.step {
+			values = append(values, float64(t))
+		}
+		result = append(result, &types.MetricData{FetchResponse: pb.FetchResponse{
+			Name:              name,
+			PathExpression:    r.PathExpression,
+			ConsolidationFunc: "average",
+			StartTime:         start,
+			StopTime:          stop,
+			StepTime:          b.step,
+			Values:            values,
+			RequestStartTime:  r.StartTime,
+			RequestStopTime:   r.StopTime,
+		}})
+	}
+	return result
+}
+
+func (b *fakeBackend) render(ctx context.Context, request pb.MultiFetchRequest) ([]*types.MetricData, *zipperTypes.Stats, merry.Error) {
+	var result []*types.MetricData
+	for _, r := range request.Metrics {
+		b.requests = append(b.requests, r)
+		result = append(result, b.fetch(r)...)
+	}
+	return result, nil, nil
+}
+
+func TestSeriesCache(t *testing.T) {
+	defer func() { timeNow = time.Now }()
+
+	const chunkSize = 600
+	now := int64(1000*chunkSize + 130)
+	backend := &fakeBackend{step: 60}
+	c := New(cache.NewExpireCache(0), chunkSize, 3600)
+
+	tests := []struct {
+		name   string
+		now    int64
+		from   int64
+		until  int64
+		step   int64
+		fetch  []int64
+		hits   uint64
+		misses uint64
+		// maxDataPoints and filter are added to the request
+		maxDataPoints int64
+		filter        []*pb.FilteringFunction
+	}{
+		{
+			name:  "empty cache",
+			now:   now,
+			from:  now - 3600,
+			until: now,
+			step:  60,
+			// complete chunks are fetched from the beginning of the first chunk
+			fetch:  []int64{now - 3600 - (now-3600)%chunkSize - 1},
+			misses: 6,
+		},
+		{
+			name:   "tail",
+			now:    now + 120,
+			from:   now + 120 - 3600,
+			until:  now + 120,
+			step:   60,
+			fetch:  []int64{now - now%chunkSize - 1},
+			hits:   6,
+			misses: 6,
+		},
+		{
+			name:   "fresh data is not cached",
+			now:    now,
+			from:   now - 100,
+			until:  now,
+			step:   60,
+			fetch:  []int64{now - 100},
+			hits:   6,
+			misses: 6,
+		},
+		{
+			name:  "resolution change",
+			now:   now + 1200,
+			from:  now + 1200 - 3600,
+			until: now + 1200,
+			step:  120,
+			// new series can't be stitched with cached ones, so whole interval is fetched again
+			fetch:  []int64{now - now%chunkSize - 1, now + 1200 - 3600 - (now+1200-3600)%chunkSize - 1},
+			hits:   10,
+			misses: 8,
+		},
+		{
+			name:   "refetched chunks are cached",
+			now:    now + 1200,
+			from:   now + 1200 - 3600,
+			until:  now + 1200,
+			step:   120,
+			fetch:  []int64{now + 1200 - (now+1200)%chunkSize - 1},
+			hits:   16,
+			misses: 8,
+		},
+		{
+			name:          "consolidated series are not cached",
+			now:           now + 1200,
+			from:          now + 1200 - 3600,
+			until:         now + 1200,
+			step:          120,
+			maxDataPoints: 10,
+			fetch:         []int64{now + 1200 - 3600},
+			hits:          16,
+			misses:        8,
+		},
+		{
+			name:   "filter functions are part of the key",
+			now:    now + 1200,
+			from:   now + 1200 - 3600,
+			until:  now + 1200,
+			step:   120,
+			filter: []*pb.FilteringFunction{{Name: "exclude", Arguments: []string{"baz"}}},
+			fetch:  []int64{now + 1200 - 3600 - (now+1200-3600)%chunkSize - 1},
+			hits:   16,
+			misses: 14,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timeNow = func() time.Time { return time.Unix(tt.now, 0) }
+			backend.step = tt.step
+			backend.requests = nil
+
+			r := pb.FetchRequest{
+				Name:            "foo.*",
+				PathExpression:  "foo.*",
+				StartTime:       tt.from,
+				StopTime:        tt.until,
+				MaxDataPoints:   tt.maxDataPoints,
+				FilterFunctions: tt.filter,
+			}
+			got, _, err := c.Render(context.Background(), pb.MultiFetchRequest{Metrics: []pb.FetchRequest{r}}, backend.render)
+			assert.NoError(t, err)
+
+			var fetch []int64
+			for _, r := range backend.requests {
+				fetch = append(fetch, r.StartTime)
+			}
+			assert.Equal(t, tt.fetch, fetch, "unexpected backend requests")
+
+			expected := backend.fetch(r)
+			if assert.Len(t, got, len(expected)) {
+				for i := range expected {
+					assert.Equal(t, expected[i].Name, got[i].Name)
+					assert.Equal(t, expected[i].StartTime, got[i].StartTime)
+					assert.Equal(t, expected[i].StopTime, got[i].StopTime)
+					assert.Equal(t, expected[i].StepTime, got[i].StepTime)
+					assert.Equal(t, expected[i].Values, got[i].Values)
+				}
+			}
+
+			assert.Equal(t, tt.hits, c.Hits(), "hits")
+			assert.Equal(t, tt.misses, c.Misses(), "misses")
+		})
+	}
+}
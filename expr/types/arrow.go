@@ -0,0 +1,520 @@
+package types
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+	"strconv"
+
+	flatbuffers "github.com/google/flatbuffers/go"
+)
+
+// Apache Arrow IPC streaming format, see https://arrow.apache.org/docs/format/Columnar.html#ipc-streaming-format
+// Only the subset needed for render results is implemented: a schema message followed by record batches of either
+// a wide table (non-null timestamp column and nullable float64 column per series) or a long table (timestamp, name and
+// value columns, series after series).
+
+// flatbuffers enums and union types from arrow's Schema.fbs and Message.fbs
+const (
+	arrowMetadataV5 = 4
+
+	arrowMessageHeaderSchema      = 1
+	arrowMessageHeaderRecordBatch = 3
+
+	arrowTypeFloatingPoint = 3
+	arrowTypeUtf8          = 5
+	arrowTypeTimestamp     = 10
+
+	arrowPrecisionDouble = 2
+
+	arrowTimeUnitSecond      = 0
+	arrowTimeUnitMillisecond = 1
+	arrowTimeUnitMicrosecond = 2
+	arrowTimeUnitNanosecond  = 3
+)
+
+const (
+	arrowContinuation = 0xFFFFFFFF
+	arrowAlignment    = 8
+
+	// arrowBatchCells limits number of values in one record batch, so only a few megabytes are buffered at once
+	arrowBatchCells = 1 << 20
+)
+
+// Names of the columns of the long table, ArrowTimestampColumn is used by the wide table as well
+const (
+	ArrowTimestampColumn = "timestamp"
+	ArrowNameColumn      = "name"
+	ArrowValueColumn     = "value"
+)
+
+// Layouts of the table, written to "layout" key of the schema metadata
+const (
+	ArrowLayoutWide = "wide"
+	ArrowLayoutLong = "long"
+)
+
+type arrowFieldNode struct {
+	length    int64
+	nullCount int64
+}
+
+type arrowBuffer struct {
+	offset int64
+	length int64
+}
+
+// arrowWriter writes messages of the stream and counts written bytes
+type arrowWriter struct {
+	w       io.Writer
+	n       int64
+	builder *flatbuffers.Builder
+	body    []byte
+}
+
+func (aw *arrowWriter) write(b []byte) error {
+	n, err := aw.w.Write(b)
+	aw.n += int64(n)
+	return err
+}
+
+// WriteArrow writes metric data as Arrow IPC stream. If series share the time grid, they are written as a wide table:
+// the grid starts at the earliest start time, its step is the smallest step of the series, steps and start times of
+// all series must be multiples of it. Values missing in a series are nulls. Metadata of every series column has name,
+// pathExpression, consolidation parameters and tags (as JSON object).
+// Otherwise such a grid would be much denser than the series, so they are written as a long table instead: rows of
+// every series have its own timestamps, name of the series and the value. Metadata of the series is written to the
+// schema metadata as JSON array in the order of the series.
+// Rows are written in batches of limited size, so only results and a single batch are held in memory, not the
+// whole encoded response.
+// Results must not be modified while they are written, aggregated values should be computed beforehand.
+func WriteArrow(w io.Writer, results []*MetricData, timestampMultiplier int64) (int64, error) {
+	aw := &arrowWriter{
+		w:       w,
+		builder: flatbuffers.NewBuilder(1024),
+	}
+
+	values := make([][]float64, len(results))
+	var start, stop, step, minStep int64
+	for i, r := range results {
+		values[i] = r.AggregatedValues()
+		rStep := r.AggregatedTimeStep()
+		if rStep <= 0 || len(values[i]) == 0 {
+			continue
+		}
+		rStop := r.StartTime + int64(len(values[i]))*rStep
+		if step == 0 {
+			start, stop, step, minStep = r.StartTime, rStop, rStep, rStep
+			continue
+		}
+		// grid must go through every point of every series
+		step = gcd(gcd(step, rStep), absInt64(r.StartTime-start))
+		if rStep < minStep {
+			minStep = rStep
+		}
+		if r.StartTime < start {
+			start = r.StartTime
+		}
+		if rStop > stop {
+			stop = rStop
+		}
+	}
+
+	if step != minStep {
+		return aw.writeLong(results, values, timestampMultiplier)
+	}
+
+	if err := aw.writeSchema(results, step, timestampMultiplier); err != nil {
+		return aw.n, err
+	}
+
+	var rows int64
+	if step > 0 {
+		rows = (stop - start + step - 1) / step
+	}
+	batchRows := int64(arrowBatchCells / (len(results) + 1))
+	if batchRows < 1 {
+		batchRows = 1
+	}
+	for row := int64(0); row < rows; row += batchRows {
+		n := batchRows
+		if row+n > rows {
+			n = rows - row
+		}
+		if err := aw.writeRecordBatch(results, values, start+row*step, step, n, timestampMultiplier); err != nil {
+			return aw.n, err
+		}
+	}
+
+	return aw.n, aw.writeEOS()
+}
+
+// writeLong writes series as a long table, every series is written in its own record batches
+func (aw *arrowWriter) writeLong(results []*MetricData, values [][]float64, timestampMultiplier int64) (int64, error) {
+	if err := aw.writeLongSchema(results, timestampMultiplier); err != nil {
+		return aw.n, err
+	}
+
+	batchRows := arrowBatchCells / 3
+	for i, r := range results {
+		rStep := r.AggregatedTimeStep()
+		for row := 0; row < len(values[i]); row += batchRows {
+			n := batchRows
+			if row+n > len(values[i]) {
+				n = len(values[i]) - row
+			}
+			if err := aw.writeLongRecordBatch(r.Name, values[i][row:row+n], r.StartTime+int64(row)*rStep, rStep, timestampMultiplier); err != nil {
+				return aw.n, err
+			}
+		}
+	}
+
+	return aw.n, aw.writeEOS()
+}
+
+func (aw *arrowWriter) writeEOS() error {
+	var eos [8]byte
+	binary.LittleEndian.PutUint32(eos[:], arrowContinuation)
+	return aw.write(eos[:])
+}
+
+func (aw *arrowWriter) writeSchema(results []*MetricData, step, timestampMultiplier int64) error {
+	b := aw.builder
+	b.Reset()
+
+	fields := make([]flatbuffers.UOffsetT, 0, len(results)+1)
+	fields = append(fields, arrowTimestampField(b, timestampMultiplier))
+	for _, r := range results {
+		fields = append(fields, arrowSeriesField(b, r))
+	}
+	fieldsVector := arrowOffsetVector(b, fields)
+	metadata := arrowMetadata(b, [][2]string{
+		{"layout", ArrowLayoutWide},
+		{"step", strconv.FormatInt(step, 10)},
+	})
+
+	return aw.writeSchemaMessage(fieldsVector, metadata)
+}
+
+func (aw *arrowWriter) writeLongSchema(results []*MetricData, timestampMultiplier int64) error {
+	b := aw.builder
+	b.Reset()
+
+	series := make([]map[string]string, 0, len(results))
+	for _, r := range results {
+		m := make(map[string]string)
+		for _, kv := range arrowSeriesMetadata(r) {
+			m[kv[0]] = kv[1]
+		}
+		series = append(series, m)
+	}
+	seriesJSON, err := json.Marshal(series)
+	if err != nil {
+		return err
+	}
+
+	b.StartObject(0)
+	utf8Type := b.EndObject()
+	b.StartObject(1)
+	b.PrependInt16Slot(0, arrowPrecisionDouble, 0)
+	floatType := b.EndObject()
+
+	fieldsVector := arrowOffsetVector(b, []flatbuffers.UOffsetT{
+		arrowTimestampField(b, timestampMultiplier),
+		arrowField(b, ArrowNameColumn, false, arrowTypeUtf8, utf8Type, 0),
+		arrowField(b, ArrowValueColumn, true, arrowTypeFloatingPoint, floatType, 0),
+	})
+	metadata := arrowMetadata(b, [][2]string{
+		{"layout", ArrowLayoutLong},
+		{"series", string(seriesJSON)},
+	})
+
+	return aw.writeSchemaMessage(fieldsVector, metadata)
+}
+
+func (aw *arrowWriter) writeSchemaMessage(fieldsVector, metadata flatbuffers.UOffsetT) error {
+	b := aw.builder
+	b.StartObject(4)
+	b.PrependUOffsetTSlot(1, fieldsVector, 0)
+	b.PrependUOffsetTSlot(2, metadata, 0)
+	schema := b.EndObject()
+
+	return aw.writeMessage(arrowMessageHeaderSchema, schema)
+}
+
+func arrowTimestampField(b *flatbuffers.Builder, timestampMultiplier int64) flatbuffers.UOffsetT {
+	unit := int16(arrowTimeUnitSecond)
+	switch timestampMultiplier {
+	case 1000:
+		unit = arrowTimeUnitMillisecond
+	case 1000000:
+		unit = arrowTimeUnitMicrosecond
+	case 1000000000:
+		unit = arrowTimeUnitNanosecond
+	}
+
+	timezone := b.CreateString("UTC")
+	b.StartObject(2)
+	b.PrependInt16Slot(0, unit, 0)
+	b.PrependUOffsetTSlot(1, timezone, 0)
+	timestampType := b.EndObject()
+
+	return arrowField(b, ArrowTimestampColumn, false, arrowTypeTimestamp, timestampType, 0)
+}
+
+func arrowSeriesField(b *flatbuffers.Builder, r *MetricData) flatbuffers.UOffsetT {
+	b.StartObject(1)
+	b.PrependInt16Slot(0, arrowPrecisionDouble, 0)
+	floatType := b.EndObject()
+
+	metadata := arrowMetadata(b, arrowSeriesMetadata(r))
+	return arrowField(b, r.Name, true, arrowTypeFloatingPoint, floatType, metadata)
+}
+
+func arrowSeriesMetadata(r *MetricData) [][2]string {
+	// graphite-web's defaults are used for unset fields, same as in msgpack
+	pathExpression := r.PathExpression
+	if pathExpression == "" {
+		pathExpression = r.Name
+	}
+	valuesPerPoint := r.ValuesPerPoint
+	if valuesPerPoint < 1 {
+		valuesPerPoint = 1
+	}
+	consolidationFunc := r.ConsolidationFunc
+	if consolidationFunc == "" {
+		consolidationFunc = "average"
+	}
+	tags, _ := json.Marshal(r.Tags)
+	if r.Tags == nil {
+		tags = []byte("{}")
+	}
+	return [][2]string{
+		{"name", r.Name},
+		{"pathExpression", pathExpression},
+		{"start", strconv.FormatInt(r.StartTime, 10)},
+		{"stop", strconv.FormatInt(r.StopTime, 10)},
+		{"step", strconv.FormatInt(r.AggregatedTimeStep(), 10)},
+		{"valuesPerPoint", strconv.Itoa(valuesPerPoint)},
+		{"consolidationFunc", consolidationFunc},
+		{"xFilesFactor", strconv.FormatFloat(float64(r.XFilesFactor), 'g', -1, 32)},
+		{"tags", string(tags)},
+	}
+}
+
+func arrowField(b *flatbuffers.Builder, name string, nullable bool, typeType byte, typ, metadata flatbuffers.UOffsetT) flatbuffers.UOffsetT {
+	nameOffset := b.CreateString(name)
+	// readers expect children even for primitive types
+	children := arrowOffsetVector(b, nil)
+
+	b.StartObject(7)
+	b.PrependUOffsetTSlot(0, nameOffset, 0)
+	b.PrependBoolSlot(1, nullable, false)
+	b.PrependByteSlot(2, typeType, 0)
+	b.PrependUOffsetTSlot(3, typ, 0)
+	b.PrependUOffsetTSlot(5, children, 0)
+	b.PrependUOffsetTSlot(6, metadata, 0)
+	return b.EndObject()
+}
+
+func arrowMetadata(b *flatbuffers.Builder, kv [][2]string) flatbuffers.UOffsetT {
+	offsets := make([]flatbuffers.UOffsetT, len(kv))
+	for i, p := range kv {
+		key := b.CreateString(p[0])
+		value := b.CreateString(p[1])
+		b.StartObject(2)
+		b.PrependUOffsetTSlot(0, key, 0)
+		b.PrependUOffsetTSlot(1, value, 0)
+		offsets[i] = b.EndObject()
+	}
+	return arrowOffsetVector(b, offsets)
+}
+
+func arrowOffsetVector(b *flatbuffers.Builder, offsets []flatbuffers.UOffsetT) flatbuffers.UOffsetT {
+	b.StartVector(4, len(offsets), 4)
+	for i := len(offsets) - 1; i >= 0; i-- {
+		b.PrependUOffsetT(offsets[i])
+	}
+	return b.EndVector(len(offsets))
+}
+
+// arrowBatch is the body of record batch that is being built and the description of its buffers
+type arrowBatch struct {
+	aw      *arrowWriter
+	nodes   []arrowFieldNode
+	buffers []arrowBuffer
+}
+
+func (aw *arrowWriter) newBatch(columns int) *arrowBatch {
+	aw.body = aw.body[:0]
+	return &arrowBatch{
+		aw:      aw,
+		nodes:   make([]arrowFieldNode, 0, columns),
+		buffers: make([]arrowBuffer, 0, 3*columns),
+	}
+}
+
+// appendBuffer appends a buffer of n bytes padded to the alignment and returns it
+func (ab *arrowBatch) appendBuffer(n int) []byte {
+	offset := len(ab.aw.body)
+	ab.aw.body = append(ab.aw.body, make([]byte, arrowPadding(n))...)
+	ab.buffers = append(ab.buffers, arrowBuffer{offset: int64(offset), length: int64(n)})
+	return ab.aw.body[offset : offset+n]
+}
+
+// appendTimestamps appends non-null timestamp column, validity bitmap is omitted
+func (ab *arrowBatch) appendTimestamps(from, step, rows, timestampMultiplier int64) {
+	ab.nodes = append(ab.nodes, arrowFieldNode{length: rows})
+	ab.buffers = append(ab.buffers, arrowBuffer{offset: int64(len(ab.aw.body))})
+	data := ab.appendBuffer(8 * int(rows))
+	for i := int64(0); i < rows; i++ {
+		binary.LittleEndian.PutUint64(data[8*i:], uint64((from+i*step)*timestampMultiplier))
+	}
+}
+
+// appendValues appends float64 column, NaNs are nulls
+func (ab *arrowBatch) appendValues(rows int64, value func(row int64) float64) {
+	var nullCount int64
+	for row := int64(0); row < rows; row++ {
+		if math.IsNaN(value(row)) {
+			nullCount++
+		}
+	}
+	ab.nodes = append(ab.nodes, arrowFieldNode{length: rows, nullCount: nullCount})
+
+	// validity bitmap may be omitted if there are no nulls
+	if nullCount == 0 {
+		ab.buffers = append(ab.buffers, arrowBuffer{offset: int64(len(ab.aw.body))})
+	} else {
+		bitmap := ab.appendBuffer(int((rows + 7) / 8))
+		for row := int64(0); row < rows; row++ {
+			if !math.IsNaN(value(row)) {
+				bitmap[row/8] |= 1 << uint(row%8)
+			}
+		}
+	}
+
+	data := ab.appendBuffer(8 * int(rows))
+	for row := int64(0); row < rows; row++ {
+		if v := value(row); !math.IsNaN(v) {
+			binary.LittleEndian.PutUint64(data[8*row:], math.Float64bits(v))
+		}
+	}
+}
+
+// appendRepeatedString appends non-null utf8 column that has the same string in every row
+func (ab *arrowBatch) appendRepeatedString(rows int64, s string) {
+	ab.nodes = append(ab.nodes, arrowFieldNode{length: rows})
+	ab.buffers = append(ab.buffers, arrowBuffer{offset: int64(len(ab.aw.body))})
+	offsets := ab.appendBuffer(4 * int(rows+1))
+	for row := int64(0); row <= rows; row++ {
+		binary.LittleEndian.PutUint32(offsets[4*row:], uint32(row*int64(len(s))))
+	}
+	data := ab.appendBuffer(int(rows) * len(s))
+	for row := 0; row < int(rows); row++ {
+		copy(data[row*len(s):], s)
+	}
+}
+
+// writeRecordBatch writes rows of the time grid starting at from
+func (aw *arrowWriter) writeRecordBatch(results []*MetricData, values [][]float64, from, step, rows, timestampMultiplier int64) error {
+	ab := aw.newBatch(len(results) + 1)
+	ab.appendTimestamps(from, step, rows, timestampMultiplier)
+	for i, r := range results {
+		rStep := r.AggregatedTimeStep()
+		rValues := values[i]
+		ab.appendValues(rows, func(row int64) float64 {
+			d := from + row*step - r.StartTime
+			if rStep <= 0 || d < 0 || d%rStep != 0 || d/rStep >= int64(len(rValues)) {
+				return math.NaN()
+			}
+			return rValues[d/rStep]
+		})
+	}
+	return ab.write(rows)
+}
+
+// writeLongRecordBatch writes values of the series starting at from as rows of the long table
+func (aw *arrowWriter) writeLongRecordBatch(name string, values []float64, from, step, timestampMultiplier int64) error {
+	rows := int64(len(values))
+	ab := aw.newBatch(3)
+	ab.appendTimestamps(from, step, rows, timestampMultiplier)
+	ab.appendRepeatedString(rows, name)
+	ab.appendValues(rows, func(row int64) float64 {
+		return values[row]
+	})
+	return ab.write(rows)
+}
+
+func (ab *arrowBatch) write(rows int64) error {
+	b := ab.aw.builder
+	b.Reset()
+
+	b.StartVector(16, len(ab.nodes), 8)
+	for i := len(ab.nodes) - 1; i >= 0; i-- {
+		b.Prep(8, 16)
+		b.PrependInt64(ab.nodes[i].nullCount)
+		b.PrependInt64(ab.nodes[i].length)
+	}
+	nodesVector := b.EndVector(len(ab.nodes))
+
+	b.StartVector(16, len(ab.buffers), 8)
+	for i := len(ab.buffers) - 1; i >= 0; i-- {
+		b.Prep(8, 16)
+		b.PrependInt64(ab.buffers[i].length)
+		b.PrependInt64(ab.buffers[i].offset)
+	}
+	buffersVector := b.EndVector(len(ab.buffers))
+
+	b.StartObject(4)
+	b.PrependInt64Slot(0, rows, 0)
+	b.PrependUOffsetTSlot(1, nodesVector, 0)
+	b.PrependUOffsetTSlot(2, buffersVector, 0)
+	batch := b.EndObject()
+
+	if err := ab.aw.writeMessage(arrowMessageHeaderRecordBatch, batch); err != nil {
+		return err
+	}
+	return ab.aw.write(ab.aw.body)
+}
+
+// writeMessage finishes message with the given header and writes it with the encapsulation prefix.
+// Body of the message must be in aw.body, its length is a multiple of 8 as all buffers are multiples of 8.
+func (aw *arrowWriter) writeMessage(headerType byte, header flatbuffers.UOffsetT) error {
+	b := aw.builder
+	b.StartObject(5)
+	b.PrependInt16Slot(0, arrowMetadataV5, 0)
+	b.PrependByteSlot(1, headerType, 0)
+	b.PrependUOffsetTSlot(2, header, 0)
+	if headerType == arrowMessageHeaderRecordBatch {
+		b.PrependInt64Slot(3, int64(len(aw.body)), 0)
+	}
+	b.Finish(b.EndObject())
+
+	metadata := b.FinishedBytes()
+	prefix := make([]byte, 8, 8+arrowPadding(len(metadata)))
+	binary.LittleEndian.PutUint32(prefix, arrowContinuation)
+	binary.LittleEndian.PutUint32(prefix[4:], uint32(arrowPadding(len(metadata))))
+	prefix = append(prefix, metadata...)
+	prefix = append(prefix, make([]byte, arrowPadding(len(metadata))-len(metadata))...)
+	return aw.write(prefix)
+}
+
+func arrowPadding(n int) int {
+	return (n + arrowAlignment - 1) / arrowAlignment * arrowAlignment
+}
+
+func gcd(a, b int64) int64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+func absInt64(a int64) int64 {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
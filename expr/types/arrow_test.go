@@ -0,0 +1,349 @@
+package types
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"reflect"
+	"testing"
+
+	flatbuffers "github.com/google/flatbuffers/go"
+)
+
+// arrowTestMessage is a message of arrow stream, tables are read the same way as arrow's generated code does
+type arrowTestMessage struct {
+	headerType byte
+	header     flatbuffers.Table
+	body       []byte
+}
+
+func arrowTestSlot(tab *flatbuffers.Table, slot int) flatbuffers.UOffsetT {
+	return flatbuffers.UOffsetT(tab.Offset(flatbuffers.VOffsetT(4 + 2*slot)))
+}
+
+func arrowTestTables(tab *flatbuffers.Table, slot int) []flatbuffers.Table {
+	o := arrowTestSlot(tab, slot)
+	if o == 0 {
+		return nil
+	}
+	res := make([]flatbuffers.Table, tab.VectorLen(o))
+	start := tab.Vector(o)
+	for i := range res {
+		res[i] = flatbuffers.Table{Bytes: tab.Bytes, Pos: tab.Indirect(start + flatbuffers.UOffsetT(4*i))}
+	}
+	return res
+}
+
+func arrowTestString(tab *flatbuffers.Table, slot int) string {
+	return tab.String(arrowTestSlot(tab, slot) + tab.Pos)
+}
+
+// arrowTestStructs returns pairs of int64 from vector of FieldNode or Buffer structs
+func arrowTestStructs(tab *flatbuffers.Table, slot int) [][2]int64 {
+	o := arrowTestSlot(tab, slot)
+	res := make([][2]int64, tab.VectorLen(o))
+	start := tab.Vector(o)
+	for i := range res {
+		pos := start + flatbuffers.UOffsetT(16*i)
+		res[i] = [2]int64{tab.GetInt64(pos), tab.GetInt64(pos + 8)}
+	}
+	return res
+}
+
+func readArrowTestStream(t *testing.T, b []byte) []arrowTestMessage {
+	var res []arrowTestMessage
+	for {
+		if len(b) < 8 || binary.LittleEndian.Uint32(b) != arrowContinuation {
+			t.Fatalf("message should start with continuation marker")
+		}
+		size := int(binary.LittleEndian.Uint32(b[4:]))
+		if size == 0 {
+			if len(b) != 8 {
+				t.Fatalf("unexpected %d bytes after end of stream", len(b)-8)
+			}
+			return res
+		}
+		if size%8 != 0 {
+			t.Fatalf("metadata size %d is not padded", size)
+		}
+		metadata := b[8 : 8+size]
+		b = b[8+size:]
+
+		msg := flatbuffers.Table{Bytes: metadata, Pos: flatbuffers.GetUOffsetT(metadata)}
+		// golden files are written by arrow-go that uses V4, it differs from V5 only in union types
+		if v := msg.GetInt16(msg.Pos + arrowTestSlot(&msg, 0)); v != arrowMetadataV5 && v != arrowMetadataV5-1 {
+			t.Fatalf("unexpected metadata version %d", v)
+		}
+		m := arrowTestMessage{headerType: msg.GetByte(msg.Pos + arrowTestSlot(&msg, 1))}
+		msg.Union(&m.header, arrowTestSlot(&msg, 2))
+		var bodyLength int64
+		if o := arrowTestSlot(&msg, 3); o != 0 {
+			bodyLength = msg.GetInt64(msg.Pos + o)
+		}
+		m.body = b[:bodyLength]
+		b = b[bodyLength:]
+		res = append(res, m)
+	}
+}
+
+func arrowTestMetadata(tab *flatbuffers.Table, slot int) map[string]string {
+	res := make(map[string]string)
+	for _, kv := range arrowTestTables(tab, slot) {
+		res[arrowTestString(&kv, 0)] = arrowTestString(&kv, 1)
+	}
+	return res
+}
+
+// arrowTestEqual compares values, NaNs are nulls and are equal to each other
+func arrowTestEqual(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] && !(math.IsNaN(a[i]) && math.IsNaN(b[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+// arrowTestField is a field of the schema, unit is set only for timestamps
+type arrowTestField struct {
+	name     string
+	typ      byte
+	nullable bool
+	unit     int16
+	metadata map[string]string
+}
+
+// arrowTestTable is decoded stream, columns of every batch are []float64 with NaN as null or []string
+type arrowTestTable struct {
+	metadata map[string]string
+	fields   []arrowTestField
+	batches  [][]interface{}
+}
+
+func decodeArrowTestTable(t *testing.T, b []byte) arrowTestTable {
+	messages := readArrowTestStream(t, b)
+	if len(messages) == 0 || messages[0].headerType != arrowMessageHeaderSchema {
+		t.Fatalf("stream should start with schema")
+	}
+
+	schema := messages[0].header
+	table := arrowTestTable{metadata: arrowTestMetadata(&schema, 2)}
+	for _, f := range arrowTestTables(&schema, 1) {
+		field := arrowTestField{
+			name:     arrowTestString(&f, 0),
+			typ:      f.GetByte(f.Pos + arrowTestSlot(&f, 2)),
+			nullable: f.GetBool(f.Pos + arrowTestSlot(&f, 1)),
+			metadata: arrowTestMetadata(&f, 6),
+		}
+		if field.typ == arrowTypeTimestamp {
+			var typ flatbuffers.Table
+			f.Union(&typ, arrowTestSlot(&f, 3))
+			field.unit = typ.GetInt16(typ.Pos + arrowTestSlot(&typ, 0))
+		}
+		table.fields = append(table.fields, field)
+	}
+
+	for _, m := range messages[1:] {
+		if m.headerType != arrowMessageHeaderRecordBatch {
+			t.Fatalf("unexpected message type %d", m.headerType)
+		}
+		batch := m.header
+		rows := batch.GetInt64(batch.Pos + arrowTestSlot(&batch, 0))
+		nodes := arrowTestStructs(&batch, 1)
+		buffers := arrowTestStructs(&batch, 2)
+		if len(nodes) != len(table.fields) {
+			t.Fatalf("batch has %d columns, schema has %d", len(nodes), len(table.fields))
+		}
+		for _, b := range buffers {
+			if b[0]%8 != 0 {
+				t.Errorf("buffer at %d is not aligned", b[0])
+			}
+		}
+
+		var columns []interface{}
+		for _, field := range table.fields {
+			if nodes[len(columns)][0] != rows {
+				t.Fatalf("column %s has %d rows, batch has %d", field.name, nodes[len(columns)][0], rows)
+			}
+			validity := buffers[0]
+			valid := func(row int64) bool {
+				return validity[1] == 0 || m.body[validity[0]+row/8]&(1<<uint(row%8)) != 0
+			}
+			switch field.typ {
+			case arrowTypeUtf8:
+				offsets, data := buffers[1], buffers[2]
+				buffers = buffers[3:]
+				column := make([]string, rows)
+				for row := range column {
+					from := binary.LittleEndian.Uint32(m.body[offsets[0]+int64(4*row):])
+					to := binary.LittleEndian.Uint32(m.body[offsets[0]+int64(4*row+4):])
+					column[row] = string(m.body[data[0]+int64(from) : data[0]+int64(to)])
+				}
+				columns = append(columns, column)
+			default:
+				data := buffers[1]
+				buffers = buffers[2:]
+				column := make([]float64, rows)
+				for row := range column {
+					v := binary.LittleEndian.Uint64(m.body[data[0]+int64(8*row):])
+					switch {
+					case !valid(int64(row)):
+						column[row] = math.NaN()
+					case field.typ == arrowTypeTimestamp:
+						column[row] = float64(v)
+					default:
+						column[row] = math.Float64frombits(v)
+					}
+				}
+				columns = append(columns, column)
+			}
+		}
+		table.batches = append(table.batches, columns)
+	}
+	return table
+}
+
+// arrowTestEqualTables compares tables, JSON in metadata is compared as decoded value
+func arrowTestEqualTables(t *testing.T, got, want arrowTestTable) {
+	jsonEqual := func(a, b map[string]string) bool {
+		if len(a) != len(b) {
+			return false
+		}
+		for k, v := range b {
+			var av, bv interface{}
+			if json.Unmarshal([]byte(a[k]), &av) == nil && json.Unmarshal([]byte(v), &bv) == nil {
+				if !reflect.DeepEqual(av, bv) {
+					return false
+				}
+			} else if a[k] != v {
+				return false
+			}
+		}
+		return true
+	}
+
+	if !jsonEqual(got.metadata, want.metadata) {
+		t.Errorf("schema metadata:\n    got %v\n    want %v", got.metadata, want.metadata)
+	}
+	if len(got.fields) != len(want.fields) {
+		t.Fatalf("fields: got %+v, want %+v", got.fields, want.fields)
+	}
+	for i := range want.fields {
+		g, w := got.fields[i], want.fields[i]
+		if g.name != w.name || g.typ != w.typ || g.nullable != w.nullable || g.unit != w.unit || !jsonEqual(g.metadata, w.metadata) {
+			t.Errorf("field %d:\n    got %+v\n    want %+v", i, g, w)
+		}
+	}
+	if len(got.batches) != len(want.batches) {
+		t.Fatalf("got %d batches, want %d", len(got.batches), len(want.batches))
+	}
+	for i := range want.batches {
+		for j := range want.batches[i] {
+			g, w := got.batches[i][j], want.batches[i][j]
+			if gf, ok := g.([]float64); ok {
+				if wf, ok := w.([]float64); !ok || !arrowTestEqual(gf, wf) {
+					t.Errorf("batch %d, column %d: got %v, want %v", i, j, g, w)
+				}
+			} else if !reflect.DeepEqual(g, w) {
+				t.Errorf("batch %d, column %d: got %v, want %v", i, j, g, w)
+			}
+		}
+	}
+}
+
+func TestArrowResponse(t *testing.T) {
+	a := MakeMetricData("metric1;foo=bar", []float64{1, 2, math.NaN(), 4, 5}, 60, 120)
+	a.ConsolidationFunc = "sum"
+	a.XFilesFactor = 0.3
+	results := []*MetricData{
+		a,
+		MakeMetricData("metric2", []float64{10, 20, 30}, 120, 60),
+	}
+
+	var buf bytes.Buffer
+	n, err := WriteArrow(&buf, results, 1000)
+	if err != nil {
+		t.Fatalf("WriteArrow returned error: %v", err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("WriteArrow returned %d, but %d bytes were written", n, buf.Len())
+	}
+
+	// testdata/arrow_wide.arrow is written by arrow-go's ipc.Writer for the same table
+	golden, err := ioutil.ReadFile("testdata/arrow_wide.arrow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := decodeArrowTestTable(t, golden)
+	got := decodeArrowTestTable(t, buf.Bytes())
+	arrowTestEqualTables(t, got, want)
+
+	nan := math.NaN()
+	wantColumns := [][]float64{
+		{60000, 120000, 180000, 240000, 300000, 360000},
+		{nan, 1, 2, nan, 4, 5},
+		{10, nan, 20, nan, 30, nan},
+	}
+	if len(got.batches) != 1 {
+		t.Fatalf("got %d batches, want 1", len(got.batches))
+	}
+	for i, w := range wantColumns {
+		if c := got.batches[0][i].([]float64); !arrowTestEqual(c, w) {
+			t.Errorf("column %d: got %v, want %v", i, c, w)
+		}
+	}
+	if got.fields[0].unit != arrowTimeUnitMillisecond || got.metadata["layout"] != ArrowLayoutWide || got.metadata["step"] != "60" {
+		t.Errorf("unexpected schema %+v", got)
+	}
+}
+
+func TestArrowResponseLong(t *testing.T) {
+	a := MakeMetricData("metric1;foo=bar", []float64{1, 2, math.NaN(), 4, 5}, 60, 120)
+	a.ConsolidationFunc = "sum"
+	a.XFilesFactor = 0.3
+	// steps don't share the grid, so series are written one after another
+	results := []*MetricData{
+		a,
+		MakeMetricData("metric2", []float64{10, 20, 30}, 90, 60),
+	}
+
+	var buf bytes.Buffer
+	if _, err := WriteArrow(&buf, results, 1000); err != nil {
+		t.Fatalf("WriteArrow returned error: %v", err)
+	}
+
+	// testdata/arrow_long.arrow is written by arrow-go's ipc.Writer for the same table
+	golden, err := ioutil.ReadFile("testdata/arrow_long.arrow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := decodeArrowTestTable(t, golden)
+	got := decodeArrowTestTable(t, buf.Bytes())
+	arrowTestEqualTables(t, got, want)
+
+	if len(got.batches) != 2 {
+		t.Fatalf("got %d batches, want 2", len(got.batches))
+	}
+	if ts := got.batches[1][0].([]float64); !arrowTestEqual(ts, []float64{60000, 150000, 240000}) {
+		t.Errorf("timestamps of metric2: got %v", ts)
+	}
+	if got.metadata["layout"] != ArrowLayoutLong {
+		t.Errorf("unexpected layout %v", got.metadata["layout"])
+	}
+}
+
+func TestArrowResponseEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := WriteArrow(&buf, nil, 1); err != nil {
+		t.Fatalf("WriteArrow returned error: %v", err)
+	}
+	got := decodeArrowTestTable(t, buf.Bytes())
+	if len(got.fields) != 1 || len(got.batches) != 0 {
+		t.Errorf("stream should have only timestamp field and no batches, got %+v", got)
+	}
+}
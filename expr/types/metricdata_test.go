@@ -99,3 +99,94 @@ func BenchmarkMarshalJSON(b *testing.B) {
 		_ = MarshalJSON(data, 1.0, false)
 	}
 }
+
+func TestMsgpackResponse(t *testing.T) {
+	r := MakeMetricData("metric1", []float64{1.5, math.NaN()}, 60, 1200)
+	r.XFilesFactor = 0.3
+
+	// the same bytes as graphite-web 1.1 produces
+	want := []byte("\x91\x89" +
+		"\xa4name\xa7metric1" +
+		"\xa5start\xcd\x04\xb0" +
+		"\xa3end\xcd\x05\x28" +
+		"\xa4step\x3c" +
+		"\xa6values\x92\xcb\x3f\xf8\x00\x00\x00\x00\x00\x00\xc0" +
+		"\xaepathExpression\xa7metric1" +
+		"\xaevaluesPerPoint\x01" +
+		"\xb1consolidationFunc\xa7average" +
+		"\xacxFilesFactor\xcb\x3f\xd3\x33\x33\x33\x33\x33\x33")
+
+	b := MarshalMsgpack([]*MetricData{r})
+	if !bytes.Equal(b, want) {
+		t.Errorf("MarshalMsgpack:\n    got %q\n    want %q", b, want)
+	}
+
+	// values are consolidated, step matches them
+	r = MakeMetricData("metric1", []float64{1, 2, 3, 4}, 60, 1200)
+	r.ConsolidationFunc = "average"
+	r.SetValuesPerPoint(2)
+	want = []byte("\x91\x89" +
+		"\xa4name\xa7metric1" +
+		"\xa5start\xcd\x04\xb0" +
+		"\xa3end\xcd\x05\xa0" +
+		"\xa4step\x78" +
+		"\xa6values\x92" +
+		"\xcb\x3f\xf8\x00\x00\x00\x00\x00\x00\xcb\x40\x0c\x00\x00\x00\x00\x00\x00" +
+		"\xaepathExpression\xa7metric1" +
+		"\xaevaluesPerPoint\x01" +
+		"\xb1consolidationFunc\xa7average" +
+		"\xacxFilesFactor\xcb\x00\x00\x00\x00\x00\x00\x00\x00")
+
+	b = MarshalMsgpack([]*MetricData{r})
+	if !bytes.Equal(b, want) {
+		t.Errorf("MarshalMsgpack:\n    got %q\n    want %q", b, want)
+	}
+}
+
+func TestAggregatedValuesXFilesFactor(t *testing.T) {
+	tests := []struct {
+		name         string
+		values       []float64
+		xFilesFactor float32
+		want         []float64
+	}{
+		{
+			name:         "default xFilesFactor",
+			values:       []float64{1, math.NaN(), math.NaN(), math.NaN(), math.NaN(), math.NaN(), 3, 5},
+			xFilesFactor: 0,
+			want:         []float64{1, math.NaN(), 4},
+		},
+		{
+			name:         "half of the points required",
+			values:       []float64{1, math.NaN(), math.NaN(), 2, 4, math.NaN(), 3, 5},
+			xFilesFactor: 0.5,
+			want:         []float64{math.NaN(), 3, 4},
+		},
+		{
+			name:         "all points required",
+			values:       []float64{1, 2, 3, 2, math.NaN(), 6, 3},
+			xFilesFactor: 1,
+			want:         []float64{2, math.NaN(), 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := MakeMetricData("metric1", tt.values, 1, 1)
+			r.ConsolidationFunc = "avg"
+			r.XFilesFactor = tt.xFilesFactor
+			r.SetValuesPerPoint(3)
+
+			got := r.AggregatedValues()
+			if len(got) != len(tt.want) {
+				t.Fatalf("unexpected length: got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] && !(math.IsNaN(got[i]) && math.IsNaN(tt.want[i])) {
+					t.Errorf("unexpected value at %d: got %v, want %v", i, got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
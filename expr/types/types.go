@@ -16,6 +16,7 @@ import (
 	pbv2 "github.com/go-graphite/protocol/carbonapi_v2_pb"
 	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
 	pickle "github.com/lomik/og-rek"
+	"github.com/tinylib/msgp/msgp"
 )
 
 var (
@@ -201,6 +202,64 @@ func MarshalPickle(results []*MetricData) []byte {
 	return buf.Bytes()
 }
 
+// MarshalMsgpack marshals metric data to msgpack, same as graphite-web 1.1 does (TimeSeries.getInfo)
+func MarshalMsgpack(results []*MetricData) []byte {
+	b := msgp.AppendArrayHeader(nil, uint32(len(results)))
+	for _, r := range results {
+		b = msgp.AppendMapHeader(b, 9)
+		b = msgp.AppendString(b, "name")
+		b = msgp.AppendString(b, r.Name)
+		b = msgp.AppendString(b, "start")
+		b = AppendMsgpackInt(b, r.StartTime)
+		b = msgp.AppendString(b, "end")
+		b = AppendMsgpackInt(b, r.StopTime)
+		b = msgp.AppendString(b, "step")
+		b = AppendMsgpackInt(b, r.AggregatedTimeStep())
+
+		// graphite-web sends list(series), that is consolidated to maxDataPoints, so step is the step of consolidated
+		// values and valuesPerPoint is always 1
+		values := r.AggregatedValues()
+		b = msgp.AppendString(b, "values")
+		b = msgp.AppendArrayHeader(b, uint32(len(values)))
+		for _, v := range values {
+			if math.IsNaN(v) {
+				b = msgp.AppendNil(b)
+			} else {
+				b = msgp.AppendFloat64(b, v)
+			}
+		}
+
+		// graphite-web's defaults are used for unset fields
+		pathExpression := r.PathExpression
+		if pathExpression == "" {
+			pathExpression = r.Name
+		}
+		b = msgp.AppendString(b, "pathExpression")
+		b = msgp.AppendString(b, pathExpression)
+		b = msgp.AppendString(b, "valuesPerPoint")
+		b = AppendMsgpackInt(b, 1)
+		consolidationFunc := r.ConsolidationFunc
+		if consolidationFunc == "" {
+			consolidationFunc = "average"
+		}
+		b = msgp.AppendString(b, "consolidationFunc")
+		b = msgp.AppendString(b, consolidationFunc)
+		// xFilesFactor is float32, it's converted through its shortest representation so 0.3 is encoded as 0.3
+		xFilesFactor, _ := strconv.ParseFloat(strconv.FormatFloat(float64(r.XFilesFactor), 'g', -1, 32), 64)
+		b = msgp.AppendString(b, "xFilesFactor")
+		b = msgp.AppendFloat64(b, xFilesFactor)
+	}
+	return b
+}
+
+// AppendMsgpackInt appends integer the same way python's msgpack does: non-negative integers are always unsigned
+func AppendMsgpackInt(b []byte, i int64) []byte {
+	if i >= 0 {
+		return msgp.AppendUint64(b, uint64(i))
+	}
+	return msgp.AppendInt64(b, i)
+}
+
 // MarshalProtobufV3 marshals metric data to protobuf
 func MarshalProtobufV2(results []*MetricData) ([]byte, error) {
 	response := pbv2.MultiFetchResponse{}
@@ -334,19 +393,25 @@ func (r *MetricData) AggregateValues() {
 	v := r.Values
 
 	for len(v) >= r.ValuesPerPoint {
-		val := r.AggregateFunction(v[:r.ValuesPerPoint])
-		aggV = append(aggV, val)
+		aggV = append(aggV, r.aggregateBucket(v[:r.ValuesPerPoint]))
 		v = v[r.ValuesPerPoint:]
 	}
 
 	if len(v) > 0 {
-		val := r.AggregateFunction(v)
-		aggV = append(aggV, val)
+		aggV = append(aggV, r.aggregateBucket(v))
 	}
 
 	r.aggregatedValues = aggV
 }
 
+// aggregateBucket consolidates single bucket of values, returns NaN if bucket doesn't satisfy xFilesFactor
+func (r *MetricData) aggregateBucket(v []float64) float64 {
+	if !consolidations.XFilesFactorValues(v, r.XFilesFactor) {
+		return math.NaN()
+	}
+	return r.AggregateFunction(v)
+}
+
 // MakeMetricData creates new metrics data with given metric timeseries
 func MakeMetricData(name string, values []float64, step, start int64) *MetricData {
 	return makeMetricDataWithTags(name, values, step, start, tags.ExtractTags(name))
@@ -24,7 +24,11 @@ require (
 	github.com/facebookgo/stats v0.0.0-20151006221625-1b76add642e4 // indirect
 	github.com/facebookgo/subset v0.0.0-20200203212716-c811ad88dec4 // indirect
 	github.com/go-graphite/protocol v0.4.3
+	github.com/go-redis/redis/v7 v7.4.0
+	github.com/gogo/protobuf v1.2.1
 	github.com/golang/protobuf v1.4.0
+	github.com/golang/snappy v0.0.1
+	github.com/google/flatbuffers v1.12.1
 	github.com/gorilla/handlers v1.4.2
 	github.com/lib/pq v1.4.0
 	github.com/lomik/og-rek v0.0.0-20170411191824-628eefeb8d80
@@ -33,13 +37,16 @@ require (
 	github.com/mjibson/go-dsp v0.0.0-20180508042940-11479a337f12
 	github.com/peterbourgon/g2g v0.0.0-20161124161852-0c2bab2b173d
 	github.com/philhofer/fwd v1.0.0 // indirect
+	github.com/prometheus/tsdb v0.10.0
 	github.com/satori/go.uuid v1.2.0
 	github.com/spf13/viper v1.6.3
 	github.com/stretchr/testify v1.5.1
 	github.com/tinylib/msgp v1.1.2
 	github.com/wangjohn/quickselect v0.0.0-20161129230411-ed8402a42d5f
 	go.uber.org/zap v1.15.0
+	golang.org/x/sync v0.0.0-20220907140024-f12130a52804
 	gonum.org/v1/gonum v0.7.0
 	google.golang.org/grpc v1.29.1
+	google.golang.org/protobuf v1.21.0
 	gopkg.in/yaml.v2 v2.2.8
 )
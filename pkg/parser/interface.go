@@ -106,6 +106,8 @@ type Expr interface {
 
 	// GetIntervalArg returns interval typed argument.
 	GetIntervalArg(n int, defaultSign int) (int32, error)
+	// GetIntervalNamedOrPosArgDefault returns specific positioned interval-typed argument (in seconds) or replace it with default if none found.
+	GetIntervalNamedOrPosArgDefault(k string, n int, defaultSign int, v int64) (int64, error)
 
 	// GetStringArg returns n-th argument as string.
 	GetStringArg(n int) (string, error)
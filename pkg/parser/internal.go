@@ -38,6 +38,19 @@ func (e *expr) doGetStringArg() (string, error) {
 	return e.valStr, nil
 }
 
+func (e *expr) doGetIntervalArg(defaultSign int) (int32, error) {
+	if e.etype != EtString || e.valStr == "" {
+		return 0, ErrBadType
+	}
+
+	seconds, err := IntervalString(e.valStr, defaultSign)
+	if err != nil {
+		return 0, ErrBadType
+	}
+
+	return seconds, nil
+}
+
 func (e *expr) doGetBoolArg() (bool, error) {
 	if e.etype != EtString && e.etype != EtBool {
 		return false, ErrBadType
@@ -53,6 +66,18 @@ func (e *expr) doGetBoolArg() (bool, error) {
 	return false, ErrBadType
 }
 
+// alignDST returns value of alignDST argument of timeShift, graphite-web spelling is alignDST, but alignDst is accepted as well
+func (e *expr) alignDST() bool {
+	for _, k := range []string{"alignDST", "alignDst"} {
+		if a := e.getNamedArg(k); a != nil {
+			v, _ := a.doGetBoolArg()
+			return v
+		}
+	}
+	v, _ := e.GetBoolArgDefault(3, false)
+	return v
+}
+
 func (e *expr) toExpr() interface{} {
 	return e
 }
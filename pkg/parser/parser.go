@@ -145,9 +145,14 @@ func (e *expr) Metrics() []MetricRequest {
 			if err != nil {
 				return nil
 			}
+			// with alignDST one more hour is fetched on each side, as DST offset depends on time zone of the request
+			var dstWindow int64
+			if e.alignDST() {
+				dstWindow = 3600
+			}
 			for i := range r {
-				r[i].From += int64(offs)
-				r[i].Until += int64(offs)
+				r[i].From += int64(offs) - dstWindow
+				r[i].Until += int64(offs) + dstWindow
 			}
 		case "timeStack":
 			offs, err := e.GetIntervalArg(1, -1)
@@ -179,9 +184,25 @@ func (e *expr) Metrics() []MetricRequest {
 			}
 
 			return r2
-		case "holtWintersForecast", "holtWintersConfidenceBands", "holtWintersAberration":
+		case "holtWintersForecast", "holtWintersConfidenceBands", "holtWintersConfidenceArea", "holtWintersAberration":
+			// bootstrapInterval is the second argument of holtWintersForecast and the third one for the rest of the functions,
+			// seasonality goes right after it
+			n := 2
+			if e.target == "holtWintersForecast" {
+				n = 1
+			}
+			bootstrapInterval, err := e.GetIntervalNamedOrPosArgDefault("bootstrapInterval", n, 1, 7*86400)
+			if err != nil {
+				return nil
+			}
+			seasonality, err := e.GetIntervalNamedOrPosArgDefault("seasonality", n+1, 1, 86400)
+			if err != nil {
+				return nil
+			}
 			for i := range r {
-				r[i].From -= 7 * 86400 // starts -7 days from where the original starts
+				// same as in graphite-web, bootstrapInterval (7 days by default) and one more season (1 day by default)
+				// are fetched before the original start
+				r[i].From -= bootstrapInterval + seasonality
 			}
 		case "movingAverage", "movingMedian", "movingMin", "movingMax", "movingSum":
 			if e.args[1].etype == EtString {
@@ -194,6 +215,19 @@ func (e *expr) Metrics() []MetricRequest {
 					r[i].From = fromNew
 				}
 			}
+		case "exponentialMovingAverage", "movingWindow":
+			if e.args[1].etype == EtString {
+				offs, err := e.GetIntervalArg(1, 1)
+				if err != nil {
+					return nil
+				}
+				if offs < 0 {
+					offs = -offs
+				}
+				for i := range r {
+					r[i].From -= int64(offs)
+				}
+			}
 		}
 		return r
 	}
@@ -206,16 +240,23 @@ func (e *expr) GetIntervalArg(n int, defaultSign int) (int32, error) {
 		return 0, ErrMissingArgument
 	}
 
-	if e.args[n].etype != EtString {
-		return 0, ErrBadType
-	}
+	return e.args[n].doGetIntervalArg(defaultSign)
+}
 
-	seconds, err := IntervalString(e.args[n].valStr, defaultSign)
-	if err != nil {
-		return 0, ErrBadType
+func (e *expr) GetIntervalNamedOrPosArgDefault(k string, n int, defaultSign int, v int64) (int64, error) {
+	var (
+		seconds int32
+		err     error
+	)
+	if a := e.getNamedArg(k); a != nil {
+		seconds, err = a.doGetIntervalArg(defaultSign)
+	} else if len(e.args) > n {
+		seconds, err = e.args[n].doGetIntervalArg(defaultSign)
+	} else {
+		return v, nil
 	}
 
-	return seconds, nil
+	return int64(seconds), err
 }
 
 func (e *expr) GetStringArg(n int) (string, error) {
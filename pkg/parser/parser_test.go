@@ -371,3 +371,27 @@ func TestParseExpr(t *testing.T) {
 		})
 	}
 }
+
+func TestMetricsHoltWinters(t *testing.T) {
+	tests := []struct {
+		s    string
+		from int64
+	}{
+		// bootstrapInterval and one season before the original start, same as in graphite-web
+		{"holtWintersForecast(metric1)", -8 * 86400},
+		{"holtWintersForecast(metric1,'2d','1h')", -2*86400 - 3600},
+		{"holtWintersConfidenceBands(metric1)", -8 * 86400},
+		{"holtWintersConfidenceArea(metric1,3,'2d','7d')", -9 * 86400},
+		{"holtWintersAberration(metric1,seasonality='2d')", -9 * 86400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			e, _, err := ParseExpr(tt.s)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, []MetricRequest{{Metric: "metric1", From: tt.from}}, e.Metrics())
+		})
+	}
+}
@@ -35,7 +35,7 @@ func (evaluator *FuncEvaluator) Eval(ctx context.Context, e parser.Expr, from, u
 	}
 
 	if evaluator.eval != nil {
-		return evaluator.eval(context.Background(), e, from, until, values)
+		return evaluator.eval(ctx, e, from, until, values)
 	} else {
 		return nil, helper.ErrUnknownFunction(e.Target())
 	}
@@ -76,11 +76,12 @@ func DeepClone(original map[parser.MetricRequest][]*types.MetricData) map[parser
 		for _, originalMetric := range originalMetrics {
 			copiedMetric := types.MetricData{
 				FetchResponse: pb.FetchResponse{
-					Name:      originalMetric.Name,
-					StartTime: originalMetric.StartTime,
-					StopTime:  originalMetric.StopTime,
-					StepTime:  originalMetric.StepTime,
-					Values:    make([]float64, len(originalMetric.Values)),
+					Name:         originalMetric.Name,
+					StartTime:    originalMetric.StartTime,
+					StopTime:     originalMetric.StopTime,
+					StepTime:     originalMetric.StepTime,
+					XFilesFactor: originalMetric.XFilesFactor,
+					Values:       make([]float64, len(originalMetric.Values)),
 				},
 				Tags: make(map[string]string),
 			}
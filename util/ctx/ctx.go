@@ -3,6 +3,7 @@ package ctx
 import (
 	"context"
 	"net/http"
+	"time"
 )
 
 type key int
@@ -15,6 +16,7 @@ const (
 	headersToPassKey
 	headersToLogKey
 	maxDataPoints
+	timeZone
 )
 
 func ifaceToString(v interface{}) string {
@@ -80,6 +82,19 @@ func GetMaxDatapoints(ctx context.Context) int64 {
 	return getCtxInt64(ctx, maxDataPoints)
 }
 
+// SetTimeZone stores the time zone of the request, it's used by functions that depend on local time (e.x. timeShift with alignDst)
+func SetTimeZone(ctx context.Context, tz *time.Location) context.Context {
+	return context.WithValue(ctx, timeZone, tz)
+}
+
+// GetTimeZone returns the time zone of the request or time.Local if it's not set
+func GetTimeZone(ctx context.Context) *time.Location {
+	if v, ok := ctx.Value(timeZone).(*time.Location); ok && v != nil {
+		return v
+	}
+	return time.Local
+}
+
 func ParseCtx(h http.HandlerFunc, uuidKey string) http.HandlerFunc {
 	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
 		uuid := req.Header.Get(uuidKey)
@@ -0,0 +1,256 @@
+package consistenthash
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ansel1/merry"
+	"github.com/go-graphite/carbonapi/limiter"
+	"github.com/go-graphite/carbonapi/pathcache"
+	"github.com/go-graphite/carbonapi/zipper/broadcast"
+	"github.com/go-graphite/carbonapi/zipper/types"
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+
+	"go.uber.org/zap"
+)
+
+// ConsistentHashGroup sends fetch requests only to the servers that own the metric, the same way carbon-c-relay
+// distributes metrics between them. All other requests are broadcasted, as every server have only a part of the metrics.
+type ConsistentHashGroup struct {
+	*broadcast.BroadcastGroup
+
+	backends          []types.BackendServer
+	ring              *Ring
+	replicationFactor int
+	limiter           limiter.ServerLimiter
+	timeout           types.Timeouts
+
+	logger *zap.Logger
+}
+
+func NewConsistentHashGroup(logger *zap.Logger, groupName string, hashType HashType, replicationFactor int, servers []types.BackendServer, nodes []Node, expireDelaySec int32, concurrencyLimit, maxBatchSize int, timeout types.Timeouts, tldCacheDisabled bool) (*ConsistentHashGroup, merry.Error) {
+	if len(servers) == 0 {
+		return nil, types.ErrNoServersSpecified
+	}
+	if len(servers) != len(nodes) {
+		return nil, merry.Errorf("got %v servers, but %v hash ring nodes", len(servers), len(nodes))
+	}
+	if replicationFactor < 1 {
+		replicationFactor = 1
+	}
+
+	serverNames := make([]string, 0, len(servers))
+	for _, s := range servers {
+		serverNames = append(serverNames, s.Name())
+	}
+	pathCache := pathcache.NewPathCache(expireDelaySec)
+	limiter := limiter.NewServerLimiter(serverNames, concurrencyLimit)
+
+	bg, err := broadcast.NewBroadcastGroupWithLimiter(logger, groupName, servers, serverNames, maxBatchSize, pathCache, limiter, timeout, tldCacheDisabled)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &ConsistentHashGroup{
+		BroadcastGroup: bg,
+
+		backends:          servers,
+		ring:              NewRing(hashType, nodes),
+		replicationFactor: replicationFactor,
+		limiter:           limiter,
+		timeout:           timeout,
+
+		logger: logger.With(zap.String("type", "consistentHashGroup"), zap.String("groupName", groupName)),
+	}
+
+	g.logger.Debug("created consistent hash group",
+		zap.Strings("backends", serverNames),
+		zap.Int("replication_factor", replicationFactor),
+	)
+
+	return g, nil
+}
+
+func isGlob(name string) bool {
+	return strings.ContainsAny(name, "*?[{")
+}
+
+// owners returns backends that have the metric
+func (g *ConsistentHashGroup) owners(name string) []types.BackendServer {
+	nodes := g.ring.GetNodes(name, g.replicationFactor)
+	res := make([]types.BackendServer, 0, len(nodes))
+	for _, n := range nodes {
+		res = append(res, g.backends[n])
+	}
+	return res
+}
+
+// splitRequest resolves globs and builds requests for every server that owns some of the metrics
+func (g *ConsistentHashGroup) splitRequest(ctx context.Context, logger *zap.Logger, request *protov3.MultiFetchRequest) ([]types.BackendServer, map[string][]*protov3.MultiFetchRequest, []merry.Error) {
+	var backends []types.BackendServer
+	requests := make(map[string][]*protov3.MultiFetchRequest)
+	var errs []merry.Error
+
+	add := func(backend types.BackendServer, metric protov3.FetchRequest) {
+		r := requests[backend.Name()]
+		if r == nil {
+			backends = append(backends, backend)
+			r = []*protov3.MultiFetchRequest{{}}
+		}
+		last := r[len(r)-1]
+		if max := g.MaxMetricsPerRequest(); max > 0 && len(last.Metrics) == max {
+			last = &protov3.MultiFetchRequest{}
+			r = append(r, last)
+		}
+		last.Metrics = append(last.Metrics, metric)
+		requests[backend.Name()] = r
+	}
+
+	for _, metric := range request.Metrics {
+		// TODO(Civil): Tags: improve logic
+		// tagged series can't be hashed before they are resolved, so every server is asked for them
+		if strings.HasPrefix(metric.Name, "seriesByTag") {
+			for _, backend := range g.backends {
+				add(backend, metric)
+			}
+			continue
+		}
+
+		if !isGlob(metric.Name) {
+			for _, backend := range g.owners(metric.Name) {
+				add(backend, metric)
+			}
+			continue
+		}
+
+		f, _, err := g.Find(ctx, &protov3.MultiGlobRequest{
+			Metrics:   []string{metric.Name},
+			StartTime: metric.StartTime,
+			StopTime:  metric.StopTime,
+		})
+		if err != nil && !merry.Is(err, types.ErrNonFatalErrors) && merry.HTTPCode(err) != 404 {
+			logger.Warn("find request failed when resolving globs",
+				zap.String("metric_name", metric.Name),
+				zap.Error(err),
+			)
+			errs = append(errs, err)
+		}
+		if f == nil {
+			continue
+		}
+
+		for _, m := range f.Metrics {
+			for _, match := range m.Matches {
+				if !match.IsLeaf {
+					continue
+				}
+				r := metric
+				r.Name = match.Path
+				for _, backend := range g.owners(match.Path) {
+					add(backend, r)
+				}
+			}
+		}
+	}
+
+	return backends, requests, errs
+}
+
+func (g *ConsistentHashGroup) doSingleFetch(ctx context.Context, logger *zap.Logger, backend types.BackendServer, reqs interface{}, resCh chan types.ServerFetcherResponse) {
+	requests, ok := reqs.(map[string][]*protov3.MultiFetchRequest)
+	if !ok {
+		logger.Fatal("unhandled error in doSingleFetch",
+			zap.Stack("stack"),
+			zap.String("got_type", fmt.Sprintf("%T", reqs)),
+			zap.String("expected_type", fmt.Sprintf("%T", requests)),
+		)
+	}
+	logger = logger.With(zap.String("backend_name", backend.Name()))
+
+	response := types.NewServerFetchResponse()
+	response.Server = backend.Name()
+
+	if err := g.limiter.Enter(ctx, backend.Name()); err != nil {
+		logger.Debug("timeout waiting for a slot")
+		resCh <- response.NonFatalError(merry.Prepend(err, "timeout waiting for slot"))
+		return
+	}
+	defer g.limiter.Leave(ctx, backend.Name())
+
+	var err merry.Error
+	for _, req := range requests[backend.Name()] {
+		r := types.NewServerFetchResponse()
+		r.Response, r.Stats, err = backend.Fetch(ctx, req)
+		r.AddError(err)
+		_ = response.Merge(r)
+	}
+
+	resCh <- response
+}
+
+func (g *ConsistentHashGroup) Fetch(ctx context.Context, request *protov3.MultiFetchRequest) (*protov3.MultiFetchResponse, *types.Stats, merry.Error) {
+	requestNames := make([]string, 0, len(request.Metrics))
+	for i := range request.Metrics {
+		requestNames = append(requestNames, request.Metrics[i].Name)
+	}
+	logger := g.logger.With(zap.String("type", "fetch"), zap.Strings("request", requestNames))
+
+	backends, requests, findErrors := g.splitRequest(ctx, logger, request)
+
+	result := types.NewServerFetchResponse()
+	for _, r := range requests {
+		result.Stats.ZipperRequests += int64(len(r))
+		for _, req := range r {
+			result.Stats.TotalMetricsCount += int64(len(req.Metrics))
+		}
+	}
+	result.Err = findErrors
+
+	if len(backends) > 0 {
+		ctxNew, cancel := context.WithTimeout(ctx, g.timeout.Render)
+		defer cancel()
+
+		resultNew, _ := types.DoRequest(ctxNew, logger, backends, result, requests, g.doSingleFetch)
+		var ok bool
+		result, ok = resultNew.Self().(*types.ServerFetchResponse)
+		if !ok {
+			logger.Fatal("unhandled error in Fetch",
+				zap.Stack("stack"),
+				zap.String("got_type", fmt.Sprintf("%T", resultNew.Self())),
+				zap.String("expected_type", fmt.Sprintf("%T", result)),
+			)
+		}
+	}
+
+	if len(result.Response.Metrics) == 0 {
+		nonNotFoundErrors := types.ReturnNonNotFoundError(result.Err)
+		if nonNotFoundErrors != nil {
+			err := types.ErrFailedToFetch.WithHTTPCode(500)
+			for _, e := range nonNotFoundErrors {
+				err = err.WithCause(e)
+			}
+			logger.Debug("non-404 errors while fetching data from backends",
+				zap.Any("errors", result.Err),
+			)
+			return nil, result.Stats, err
+		}
+		return nil, result.Stats, types.ErrNotFound.WithHTTPCode(404)
+	}
+
+	logger.Debug("got some fetch responses",
+		zap.Int("backends_count", len(backends)),
+		zap.Bool("have_errors", len(result.Err) != 0),
+		zap.Int("response_count", len(result.Response.Metrics)),
+	)
+
+	var err merry.Error
+	if len(result.Err) > 0 {
+		err = types.ErrNonFatalErrors
+		for _, e := range result.Err {
+			err = err.WithCause(e)
+		}
+	}
+
+	return result.Response, result.Stats, err
+}
@@ -0,0 +1,154 @@
+package consistenthash
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/go-graphite/carbonapi/zipper/dummy"
+	"github.com/go-graphite/carbonapi/zipper/types"
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"go.uber.org/zap"
+)
+
+// recordingClient returns a series for every requested metric and records their names
+type recordingClient struct {
+	*dummy.DummyClient
+
+	sync.Mutex
+	fetched []string
+}
+
+func (c *recordingClient) Fetch(ctx context.Context, request *protov3.MultiFetchRequest) (*protov3.MultiFetchResponse, *types.Stats, merry.Error) {
+	c.Lock()
+	defer c.Unlock()
+	response := &protov3.MultiFetchResponse{}
+	for _, m := range request.Metrics {
+		c.fetched = append(c.fetched, m.Name)
+		response.Metrics = append(response.Metrics, protov3.FetchResponse{
+			Name:           m.Name,
+			PathExpression: m.PathExpression,
+			StartTime:      m.StartTime,
+			StopTime:       m.StopTime,
+			StepTime:       60,
+			Values:         []float64{1, 2},
+		})
+	}
+	return response, &types.Stats{}, nil
+}
+
+func newTestGroup(t *testing.T, hashType HashType, replicationFactor int) (*ConsistentHashGroup, []*recordingClient) {
+	nodes := []Node{
+		{Host: "10.0.0.1", Port: "2003"},
+		{Host: "10.0.0.2", Port: "2003"},
+		{Host: "10.0.0.3", Port: "2003", Instance: "b"},
+	}
+
+	var clients []*recordingClient
+	var servers []types.BackendServer
+	for _, n := range nodes {
+		c := &recordingClient{DummyClient: dummy.NewDummyClient(n.Host, []string{n.Host}, 0)}
+		c.AddFindResponse(
+			&protov3.MultiGlobRequest{Metrics: []string{"*"}},
+			&protov3.MultiGlobResponse{Metrics: []protov3.GlobResponse{{
+				Name: "*",
+				Matches: []protov3.GlobMatch{
+					{Path: "foo.bar", IsLeaf: true},
+					{Path: "x", IsLeaf: true},
+					{Path: "servers", IsLeaf: false},
+				},
+			}}},
+			&types.Stats{},
+			nil,
+		)
+		clients = append(clients, c)
+		servers = append(servers, c)
+	}
+
+	timeouts := types.Timeouts{Find: time.Second, Render: time.Second, Connect: time.Second}
+	g, err := NewConsistentHashGroup(zap.NewNop(), "ch", hashType, replicationFactor, servers, nodes, 60, 10, 0, timeouts, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return g, clients
+}
+
+func TestFetch(t *testing.T) {
+	tests := []struct {
+		name              string
+		replicationFactor int
+		metrics           []string
+		want              [][]string
+	}{
+		{
+			name:              "single metric",
+			replicationFactor: 1,
+			metrics:           []string{"foo.bar"},
+			want:              [][]string{{"foo.bar"}, nil, nil},
+		},
+		{
+			name:              "replicated metrics",
+			replicationFactor: 2,
+			metrics:           []string{"carbon.agents.host1.cpuUsage", "foo.bar"},
+			want:              [][]string{{"foo.bar"}, {"carbon.agents.host1.cpuUsage", "foo.bar"}, {"carbon.agents.host1.cpuUsage"}},
+		},
+		{
+			name:              "glob",
+			replicationFactor: 1,
+			metrics:           []string{"*"},
+			want:              [][]string{{"foo.bar"}, {"x"}, nil},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, clients := newTestGroup(t, CarbonCH, tt.replicationFactor)
+
+			request := &protov3.MultiFetchRequest{}
+			for _, m := range tt.metrics {
+				request.Metrics = append(request.Metrics, protov3.FetchRequest{Name: m, PathExpression: m, StartTime: 60, StopTime: 180})
+			}
+
+			res, _, err := g.Fetch(context.Background(), request)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var names []string
+			for _, m := range res.Metrics {
+				names = append(names, m.Name)
+			}
+			sort.Strings(names)
+			var want []string
+			for _, w := range tt.want {
+				want = append(want, w...)
+			}
+			want = uniq(want)
+			if !reflect.DeepEqual(names, want) {
+				t.Errorf("got series %v, want %v", names, want)
+			}
+
+			for i, c := range clients {
+				sort.Strings(c.fetched)
+				if !reflect.DeepEqual(c.fetched, tt.want[i]) {
+					t.Errorf("server %v got requests for %v, want %v", i, c.fetched, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func uniq(s []string) []string {
+	sort.Strings(s)
+	res := s[:0]
+	for i, v := range s {
+		if i == 0 || v != s[i-1] {
+			res = append(res, v)
+		}
+	}
+	return res
+}
@@ -0,0 +1,220 @@
+package consistenthash
+
+import (
+	"crypto/md5"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// HashType defines how metrics are distributed between servers
+type HashType int
+
+const (
+	// CarbonCH is a consistent hash ring of carbon-relay (and carbon_ch of carbon-c-relay), positions are first
+	// 2 bytes of md5
+	CarbonCH HashType = iota
+	// FNV1aCH is fnv1a_ch of carbon-c-relay (and carbon), positions are 32-bit fnv1a folded to 16 bits
+	FNV1aCH
+	// JumpFNV1a is jump_fnv1a_ch of carbon-c-relay: jump consistent hash of 64-bit fnv1a
+	JumpFNV1a
+)
+
+// replicas is number of positions of each of the nodes in the ring, same as in carbon and carbon-c-relay
+const replicas = 100
+
+// Node is a destination of carbon-c-relay cluster. Host is ip address or hostname, exactly as it's specified in
+// relay's config, Instance is an optional instance name (`host:port=instance`).
+type Node struct {
+	Host     string
+	Port     string
+	Instance string
+}
+
+// carbonKey is how carbon serializes (server, instance) tuple for carbon_ch
+func (n Node) carbonKey() string {
+	if n.Instance == "" {
+		return fmt.Sprintf("('%s', None)", n.Host)
+	}
+	return fmt.Sprintf("('%s', '%s')", n.Host, n.Instance)
+}
+
+// fnv1aKey is identity of the node for fnv1a_ch and jump_fnv1a_ch: instance if it's set, host:port otherwise
+func (n Node) fnv1aKey() string {
+	if n.Instance != "" {
+		return n.Instance
+	}
+	return n.Host + ":" + n.Port
+}
+
+type ringEntry struct {
+	position int
+	node     int
+}
+
+// Ring maps metric names to the nodes that own them
+type Ring struct {
+	hashType HashType
+	nodes    []Node
+	entries  []ringEntry
+	// jump is the order of nodes for jump hash
+	jump []int
+}
+
+// NewRing creates hash ring for the nodes
+func NewRing(hashType HashType, nodes []Node) *Ring {
+	r := &Ring{
+		hashType: hashType,
+		nodes:    nodes,
+	}
+
+	if hashType == JumpFNV1a {
+		// jump hash works with buckets, so order of servers must not depend on order in the config
+		r.jump = make([]int, len(nodes))
+		for i := range r.jump {
+			r.jump[i] = i
+		}
+		sort.SliceStable(r.jump, func(i, j int) bool {
+			return nodes[r.jump[i]].fnv1aKey() < nodes[r.jump[j]].fnv1aKey()
+		})
+		return r
+	}
+
+	taken := make(map[int]bool, len(nodes)*replicas)
+	for i, node := range nodes {
+		for replica := 0; replica < replicas; replica++ {
+			var key string
+			if hashType == FNV1aCH {
+				key = fmt.Sprintf("%d-%s", replica, node.fnv1aKey())
+			} else {
+				key = fmt.Sprintf("%s:%d", node.carbonKey(), replica)
+			}
+			// carbon moves colliding entries to the next free position
+			position := r.position(key)
+			for taken[position] {
+				position++
+			}
+			taken[position] = true
+			r.entries = append(r.entries, ringEntry{position: position, node: i})
+		}
+	}
+	sort.Slice(r.entries, func(i, j int) bool {
+		return r.entries[i].position < r.entries[j].position
+	})
+
+	return r
+}
+
+func (r *Ring) position(key string) int {
+	if r.hashType == FNV1aCH {
+		h := fnv1a32(key)
+		return int((h >> 16) ^ (h & 0xffff))
+	}
+	sum := md5.Sum([]byte(key))
+	return int(sum[0])<<8 | int(sum[1])
+}
+
+// GetNodes returns indexes of up to n distinct nodes that own the metric, in order of preference
+func (r *Ring) GetNodes(metric string, n int) []int {
+	if n > len(r.nodes) {
+		n = len(r.nodes)
+	}
+	if n <= 0 {
+		return nil
+	}
+
+	if r.hashType == JumpFNV1a {
+		return r.getJumpNodes(metric, n)
+	}
+
+	res := make([]int, 0, n)
+	position := r.position(metric)
+	idx := sort.Search(len(r.entries), func(i int) bool {
+		return r.entries[i].position >= position
+	})
+	for i := 0; i < len(r.entries) && len(res) < n; i++ {
+		node := r.entries[(idx+i)%len(r.entries)].node
+		if !containsNode(res, node) {
+			res = append(res, node)
+		}
+	}
+	return res
+}
+
+// getJumpNodes selects replicas by jumping again over the servers that are not selected yet
+func (r *Ring) getJumpNodes(metric string, n int) []int {
+	key := fnv1a64(metric)
+	buckets := append([]int(nil), r.jump...)
+	res := make([]int, 0, n)
+	for len(res) < n {
+		b := jumpHash(key, len(buckets))
+		res = append(res, buckets[b])
+		buckets = append(buckets[:b], buckets[b+1:]...)
+	}
+	return res
+}
+
+func containsNode(nodes []int, node int) bool {
+	for _, n := range nodes {
+		if n == node {
+			return true
+		}
+	}
+	return false
+}
+
+func fnv1a32(s string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(s); i++ {
+		h ^= uint32(s[i])
+		h *= 16777619
+	}
+	return h
+}
+
+func fnv1a64(s string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= 1099511628211
+	}
+	return h
+}
+
+// jumpHash is "A Fast, Minimal Memory, Consistent Hash Algorithm" by John Lamping and Eric Veach
+func jumpHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
+
+// ParseServer splits server from the config into its address and ring node. Instance of the node can be specified
+// the same way carbon-c-relay does, e.x. "http://10.0.0.1:8080=a". Host and port are taken from the address.
+func ParseServer(server string) (string, Node, error) {
+	var node Node
+	if idx := strings.LastIndex(server, "="); idx > 0 {
+		node.Instance = server[idx+1:]
+		server = server[:idx]
+	}
+
+	address := server
+	if !strings.Contains(address, "://") {
+		address = "//" + address
+	}
+	u, err := url.Parse(address)
+	if err != nil {
+		return "", node, err
+	}
+	node.Host = u.Hostname()
+	node.Port = u.Port()
+	if node.Host == "" {
+		return "", node, fmt.Errorf("no host in server address '%s'", server)
+	}
+
+	return server, node, nil
+}
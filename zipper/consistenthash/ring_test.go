@@ -0,0 +1,144 @@
+package consistenthash
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHashFunctions(t *testing.T) {
+	fnv32Tests := map[string]uint32{
+		"":       0x811c9dc5,
+		"a":      0xe40c292c,
+		"foobar": 0xbf9cf968,
+	}
+	for s, want := range fnv32Tests {
+		if got := fnv1a32(s); got != want {
+			t.Errorf("fnv1a32(%q) = %#x, want %#x", s, got, want)
+		}
+	}
+
+	fnv64Tests := map[string]uint64{
+		"":  0xcbf29ce484222325,
+		"a": 0xaf63dc4c8601ec8c,
+	}
+	for s, want := range fnv64Tests {
+		if got := fnv1a64(s); got != want {
+			t.Errorf("fnv1a64(%q) = %#x, want %#x", s, got, want)
+		}
+	}
+
+	// test vectors of the reference implementation
+	jumpTests := []struct {
+		key     uint64
+		buckets int
+		want    int
+	}{
+		{1, 1, 0},
+		{42, 57, 43},
+		{0xDEAD10CC, 1, 0},
+		{0xDEAD10CC, 666, 361},
+		{256, 1024, 520},
+	}
+	for _, tt := range jumpTests {
+		if got := jumpHash(tt.key, tt.buckets); got != tt.want {
+			t.Errorf("jumpHash(%v, %v) = %v, want %v", tt.key, tt.buckets, got, tt.want)
+		}
+	}
+}
+
+var testMetrics = []string{
+	"a.b.c",
+	"carbon.agents.host1.cpuUsage",
+	"foo.bar",
+	"servers.web01.load.shortterm",
+	"x",
+}
+
+// Expected nodes of carbon_ch and fnv1a_ch are computed by ConsistentHashRing of carbon (lib/carbon/hashing.py).
+// carbon has no jump hash, expected nodes of jump_fnv1a are computed by a standalone python transcription of
+// jump_fnv1a_ch of carbon-c-relay: jump hash (verified by TestHashFunctions) of 64-bit fnv1a of the metric over
+// servers sorted by instance or host:port, next replica is taken by jumping over the servers that are left.
+func TestRing(t *testing.T) {
+	tests := []struct {
+		name     string
+		hashType HashType
+		nodes    []Node
+		want     [][]int
+	}{
+		{
+			name:     "carbon_ch",
+			hashType: CarbonCH,
+			nodes: []Node{
+				{Host: "10.0.0.1", Port: "2003"},
+				{Host: "10.0.0.2", Port: "2003"},
+				{Host: "10.0.0.3", Port: "2003", Instance: "b"},
+			},
+			want: [][]int{{1, 0}, {1, 2}, {0, 1}, {1, 2}, {1, 0}},
+		},
+		{
+			name:     "fnv1a_ch",
+			hashType: FNV1aCH,
+			nodes: []Node{
+				{Host: "10.0.0.1", Port: "2003"},
+				{Host: "10.0.0.2", Port: "2003"},
+				{Host: "10.0.0.3", Port: "2003", Instance: "c"},
+			},
+			want: [][]int{{0, 1}, {0, 2}, {2, 0}, {0, 2}, {1, 0}},
+		},
+		{
+			name:     "jump_fnv1a",
+			hashType: JumpFNV1a,
+			nodes: []Node{
+				{Host: "10.0.0.1", Port: "2003"},
+				{Host: "10.0.0.2", Port: "2003"},
+				{Host: "10.0.0.3", Port: "2003", Instance: "c"},
+			},
+			want: [][]int{{1, 2}, {0, 1}, {1, 2}, {0, 1}, {1, 2}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRing(tt.hashType, tt.nodes)
+			for i, m := range testMetrics {
+				if got := r.GetNodes(m, 2); !reflect.DeepEqual(got, tt.want[i]) {
+					t.Errorf("%v: got nodes %v, want %v", m, got, tt.want[i])
+				}
+				if got := r.GetNodes(m, 1); !reflect.DeepEqual(got, tt.want[i][:1]) {
+					t.Errorf("%v: got node %v, want %v", m, got, tt.want[i][:1])
+				}
+				if got := r.GetNodes(m, 5); len(got) != len(tt.nodes) {
+					t.Errorf("%v: replication factor isn't limited by number of nodes: %v", m, got)
+				}
+			}
+		})
+	}
+}
+
+func TestParseServer(t *testing.T) {
+	tests := []struct {
+		server  string
+		address string
+		node    Node
+	}{
+		{"http://10.0.0.1:8080", "http://10.0.0.1:8080", Node{Host: "10.0.0.1", Port: "8080"}},
+		{"http://10.0.0.1:8080=a", "http://10.0.0.1:8080", Node{Host: "10.0.0.1", Port: "8080", Instance: "a"}},
+		{"10.0.0.2:8081", "10.0.0.2:8081", Node{Host: "10.0.0.2", Port: "8081"}},
+		{"http://[::1]:8080=10.0.0.1:2003", "http://[::1]:8080", Node{Host: "::1", Port: "8080", Instance: "10.0.0.1:2003"}},
+	}
+
+	for _, tt := range tests {
+		address, node, err := ParseServer(tt.server)
+		if err != nil {
+			t.Errorf("%v: unexpected error %v", tt.server, err)
+			continue
+		}
+		if address != tt.address || node != tt.node {
+			t.Errorf("%v: got %v, %+v, want %v, %+v", tt.server, address, node, tt.address, tt.node)
+		}
+	}
+
+	if _, _, err := ParseServer("http://"); err == nil {
+		t.Error("expected error for server without host")
+	}
+}
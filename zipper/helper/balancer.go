@@ -0,0 +1,355 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+// Balancer picks server for the next request and learns from results of the requests
+type Balancer interface {
+	// Pick returns server for the next try. Servers that were already tried are avoided if possible.
+	Pick(tried []string) string
+	// Report is called with result of the request to the server, err is nil if server responded successfully
+	Report(server string, latency time.Duration, err error)
+}
+
+// NewBalancer creates balancer for lbMethod of the backend group
+func NewBalancer(groupName, lbMethod string, servers []string) Balancer {
+	var m types.LBMethod
+	if err := m.FromString(lbMethod); err == nil && m == types.LeastLatencyLB {
+		return NewLeastLatencyBalancer(groupName, servers)
+	}
+	return NewRoundRobinBalancer(servers)
+}
+
+// RoundRobinBalancer treats all servers as equals
+type RoundRobinBalancer struct {
+	servers []string
+	counter uint64
+}
+
+func NewRoundRobinBalancer(servers []string) *RoundRobinBalancer {
+	return &RoundRobinBalancer{servers: servers}
+}
+
+func (b *RoundRobinBalancer) Pick(tried []string) string {
+	if len(b.servers) == 1 {
+		// No need to do heavy operations here
+		return b.servers[0]
+	}
+	counter := atomic.AddUint64(&b.counter, 1)
+	return b.servers[int(counter%uint64(len(b.servers)))]
+}
+
+func (b *RoundRobinBalancer) Report(server string, latency time.Duration, err error) {}
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+func (s circuitState) String() string {
+	switch s {
+	case circuitClosed:
+		return "healthy"
+	case circuitOpen:
+		return "ejected"
+	default:
+		return "probing"
+	}
+}
+
+const (
+	// latencyDecay is the time constant of EWMA of latency and error rate, older results weight less
+	latencyDecay = 10 * time.Second
+	// failureThreshold is number of consecutive failures after which server is ejected
+	failureThreshold = 5
+	// minEjectTime is for how long server is ejected first time, it doubles on every failed probe up to maxEjectTime
+	minEjectTime = 5 * time.Second
+	maxEjectTime = 5 * time.Minute
+)
+
+// errNotSent is reported if request wasn't sent to the server, e.x. because of the limiter
+var errNotSent = errors.New("request was not sent")
+
+// for testing
+var timeNow = time.Now
+
+type serverHealth struct {
+	sync.Mutex
+	server string
+
+	// latency is EWMA of response time in seconds, errorRate is EWMA of failures from 0 to 1
+	latency    float64
+	errorRate  float64
+	lastUpdate time.Time
+	inflight   int64
+
+	state               circuitState
+	consecutiveFailures int
+	ejectTime           time.Duration
+	retryAt             time.Time
+}
+
+// available tells if request can be sent to the server. Ejected server becomes available when it's time to probe it,
+// while probe is in flight no other requests are sent to it.
+func (h *serverHealth) available(now time.Time) bool {
+	switch h.state {
+	case circuitClosed:
+		return true
+	case circuitOpen:
+		return !now.Before(h.retryAt)
+	default:
+		return false
+	}
+}
+
+// cost is expected latency of the request, with penalty for errors and requests that are already in flight
+func (h *serverHealth) cost() float64 {
+	return h.latency * float64(h.inflight+1) / (1.01 - math.Min(h.errorRate, 1))
+}
+
+func (h *serverHealth) update(now time.Time, latency time.Duration, failed bool) {
+	w := 0.0
+	if !h.lastUpdate.IsZero() {
+		w = math.Exp(-float64(now.Sub(h.lastUpdate)) / float64(latencyDecay))
+	}
+	h.lastUpdate = now
+	h.latency = h.latency*w + latency.Seconds()*(1-w)
+	errorRate := 0.0
+	if failed {
+		errorRate = 1
+	}
+	h.errorRate = h.errorRate*w + errorRate*(1-w)
+
+	if !failed {
+		h.consecutiveFailures = 0
+		h.state = circuitClosed
+		h.ejectTime = 0
+		return
+	}
+
+	h.consecutiveFailures++
+	if h.state == circuitHalfOpen || h.consecutiveFailures >= failureThreshold {
+		h.ejectTime *= 2
+		if h.ejectTime < minEjectTime {
+			h.ejectTime = minEjectTime
+		}
+		if h.ejectTime > maxEjectTime {
+			h.ejectTime = maxEjectTime
+		}
+		h.state = circuitOpen
+		h.retryAt = now.Add(h.ejectTime)
+	}
+}
+
+// LeastLatencyBalancer picks two random servers and sends request to the one with lower expected latency
+// ("power of two choices"). Servers that fail consecutively are ejected for a while and then are probed by a single
+// request before they get traffic again.
+type LeastLatencyBalancer struct {
+	groupName string
+	servers   []*serverHealth
+	index     map[string]*serverHealth
+
+	rngMutex sync.Mutex
+	rng      *rand.Rand
+}
+
+func NewLeastLatencyBalancer(groupName string, servers []string) *LeastLatencyBalancer {
+	b := &LeastLatencyBalancer{
+		groupName: groupName,
+		index:     make(map[string]*serverHealth, len(servers)),
+		rng:       rand.New(rand.NewSource(timeNow().UnixNano())),
+	}
+	for _, s := range servers {
+		h := &serverHealth{server: s}
+		b.servers = append(b.servers, h)
+		b.index[s] = h
+	}
+	registerBalancer(b)
+	return b
+}
+
+func (b *LeastLatencyBalancer) random(n int) int {
+	b.rngMutex.Lock()
+	defer b.rngMutex.Unlock()
+	return b.rng.Intn(n)
+}
+
+func contains(servers []string, server string) bool {
+	for _, s := range servers {
+		if s == server {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *LeastLatencyBalancer) Pick(tried []string) string {
+	now := timeNow()
+
+	candidates := make([]*serverHealth, 0, len(b.servers))
+	var fallback []*serverHealth
+	var probe *serverHealth
+	for _, h := range b.servers {
+		h.Lock()
+		ok := h.available(now)
+		ejected := h.state == circuitOpen
+		h.Unlock()
+		if !ok {
+			continue
+		}
+		if contains(tried, h.server) {
+			fallback = append(fallback, h)
+			continue
+		}
+		// ejected server would lose any comparison, so it's probed before others are considered
+		if ejected {
+			if probe == nil {
+				probe = h
+			}
+			continue
+		}
+		candidates = append(candidates, h)
+	}
+	if probe != nil {
+		candidates = []*serverHealth{probe}
+	}
+	if len(candidates) == 0 {
+		candidates = fallback
+	}
+	if len(candidates) == 0 {
+		// every server is ejected, the one that will be probed first is the best guess
+		var first *serverHealth
+		var firstRetry time.Time
+		for _, h := range b.servers {
+			h.Lock()
+			retryAt := h.retryAt
+			h.Unlock()
+			if first == nil || retryAt.Before(firstRetry) {
+				first, firstRetry = h, retryAt
+			}
+		}
+		candidates = []*serverHealth{first}
+	}
+
+	picked := candidates[0]
+	if len(candidates) > 1 {
+		i := b.random(len(candidates))
+		j := b.random(len(candidates) - 1)
+		if j >= i {
+			j++
+		}
+		first, second := candidates[i], candidates[j]
+		first.Lock()
+		firstCost := first.cost()
+		first.Unlock()
+		second.Lock()
+		secondCost := second.cost()
+		second.Unlock()
+		picked = first
+		if secondCost < firstCost {
+			picked = second
+		}
+	}
+
+	picked.Lock()
+	if picked.state == circuitOpen {
+		picked.state = circuitHalfOpen
+	}
+	picked.inflight++
+	picked.Unlock()
+
+	return picked.server
+}
+
+func (b *LeastLatencyBalancer) Report(server string, latency time.Duration, err error) {
+	h, ok := b.index[server]
+	if !ok {
+		return
+	}
+
+	h.Lock()
+	defer h.Unlock()
+	h.inflight--
+	// request canceled by the caller or not sent at all tells nothing about the server, but probe should be retried
+	if err == context.Canceled || err == errNotSent {
+		if h.state == circuitHalfOpen {
+			h.state = circuitOpen
+		}
+		return
+	}
+	h.update(timeNow(), latency, err != nil)
+}
+
+// ServerHealth is exported through expvar
+type ServerHealth struct {
+	Server              string  `json:"server"`
+	State               string  `json:"state"`
+	LatencySeconds      float64 `json:"latency_seconds"`
+	ErrorRate           float64 `json:"error_rate"`
+	Inflight            int64   `json:"inflight"`
+	ConsecutiveFailures int     `json:"consecutive_failures"`
+}
+
+// Health returns current state of all servers of the group
+func (b *LeastLatencyBalancer) Health() []ServerHealth {
+	res := make([]ServerHealth, 0, len(b.servers))
+	for _, h := range b.servers {
+		h.Lock()
+		res = append(res, ServerHealth{
+			Server:              h.server,
+			State:               h.state.String(),
+			LatencySeconds:      h.latency,
+			ErrorRate:           h.errorRate,
+			Inflight:            h.inflight,
+			ConsecutiveFailures: h.consecutiveFailures,
+		})
+		h.Unlock()
+	}
+	return res
+}
+
+var balancers = struct {
+	sync.Mutex
+	once   sync.Once
+	groups map[string]*LeastLatencyBalancer
+}{groups: make(map[string]*LeastLatencyBalancer)}
+
+// registerBalancer makes health of servers available as "backend_health" expvar, balancer that is created later for
+// the same group replaces the previous one
+func registerBalancer(b *LeastLatencyBalancer) {
+	balancers.once.Do(func() {
+		expvar.Publish("backend_health", expvar.Func(backendHealth))
+	})
+	balancers.Lock()
+	balancers.groups[b.groupName] = b
+	balancers.Unlock()
+}
+
+func backendHealth() interface{} {
+	balancers.Lock()
+	defer balancers.Unlock()
+	res := make(map[string][]ServerHealth, len(balancers.groups))
+	for name, b := range balancers.groups {
+		h := b.Health()
+		sort.Slice(h, func(i, j int) bool {
+			return strings.Compare(h[i].Server, h[j].Server) < 0
+		})
+		res[name] = h
+	}
+	return res
+}
@@ -0,0 +1,158 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/limiter"
+	"go.uber.org/zap"
+)
+
+func withTime(t0 time.Time) (func(time.Duration), func()) {
+	now := t0
+	timeNow = func() time.Time { return now }
+	return func(d time.Duration) { now = now.Add(d) }, func() { timeNow = time.Now }
+}
+
+func state(b *LeastLatencyBalancer, server string) ServerHealth {
+	for _, h := range b.Health() {
+		if h.Server == server {
+			return h
+		}
+	}
+	return ServerHealth{}
+}
+
+func TestLeastLatencyPrefersFasterServer(t *testing.T) {
+	advance, restore := withTime(time.Unix(1000, 0))
+	defer restore()
+
+	b := NewLeastLatencyBalancer("test_latency", []string{"fast", "slow"})
+	for i := 0; i < 10; i++ {
+		advance(time.Second)
+		b.Report(b.Pick([]string{"slow"}), 10*time.Millisecond, nil)
+		b.Report(b.Pick([]string{"fast"}), 500*time.Millisecond, nil)
+	}
+
+	for i := 0; i < 100; i++ {
+		server := b.Pick(nil)
+		if server != "fast" {
+			t.Fatalf("got %v, want fast", server)
+		}
+		b.Report(server, 10*time.Millisecond, nil)
+	}
+
+	if got := b.Pick([]string{"fast"}); got != "slow" {
+		t.Errorf("retry should go to the other server, got %v", got)
+	}
+	b.Report("slow", 0, errNotSent)
+}
+
+func TestLeastLatencyCircuitBreaker(t *testing.T) {
+	advance, restore := withTime(time.Unix(1000, 0))
+	defer restore()
+
+	failure := errors.New("failure")
+	b := NewLeastLatencyBalancer("test_breaker", []string{"good", "bad"})
+
+	for i := 0; i < failureThreshold; i++ {
+		b.Pick([]string{"good"})
+		b.Report("bad", time.Millisecond, failure)
+	}
+	if h := state(b, "bad"); h.State != "ejected" || h.ConsecutiveFailures != failureThreshold {
+		t.Fatalf("server should be ejected, got %+v", h)
+	}
+
+	// ejected server doesn't get requests, even retries
+	for i := 0; i < 10; i++ {
+		if server := b.Pick([]string{"good"}); server != "good" {
+			t.Fatalf("got %v, want good", server)
+		}
+		b.Report("good", time.Millisecond, nil)
+	}
+
+	// single probe is sent after eject time, no other requests go to the server while it's in flight
+	advance(minEjectTime)
+	if server := b.Pick(nil); server != "bad" {
+		t.Fatalf("got %v, want probe to bad server", server)
+	}
+	if h := state(b, "bad"); h.State != "probing" {
+		t.Errorf("server should be probed, got %+v", h)
+	}
+	if server := b.Pick(nil); server != "good" {
+		t.Errorf("got %v while probe is in flight", server)
+	}
+	b.Report("good", time.Millisecond, nil)
+
+	// failed probe ejects server for longer
+	b.Report("bad", time.Millisecond, failure)
+	advance(minEjectTime)
+	if server := b.Pick(nil); server != "good" {
+		t.Fatalf("got %v, eject time should be doubled", server)
+	}
+	b.Report("good", time.Millisecond, nil)
+
+	advance(minEjectTime)
+	if server := b.Pick(nil); server != "bad" {
+		t.Fatalf("got %v, want probe to bad server", server)
+	}
+	b.Report("bad", time.Millisecond, nil)
+	if h := state(b, "bad"); h.State != "healthy" || h.ConsecutiveFailures != 0 || h.Inflight != 0 {
+		t.Errorf("server should be healthy after successful probe, got %+v", h)
+	}
+}
+
+func TestLeastLatencyAllEjected(t *testing.T) {
+	_, restore := withTime(time.Unix(1000, 0))
+	defer restore()
+
+	b := NewLeastLatencyBalancer("test_all_ejected", []string{"a"})
+	for i := 0; i < failureThreshold; i++ {
+		b.Report(b.Pick(nil), time.Millisecond, errors.New("failure"))
+	}
+
+	// request is still sent somewhere, as there is no other choice
+	if server := b.Pick(nil); server != "a" {
+		t.Errorf("got %v, want a", server)
+	}
+}
+
+func TestHttpQueryReportsToBalancer(t *testing.T) {
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer bad.Close()
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer good.Close()
+
+	servers := []string{bad.URL, good.URL}
+	b := NewLeastLatencyBalancer("test_http_query", servers)
+	q := NewHttpQueryWithBalancer("test_http_query", servers, 2, limiter.NoopLimiter{}, http.DefaultClient, "", b, nil)
+
+	for i := 0; i < 20; i++ {
+		res, err := q.DoQuery(context.Background(), zap.NewNop(), "/render", nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if res.Server != good.URL {
+			t.Fatalf("got response from %v", res.Server)
+		}
+	}
+
+	// failed server loses every comparison once error is reported, so it's not retried
+	if h := state(b, bad.URL); h.ErrorRate == 0 || h.Inflight != 0 {
+		t.Errorf("failure should be reported, got %+v", h)
+	}
+	if h := state(b, good.URL); h.State != "healthy" || h.Inflight != 0 {
+		t.Errorf("got %+v", h)
+	}
+	if health := backendHealth().(map[string][]ServerHealth); len(health["test_http_query"]) != 2 {
+		t.Errorf("unexpected expvar %+v", health)
+	}
+}
@@ -0,0 +1,85 @@
+package helper
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// latencyWindowSize is number of recent response times that hedging delay is computed from
+	latencyWindowSize = 1024
+	// latencyMinSamples is number of responses needed before requests are hedged
+	latencyMinSamples = 20
+	// latencyRecompute is how often (in responses) hedging delay is recomputed
+	latencyRecompute = 32
+)
+
+// latencyWindow keeps recent response times of the group and computes hedging delay as their percentile
+type latencyWindow struct {
+	sync.Mutex
+	percentile float64
+	minDelay   time.Duration
+
+	samples []time.Duration
+	next    int
+	added   int
+	delay   time.Duration
+	ready   bool
+}
+
+func newLatencyWindow(percentile float64, minDelay time.Duration) *latencyWindow {
+	return &latencyWindow{
+		percentile: percentile,
+		minDelay:   minDelay,
+		samples:    make([]time.Duration, 0, latencyWindowSize),
+	}
+}
+
+func (w *latencyWindow) add(latency time.Duration) {
+	w.Lock()
+	defer w.Unlock()
+
+	if len(w.samples) < latencyWindowSize {
+		w.samples = append(w.samples, latency)
+	} else {
+		w.samples[w.next] = latency
+		w.next = (w.next + 1) % latencyWindowSize
+	}
+
+	w.added++
+	if w.added < latencyRecompute && w.ready {
+		return
+	}
+	w.added = 0
+	if len(w.samples) < latencyMinSamples {
+		return
+	}
+
+	sorted := make([]time.Duration, len(w.samples))
+	copy(sorted, w.samples)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	idx := int(math.Ceil(w.percentile/100*float64(len(sorted)))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	w.delay = sorted[idx]
+	if w.delay < w.minDelay {
+		w.delay = w.minDelay
+	}
+	w.ready = true
+}
+
+// hedgeDelay returns how long to wait for response before sending request to another server, ok is false if there
+// were not enough responses yet to know that
+func (w *latencyWindow) hedgeDelay() (time.Duration, bool) {
+	w.Lock()
+	defer w.Unlock()
+	return w.delay, w.ready
+}
@@ -0,0 +1,139 @@
+package helper
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/limiter"
+	"github.com/go-graphite/carbonapi/zipper/types"
+	"go.uber.org/zap"
+)
+
+func TestLatencyWindow(t *testing.T) {
+	w := newLatencyWindow(90, 5*time.Millisecond)
+	for i := 1; i < latencyMinSamples; i++ {
+		w.add(time.Duration(i) * time.Millisecond)
+	}
+	if _, ok := w.hedgeDelay(); ok {
+		t.Fatal("requests shouldn't be hedged until enough responses are seen")
+	}
+
+	w.add(latencyMinSamples * time.Millisecond)
+	if delay, ok := w.hedgeDelay(); !ok || delay != 18*time.Millisecond {
+		t.Errorf("got delay %v, want 18ms", delay)
+	}
+
+	w = newLatencyWindow(50, 5*time.Millisecond)
+	for i := 0; i < latencyMinSamples; i++ {
+		w.add(time.Millisecond)
+	}
+	if delay, _ := w.hedgeDelay(); delay != 5*time.Millisecond {
+		t.Errorf("got delay %v, minDelay should be respected", delay)
+	}
+}
+
+func newHedgedQuery(servers []string) *HttpQuery {
+	q := NewHttpQueryWithBalancer("test_hedging", servers, 2, limiter.NoopLimiter{}, http.DefaultClient, "", NewRoundRobinBalancer(servers), &types.Hedging{Percentile: 95})
+	for i := 0; i < latencyMinSamples; i++ {
+		q.latencies.add(10 * time.Millisecond)
+	}
+	return q
+}
+
+func TestHedgedQuery(t *testing.T) {
+	canceled := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			close(canceled)
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("fast"))
+	}))
+	defer fast.Close()
+
+	// round-robin picks the second server first
+	q := newHedgedQuery([]string{fast.URL, slow.URL})
+	res, err := q.DoQuery(context.Background(), zap.NewNop(), "/render", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.Server != fast.URL || res.HedgesSent != 1 || res.HedgesWon != 1 {
+		t.Errorf("hedged request should win, got %+v", res)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Error("slow request wasn't canceled")
+	}
+
+	stats := &types.Stats{}
+	res.UpdateStats(stats)
+	if stats.HedgesSent != 1 || stats.HedgesWon != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	q = newHedgedQuery([]string{slow.URL, fast.URL})
+	res, err = q.DoQuery(context.Background(), zap.NewNop(), "/render", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.Server != fast.URL || res.HedgesSent != 0 || res.HedgesWon != 0 {
+		t.Errorf("fast server shouldn't be hedged, got %+v", res)
+	}
+}
+
+func TestHedgedQueryFailures(t *testing.T) {
+	failed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failed.Close()
+
+	q := newHedgedQuery([]string{failed.URL, failed.URL})
+	_, err := q.DoQuery(context.Background(), zap.NewNop(), "/render", nil)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer ok.Close()
+
+	// failed request is retried on another server without hedging
+	q = newHedgedQuery([]string{ok.URL, failed.URL})
+	res, err := q.DoQuery(context.Background(), zap.NewNop(), "/render", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.Server != ok.URL || res.HedgesSent != 0 {
+		t.Errorf("got %+v", res)
+	}
+}
+
+func TestHedgedQueryFailedHedge(t *testing.T) {
+	slowFailed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer slowFailed.Close()
+
+	q := newHedgedQuery([]string{slowFailed.URL, slowFailed.URL})
+	res, err := q.DoQuery(context.Background(), zap.NewNop(), "/render", nil)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	// hedge is counted even if both requests failed
+	stats := &types.Stats{}
+	res.UpdateStats(stats)
+	if stats.HedgesSent != 1 || stats.HedgesWon != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
@@ -7,7 +7,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
-	"sync/atomic"
+	"time"
 
 	"github.com/ansel1/merry"
 	"github.com/go-graphite/carbonapi/limiter"
@@ -17,8 +17,31 @@ import (
 )
 
 type ServerResponse struct {
-	Server   string
-	Response []byte
+	Server      string
+	Response    []byte
+	ContentType string
+
+	// HedgesSent is 1 if request was also sent to another server because the first one was slow, HedgesWon is 1 if
+	// this response came from that second server
+	HedgesSent int64
+	HedgesWon  int64
+
+	// Data is the result of ResponseReader if request was sent with one, Response is empty in that case
+	Data interface{}
+}
+
+// ResponseReader reads body of successful (200 OK) response, it's used for responses that shouldn't be buffered as a
+// whole. Readers of hedged requests can run concurrently, so result has to be returned rather than stored.
+type ResponseReader func(contentType string, body io.Reader) (interface{}, error)
+
+// UpdateStats adds hedging statistics of the response to the stats. Failed queries return response only if a hedge was
+// sent, so r can be nil.
+func (r *ServerResponse) UpdateStats(stats *types.Stats) {
+	if r == nil {
+		return
+	}
+	stats.HedgesSent += r.HedgesSent
+	stats.HedgesWon += r.HedgesWon
 }
 
 type HttpQuery struct {
@@ -28,44 +51,66 @@ type HttpQuery struct {
 	limiter   limiter.ServerLimiter
 	client    *http.Client
 	encoding  string
-
-	counter uint64
+	balancer  Balancer
+	latencies *latencyWindow
 }
 
 func NewHttpQuery(groupName string, servers []string, maxTries int, limiter limiter.ServerLimiter, client *http.Client, encoding string) *HttpQuery {
-	return &HttpQuery{
+	return NewHttpQueryWithBalancer(groupName, servers, maxTries, limiter, client, encoding, NewRoundRobinBalancer(servers), nil)
+}
+
+// NewHttpQueryWithBalancer creates HttpQuery that uses balancer to pick servers. If hedging is enabled, slow requests
+// are also sent to another server and the first successful response is used.
+func NewHttpQueryWithBalancer(groupName string, servers []string, maxTries int, limiter limiter.ServerLimiter, client *http.Client, encoding string, balancer Balancer, hedging *types.Hedging) *HttpQuery {
+	c := &HttpQuery{
 		groupName: groupName,
 		servers:   servers,
 		maxTries:  maxTries,
 		limiter:   limiter,
 		client:    client,
 		encoding:  encoding,
+		balancer:  balancer,
+	}
+	if hedging != nil && hedging.Percentile > 0 && len(servers) > 1 {
+		c.latencies = newLatencyWindow(hedging.Percentile, hedging.MinDelay)
 	}
+	return c
 }
 
-func (c *HttpQuery) pickServer(logger *zap.Logger) string {
-	if len(c.servers) == 1 {
-		// No need to do heavy operations here
-		return c.servers[0]
-	}
-	logger = logger.With(zap.String("function", "picker"))
-	counter := atomic.AddUint64(&(c.counter), 1)
-	idx := counter % uint64(len(c.servers))
-	srv := c.servers[int(idx)]
-	logger.Debug("picked",
-		zap.Uint64("counter", counter),
-		zap.Uint64("idx", idx),
-		zap.String("server", srv),
-	)
+func (c *HttpQuery) pickServer(logger *zap.Logger, tried []string) string {
+	srv := c.balancer.Pick(tried)
+	if len(c.servers) > 1 {
+		logger.Debug("picked",
+			zap.String("function", "picker"),
+			zap.String("server", srv),
+		)
+	}
 
 	return srv
 }
 
-func (c *HttpQuery) doRequest(ctx context.Context, logger *zap.Logger, uri string, r types.Request) (*ServerResponse, merry.Error) {
+// report passes result of the request to the balancer. t0 is zero if request wasn't sent.
+func (c *HttpQuery) report(ctx context.Context, server string, t0 time.Time, e merry.Error) {
+	var err error
+	switch {
+	case t0.IsZero():
+		err = errNotSent
+	case ctx.Err() == context.Canceled:
+		err = context.Canceled
+	case e != nil:
+		err = e
+	}
+	c.balancer.Report(server, time.Since(t0), err)
+}
+
+func (c *HttpQuery) doRequest(ctx context.Context, logger *zap.Logger, server, method, uri string, r types.Request, headers map[string]string, read ResponseReader) (res *ServerResponse, e merry.Error) {
 	logger = logger.With(
 		zap.String("function", "HttpQuery.doRequest"),
 	)
-	server := c.pickServer(logger)
+	var t0 time.Time
+	defer func() {
+		c.report(ctx, server, t0, e)
+	}()
 
 	u, err := url.Parse(server + uri)
 	if err != nil {
@@ -89,12 +134,15 @@ func (c *HttpQuery) doRequest(ctx context.Context, logger *zap.Logger, uri strin
 		zap.String("uri", u.String()),
 	)
 
-	req, err := http.NewRequest("GET", u.String(), reader)
+	req, err := http.NewRequest(method, u.String(), reader)
 	if err != nil {
 		return nil, merry.Here(err).WithValue("server", server)
 	}
 
 	req.Header.Set("Accept", c.encoding)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
 	req = util.MarshalPassHeaders(ctx, util.MarshalCtx(ctx, util.MarshalCtx(ctx, req, util.HeaderUUIDZipper), util.HeaderUUIDAPI))
 
 	logger.Debug("trying to get slot",
@@ -115,6 +163,7 @@ func (c *HttpQuery) doRequest(ctx context.Context, logger *zap.Logger, uri strin
 	if r != nil {
 		logger = logger.With(zap.Any("payloadData", r.LogInfo()))
 	}
+	t0 = time.Now()
 	resp, err := c.client.Do(req.WithContext(ctx))
 	if err != nil {
 		logger.Debug("error fetching result",
@@ -129,6 +178,17 @@ func (c *HttpQuery) doRequest(ctx context.Context, logger *zap.Logger, uri strin
 		return &ServerResponse{Server: server}, nil
 	}
 
+	if read != nil && resp.StatusCode == http.StatusOK {
+		data, err := read(resp.Header.Get("Content-Type"), resp.Body)
+		if err != nil {
+			logger.Debug("error reading body",
+				zap.Error(err),
+			)
+			return nil, merry.Here(err).WithValue("server", server)
+		}
+		return &ServerResponse{Server: server, ContentType: resp.Header.Get("Content-Type"), Data: data}, nil
+	}
+
 	body, err = ioutil.ReadAll(resp.Body)
 	if err != nil {
 		logger.Debug("error reading body",
@@ -141,18 +201,39 @@ func (c *HttpQuery) doRequest(ctx context.Context, logger *zap.Logger, uri strin
 		return nil, types.ErrFailedToFetch.Here().WithValue("group", c.groupName).WithValue("status_code", resp.StatusCode).WithValue("body", string(body))
 	}
 
-	return &ServerResponse{Server: server, Response: body}, nil
+	return &ServerResponse{Server: server, Response: body, ContentType: resp.Header.Get("Content-Type")}, nil
 }
 
 func (c *HttpQuery) DoQuery(ctx context.Context, logger *zap.Logger, uri string, r types.Request) (*ServerResponse, merry.Error) {
+	return c.doQuery(ctx, logger, http.MethodGet, uri, r, nil, nil)
+}
+
+// DoPostQuery sends marshaled r as a body of POST request with extra headers set
+func (c *HttpQuery) DoPostQuery(ctx context.Context, logger *zap.Logger, uri string, r types.Request, headers map[string]string) (*ServerResponse, merry.Error) {
+	return c.doQuery(ctx, logger, http.MethodPost, uri, r, headers, nil)
+}
+
+// DoPostStreamQuery works as DoPostQuery, but body of successful response is passed to read instead of being buffered
+func (c *HttpQuery) DoPostStreamQuery(ctx context.Context, logger *zap.Logger, uri string, r types.Request, headers map[string]string, read ResponseReader) (*ServerResponse, merry.Error) {
+	return c.doQuery(ctx, logger, http.MethodPost, uri, r, headers, read)
+}
+
+func (c *HttpQuery) doQuery(ctx context.Context, logger *zap.Logger, method, uri string, r types.Request, headers map[string]string, read ResponseReader) (*ServerResponse, merry.Error) {
 	maxTries := c.maxTries
 	if len(c.servers) > maxTries {
 		maxTries = len(c.servers)
 	}
 
+	if c.latencies != nil {
+		return c.doHedgedQuery(ctx, logger, method, uri, r, headers, read, maxTries)
+	}
+
 	e := types.ErrFailedToFetch.WithValue("uri", uri)
+	tried := make([]string, 0, maxTries)
 	for try := 0; try < maxTries; try++ {
-		res, err := c.doRequest(ctx, logger, uri, r)
+		server := c.pickServer(logger, tried)
+		tried = append(tried, server)
+		res, err := c.doRequest(ctx, logger, server, method, uri, r, headers, read)
 		if err != nil {
 			logger.Debug("have errors",
 				zap.Error(err),
@@ -167,3 +248,95 @@ func (c *HttpQuery) DoQuery(ctx context.Context, logger *zap.Logger, uri string,
 
 	return nil, types.ErrMaxTriesExceeded.WithCause(e)
 }
+
+type hedgedResponse struct {
+	res     *ServerResponse
+	err     merry.Error
+	hedge   bool
+	latency time.Duration
+}
+
+// doHedgedQuery works as doQuery, but if server doesn't respond within the hedging delay, request is sent to another
+// server as well. The first successful response wins and the other request is canceled. Every request counts as a try.
+func (c *HttpQuery) doHedgedQuery(ctx context.Context, logger *zap.Logger, method, uri string, r types.Request, headers map[string]string, read ResponseReader, maxTries int) (*ServerResponse, merry.Error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan hedgedResponse, maxTries)
+	tried := make([]string, 0, maxTries)
+	send := func(hedge bool) {
+		server := c.pickServer(logger, tried)
+		tried = append(tried, server)
+		go func() {
+			t0 := time.Now()
+			res, err := c.doRequest(ctx, logger, server, method, uri, r, headers, read)
+			results <- hedgedResponse{res: res, err: err, hedge: hedge, latency: time.Since(t0)}
+		}()
+	}
+
+	var timer *time.Timer
+	var hedge <-chan time.Time
+	startTimer := func() {
+		if delay, ok := c.latencies.hedgeDelay(); ok {
+			timer = time.NewTimer(delay)
+			hedge = timer.C
+		}
+	}
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	e := types.ErrFailedToFetch.WithValue("uri", uri)
+	var hedgesSent int64
+	send(false)
+	inflight := 1
+	startTimer()
+	for inflight > 0 {
+		select {
+		case <-hedge:
+			hedge = nil
+			if hedgesSent == 0 && len(tried) < maxTries {
+				logger.Debug("hedging request",
+					zap.Strings("tried", tried),
+				)
+				hedgesSent = 1
+				send(true)
+				inflight++
+			}
+		case res := <-results:
+			inflight--
+			if res.err == nil {
+				c.latencies.add(res.latency)
+				res.res.HedgesSent = hedgesSent
+				if res.hedge {
+					res.res.HedgesWon = 1
+				}
+				return res.res, nil
+			}
+
+			logger.Debug("have errors",
+				zap.Error(res.err),
+			)
+			e = e.WithCause(res.err)
+			if inflight == 0 && len(tried) < maxTries {
+				send(false)
+				inflight++
+				if hedgesSent == 0 {
+					if timer != nil {
+						timer.Stop()
+					}
+					startTimer()
+				}
+			}
+		}
+	}
+
+	var res *ServerResponse
+	if hedgesSent > 0 {
+		// hedge is counted even if it failed, response carries only the statistics then
+		res = &ServerResponse{HedgesSent: hedgesSent}
+	}
+	return res, types.ErrMaxTriesExceeded.WithCause(e)
+}
@@ -0,0 +1,680 @@
+package clickhouse
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/go-graphite/carbonapi/limiter"
+	"github.com/go-graphite/carbonapi/zipper/helper"
+	"github.com/go-graphite/carbonapi/zipper/metadata"
+	"github.com/go-graphite/carbonapi/zipper/types"
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+
+	"go.uber.org/zap"
+)
+
+func init() {
+	aliases := []string{"clickhouse"}
+	metadata.Metadata.Lock()
+	for _, name := range aliases {
+		metadata.Metadata.SupportedProtocols[name] = struct{}{}
+		metadata.Metadata.ProtocolInits[name] = New
+		metadata.Metadata.ProtocolInitsWithLimiter[name] = NewWithLimiter
+	}
+	defer metadata.Metadata.Unlock()
+}
+
+var errInvalidOption = merry.New("invalid backend option")
+
+// ClickHouseGroup talks directly to ClickHouse HTTP interface using graphite-clickhouse table layout, implements BackendServer interface
+type ClickHouseGroup struct {
+	groupName string
+	servers   []string
+	protocol  string
+
+	client *http.Client
+
+	limiter              limiter.ServerLimiter
+	logger               *zap.Logger
+	timeout              types.Timeouts
+	maxTries             int
+	maxMetricsPerRequest int
+
+	treeTable   string
+	dataTable   string
+	taggedTable string
+
+	rollup rollup
+
+	httpQuery *helper.HttpQuery
+}
+
+func stringOption(options map[string]interface{}, name, defaultValue string) (string, merry.Error) {
+	v, ok := options[name]
+	if !ok {
+		return defaultValue, nil
+	}
+	s, ok := v.(string)
+	if !ok || s == "" {
+		return "", errInvalidOption.WithMessagef("option %q must be a non-empty string, got %T", name, v)
+	}
+	return s, nil
+}
+
+func NewWithLimiter(logger *zap.Logger, config types.BackendV2, tldCacheDisabled bool, limiter limiter.ServerLimiter) (types.BackendServer, merry.Error) {
+	logger = logger.With(zap.String("type", "clickhouse"), zap.String("protocol", config.Protocol), zap.String("name", config.GroupName))
+
+	logger.Warn("support for this backend protocol is experimental, use with caution")
+
+	httpClient := &http.Client{
+		Transport: &http.Transport{
+			MaxIdleConnsPerHost: *config.MaxIdleConnsPerHost,
+			DialContext: (&net.Dialer{
+				Timeout:   config.Timeouts.Connect,
+				KeepAlive: *config.KeepAliveInterval,
+			}).DialContext,
+		},
+	}
+
+	treeTable, e := stringOption(config.BackendOptions, "tree_table", "graphite_tree")
+	if e != nil {
+		return nil, e
+	}
+	dataTable, e := stringOption(config.BackendOptions, "data_table", "graphite")
+	if e != nil {
+		return nil, e
+	}
+	taggedTable, e := stringOption(config.BackendOptions, "tagged_table", "graphite_tagged")
+	if e != nil {
+		return nil, e
+	}
+
+	step := int64(60)
+	if stepI, ok := config.BackendOptions["step"]; ok {
+		var err error
+		step, err = toSeconds(stepI)
+		if err != nil || step <= 0 {
+			return nil, errInvalidOption.WithMessagef("failed to parse step: %v", stepI)
+		}
+	}
+
+	r := rollup{
+		defaultRule: rollupRule{
+			Function:   "avg",
+			Retentions: []retention{{Age: 0, Precision: step}},
+		},
+	}
+	if rollupI, ok := config.BackendOptions["rollup"]; ok {
+		var err error
+		r.rules, err = parseRollup(rollupI)
+		if err != nil {
+			return nil, errInvalidOption.WithMessagef("failed to parse rollup: %v", err)
+		}
+	}
+
+	httpQuery := helper.NewHttpQueryWithBalancer(config.GroupName, config.Servers, *config.MaxTries, limiter, httpClient, "text/tab-separated-values", helper.NewBalancer(config.GroupName, config.LBMethod, config.Servers), config.Hedging)
+
+	c := &ClickHouseGroup{
+		groupName:            config.GroupName,
+		servers:              config.Servers,
+		protocol:             config.Protocol,
+		timeout:              *config.Timeouts,
+		maxTries:             *config.MaxTries,
+		maxMetricsPerRequest: *config.MaxBatchSize,
+
+		treeTable:   treeTable,
+		dataTable:   dataTable,
+		taggedTable: taggedTable,
+		rollup:      r,
+
+		client:  httpClient,
+		limiter: limiter,
+		logger:  logger,
+
+		httpQuery: httpQuery,
+	}
+	return c, nil
+}
+
+func New(logger *zap.Logger, config types.BackendV2, tldCacheDisabled bool) (types.BackendServer, merry.Error) {
+	if config.ConcurrencyLimit == nil {
+		return nil, types.ErrConcurrencyLimitNotSet
+	}
+	if len(config.Servers) == 0 {
+		return nil, types.ErrNoServersSpecified
+	}
+	l := limiter.NewServerLimiter(config.Servers, *config.ConcurrencyLimit)
+
+	return NewWithLimiter(logger, config, tldCacheDisabled, l)
+}
+
+func (c *ClickHouseGroup) Children() []types.BackendServer {
+	return []types.BackendServer{c}
+}
+
+func (c ClickHouseGroup) MaxMetricsPerRequest() int {
+	return c.maxMetricsPerRequest
+}
+
+func (c ClickHouseGroup) Name() string {
+	return c.groupName
+}
+
+func (c ClickHouseGroup) Backends() []string {
+	return c.servers
+}
+
+// sqlQuery is sent as a body of POST request, so long lists of paths aren't limited by http_max_uri_size.
+// Implements types.Request
+type sqlQuery string
+
+func (q sqlQuery) Marshal() ([]byte, merry.Error) {
+	return []byte(q), nil
+}
+
+func (q sqlQuery) LogInfo() interface{} {
+	return string(q)
+}
+
+// query sends SQL query to ClickHouse and returns rows of TabSeparated output
+func (c *ClickHouseGroup) query(ctx context.Context, logger *zap.Logger, stats *types.Stats, query string) ([][]string, merry.Error) {
+	query += " FORMAT TabSeparated"
+	logger.Debug("will do query",
+		zap.String("query", query),
+	)
+
+	res, err := c.httpQuery.DoPostQuery(ctx, logger, "/", sqlQuery(query), nil)
+	res.UpdateStats(stats)
+	if err != nil {
+		return nil, err
+	}
+
+	if msg, ok := clickhouseError(res.Response); ok {
+		return nil, types.ErrFailedToFetch.WithMessage(msg).WithValue("query", query)
+	}
+
+	return parseTSV(res.Response), nil
+}
+
+// findPaths returns paths from tree table that match the glob, branches end with dot
+func (c *ClickHouseGroup) findPaths(ctx context.Context, logger *zap.Logger, stats *types.Stats, glob string) ([]string, merry.Error) {
+	var where string
+	if !hasWildcards(glob) {
+		where = "Path IN (" + quote(glob) + ", " + quote(glob+".") + ")"
+	} else {
+		level := strings.Count(glob, ".") + 1
+		where = "Level = " + strconv.Itoa(level)
+		if prefix := globPrefix(glob); prefix != "" {
+			where += " AND Path LIKE " + quote(likePrefix(prefix))
+		}
+		where += " AND match(Path, " + quote("^"+globToRegexp(glob)+`\.?$`) + ")"
+	}
+
+	query := "SELECT Path FROM " + c.treeTable + " WHERE " + where + " GROUP BY Path HAVING argMax(Deleted, Version) = 0 ORDER BY Path"
+	rows, err := c.query(ctx, logger, stats, query)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(rows))
+	for _, row := range rows {
+		paths = append(paths, row[0])
+	}
+	return paths, nil
+}
+
+// findTagged returns paths from tagged table that match seriesByTag expression
+func (c *ClickHouseGroup) findTagged(ctx context.Context, logger *zap.Logger, stats *types.Stats, target string) ([]string, merry.Error) {
+	exprs, err := parseSeriesByTag(target)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+
+	conditions := make([]string, 0, len(exprs)+1)
+	// Every tag of the series have own row in the table with the tag in Tag1, so it can be used as primary key
+	for _, t := range exprs {
+		if t.Op == "=" {
+			conditions = append(conditions, "Tag1 = "+quote(t.Tag+"="+t.Value))
+			break
+		}
+	}
+	for _, t := range exprs {
+		conditions = append(conditions, t.condition())
+	}
+
+	query := "SELECT Path FROM " + c.taggedTable + " WHERE " + strings.Join(conditions, " AND ") + " GROUP BY Path HAVING argMax(Deleted, Version) = 0 ORDER BY Path"
+	rows, e := c.query(ctx, logger, stats, query)
+	if e != nil {
+		return nil, e
+	}
+
+	paths := make([]string, 0, len(rows))
+	for _, row := range rows {
+		paths = append(paths, row[0])
+	}
+	return paths, nil
+}
+
+// expandTarget returns list of paths in data table for the target
+func (c *ClickHouseGroup) expandTarget(ctx context.Context, logger *zap.Logger, stats *types.Stats, target string) ([]string, merry.Error) {
+	if strings.HasPrefix(target, "seriesByTag") {
+		return c.findTagged(ctx, logger, stats, target)
+	}
+
+	if !hasWildcards(target) {
+		return []string{target}, nil
+	}
+
+	paths, err := c.findPaths(ctx, logger, stats, target)
+	if err != nil {
+		return nil, err
+	}
+	leafs := paths[:0]
+	for _, p := range paths {
+		if !strings.HasSuffix(p, ".") {
+			leafs = append(leafs, p)
+		}
+	}
+	return leafs, nil
+}
+
+// fetchPoints returns raw points of the paths, deduplicated by the most recent Timestamp
+func (c *ClickHouseGroup) fetchPoints(ctx context.Context, logger *zap.Logger, stats *types.Stats, paths []string, from, until int64) (map[string][]point, merry.Error) {
+	quoted := make([]string, 0, len(paths))
+	for _, p := range paths {
+		quoted = append(quoted, quote(p))
+	}
+
+	fromStr := strconv.FormatInt(from, 10)
+	untilStr := strconv.FormatInt(until, 10)
+	query := "SELECT Path, Time, argMax(Value, Timestamp) FROM " + c.dataTable +
+		" WHERE Path IN (" + strings.Join(quoted, ", ") + ")" +
+		" AND Date >= toDate(" + fromStr + ") - 1 AND Date <= toDate(" + untilStr + ") + 1" +
+		" AND Time >= " + fromStr + " AND Time <= " + untilStr +
+		" GROUP BY Path, Time ORDER BY Path, Time"
+
+	rows, e := c.query(ctx, logger, stats, query)
+	if e != nil {
+		return nil, e
+	}
+
+	res := make(map[string][]point)
+	for _, row := range rows {
+		if len(row) != 3 {
+			return nil, types.ErrFailedToFetch.WithMessagef("unexpected number of columns: %v", len(row))
+		}
+		t, err := strconv.ParseInt(row[1], 10, 64)
+		if err != nil {
+			return nil, merry.Wrap(err)
+		}
+		v, err := strconv.ParseFloat(row[2], 64)
+		if err != nil {
+			return nil, merry.Wrap(err)
+		}
+		res[row[0]] = append(res[row[0]], point{Time: t, Value: v})
+	}
+	return res, nil
+}
+
+func (c *ClickHouseGroup) Fetch(ctx context.Context, request *protov3.MultiFetchRequest) (*protov3.MultiFetchResponse, *types.Stats, merry.Error) {
+	logger := c.logger.With(zap.String("type", "fetch"), zap.String("request", request.String()))
+	stats := &types.Stats{}
+
+	var r protov3.MultiFetchResponse
+	var e merry.Error
+	addError := func(err merry.Error) {
+		stats.RenderErrors++
+		if merry.Is(err, types.ErrTimeoutExceeded) {
+			stats.Timeouts++
+			stats.RenderTimeouts++
+		}
+		if e == nil {
+			e = err
+		} else {
+			e = e.WithCause(err)
+		}
+	}
+
+	// paths of all targets with the same time range are fetched together, up to maxMetricsPerRequest per query
+	type fetchRange struct {
+		from, until int64
+	}
+	targetPaths := make([][]string, len(request.Metrics))
+	var ranges []fetchRange
+	rangePaths := make(map[fetchRange][]string)
+	seen := make(map[fetchRange]map[string]struct{})
+	for i, m := range request.Metrics {
+		stats.RenderRequests++
+		paths, err := c.expandTarget(ctx, logger, stats, m.Name)
+		if err != nil {
+			addError(err)
+			continue
+		}
+		targetPaths[i] = paths
+
+		key := fetchRange{m.StartTime, m.StopTime}
+		if _, ok := seen[key]; !ok {
+			ranges = append(ranges, key)
+			seen[key] = make(map[string]struct{})
+		}
+		for _, p := range paths {
+			if _, ok := seen[key][p]; !ok {
+				seen[key][p] = struct{}{}
+				rangePaths[key] = append(rangePaths[key], p)
+			}
+		}
+	}
+
+	points := make(map[fetchRange]map[string][]point, len(ranges))
+	failed := make(map[fetchRange]map[string]merry.Error)
+	for _, key := range ranges {
+		points[key] = make(map[string][]point)
+		paths := rangePaths[key]
+		for len(paths) > 0 {
+			batch := paths
+			if c.maxMetricsPerRequest > 0 && len(batch) > c.maxMetricsPerRequest {
+				batch = batch[:c.maxMetricsPerRequest]
+			}
+			paths = paths[len(batch):]
+
+			res, err := c.fetchPoints(ctx, logger, stats, batch, key.from, key.until)
+			if err != nil {
+				if failed[key] == nil {
+					failed[key] = make(map[string]merry.Error)
+				}
+				for _, p := range batch {
+					failed[key][p] = err
+				}
+				continue
+			}
+			for p, pts := range res {
+				points[key][p] = pts
+			}
+		}
+	}
+
+	now := time.Now().Unix()
+	for i, m := range request.Metrics {
+		paths := targetPaths[i]
+		if len(paths) == 0 {
+			continue
+		}
+		key := fetchRange{m.StartTime, m.StopTime}
+
+		var err merry.Error
+		for _, p := range paths {
+			if err = failed[key][p]; err != nil {
+				break
+			}
+		}
+		if err != nil {
+			addError(err)
+			continue
+		}
+
+		for _, p := range paths {
+			name := taggedPathToGraphite(p)
+			rule := c.rollup.match(name)
+			step := rule.step(now - m.StartTime)
+			start, stop, values := consolidate(points[key][p], m.StartTime, m.StopTime, step, rule)
+
+			r.Metrics = append(r.Metrics, protov3.FetchResponse{
+				Name:              name,
+				PathExpression:    m.PathExpression,
+				ConsolidationFunc: rule.consolidationFunc(),
+				StartTime:         start,
+				StopTime:          stop,
+				StepTime:          step,
+				Values:            values,
+				XFilesFactor:      0.0,
+				RequestStartTime:  m.StartTime,
+				RequestStopTime:   m.StopTime,
+			})
+		}
+	}
+
+	if e != nil {
+		stats.FailedServers = []string{c.groupName}
+		logger.Error("errors occurred while getting results",
+			zap.Any("errors", e),
+		)
+		return &r, stats, e
+	}
+	return &r, stats, nil
+}
+
+func (c *ClickHouseGroup) Find(ctx context.Context, request *protov3.MultiGlobRequest) (*protov3.MultiGlobResponse, *types.Stats, merry.Error) {
+	logger := c.logger.With(zap.String("type", "find"), zap.Strings("request", request.Metrics))
+	stats := &types.Stats{}
+
+	r := protov3.MultiGlobResponse{
+		Metrics: make([]protov3.GlobResponse, 0),
+	}
+	var e merry.Error
+	for _, query := range request.Metrics {
+		stats.FindRequests++
+		paths, err := c.findPaths(ctx, logger, stats, query)
+		if err != nil {
+			stats.FindErrors++
+			if merry.Is(err, types.ErrTimeoutExceeded) {
+				stats.Timeouts++
+				stats.FindTimeouts++
+			}
+			if e == nil {
+				e = err
+			} else {
+				e = e.WithCause(err)
+			}
+			continue
+		}
+
+		resp := protov3.GlobResponse{
+			Name:    query,
+			Matches: make([]protov3.GlobMatch, 0, len(paths)),
+		}
+		for _, p := range paths {
+			resp.Matches = append(resp.Matches, protov3.GlobMatch{
+				Path:   strings.TrimSuffix(p, "."),
+				IsLeaf: !strings.HasSuffix(p, "."),
+			})
+		}
+		r.Metrics = append(r.Metrics, resp)
+	}
+
+	if e != nil {
+		stats.FailedServers = []string{c.groupName}
+		logger.Error("errors occurred while getting results",
+			zap.Any("errors", e),
+		)
+		return &r, stats, e
+	}
+	return &r, stats, nil
+}
+
+// Info returns retentions based on rollup rules, as ClickHouse have no per-metric metadata
+func (c *ClickHouseGroup) Info(ctx context.Context, request *protov3.MultiMetricsInfoRequest) (*protov3.ZipperInfoResponse, *types.Stats, merry.Error) {
+	stats := &types.Stats{}
+	info := protov3.MultiMetricsInfoResponse{
+		Metrics: make([]protov3.MetricsInfoResponse, 0, len(request.Names)),
+	}
+
+	for _, name := range request.Names {
+		stats.InfoRequests++
+		rule := c.rollup.match(name)
+
+		retentions := make([]protov3.Retention, 0, len(rule.Retentions))
+		for i, ret := range rule.Retentions {
+			var points int64
+			if i+1 < len(rule.Retentions) {
+				points = (rule.Retentions[i+1].Age - ret.Age) / ret.Precision
+			}
+			retentions = append(retentions, protov3.Retention{
+				SecondsPerPoint: ret.Precision,
+				NumberOfPoints:  points,
+			})
+		}
+
+		info.Metrics = append(info.Metrics, protov3.MetricsInfoResponse{
+			Name:              name,
+			ConsolidationFunc: rule.consolidationFunc(),
+			XFilesFactor:      0.0,
+			MaxRetention:      rule.Retentions[len(rule.Retentions)-1].Age,
+			Retentions:        retentions,
+		})
+	}
+
+	r := &protov3.ZipperInfoResponse{
+		Info: map[string]protov3.MultiMetricsInfoResponse{
+			c.Name(): info,
+		},
+	}
+	return r, stats, nil
+}
+
+func (c *ClickHouseGroup) List(ctx context.Context) (*protov3.ListMetricsResponse, *types.Stats, merry.Error) {
+	return nil, nil, types.ErrNotSupportedByBackend
+}
+
+func (c *ClickHouseGroup) Stats(ctx context.Context) (*protov3.MetricDetailsResponse, *types.Stats, merry.Error) {
+	return nil, nil, types.ErrNotSupportedByBackend
+}
+
+func parseTagQuery(query string) map[string][]string {
+	params := make(map[string][]string)
+	queryDecoded, _ := url.QueryUnescape(query)
+	for _, qvRaw := range strings.Split(queryDecoded, "&") {
+		idx := strings.Index(qvRaw, "=")
+		//no parameters passed
+		if idx < 1 {
+			continue
+		}
+		params[qvRaw[:idx]] = append(params[qvRaw[:idx]], qvRaw[idx+1:])
+	}
+	return params
+}
+
+func (c *ClickHouseGroup) doTagQuery(ctx context.Context, isTagName bool, query string, limit int64) ([]string, merry.Error) {
+	logger := c.logger
+	params := parseTagQuery(query)
+
+	var (
+		column     string
+		conditions []string
+	)
+	if isTagName {
+		logger = logger.With(zap.String("type", "tagName"))
+		column = "splitByChar('=', Tag1)[1]"
+		if prefix, ok := params["tagPrefix"]; ok && prefix[0] != "" {
+			tagPrefix := prefix[0]
+			if strings.HasPrefix("name", tagPrefix) {
+				// name is stored as __name__, it's easier to filter it later
+				tagPrefix = ""
+			}
+			conditions = append(conditions, "Tag1 LIKE "+quote(likePrefix(tagPrefix)))
+		}
+	} else {
+		logger = logger.With(zap.String("type", "tagValues"))
+		tag, ok := params["tag"]
+		if !ok {
+			return []string{}, types.ErrNoTagSpecified
+		}
+		tagName := tag[0]
+		if tagName == "name" {
+			tagName = "__name__"
+		}
+		column = "substring(Tag1, " + strconv.Itoa(len(tagName)+2) + ")"
+		var valuePrefix string
+		if prefix, ok := params["valuePrefix"]; ok {
+			valuePrefix = prefix[0]
+		}
+		conditions = append(conditions, "Tag1 LIKE "+quote(likePrefix(tagName+"="+valuePrefix)))
+	}
+
+	for _, expr := range params["expr"] {
+		t, err := parseTagExpr(expr)
+		if err != nil {
+			return []string{}, merry.Wrap(err)
+		}
+		conditions = append(conditions, t.condition())
+	}
+
+	q := "SELECT " + column + " AS value FROM " + c.taggedTable
+	if len(conditions) > 0 {
+		q += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	q += " GROUP BY value ORDER BY value"
+
+	rows, e := c.query(ctx, logger, &types.Stats{}, q)
+	if e != nil {
+		return []string{}, e
+	}
+
+	result := make([]string, 0, len(rows))
+	for _, row := range rows {
+		v := row[0]
+		if isTagName {
+			if v == "__name__" {
+				v = "name"
+			}
+			if prefix, ok := params["tagPrefix"]; ok && !strings.HasPrefix(v, prefix[0]) {
+				continue
+			}
+		}
+		result = append(result, v)
+	}
+	sort.Strings(result)
+
+	if limit > 0 && len(result) > int(limit) {
+		result = result[:int(limit)]
+	}
+
+	logger.Debug("got client response",
+		zap.Strings("result", result),
+	)
+
+	return result, nil
+}
+
+func (c *ClickHouseGroup) TagNames(ctx context.Context, query string, limit int64) ([]string, merry.Error) {
+	return c.doTagQuery(ctx, true, query, limit)
+}
+
+func (c *ClickHouseGroup) TagValues(ctx context.Context, query string, limit int64) ([]string, merry.Error) {
+	return c.doTagQuery(ctx, false, query, limit)
+}
+
+func (c *ClickHouseGroup) ProbeTLDs(ctx context.Context) ([]string, merry.Error) {
+	logger := c.logger.With(zap.String("function", "prober"))
+	req := &protov3.MultiGlobRequest{
+		Metrics: []string{"*"},
+	}
+
+	logger.Debug("doing request",
+		zap.Strings("request", req.Metrics),
+	)
+
+	res, _, err := c.Find(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var tlds []string
+	for _, m := range res.Metrics {
+		for _, v := range m.Matches {
+			tlds = append(tlds, v.Path)
+		}
+	}
+
+	logger.Debug("will return data",
+		zap.Strings("tlds", tlds),
+	)
+
+	return tlds, nil
+}
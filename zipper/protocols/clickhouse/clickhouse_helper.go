@@ -0,0 +1,504 @@
+package clickhouse
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// quote returns string literal that is safe to use in ClickHouse query
+func quote(s string) string {
+	var sb strings.Builder
+	sb.Grow(len(s) + 2)
+	sb.WriteByte('\'')
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\', '\'':
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(s[i])
+	}
+	sb.WriteByte('\'')
+	return sb.String()
+}
+
+// hasWildcards checks if graphite glob contains any wildcard symbols
+func hasWildcards(query string) bool {
+	return strings.ContainsAny(query, "*?[{")
+}
+
+// globToRegexp converts graphite glob to re2 expression without anchors, wildcards never match across the dots
+func globToRegexp(query string) string {
+	var sb strings.Builder
+
+	for {
+		n := strings.IndexAny(query, "*?[{")
+		if n < 0 {
+			sb.WriteString(regexp.QuoteMeta(query))
+			return sb.String()
+		}
+
+		sb.WriteString(regexp.QuoteMeta(query[:n]))
+		ch := query[n]
+		query = query[n+1:]
+
+		switch ch {
+		case '*':
+			sb.WriteString("[^.]*")
+		case '?':
+			sb.WriteString("[^.]")
+		case '[':
+			n = strings.Index(query, "]")
+			if n < 0 {
+				sb.WriteString(regexp.QuoteMeta("[" + query))
+				return sb.String()
+			}
+			sb.WriteString("[" + query[:n+1])
+			query = query[n+1:]
+		case '{':
+			n = strings.Index(query, "}")
+			if n < 0 {
+				sb.WriteString(regexp.QuoteMeta("{" + query))
+				return sb.String()
+			}
+			alts := strings.Split(query[:n], ",")
+			query = query[n+1:]
+			for i := range alts {
+				alts[i] = globToRegexp(alts[i])
+			}
+			sb.WriteString("(" + strings.Join(alts, "|") + ")")
+		}
+	}
+}
+
+// globPrefix returns the part of the glob before the first wildcard, it's used to narrow down index scan
+func globPrefix(query string) string {
+	n := strings.IndexAny(query, "*?[{")
+	if n < 0 {
+		return query
+	}
+	return query[:n]
+}
+
+// likePrefix returns LIKE expression that matches strings starting with prefix
+func likePrefix(prefix string) string {
+	r := strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_")
+	return r.Replace(prefix) + "%"
+}
+
+var tsvUnescaper = strings.NewReplacer(
+	"\\\\", "\\",
+	"\\t", "\t",
+	"\\n", "\n",
+	"\\r", "\r",
+	"\\b", "\b",
+	"\\f", "\f",
+	"\\0", "\x00",
+	"\\'", "'",
+)
+
+// parseTSV splits ClickHouse TabSeparated output into rows and unescapes the fields
+func parseTSV(data []byte) [][]string {
+	var rows [][]string
+	for _, line := range bytes.Split(data, []byte{'\n'}) {
+		if len(line) == 0 {
+			continue
+		}
+		fields := strings.Split(string(line), "\t")
+		for i := range fields {
+			if strings.IndexByte(fields[i], '\\') >= 0 {
+				fields[i] = tsvUnescaper.Replace(fields[i])
+			}
+		}
+		rows = append(rows, fields)
+	}
+	return rows
+}
+
+// clickhouseError extracts error message from the response, ClickHouse might return errors with non-5xx codes,
+// e.x. for syntax errors or unknown tables
+func clickhouseError(data []byte) (string, bool) {
+	if bytes.HasPrefix(data, []byte("Code: ")) {
+		return string(bytes.TrimSpace(data)), true
+	}
+	return "", false
+}
+
+// taggedPathToGraphite converts path of tagged series in graphite-clickhouse format (name?tag1=v1&tag2=v2) to graphite
+// format (name;tag1=v1;tag2=v2)
+func taggedPathToGraphite(path string) string {
+	n := strings.IndexByte(path, '?')
+	if n < 0 {
+		return path
+	}
+
+	var sb strings.Builder
+	name, _ := url.PathUnescape(path[:n])
+	sb.WriteString(name)
+
+	tags, err := url.ParseQuery(path[n+1:])
+	if err != nil {
+		return path
+	}
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range tags[k] {
+			sb.WriteString(";" + k + "=" + v)
+		}
+	}
+	return sb.String()
+}
+
+type tagExpr struct {
+	Tag   string
+	Op    string
+	Value string
+}
+
+// parseTagExpr parses seriesByTag expression, e.x. 'name=value', 'name!=value', 'name=~regex' or 'name!=~regex'
+func parseTagExpr(s string) (tagExpr, error) {
+	s = strings.TrimSpace(s)
+	s = strings.Trim(s, "'\"")
+
+	n := strings.IndexAny(s, "!=")
+	if n < 1 {
+		return tagExpr{}, fmt.Errorf("invalid tag expression %q", s)
+	}
+
+	t := tagExpr{Tag: strings.TrimSpace(s[:n])}
+	rest := s[n:]
+	for _, op := range []string{"!=~", "=~", "!=", "="} {
+		if strings.HasPrefix(rest, op) {
+			t.Op = op
+			t.Value = strings.TrimSpace(rest[len(op):])
+			break
+		}
+	}
+	if t.Op == "" {
+		return tagExpr{}, fmt.Errorf("invalid tag expression %q", s)
+	}
+	if t.Tag == "name" {
+		t.Tag = "__name__"
+	}
+	return t, nil
+}
+
+// parseSeriesByTag returns list of tag expressions of seriesByTag('tag1=v1', 'tag2=~v2') target
+func parseSeriesByTag(target string) ([]tagExpr, error) {
+	if !strings.HasPrefix(target, "seriesByTag(") || !strings.HasSuffix(target, ")") {
+		return nil, fmt.Errorf("invalid seriesByTag expression %q", target)
+	}
+	args := target[len("seriesByTag(") : len(target)-1]
+
+	var res []tagExpr
+	for _, arg := range splitArgs(args) {
+		t, err := parseTagExpr(arg)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, t)
+	}
+	if len(res) == 0 {
+		return nil, fmt.Errorf("no tag expressions in %q", target)
+	}
+	return res, nil
+}
+
+// splitArgs splits comma separated list of quoted strings, commas inside quotes are preserved
+func splitArgs(s string) []string {
+	var (
+		res   []string
+		quote byte
+		start int
+	)
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quote != 0:
+			if s[i] == quote {
+				quote = 0
+			}
+		case s[i] == '\'' || s[i] == '"':
+			quote = s[i]
+		case s[i] == ',':
+			res = append(res, s[start:i])
+			start = i + 1
+		}
+	}
+	if strings.TrimSpace(s[start:]) != "" {
+		res = append(res, s[start:])
+	}
+	return res
+}
+
+// condition returns ClickHouse condition over Tags array of the tagged table
+func (t tagExpr) condition() string {
+	switch t.Op {
+	case "=":
+		return "has(Tags, " + quote(t.Tag+"="+t.Value) + ")"
+	case "!=":
+		return "NOT has(Tags, " + quote(t.Tag+"="+t.Value) + ")"
+	case "=~":
+		return "arrayExists(x -> match(x, " + quote("^"+regexp.QuoteMeta(t.Tag)+"=(?:"+t.Value+")") + "), Tags)"
+	default:
+		return "NOT arrayExists(x -> match(x, " + quote("^"+regexp.QuoteMeta(t.Tag)+"=(?:"+t.Value+")") + "), Tags)"
+	}
+}
+
+// retention is a single precision step of rollup rule, Precision is used for data that is older than Age seconds
+type retention struct {
+	Age       int64
+	Precision int64
+}
+
+// rollupRule describes resolution of the data for the metrics matched by Regexp, same as graphite_rollup config of
+// ClickHouse GraphiteMergeTree
+type rollupRule struct {
+	Regexp     *regexp.Regexp
+	Function   string
+	Retentions []retention
+}
+
+type rollup struct {
+	rules       []rollupRule
+	defaultRule rollupRule
+}
+
+// match returns first rule which regexp matches the metric or the default one
+func (r *rollup) match(metric string) *rollupRule {
+	for i := range r.rules {
+		if r.rules[i].Regexp == nil || r.rules[i].Regexp.MatchString(metric) {
+			return &r.rules[i]
+		}
+	}
+	return &r.defaultRule
+}
+
+// step returns precision of the data that is age seconds old
+func (r *rollupRule) step(age int64) int64 {
+	step := r.Retentions[0].Precision
+	for _, ret := range r.Retentions {
+		if ret.Age > age {
+			break
+		}
+		step = ret.Precision
+	}
+	return step
+}
+
+// consolidationFunc returns name of the function in the format that is used in carbonapi responses
+func (r *rollupRule) consolidationFunc() string {
+	switch r.Function {
+	case "avg", "average":
+		return "average"
+	case "any", "first":
+		return "first"
+	case "anyLast":
+		return "last"
+	default:
+		return r.Function
+	}
+}
+
+// aggregate applies rollup function to the values of single step
+func (r *rollupRule) aggregate(values []float64) float64 {
+	if len(values) == 0 {
+		return math.NaN()
+	}
+
+	switch r.Function {
+	case "sum":
+		var sum float64
+		for _, v := range values {
+			sum += v
+		}
+		return sum
+	case "min":
+		min := values[0]
+		for _, v := range values[1:] {
+			if v < min {
+				min = v
+			}
+		}
+		return min
+	case "max":
+		max := values[0]
+		for _, v := range values[1:] {
+			if v > max {
+				max = v
+			}
+		}
+		return max
+	case "last", "anyLast":
+		return values[len(values)-1]
+	case "first", "any":
+		return values[0]
+	default:
+		var sum float64
+		for _, v := range values {
+			sum += v
+		}
+		return sum / float64(len(values))
+	}
+}
+
+type point struct {
+	Time  int64
+	Value float64
+}
+
+// consolidate puts points into the buckets of step seconds and aggregates them with the rollup function. Points must
+// be sorted by time. Returned series starts at from aligned to step and covers until.
+func consolidate(points []point, from, until, step int64, rule *rollupRule) (int64, int64, []float64) {
+	start := from - from%step
+	stop := until - until%step + step
+	values := make([]float64, (stop-start)/step)
+	for i := range values {
+		values[i] = math.NaN()
+	}
+
+	var bucket []float64
+	idx := -1
+	for _, p := range points {
+		i := int((p.Time - start) / step)
+		if i < 0 || i >= len(values) {
+			continue
+		}
+		if i != idx {
+			if idx >= 0 {
+				values[idx] = rule.aggregate(bucket)
+			}
+			idx = i
+			bucket = bucket[:0]
+		}
+		bucket = append(bucket, p.Value)
+	}
+	if idx >= 0 {
+		values[idx] = rule.aggregate(bucket)
+	}
+
+	return start, stop, values
+}
+
+// parseRollup parses list of rules from backendOptions:
+//
+//	rollup:
+//	  - regexp: "^servers\\."
+//	    function: "max"
+//	    retention:
+//	      - age: 0
+//	        precision: 10
+//	      - age: "720h"
+//	        precision: 600
+func parseRollup(v interface{}) ([]rollupRule, error) {
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("rollup must be a list, got %T", v)
+	}
+
+	rules := make([]rollupRule, 0, len(list))
+	for _, item := range list {
+		m, err := toStringMap(item)
+		if err != nil {
+			return nil, err
+		}
+
+		var rule rollupRule
+		if re, ok := m["regexp"]; ok {
+			s, ok := re.(string)
+			if !ok {
+				return nil, fmt.Errorf("rollup regexp must be a string, got %T", re)
+			}
+			rule.Regexp, err = regexp.Compile(s)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		rule.Function = "avg"
+		if f, ok := m["function"]; ok {
+			if rule.Function, ok = f.(string); !ok {
+				return nil, fmt.Errorf("rollup function must be a string, got %T", f)
+			}
+		}
+
+		retentions, ok := m["retention"].([]interface{})
+		if !ok || len(retentions) == 0 {
+			return nil, fmt.Errorf("rollup rule must have non-empty list of retentions")
+		}
+		for _, r := range retentions {
+			rm, err := toStringMap(r)
+			if err != nil {
+				return nil, err
+			}
+			age, err := toSeconds(rm["age"])
+			if err != nil {
+				return nil, fmt.Errorf("invalid age: %v", err)
+			}
+			precision, err := toSeconds(rm["precision"])
+			if err != nil {
+				return nil, fmt.Errorf("invalid precision: %v", err)
+			}
+			if precision <= 0 {
+				return nil, fmt.Errorf("precision must be positive")
+			}
+			rule.Retentions = append(rule.Retentions, retention{Age: age, Precision: precision})
+		}
+		sort.Slice(rule.Retentions, func(i, j int) bool {
+			return rule.Retentions[i].Age < rule.Retentions[j].Age
+		})
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+func toStringMap(v interface{}) (map[string]interface{}, error) {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		return m, nil
+	case map[interface{}]interface{}:
+		res := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			res[fmt.Sprint(k)] = v
+		}
+		return res, nil
+	default:
+		return nil, fmt.Errorf("expected map, got %T", v)
+	}
+}
+
+// toSeconds accepts either amount of seconds or duration string, e.x. "720h"
+func toSeconds(v interface{}) (int64, error) {
+	switch s := v.(type) {
+	case int:
+		return int64(s), nil
+	case int64:
+		return s, nil
+	case float64:
+		return int64(s), nil
+	case string:
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n, nil
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, err
+		}
+		return int64(d.Seconds()), nil
+	case nil:
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("unexpected type %T", v)
+	}
+}
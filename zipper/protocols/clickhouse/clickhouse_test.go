@@ -0,0 +1,358 @@
+package clickhouse
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/zipper/types"
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"go.uber.org/zap"
+)
+
+// clickhouseStub answers queries with the response of the first matching substring and records received queries
+type clickhouseStub struct {
+	responses [][2]string
+	queries   []string
+}
+
+func (s *clickhouseStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	query := string(body)
+	s.queries = append(s.queries, query)
+	for _, resp := range s.responses {
+		if strings.Contains(query, resp[0]) {
+			_, _ = w.Write([]byte(resp[1]))
+			return
+		}
+	}
+	w.WriteHeader(http.StatusInternalServerError)
+	_, _ = w.Write([]byte("Code: 62. DB::Exception: unexpected query"))
+}
+
+func newTestGroup(t *testing.T, stub *clickhouseStub, options map[string]interface{}) (*ClickHouseGroup, func()) {
+	srv := httptest.NewServer(stub)
+
+	concurrencyLimit := 10
+	maxIdleConns := 1
+	keepAlive := time.Second
+	maxTries := 1
+	maxBatchSize := 100
+	config := types.BackendV2{
+		GroupName:           "clickhouse",
+		Protocol:            "clickhouse",
+		Servers:             []string{srv.URL},
+		Timeouts:            &types.Timeouts{Find: time.Second, Render: time.Second, Connect: time.Second},
+		ConcurrencyLimit:    &concurrencyLimit,
+		KeepAliveInterval:   &keepAlive,
+		MaxIdleConnsPerHost: &maxIdleConns,
+		MaxTries:            &maxTries,
+		MaxBatchSize:        &maxBatchSize,
+		BackendOptions:      options,
+	}
+
+	c, err := New(zap.NewNop(), config, true)
+	if err != nil {
+		srv.Close()
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return c.(*ClickHouseGroup), srv.Close
+}
+
+func TestGlobToRegexp(t *testing.T) {
+	tests := []struct {
+		glob string
+		want string
+	}{
+		{"a.b.c", `a\.b\.c`},
+		{"a.*.c", `a\.[^.]*\.c`},
+		{"a.b?", `a\.b[^.]`},
+		{"a.{b,c*}.d", `a\.(b|c[^.]*)\.d`},
+		{"a.[0-9].d", `a\.[0-9]\.d`},
+	}
+
+	for _, tt := range tests {
+		if got := globToRegexp(tt.glob); got != tt.want {
+			t.Errorf("globToRegexp(%q) = %q, want %q", tt.glob, got, tt.want)
+		}
+	}
+}
+
+func TestParseTSV(t *testing.T) {
+	got := parseTSV([]byte("a\\tb\t1\nc\\\\d\t2\n"))
+	want := [][]string{{"a\tb", "1"}, {"c\\d", "2"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseTSV() = %q, want %q", got, want)
+	}
+}
+
+func TestTaggedPathToGraphite(t *testing.T) {
+	got := taggedPathToGraphite("cpu.usage?host=a&dc=b")
+	if want := "cpu.usage;dc=b;host=a"; got != want {
+		t.Errorf("taggedPathToGraphite() = %q, want %q", got, want)
+	}
+}
+
+func TestConsolidate(t *testing.T) {
+	points := []point{{60, 1}, {70, 3}, {130, 5}, {250, 7}}
+	rule := &rollupRule{Function: "sum"}
+	start, stop, values := consolidate(points, 65, 250, 60, rule)
+
+	if start != 60 || stop != 300 {
+		t.Fatalf("unexpected range [%v, %v)", start, stop)
+	}
+	want := []float64{4, 5, math.NaN(), 7}
+	if len(values) != len(want) {
+		t.Fatalf("got %v, want %v", values, want)
+	}
+	for i := range want {
+		if values[i] != want[i] && !(math.IsNaN(values[i]) && math.IsNaN(want[i])) {
+			t.Errorf("got %v, want %v", values, want)
+			break
+		}
+	}
+}
+
+func TestRollupStep(t *testing.T) {
+	rules, err := parseRollup([]interface{}{
+		map[interface{}]interface{}{
+			"regexp":   "^servers\\.",
+			"function": "max",
+			"retention": []interface{}{
+				map[interface{}]interface{}{"age": "24h", "precision": 300},
+				map[interface{}]interface{}{"age": 0, "precision": 10},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	r := rollup{rules: rules, defaultRule: rollupRule{Function: "avg", Retentions: []retention{{0, 60}}}}
+	rule := r.match("servers.a.cpu")
+	if rule.Function != "max" {
+		t.Fatalf("wrong rule matched: %+v", rule)
+	}
+	if step := rule.step(3600); step != 10 {
+		t.Errorf("step for 1h = %v, want 10", step)
+	}
+	if step := rule.step(2 * 86400); step != 300 {
+		t.Errorf("step for 2d = %v, want 300", step)
+	}
+	if step := r.match("other.metric").step(2 * 86400); step != 60 {
+		t.Errorf("default step = %v, want 60", step)
+	}
+}
+
+func TestFind(t *testing.T) {
+	stub := &clickhouseStub{
+		responses: [][2]string{
+			{"FROM graphite_tree", "a.b.\na.c\n"},
+		},
+	}
+	c, closer := newTestGroup(t, stub, nil)
+	defer closer()
+
+	res, _, err := c.Find(context.Background(), &protov3.MultiGlobRequest{Metrics: []string{"a.*"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []protov3.GlobMatch{{Path: "a.b", IsLeaf: false}, {Path: "a.c", IsLeaf: true}}
+	if len(res.Metrics) != 1 || !reflect.DeepEqual(res.Metrics[0].Matches, want) {
+		t.Errorf("got %+v, want %+v", res.Metrics, want)
+	}
+	if q := stub.queries[0]; !strings.Contains(q, "Level = 2") || !strings.Contains(q, `match(Path, '^a\\.[^.]*\\.?$')`) {
+		t.Errorf("unexpected query: %s", q)
+	}
+}
+
+func TestFetch(t *testing.T) {
+	stub := &clickhouseStub{
+		responses: [][2]string{
+			{"FROM graphite_tree", "a.b.\na.c\na.d\n"},
+			{"FROM graphite WHERE", "a.c\t60\t1\na.c\t90\t3\na.c\t120\t5\na.d\t180\t2\n"},
+		},
+	}
+	c, closer := newTestGroup(t, stub, map[string]interface{}{"step": "60"})
+	defer closer()
+
+	res, _, err := c.Fetch(context.Background(), &protov3.MultiFetchRequest{
+		Metrics: []protov3.FetchRequest{{Name: "a.*", PathExpression: "a.*", StartTime: 60, StopTime: 180}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(res.Metrics) != 2 {
+		t.Fatalf("got %v series, want 2", len(res.Metrics))
+	}
+	m := res.Metrics[0]
+	if m.Name != "a.c" || m.StartTime != 60 || m.StepTime != 60 || m.ConsolidationFunc != "average" {
+		t.Errorf("unexpected series: %+v", m)
+	}
+	if m.Values[0] != 2 || m.Values[1] != 5 || !math.IsNaN(m.Values[2]) {
+		t.Errorf("unexpected values: %v", m.Values)
+	}
+	if res.Metrics[1].Name != "a.d" || res.Metrics[1].Values[2] != 2 {
+		t.Errorf("unexpected series: %+v", res.Metrics[1])
+	}
+	if q := stub.queries[1]; !strings.Contains(q, "Path IN ('a.c', 'a.d')") {
+		t.Errorf("unexpected query: %s", q)
+	}
+}
+
+func TestFetchBatches(t *testing.T) {
+	stub := &clickhouseStub{
+		responses: [][2]string{
+			{"FROM graphite_tree", "a.c\na.d\n"},
+			{"FROM graphite WHERE", "a.c\t60\t1\na.d\t60\t2\nb.c\t60\t3\n"},
+		},
+	}
+	c, closer := newTestGroup(t, stub, map[string]interface{}{"step": "60"})
+	defer closer()
+	c.maxMetricsPerRequest = 2
+
+	res, _, err := c.Fetch(context.Background(), &protov3.MultiFetchRequest{
+		Metrics: []protov3.FetchRequest{
+			{Name: "a.*", PathExpression: "a.*", StartTime: 60, StopTime: 119},
+			{Name: "b.c", PathExpression: "b.c", StartTime: 60, StopTime: 119},
+			{Name: "a.c", PathExpression: "a.c", StartTime: 60, StopTime: 119},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got []string
+	for _, m := range res.Metrics {
+		got = append(got, m.PathExpression+":"+m.Name)
+	}
+	if want := []string{"a.*:a.c", "a.*:a.d", "b.c:b.c", "a.c:a.c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if res.Metrics[2].Values[0] != 3 || res.Metrics[3].Values[0] != 1 {
+		t.Errorf("unexpected response: %+v", res.Metrics)
+	}
+
+	// paths of all targets are fetched in batches of maxBatchSize, duplicates are fetched once
+	want := []string{"Path IN ('a.c', 'a.d')", "Path IN ('b.c')"}
+	if len(stub.queries) != 1+len(want) {
+		t.Fatalf("unexpected queries: %v", stub.queries)
+	}
+	for i, w := range want {
+		if q := stub.queries[1+i]; !strings.Contains(q, w) {
+			t.Errorf("unexpected query: %s", q)
+		}
+	}
+}
+
+func TestFetchSeriesByTag(t *testing.T) {
+	stub := &clickhouseStub{
+		responses: [][2]string{
+			{"FROM graphite_tagged", "cpu?host=a\n"},
+			{"FROM graphite WHERE", "cpu?host=a\t60\t1\n"},
+		},
+	}
+	c, closer := newTestGroup(t, stub, nil)
+	defer closer()
+
+	target := "seriesByTag('name=cpu', 'host=~a|b', 'dc!=x')"
+	res, _, err := c.Fetch(context.Background(), &protov3.MultiFetchRequest{
+		Metrics: []protov3.FetchRequest{{Name: target, PathExpression: target, StartTime: 60, StopTime: 119}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(res.Metrics) != 1 || res.Metrics[0].Name != "cpu;host=a" || res.Metrics[0].Values[0] != 1 {
+		t.Errorf("unexpected response: %+v", res.Metrics)
+	}
+
+	want := "Tag1 = '__name__=cpu' AND has(Tags, '__name__=cpu') AND " +
+		"arrayExists(x -> match(x, '^host=(?:a|b)'), Tags) AND NOT has(Tags, 'dc=x')"
+	if !strings.Contains(stub.queries[0], want) {
+		t.Errorf("unexpected query: %s", stub.queries[0])
+	}
+}
+
+func TestFetchError(t *testing.T) {
+	stub := &clickhouseStub{
+		responses: [][2]string{
+			{"FROM graphite WHERE", "Code: 60. DB::Exception: Table default.graphite doesn't exist."},
+		},
+	}
+	c, closer := newTestGroup(t, stub, nil)
+	defer closer()
+
+	_, stats, err := c.Fetch(context.Background(), &protov3.MultiFetchRequest{
+		Metrics: []protov3.FetchRequest{{Name: "a.b", PathExpression: "a.b", StartTime: 60, StopTime: 120}},
+	})
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	if stats.RenderErrors != 1 {
+		t.Errorf("RenderErrors = %v, want 1", stats.RenderErrors)
+	}
+}
+
+func TestTagValues(t *testing.T) {
+	stub := &clickhouseStub{
+		responses: [][2]string{
+			{"FROM graphite_tagged", "a\nb\nc\n"},
+		},
+	}
+	c, closer := newTestGroup(t, stub, nil)
+	defer closer()
+
+	res, err := c.TagValues(context.Background(), "tag=host&valuePrefix=&expr=name%3Dcpu", 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"a", "b"}; !reflect.DeepEqual(res, want) {
+		t.Errorf("got %v, want %v", res, want)
+	}
+	if q := stub.queries[0]; !strings.Contains(q, "Tag1 LIKE 'host=%' AND has(Tags, '__name__=cpu')") {
+		t.Errorf("unexpected query: %s", q)
+	}
+}
+
+func TestInfo(t *testing.T) {
+	c, closer := newTestGroup(t, &clickhouseStub{}, map[string]interface{}{
+		"rollup": []interface{}{
+			map[string]interface{}{
+				"function": "sum",
+				"retention": []interface{}{
+					map[string]interface{}{"age": 0, "precision": 60},
+					map[string]interface{}{"age": "24h", "precision": 600},
+				},
+			},
+		},
+	})
+	defer closer()
+
+	res, _, err := c.Info(context.Background(), &protov3.MultiMetricsInfoRequest{Names: []string{"a.b"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	info := res.Info["clickhouse"].Metrics[0]
+	want := []protov3.Retention{{SecondsPerPoint: 60, NumberOfPoints: 1440}, {SecondsPerPoint: 600}}
+	if info.ConsolidationFunc != "sum" || info.MaxRetention != 86400 || !reflect.DeepEqual(info.Retentions, want) {
+		t.Errorf("unexpected info: %+v", info)
+	}
+}
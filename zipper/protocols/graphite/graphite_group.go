@@ -68,7 +68,7 @@ func NewWithLimiter(logger *zap.Logger, config types.BackendV2, tldCacheDisabled
 		},
 	}
 
-	httpQuery := helper.NewHttpQuery(config.GroupName, config.Servers, *config.MaxTries, limiter, httpClient, httpHeaders.ContentTypeCarbonAPIv2PB)
+	httpQuery := helper.NewHttpQueryWithBalancer(config.GroupName, config.Servers, *config.MaxTries, limiter, httpClient, httpHeaders.ContentTypeCarbonAPIv2PB, helper.NewBalancer(config.GroupName, config.LBMethod, config.Servers), config.Hedging)
 
 	c := &GraphiteGroup{
 		groupName:            config.GroupName,
@@ -134,6 +134,7 @@ func (c *GraphiteGroup) Fetch(ctx context.Context, request *protov3.MultiFetchRe
 		rewrite.RawQuery = v.Encode()
 		stats.RenderRequests += 1
 		res, err := c.httpQuery.DoQuery(ctx, logger, rewrite.RequestURI(), nil)
+		res.UpdateStats(stats)
 		if err != nil {
 			stats.RenderErrors += 1
 			if merry.Is(err, types.ErrTimeoutExceeded) {
@@ -208,6 +209,7 @@ func (c *GraphiteGroup) Find(ctx context.Context, request *protov3.MultiGlobRequ
 		rewrite.RawQuery = v.Encode()
 		stats.FindRequests += 1
 		res, err := c.httpQuery.DoQuery(ctx, logger, rewrite.RequestURI(), nil)
+		res.UpdateStats(stats)
 		if err != nil {
 			stats.FindErrors += 1
 			if merry.Is(err, types.ErrTimeoutExceeded) {
@@ -277,6 +279,7 @@ func (c *GraphiteGroup) Info(ctx context.Context, request *protov3.MultiMetricsI
 		rewrite.RawQuery = v.Encode()
 		stats.InfoRequests += 1
 		res, err := c.httpQuery.DoQuery(ctx, logger, rewrite.RequestURI(), nil)
+		res.UpdateStats(stats)
 		if err != nil {
 			stats.InfoErrors += 1
 			if merry.Is(err, types.ErrTimeoutExceeded) {
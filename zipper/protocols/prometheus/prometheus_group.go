@@ -7,11 +7,13 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/ansel1/merry"
+	"github.com/dgryski/go-expirecache"
 	"github.com/go-graphite/carbonapi/limiter"
 	"github.com/go-graphite/carbonapi/zipper/helper"
 	"github.com/go-graphite/carbonapi/zipper/httpHeaders"
@@ -70,6 +72,15 @@ type PrometheusGroup struct {
 
 	startDelay startDelay
 
+	remoteRead              bool
+	remoteReadPath          string
+	remoteReadConsolidation string
+
+	labelPaths []string
+	retention  int64
+	index      *expirecache.Cache
+	indexTTL   int32
+
 	httpQuery *helper.HttpQuery
 }
 
@@ -93,10 +104,8 @@ func NewWithLimiter(logger *zap.Logger, config types.BackendV2, tldCacheDisabled
 	if ok {
 		stepNew, ok := stepI.(string)
 		if ok {
-			if stepNew[len(stepNew)-1] >= '0' && stepNew[len(stepNew)-1] <= '9' {
-				stepNew += "s"
-			}
-			t, err := time.ParseDuration(stepNew)
+			var err error
+			step, err = parseStep(stepNew)
 			if err != nil {
 				logger.Fatal("failed to parse option",
 					zap.String("option_name", "step"),
@@ -104,7 +113,6 @@ func NewWithLimiter(logger *zap.Logger, config types.BackendV2, tldCacheDisabled
 					zap.Error(err),
 				)
 			}
-			step = int64(t.Seconds())
 		} else {
 			logger.Fatal("failed to parse step",
 				zap.String("type_parsed", fmt.Sprintf("%T", stepI)),
@@ -155,18 +163,115 @@ func NewWithLimiter(logger *zap.Logger, config types.BackendV2, tldCacheDisabled
 		}
 	}
 
-	httpQuery := helper.NewHttpQuery(config.GroupName, config.Servers, *config.MaxTries, limiter, httpClient, httpHeaders.ContentTypeCarbonAPIv2PB)
+	remoteRead := false
+	if rrI, ok := config.BackendOptions["remote_read"]; ok {
+		remoteRead, ok = rrI.(bool)
+		if !ok {
+			logger.Fatal("failed to parse remote_read",
+				zap.String("type_parsed", fmt.Sprintf("%T", rrI)),
+				zap.String("type_expected", "bool"),
+			)
+		}
+	}
+
+	remoteReadPath := defaultRemoteReadPath
+	if pathI, ok := config.BackendOptions["remote_read_path"]; ok {
+		remoteReadPath, ok = pathI.(string)
+		if !ok {
+			logger.Fatal("failed to parse remote_read_path",
+				zap.String("type_parsed", fmt.Sprintf("%T", pathI)),
+				zap.String("type_expected", "string"),
+			)
+		}
+	}
+
+	remoteReadConsolidation := "average"
+	if consolidationI, ok := config.BackendOptions["remote_read_consolidation"]; ok {
+		consolidation, ok := consolidationI.(string)
+		if !ok {
+			logger.Fatal("failed to parse remote_read_consolidation",
+				zap.String("type_parsed", fmt.Sprintf("%T", consolidationI)),
+				zap.String("type_expected", "string"),
+			)
+		}
+		remoteReadConsolidation, ok = remoteReadConsolidations[consolidation]
+		if !ok {
+			logger.Fatal("unsupported remote_read_consolidation",
+				zap.String("option_value", consolidation),
+			)
+		}
+	}
+
+	var labelPaths []string
+	if lpI, ok := config.BackendOptions["label_paths"]; ok {
+		lp, ok := lpI.([]interface{})
+		if !ok {
+			logger.Fatal("failed to parse label_paths",
+				zap.String("type_parsed", fmt.Sprintf("%T", lpI)),
+				zap.String("type_expected", "[]string"),
+			)
+		}
+		for _, l := range lp {
+			label, ok := l.(string)
+			if !ok || label == "" {
+				logger.Fatal("failed to parse label_paths",
+					zap.String("type_parsed", fmt.Sprintf("%T", l)),
+					zap.String("type_expected", "string"),
+				)
+			}
+			labelPaths = append(labelPaths, label)
+		}
+	}
+
+	durationOption := func(name string, defaultValue time.Duration) time.Duration {
+		vI, ok := config.BackendOptions[name]
+		if !ok {
+			return defaultValue
+		}
+		v, ok := vI.(string)
+		if !ok {
+			logger.Fatal("failed to parse "+name,
+				zap.String("type_parsed", fmt.Sprintf("%T", vI)),
+				zap.String("type_expected", "string"),
+			)
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			logger.Fatal("failed to parse option",
+				zap.String("option_name", name),
+				zap.String("option_value", v),
+				zap.Error(err),
+			)
+		}
+		return d
+	}
+
+	// Prometheus keeps data for 15 days by default
+	retention := int64(durationOption("retention", 15*24*time.Hour).Seconds())
+	indexTTL := int32(durationOption("label_cache_ttl", time.Minute).Seconds())
+
+	index := expirecache.New(0)
+	go index.ApproximateCleaner(10 * time.Second)
+
+	httpQuery := helper.NewHttpQueryWithBalancer(config.GroupName, config.Servers, *config.MaxTries, limiter, httpClient, httpHeaders.ContentTypeCarbonAPIv2PB, helper.NewBalancer(config.GroupName, config.LBMethod, config.Servers), config.Hedging)
 
 	c := &PrometheusGroup{
-		groupName:            config.GroupName,
-		servers:              config.Servers,
-		protocol:             config.Protocol,
-		timeout:              *config.Timeouts,
-		maxTries:             *config.MaxTries,
-		maxMetricsPerRequest: *config.MaxBatchSize,
-		step:                 step,
-		maxPointsPerQuery:    maxPointsPerQuery,
-		startDelay:           startDelay,
+		groupName:               config.GroupName,
+		servers:                 config.Servers,
+		protocol:                config.Protocol,
+		timeout:                 *config.Timeouts,
+		maxTries:                *config.MaxTries,
+		maxMetricsPerRequest:    *config.MaxBatchSize,
+		step:                    step,
+		maxPointsPerQuery:       maxPointsPerQuery,
+		startDelay:              startDelay,
+		remoteRead:              remoteRead,
+		remoteReadPath:          remoteReadPath,
+		remoteReadConsolidation: remoteReadConsolidation,
+		labelPaths:              labelPaths,
+		retention:               retention,
+		index:                   index,
+		indexTTL:                indexTTL,
 
 		client:  httpClient,
 		limiter: limiter,
@@ -206,6 +311,10 @@ func (c PrometheusGroup) Backends() []string {
 }
 
 func (c *PrometheusGroup) Fetch(ctx context.Context, request *protov3.MultiFetchRequest) (*protov3.MultiFetchResponse, *types.Stats, merry.Error) {
+	if c.remoteRead {
+		return c.fetchRemoteRead(ctx, request)
+	}
+
 	logger := c.logger.With(zap.String("type", "fetch"), zap.String("request", request.String()))
 	stats := &types.Stats{}
 	rewrite, _ := url.Parse("http://127.0.0.1/api/v1/query_range")
@@ -225,112 +334,119 @@ func (c *PrometheusGroup) Fetch(ctx context.Context, request *protov3.MultiFetch
 	step := adjustStep(start, stop, c.maxPointsPerQuery, c.step)
 
 	stepStr := strconv.FormatInt(step, 10)
+	queries := make([]promQuery, 0, len(request.Metrics))
 	for pathExpr, targets := range pathExprToTargets {
 		for _, target := range targets {
 			logger.Debug("got some target to query",
 				zap.Any("pathExpr", pathExpr),
 				zap.Any("target", target),
 			)
-			// rewrite metric for tag
-			// Make local copy
-			stepLocalStr := stepStr
-			if strings.HasPrefix(target, "seriesByTag") {
-				stepLocalStr, target = c.seriesByTagToPromQL(stepLocalStr, target)
-			} else {
-				reQuery := convertGraphiteTargetToPromQL(target)
-				target = fmt.Sprintf("{__name__=~%q}", reQuery)
-			}
-			if stepLocalStr[len(stepLocalStr)-1] >= '0' && stepLocalStr[len(stepLocalStr)-1] <= '9' {
-				stepLocalStr += "s"
-			}
-			t, err := time.ParseDuration(stepLocalStr)
+			q, err := c.targetToPromQL(ctx, logger, stats, pathExpr, target, stepStr)
 			if err != nil {
 				stats.RenderErrors += 1
-				logger.Debug("failed to parse step",
-					zap.String("step", stepLocalStr),
-					zap.Error(err),
-				)
 				if e == nil {
-					e = merry.Wrap(err)
+					e = err
+				} else {
+					e = e.WithCause(err)
 				}
 				continue
 			}
-			stepLocal := int64(t.Seconds())
-			/*
-				newStep, err3 := strToStep(stepStr)
-				if err3 == nil {
-					step = newStep
-				}
-			*/
-			logger.Debug("will do query",
-				zap.String("query", target),
-				zap.Int64("start", start),
-				zap.Int64("stop", stop),
+			queries = append(queries, q...)
+		}
+	}
+
+	for _, q := range queries {
+		target := q.query
+		stepLocalStr := q.step
+		if stepLocalStr[len(stepLocalStr)-1] >= '0' && stepLocalStr[len(stepLocalStr)-1] <= '9' {
+			stepLocalStr += "s"
+		}
+		t, err := time.ParseDuration(stepLocalStr)
+		if err != nil {
+			stats.RenderErrors += 1
+			logger.Debug("failed to parse step",
 				zap.String("step", stepLocalStr),
+				zap.Error(err),
 			)
-			v := url.Values{
-				"query": []string{target},
-				"start": []string{strconv.Itoa(int(start))},
-				"stop":  []string{strconv.Itoa(int(stop))},
-				"step":  []string{stepLocalStr},
+			if e == nil {
+				e = merry.Wrap(err)
 			}
+			continue
+		}
+		stepLocal := int64(t.Seconds())
+		logger.Debug("will do query",
+			zap.String("query", target),
+			zap.Int64("start", start),
+			zap.Int64("stop", stop),
+			zap.String("step", stepLocalStr),
+		)
+		v := url.Values{
+			"query": []string{target},
+			"start": []string{strconv.Itoa(int(start))},
+			"stop":  []string{strconv.Itoa(int(stop))},
+			"step":  []string{stepLocalStr},
+		}
 
-			rewrite.RawQuery = v.Encode()
-			stats.RenderRequests += 1
-			res, err2 := c.httpQuery.DoQuery(ctx, logger, rewrite.RequestURI(), nil)
-			if err2 != nil {
-				stats.RenderErrors += 1
-				if merry.Is(err, types.ErrTimeoutExceeded) {
-					stats.Timeouts += 1
-					stats.RenderTimeouts += 1
-				}
-				if e == nil {
-					e = err2
-				} else {
-					e = e.WithCause(err2)
-				}
-				continue
+		rewrite.RawQuery = v.Encode()
+		stats.RenderRequests += 1
+		res, err2 := c.httpQuery.DoQuery(ctx, logger, rewrite.RequestURI(), nil)
+		res.UpdateStats(stats)
+		if err2 != nil {
+			stats.RenderErrors += 1
+			if merry.Is(err, types.ErrTimeoutExceeded) {
+				stats.Timeouts += 1
+				stats.RenderTimeouts += 1
 			}
+			if e == nil {
+				e = err2
+			} else {
+				e = e.WithCause(err2)
+			}
+			continue
+		}
 
-			var response prometheusResponse
-			err = json.Unmarshal(res.Response, &response)
-			if err != nil {
-				stats.RenderErrors += 1
-				c.logger.Debug("failed to unmarshal response",
-					zap.Error(err),
-				)
-				if e == nil {
-					e = err2
-				} else {
-					e = e.WithCause(err2)
-				}
-				continue
+		var response prometheusResponse
+		err = json.Unmarshal(res.Response, &response)
+		if err != nil {
+			stats.RenderErrors += 1
+			c.logger.Debug("failed to unmarshal response",
+				zap.Error(err),
+			)
+			if e == nil {
+				e = err2
+			} else {
+				e = e.WithCause(err2)
 			}
+			continue
+		}
 
-			if response.Status != "success" {
-				stats.RenderErrors += 1
-				if e == nil {
-					e = types.ErrFailedToFetch.WithMessage(response.Status).WithValue("query", target).WithValue("status", response.Status)
-				} else {
-					e = e.WithCause(err2).WithValue("query", target).WithValue("status", response.Status)
-				}
-				continue
+		if response.Status != "success" {
+			stats.RenderErrors += 1
+			if e == nil {
+				e = types.ErrFailedToFetch.WithMessage(response.Status).WithValue("query", target).WithValue("status", response.Status)
+			} else {
+				e = e.WithCause(err2).WithValue("query", target).WithValue("status", response.Status)
 			}
+			continue
+		}
+
+		for _, m := range response.Data.Result {
+			alignedValues := alignValues(start, stop, stepLocal, m.Values)
 
-			for _, m := range response.Data.Result {
-				alignedValues := alignValues(start, stop, stepLocal, m.Values)
-
-				r.Metrics = append(r.Metrics, protov3.FetchResponse{
-					Name:              c.promMetricToGraphite(m.Metric),
-					PathExpression:    pathExpr,
-					ConsolidationFunc: "Average",
-					StartTime:         start,
-					StopTime:          stop,
-					StepTime:          stepLocal,
-					Values:            alignedValues,
-					XFilesFactor:      0.0,
-				})
+			name := q.name
+			if name == "" {
+				name = c.promMetricToGraphite(m.Metric)
 			}
+			r.Metrics = append(r.Metrics, protov3.FetchResponse{
+				Name:              name,
+				PathExpression:    q.pathExpr,
+				ConsolidationFunc: "Average",
+				StartTime:         start,
+				StopTime:          stop,
+				StepTime:          stepLocal,
+				Values:            alignedValues,
+				XFilesFactor:      0.0,
+			})
 		}
 	}
 
@@ -347,32 +463,14 @@ func (c *PrometheusGroup) Fetch(ctx context.Context, request *protov3.MultiFetch
 func (c *PrometheusGroup) Find(ctx context.Context, request *protov3.MultiGlobRequest) (*protov3.MultiGlobResponse, *types.Stats, merry.Error) {
 	logger := c.logger.With(zap.String("type", "find"), zap.Strings("request", request.Metrics))
 	stats := &types.Stats{}
-	rewrite, _ := url.Parse("http://127.0.0.1/api/v1/series")
 
 	r := protov3.MultiGlobResponse{
-		Metrics: make([]protov3.GlobResponse, 0),
+		Metrics: make([]protov3.GlobResponse, 0, len(request.Metrics)),
 	}
 	var e merry.Error
-	uniqueMetrics := make(map[string]bool)
 	for _, query := range request.Metrics {
-		// Convert query to Prometheus-compatible regex
-		if !strings.HasSuffix(query, "*") {
-			query = query + "*"
-		}
-
-		reQuery := convertGraphiteTargetToPromQL(query)
-		matchQuery := fmt.Sprintf("{__name__=~%q}", reQuery)
-		v := url.Values{
-			"match[]": []string{matchQuery},
-		}
-
-		if c.startDelay.IsSet {
-			v.Add("start", c.startDelay.String())
-		}
-
-		rewrite.RawQuery = v.Encode()
 		stats.FindRequests += 1
-		res, err := c.httpQuery.DoQuery(ctx, logger, rewrite.RequestURI(), nil)
+		nodes, err := c.findNodes(ctx, logger, stats, query)
 		if err != nil {
 			stats.FindErrors += 1
 			if merry.Is(err, types.ErrTimeoutExceeded) {
@@ -387,60 +485,17 @@ func (c *PrometheusGroup) Find(ctx context.Context, request *protov3.MultiGlobRe
 			continue
 		}
 
-		var pr prometheusFindResponse
-
-		err2 := json.Unmarshal(res.Response, &pr)
-		if err2 != nil {
-			stats.FindErrors += 1
-			if e == nil {
-				e = err
-			} else {
-				e = e.WithCause(err)
-			}
-			continue
-		}
-
-		if pr.Status != "success" {
-			stats.FindErrors += 1
-			if e == nil {
-				e = types.ErrFailedToFetch.WithMessage(pr.Error).WithValue("query", matchQuery).WithValue("error_type", pr.ErrorType).WithValue("error", pr.Error)
-			} else {
-				e = e.WithCause(err2).WithValue("query", matchQuery).WithValue("error_type", pr.ErrorType).WithValue("error", pr.Error)
-			}
-			continue
-		}
-
-		querySplit := strings.Split(query, ".")
 		resp := protov3.GlobResponse{
 			Name:    query,
-			Matches: make([]protov3.GlobMatch, 0),
+			Matches: make([]protov3.GlobMatch, 0, len(nodes)),
 		}
-		for _, m := range pr.Data {
-			name, ok := m["__name__"]
-			if !ok {
-				continue
-			}
-			nameSplit := strings.Split(name, ".")
-
-			if len(querySplit) > len(nameSplit) {
-				continue
-			}
-
-			isLeaf := false
-			if len(nameSplit) == len(querySplit) {
-				isLeaf = true
-			}
-
-			uniqueMetrics[strings.Join(nameSplit[:len(querySplit)], ".")] = isLeaf
-		}
-
-		for k, v := range uniqueMetrics {
+		for _, n := range nodes {
 			resp.Matches = append(resp.Matches, protov3.GlobMatch{
-				IsLeaf: v,
-				Path:   k,
+				IsLeaf: n.IsLeaf,
+				Path:   n.Path,
 			})
-			r.Metrics = append(r.Metrics, resp)
 		}
+		r.Metrics = append(r.Metrics, resp)
 	}
 
 	if e != nil {
@@ -453,8 +508,33 @@ func (c *PrometheusGroup) Find(ctx context.Context, request *protov3.MultiGlobRe
 	return &r, stats, nil
 }
 
+// Info returns scrape interval as the only retention, as Prometheus doesn't downsample data
 func (c *PrometheusGroup) Info(ctx context.Context, request *protov3.MultiMetricsInfoRequest) (*protov3.ZipperInfoResponse, *types.Stats, merry.Error) {
-	return nil, nil, types.ErrNotSupportedByBackend
+	stats := &types.Stats{}
+	info := protov3.MultiMetricsInfoResponse{
+		Metrics: make([]protov3.MetricsInfoResponse, 0, len(request.Names)),
+	}
+
+	for _, name := range request.Names {
+		stats.InfoRequests += 1
+		info.Metrics = append(info.Metrics, protov3.MetricsInfoResponse{
+			Name:              name,
+			ConsolidationFunc: "average",
+			XFilesFactor:      0.0,
+			MaxRetention:      c.retention,
+			Retentions: []protov3.Retention{{
+				SecondsPerPoint: c.step,
+				NumberOfPoints:  c.retention / c.step,
+			}},
+		})
+	}
+
+	r := &protov3.ZipperInfoResponse{
+		Info: map[string]protov3.MultiMetricsInfoResponse{
+			c.Name(): info,
+		},
+	}
+	return r, stats, nil
 }
 
 func (c *PrometheusGroup) List(ctx context.Context) (*protov3.ListMetricsResponse, *types.Stats, merry.Error) {
@@ -657,27 +737,28 @@ func (c *PrometheusGroup) TagValues(ctx context.Context, query string, limit int
 	return c.doTagQuery(ctx, false, query, limit)
 }
 
+// ProbeTLDs returns first nodes of all metric names from the label index
 func (c *PrometheusGroup) ProbeTLDs(ctx context.Context) ([]string, merry.Error) {
 	logger := c.logger.With(zap.String("function", "prober"))
-	req := &protov3.MultiGlobRequest{
-		Metrics: []string{"*"},
-	}
 
-	logger.Debug("doing request",
-		zap.Strings("request", req.Metrics),
-	)
-
-	res, _, err := c.Find(ctx, req)
+	names, err := c.metricNames(ctx, logger, &types.Stats{})
 	if err != nil {
 		return nil, err
 	}
 
-	var tlds []string
-	for _, m := range res.Metrics {
-		for _, v := range m.Matches {
-			tlds = append(tlds, v.Path)
+	unique := make(map[string]struct{})
+	for _, name := range names {
+		if idx := strings.Index(name, "."); idx > 0 {
+			name = name[:idx]
 		}
+		unique[name] = struct{}{}
+	}
+
+	tlds := make([]string, 0, len(unique))
+	for tld := range unique {
+		tlds = append(tlds, tld)
 	}
+	sort.Strings(tlds)
 
 	logger.Debug("will return data",
 		zap.Strings("tlds", tlds),
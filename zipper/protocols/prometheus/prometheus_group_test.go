@@ -0,0 +1,253 @@
+package prometheus
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+)
+
+// stubSeries are series that are known to the stub server
+var stubSeries = []struct {
+	name string
+	json string
+}{
+	{"up", `{"__name__":"up","job":"node","instance":"10.0.0.1:9100"}`},
+	{"up", `{"__name__":"up","job":"node","instance":"10.0.0.2:9100"}`},
+	{"up", `{"__name__":"up","job":"prometheus","instance":"localhost:9090"}`},
+	{"up", `{"__name__":"up","instance":"orphan"}`},
+	{"node.memory", `{"__name__":"node.memory","job":"node","instance":"10.0.0.1:9100"}`},
+}
+
+// newPrometheusStub returns server that answers label index requests, requests are counted by path, matchers of
+// series and range queries are recorded
+func newPrometheusStub(requests map[string]int, queries *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path]++
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/v1/label/__name__/values":
+			_, _ = w.Write([]byte(`{"status":"success","data":["up","node.cpu.seconds","node.memory","http.requests"]}`))
+		case "/api/v1/series":
+			match := r.URL.Query().Get("match[]")
+			*queries = append(*queries, match)
+			var re *regexp.Regexp
+			if strings.HasPrefix(match, "{__name__=~") {
+				expr, err := strconv.Unquote(match[len("{__name__=~") : len(match)-1])
+				if err == nil {
+					re, err = regexp.Compile("^(?:" + expr + ")$")
+				}
+				if err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+			}
+			var data []string
+			for _, s := range stubSeries {
+				if re != nil && re.MatchString(s.name) {
+					data = append(data, s.json)
+				}
+			}
+			_, _ = w.Write([]byte(`{"status":"success","data":[` + strings.Join(data, ",") + `]}`))
+		case "/api/v1/query_range":
+			*queries = append(*queries, r.URL.Query().Get("query"))
+			_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[` +
+				`{"metric":{"__name__":"up","job":"node","instance":"10.0.0.1:9100"},"values":[[60,"1"],[120,"1"]]}]}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func matchesOf(t *testing.T, c *PrometheusGroup, query string) []protov3.GlobMatch {
+	res, _, err := c.Find(context.Background(), &protov3.MultiGlobRequest{Metrics: []string{query}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(res.Metrics) != 1 {
+		t.Fatalf("got %v responses, want 1", len(res.Metrics))
+	}
+	return res.Metrics[0].Matches
+}
+
+func TestFind(t *testing.T) {
+	requests := make(map[string]int)
+	var queries []string
+	srv := newPrometheusStub(requests, &queries)
+	defer srv.Close()
+
+	c := newTestGroup(t, srv.URL, nil)
+
+	tests := []struct {
+		query string
+		want  []protov3.GlobMatch
+	}{
+		{"*", []protov3.GlobMatch{{Path: "http"}, {Path: "node"}, {Path: "up", IsLeaf: true}}},
+		{"node.*", []protov3.GlobMatch{{Path: "node.cpu"}, {Path: "node.memory", IsLeaf: true}}},
+		{"node.{cpu,memory}.*", []protov3.GlobMatch{{Path: "node.cpu.seconds", IsLeaf: true}}},
+		{"up.*", []protov3.GlobMatch{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got := matchesOf(t, c, tt.query)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if n := requests["/api/v1/label/__name__/values"]; n != 1 {
+		t.Errorf("label index was requested %v times, want 1", n)
+	}
+}
+
+func TestFindLabelPaths(t *testing.T) {
+	requests := make(map[string]int)
+	var queries []string
+	srv := newPrometheusStub(requests, &queries)
+	defer srv.Close()
+
+	c := newTestGroup(t, srv.URL, map[string]interface{}{
+		"label_paths": []interface{}{"job", "instance"},
+	})
+
+	tests := []struct {
+		query string
+		want  []protov3.GlobMatch
+	}{
+		{"up", []protov3.GlobMatch{{Path: "up"}}},
+		{"up.*", []protov3.GlobMatch{{Path: "up.node"}, {Path: "up.prometheus"}}},
+		{"up.node.*", []protov3.GlobMatch{
+			{Path: "up.node.10_0_0_1:9100", IsLeaf: true},
+			{Path: "up.node.10_0_0_2:9100", IsLeaf: true},
+		}},
+		{"up.*.localhost*", []protov3.GlobMatch{{Path: "up.prometheus.localhost:9090", IsLeaf: true}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got := matchesOf(t, c, tt.query)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if n := requests["/api/v1/series"]; n != 1 {
+		t.Errorf("series of the metric were requested %v times, want 1", n)
+	}
+
+	queries = nil
+	res, _, err := c.Fetch(context.Background(), &protov3.MultiFetchRequest{
+		Metrics: []protov3.FetchRequest{{Name: "up.node.10_0_0_1:9100", PathExpression: "up.node.*", StartTime: 60, StopTime: 180}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{`{__name__="up", instance="10.0.0.1:9100", job="node"}`}; !reflect.DeepEqual(queries, want) {
+		t.Errorf("got queries %v, want %v", queries, want)
+	}
+	if len(res.Metrics) != 1 || res.Metrics[0].Name != "up.node.10_0_0_1:9100" || res.Metrics[0].PathExpression != "up.node.*" {
+		t.Errorf("unexpected response: %+v", res.Metrics)
+	}
+}
+
+func TestFindLabelPathsBatch(t *testing.T) {
+	requests := make(map[string]int)
+	var queries []string
+	srv := newPrometheusStub(requests, &queries)
+	defer srv.Close()
+
+	c := newTestGroup(t, srv.URL, map[string]interface{}{
+		"label_paths": []interface{}{"job", "instance"},
+	})
+
+	want := []protov3.GlobMatch{
+		{Path: "node.cpu.seconds"},
+		{Path: "node.memory.node"},
+		{Path: "up.node.10_0_0_1:9100", IsLeaf: true},
+		{Path: "up.node.10_0_0_2:9100", IsLeaf: true},
+		{Path: "up.prometheus.localhost:9090", IsLeaf: true},
+	}
+	if got := matchesOf(t, c, "*.*.*"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if want := []string{`{__name__=~"up|node\\.memory|http\\.requests"}`}; !reflect.DeepEqual(queries, want) {
+		t.Errorf("got series queries %v, want %v", queries, want)
+	}
+
+	// series of all metrics are cached now
+	if got := matchesOf(t, c, "node.memory.*"); !reflect.DeepEqual(got, []protov3.GlobMatch{{Path: "node.memory.node"}}) {
+		t.Errorf("unexpected matches: %+v", got)
+	}
+	if n := requests["/api/v1/series"]; n != 1 {
+		t.Errorf("series were requested %v times, want 1", n)
+	}
+}
+
+func TestParseStep(t *testing.T) {
+	tests := []struct {
+		step string
+		want int64
+		err  bool
+	}{
+		{step: "60", want: 60},
+		{step: "1m", want: 60},
+		{step: "1s", want: 1},
+		{step: "500ms", err: true},
+		{step: "0", err: true},
+		{step: "", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.step, func(t *testing.T) {
+			got, err := parseStep(tt.step)
+			if (err != nil) != tt.err || got != tt.want {
+				t.Errorf("got %v, %v, want %v, error %v", got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestProbeTLDs(t *testing.T) {
+	requests := make(map[string]int)
+	var queries []string
+	srv := newPrometheusStub(requests, &queries)
+	defer srv.Close()
+
+	c := newTestGroup(t, srv.URL, nil)
+
+	tlds, err := c.ProbeTLDs(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"http", "node", "up"}; !reflect.DeepEqual(tlds, want) {
+		t.Errorf("got %v, want %v", tlds, want)
+	}
+}
+
+func TestInfo(t *testing.T) {
+	c := newTestGroup(t, "http://127.0.0.1:0", map[string]interface{}{"step": "30", "retention": "24h"})
+
+	res, _, err := c.Info(context.Background(), &protov3.MultiMetricsInfoRequest{Names: []string{"up"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := protov3.MetricsInfoResponse{
+		Name:              "up",
+		ConsolidationFunc: "average",
+		MaxRetention:      86400,
+		Retentions:        []protov3.Retention{{SecondsPerPoint: 30, NumberOfPoints: 2880}},
+	}
+	if got := res.Info["prometheus"].Metrics; len(got) != 1 || !reflect.DeepEqual(got[0], want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
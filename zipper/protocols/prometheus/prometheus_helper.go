@@ -2,14 +2,18 @@ package prometheus
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
+var errInvalidStep = errors.New("step must be at least 1s")
+
 type tag struct {
 	TagValue string
 	OP       string
@@ -308,3 +312,21 @@ func adjustStep(start, stop, maxPointsPerQuery, minStep int64) int64 {
 		return 86400 // 24h
 	}
 }
+
+// parseStep parses step in seconds or as a duration, it can't be less than a second as all timestamps are in seconds
+func parseStep(step string) (int64, error) {
+	if step == "" {
+		return 0, errInvalidStep
+	}
+	if step[len(step)-1] >= '0' && step[len(step)-1] <= '9' {
+		step += "s"
+	}
+	t, err := time.ParseDuration(step)
+	if err != nil {
+		return 0, err
+	}
+	if t < time.Second {
+		return 0, errInvalidStep
+	}
+	return int64(t.Seconds()), nil
+}
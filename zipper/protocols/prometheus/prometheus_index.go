@@ -0,0 +1,334 @@
+package prometheus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ansel1/merry"
+	"github.com/go-graphite/carbonapi/zipper/types"
+
+	"go.uber.org/zap"
+)
+
+const metricNamesKey = "__name__"
+
+// treeNode is a single result of find request. For leafs Name and Labels contain metric name and values of
+// label_paths labels, that are required to build selector for the series.
+type treeNode struct {
+	Path   string
+	IsLeaf bool
+	Name   string
+	Labels map[string]string
+}
+
+// promQuery is a single PromQL query that is required to fetch a target
+type promQuery struct {
+	pathExpr string
+	query    string
+	step     string
+	// name overrides name of the series, used when series are addressed by label paths
+	name string
+}
+
+// nodeMatcher matches single node of graphite path against single node of the glob
+type nodeMatcher struct {
+	value string
+	re    *regexp.Regexp
+}
+
+func newNodeMatcher(node string) (nodeMatcher, error) {
+	if !strings.ContainsAny(node, "*[{") {
+		return nodeMatcher{value: node}, nil
+	}
+	re, err := regexp.Compile("^" + convertGraphiteTargetToPromQL(node) + "$")
+	if err != nil {
+		return nodeMatcher{}, err
+	}
+	return nodeMatcher{re: re}, nil
+}
+
+func (m nodeMatcher) match(node string) bool {
+	if m.re == nil {
+		return m.value == node
+	}
+	return m.re.MatchString(node)
+}
+
+// labelPathNode converts label value to a node of graphite path, dots are not allowed inside nodes
+func labelPathNode(value string) string {
+	return strings.Replace(value, ".", "_", -1)
+}
+
+// metricNames returns all values of __name__, cached for label_cache_ttl
+func (c *PrometheusGroup) metricNames(ctx context.Context, logger *zap.Logger, stats *types.Stats) ([]string, merry.Error) {
+	if v, ok := c.index.Get(metricNamesKey); ok {
+		return v.([]string), nil
+	}
+
+	rewrite, _ := url.Parse("http://127.0.0.1/api/v1/label/__name__/values")
+	if c.startDelay.IsSet {
+		v := url.Values{
+			"start": []string{c.startDelay.String()},
+		}
+		rewrite.RawQuery = v.Encode()
+	}
+
+	res, err := c.httpQuery.DoQuery(ctx, logger, rewrite.RequestURI(), nil)
+	res.UpdateStats(stats)
+	if err != nil {
+		return nil, err
+	}
+
+	var r prometheusTagResponse
+	if err := json.Unmarshal(res.Response, &r); err != nil {
+		return nil, merry.Wrap(err)
+	}
+	if r.Status != "success" {
+		return nil, types.ErrFailedToFetch.WithMessage(r.Error).WithValue("error_type", r.ErrorType).WithValue("error", r.Error)
+	}
+
+	c.index.Set(metricNamesKey, r.Data, uint64(len(r.Data)), c.indexTTL)
+	return r.Data, nil
+}
+
+// seriesLabels returns label sets of all series of the metrics, cached for label_cache_ttl per metric name. Metrics
+// that aren't cached are requested by a single series query per max_batch_size names.
+func (c *PrometheusGroup) seriesLabels(ctx context.Context, logger *zap.Logger, stats *types.Stats, names []string) (map[string][]map[string]string, merry.Error) {
+	res := make(map[string][]map[string]string, len(names))
+	missing := make([]string, 0, len(names))
+	for _, name := range names {
+		if v, ok := c.index.Get("series:" + name); ok {
+			res[name] = v.([]map[string]string)
+		} else {
+			missing = append(missing, name)
+		}
+	}
+
+	batchSize := c.maxMetricsPerRequest
+	if batchSize <= 0 {
+		batchSize = len(missing)
+	}
+	for len(missing) > 0 {
+		batch := missing
+		if len(batch) > batchSize {
+			batch = batch[:batchSize]
+		}
+		missing = missing[len(batch):]
+
+		quoted := make([]string, len(batch))
+		for i, name := range batch {
+			quoted[i] = regexp.QuoteMeta(name)
+		}
+		rewrite, _ := url.Parse("http://127.0.0.1/api/v1/series")
+		v := url.Values{
+			"match[]": []string{fmt.Sprintf("{__name__=~%q}", strings.Join(quoted, "|"))},
+		}
+		if c.startDelay.IsSet {
+			v.Add("start", c.startDelay.String())
+		}
+		rewrite.RawQuery = v.Encode()
+
+		resp, err := c.httpQuery.DoQuery(ctx, logger, rewrite.RequestURI(), nil)
+		resp.UpdateStats(stats)
+		if err != nil {
+			return nil, err
+		}
+
+		var r prometheusFindResponse
+		if err := json.Unmarshal(resp.Response, &r); err != nil {
+			return nil, merry.Wrap(err)
+		}
+		if r.Status != "success" {
+			return nil, types.ErrFailedToFetch.WithMessage(r.Error).WithValue("error_type", r.ErrorType).WithValue("error", r.Error)
+		}
+
+		series := make(map[string][]map[string]string, len(batch))
+		for _, name := range batch {
+			series[name] = nil
+		}
+		for _, labels := range r.Data {
+			name := labels[metricNamesKey]
+			if _, ok := series[name]; ok {
+				series[name] = append(series[name], labels)
+			}
+		}
+		for name, labels := range series {
+			c.index.Set("series:"+name, labels, uint64(len(labels)), c.indexTTL)
+			res[name] = labels
+		}
+	}
+
+	return res, nil
+}
+
+// findNodes navigates tree that is built from metric names split by dots. If label_paths are configured, metric names
+// become branches and values of the labels are used as next levels of the tree.
+func (c *PrometheusGroup) findNodes(ctx context.Context, logger *zap.Logger, stats *types.Stats, query string) ([]treeNode, merry.Error) {
+	parts := strings.Split(query, ".")
+	matchers := make([]nodeMatcher, len(parts))
+	for i, p := range parts {
+		m, err := newNodeMatcher(p)
+		if err != nil {
+			return nil, merry.Wrap(err).WithValue("query", query)
+		}
+		matchers[i] = m
+	}
+
+	names, e := c.metricNames(ctx, logger, stats)
+	if e != nil {
+		return nil, e
+	}
+
+	type nodeKey struct {
+		path   string
+		isLeaf bool
+	}
+	found := make(map[nodeKey]treeNode)
+	add := func(n treeNode) {
+		k := nodeKey{n.Path, n.IsLeaf}
+		if _, ok := found[k]; !ok {
+			found[k] = n
+		}
+	}
+
+	// metrics which label values are next levels of the tree, their series are requested all at once
+	var labelNames []string
+NAMES:
+	for _, name := range names {
+		nameParts := strings.Split(name, ".")
+		depth := len(nameParts)
+		if depth > len(parts) {
+			depth = len(parts)
+		}
+		for i := 0; i < depth; i++ {
+			if !matchers[i].match(nameParts[i]) {
+				continue NAMES
+			}
+		}
+
+		switch {
+		case len(nameParts) > len(parts):
+			add(treeNode{Path: strings.Join(nameParts[:len(parts)], ".")})
+		case len(nameParts) == len(parts):
+			if len(c.labelPaths) == 0 {
+				add(treeNode{Path: name, IsLeaf: true, Name: name})
+			} else {
+				add(treeNode{Path: name})
+			}
+		case len(nameParts)+len(c.labelPaths) >= len(parts):
+			labelNames = append(labelNames, name)
+		}
+	}
+
+	if len(labelNames) > 0 {
+		series, e := c.seriesLabels(ctx, logger, stats, labelNames)
+		if e != nil {
+			return nil, e
+		}
+
+		for _, name := range labelNames {
+			nameParts := strings.Count(name, ".") + 1
+			levels := len(parts) - nameParts
+
+		SERIES:
+			for _, s := range series[name] {
+				nodes := make([]string, 0, levels)
+				labels := make(map[string]string, levels)
+				for i := 0; i < levels; i++ {
+					value, ok := s[c.labelPaths[i]]
+					if !ok || value == "" {
+						continue SERIES
+					}
+					node := labelPathNode(value)
+					if !matchers[nameParts+i].match(node) {
+						continue SERIES
+					}
+					nodes = append(nodes, node)
+					labels[c.labelPaths[i]] = value
+				}
+
+				isLeaf := levels == len(c.labelPaths)
+				n := treeNode{
+					Path:   name + "." + strings.Join(nodes, "."),
+					IsLeaf: isLeaf,
+				}
+				if isLeaf {
+					n.Name = name
+					n.Labels = labels
+				}
+				add(n)
+			}
+		}
+	}
+
+	res := make([]treeNode, 0, len(found))
+	for _, n := range found {
+		res = append(res, n)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Path == res[j].Path {
+			return !res[i].IsLeaf
+		}
+		return res[i].Path < res[j].Path
+	})
+	return res, nil
+}
+
+// selector returns PromQL selector for the leaf
+func (n *treeNode) selector() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("{__name__=%q", n.Name))
+
+	keys := make([]string, 0, len(n.Labels))
+	for k := range n.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		sb.WriteString(fmt.Sprintf(", %s=%q", k, n.Labels[k]))
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+// matchers returns label matchers for the leaf that are used by remote read
+func (n *treeNode) matchers() []labelMatcher {
+	res := make([]labelMatcher, 0, len(n.Labels)+1)
+	res = append(res, labelMatcher{Type: matchEqual, Name: "__name__", Value: n.Name})
+	for k, v := range n.Labels {
+		res = append(res, labelMatcher{Type: matchEqual, Name: k, Value: v})
+	}
+	return res
+}
+
+// targetToPromQL converts graphite target to the list of PromQL queries. Targets that address series by label paths
+// are resolved through the label index, as it's not possible to tell which node is a label from the target itself.
+func (c *PrometheusGroup) targetToPromQL(ctx context.Context, logger *zap.Logger, stats *types.Stats, pathExpr, target, step string) ([]promQuery, merry.Error) {
+	if strings.HasPrefix(target, "seriesByTag") {
+		step, query := c.seriesByTagToPromQL(step, target)
+		return []promQuery{{pathExpr: pathExpr, query: query, step: step}}, nil
+	}
+
+	if len(c.labelPaths) == 0 {
+		reQuery := convertGraphiteTargetToPromQL(target)
+		return []promQuery{{pathExpr: pathExpr, query: fmt.Sprintf("{__name__=~%q}", reQuery), step: step}}, nil
+	}
+
+	nodes, err := c.findNodes(ctx, logger, stats, target)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]promQuery, 0, len(nodes))
+	for _, n := range nodes {
+		if !n.IsLeaf {
+			continue
+		}
+		res = append(res, promQuery{pathExpr: pathExpr, query: n.selector(), step: step, name: n.Path})
+	}
+	return res, nil
+}
@@ -0,0 +1,475 @@
+package prometheus
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"math"
+	"strings"
+
+	"github.com/ansel1/merry"
+	"github.com/go-graphite/carbonapi/zipper/helper"
+	"github.com/go-graphite/carbonapi/zipper/types"
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"github.com/golang/snappy"
+	"github.com/prometheus/tsdb/chunkenc"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultRemoteReadPath = "/api/v1/read"
+
+	contentTypeStreamedProtobuf = "application/x-streamed-protobuf"
+
+	// same limit that Prometheus uses for a single frame of streamed response
+	maxRemoteReadFrameSize = 50 * 1024 * 1024
+	// non-streamed response is a single message that is kept in memory, both compressed and decoded sizes are limited
+	maxRemoteReadResponseSize = 256 * 1024 * 1024
+)
+
+var (
+	remoteReadHeaders = map[string]string{
+		"Content-Encoding":                 "snappy",
+		"Content-Type":                     "application/x-protobuf",
+		"X-Prometheus-Remote-Read-Version": "0.1.0",
+	}
+
+	castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+	errRemoteRead   = merry.New("remote read failed")
+	errInvalidChunk = merry.New("invalid XOR chunk")
+
+	// remoteReadConsolidations are functions that can be used to consolidate raw samples to the step
+	remoteReadConsolidations = map[string]string{
+		"avg":     "average",
+		"average": "average",
+		"sum":     "sum",
+		"min":     "min",
+		"max":     "max",
+		"first":   "first",
+		"last":    "last",
+	}
+)
+
+// Marshal returns snappy-compressed protobuf, that's what remote read endpoint expects. Implements types.Request
+func (r *readRequest) Marshal() ([]byte, merry.Error) {
+	return snappy.Encode(nil, r.marshal()), nil
+}
+
+func (r *readRequest) LogInfo() interface{} {
+	return r.Queries
+}
+
+// remoteReadTarget keeps information about original request for each query of remote read request
+type remoteReadTarget struct {
+	pathExpression string
+	start          int64
+	stop           int64
+	step           int64
+	// name overrides name of the series, used when series are addressed by label paths
+	name string
+}
+
+// remoteReadMatchers converts graphite target to label matchers, step is overridden if __step__ tag is passed
+func (c *PrometheusGroup) remoteReadMatchers(target string, step int64) ([]labelMatcher, int64, error) {
+	if !strings.HasPrefix(target, "seriesByTag") {
+		if !strings.ContainsAny(target, "*[{") {
+			return []labelMatcher{{Type: matchEqual, Name: "__name__", Value: target}}, step, nil
+		}
+		return []labelMatcher{{Type: matchRegexp, Name: "__name__", Value: convertGraphiteTargetToPromQL(target)}}, step, nil
+	}
+
+	tvs := c.splitTagValues(target[len("seriesByTag(") : len(target)-1])
+	matchers := make([]labelMatcher, 0, len(tvs))
+	for name, t := range tvs {
+		if name == "__step__" {
+			s, err := parseStep(t.TagValue)
+			if err != nil {
+				return nil, 0, err
+			}
+			step = s
+			continue
+		}
+		if name == "name" {
+			name = "__name__"
+		}
+
+		m := labelMatcher{Name: name, Value: t.TagValue}
+		switch t.OP {
+		case "=":
+			m.Type = matchEqual
+		case "!=":
+			m.Type = matchNotEqual
+		case "=~":
+			m.Type = matchRegexp
+		default:
+			m.Type = matchNotRegexp
+		}
+		matchers = append(matchers, m)
+	}
+
+	return matchers, step, nil
+}
+
+func labelsToMap(labels []promLabel) map[string]string {
+	m := make(map[string]string, len(labels))
+	for _, l := range labels {
+		m[l.Name] = l.Value
+	}
+	return m
+}
+
+// remoteReadSeries consolidates samples of the series to the step of the target as they are read, so raw samples
+// don't have to be kept in memory
+type remoteReadSeries struct {
+	labels        []promLabel
+	consolidation string
+	start         int64
+	step          int64
+	values        []float64
+	counts        []int
+}
+
+// newRemoteReadSeries returns series for the target, start is aligned to the step
+func newRemoteReadSeries(labels []promLabel, consolidation string, t *remoteReadTarget) *remoteReadSeries {
+	start := t.start - t.start%t.step
+	n := (t.stop-start)/t.step + 1
+	return &remoteReadSeries{
+		labels:        labels,
+		consolidation: consolidation,
+		start:         start,
+		step:          t.step,
+		values:        make([]float64, n),
+		counts:        make([]int, n),
+	}
+}
+
+// add puts sample into its bucket. NaNs, including Prometheus staleness markers, are ignored. Samples are expected to
+// be sorted by time, that's how remote read returns them.
+func (s *remoteReadSeries) add(timestampMs int64, v float64) {
+	if math.IsNaN(v) || timestampMs < s.start*1000 {
+		return
+	}
+	idx := (timestampMs/1000 - s.start) / s.step
+	if idx >= int64(len(s.values)) {
+		return
+	}
+
+	s.counts[idx]++
+	if s.counts[idx] == 1 {
+		s.values[idx] = v
+		return
+	}
+	switch s.consolidation {
+	case "average", "sum":
+		s.values[idx] += v
+	case "min":
+		s.values[idx] = math.Min(s.values[idx], v)
+	case "max":
+		s.values[idx] = math.Max(s.values[idx], v)
+	case "last":
+		s.values[idx] = v
+	}
+}
+
+// finish returns consolidated values, buckets without samples are NaNs
+func (s *remoteReadSeries) finish() []float64 {
+	for i := range s.values {
+		if s.counts[i] == 0 {
+			s.values[i] = math.NaN()
+		} else if s.consolidation == "average" {
+			s.values[i] /= float64(s.counts[i])
+		}
+	}
+	return s.values
+}
+
+// addChunk decodes XOR chunk and adds its samples to the series
+func (s *remoteReadSeries) addChunk(chunk promChunk) error {
+	if chunk.Type != chunkEncodingXOR {
+		return errRemoteRead.WithMessagef("unsupported chunk encoding %v", chunk.Type)
+	}
+	// chunkenc expects at least the header with number of samples
+	if len(chunk.Data) < 2 {
+		return errInvalidChunk
+	}
+	c, err := chunkenc.FromData(chunkenc.EncXOR, chunk.Data)
+	if err != nil {
+		return err
+	}
+	it := c.Iterator(nil)
+	for it.Next() {
+		s.add(it.At())
+	}
+	if it.Err() != nil {
+		return errInvalidChunk.WithCause(it.Err())
+	}
+	return nil
+}
+
+// remoteReadResult keeps series for each query of remote read request
+type remoteReadResult struct {
+	targets       []remoteReadTarget
+	consolidation string
+	series        [][]*remoteReadSeries
+}
+
+func newRemoteReadResult(targets []remoteReadTarget, consolidation string) *remoteReadResult {
+	return &remoteReadResult{
+		targets:       targets,
+		consolidation: consolidation,
+		series:        make([][]*remoteReadSeries, len(targets)),
+	}
+}
+
+// get returns series of the query with given labels. Series that is split across several frames of streamed response
+// comes in consecutive frames, so only the last series of the query is checked.
+func (r *remoteReadResult) get(queryIndex int64, labels []promLabel) (*remoteReadSeries, error) {
+	if queryIndex < 0 || queryIndex >= int64(len(r.targets)) {
+		return nil, errRemoteRead.WithMessagef("unexpected query index %v", queryIndex)
+	}
+	series := r.series[queryIndex]
+	if len(series) > 0 && sameLabels(series[len(series)-1].labels, labels) {
+		return series[len(series)-1], nil
+	}
+	s := newRemoteReadSeries(labels, r.consolidation, &r.targets[queryIndex])
+	r.series[queryIndex] = append(series, s)
+	return s, nil
+}
+
+func sameLabels(a, b []promLabel) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// readStreamedResponse decodes frames of ChunkedReadResponse as they are read from the body. Each frame is uvarint size,
+// CRC32 (castagnoli) of the data and the data itself.
+func (r *remoteReadResult) readStreamedResponse(body io.Reader) error {
+	br := bufio.NewReader(body)
+	var buf []byte
+	for {
+		size, err := binary.ReadUvarint(br)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errRemoteRead.WithMessage("failed to read frame size").WithCause(err)
+		}
+		if size > maxRemoteReadFrameSize {
+			return errRemoteRead.WithMessagef("frame size %v exceeds the limit", size)
+		}
+
+		if uint64(cap(buf)) < 4+size {
+			buf = make([]byte, 4+size)
+		}
+		buf = buf[:4+size]
+		if _, err = io.ReadFull(br, buf); err != nil {
+			return errRemoteRead.WithMessage("failed to read frame").WithCause(err)
+		}
+		data := buf[4:]
+		if crc32.Checksum(data, castagnoliTable) != binary.BigEndian.Uint32(buf) {
+			return errRemoteRead.WithMessage("frame checksum mismatch")
+		}
+
+		var frame chunkedReadResponse
+		if err = frame.unmarshal(data); err != nil {
+			return err
+		}
+		for _, cs := range frame.ChunkedSeries {
+			s, err := r.get(frame.QueryIndex, cs.Labels)
+			if err != nil {
+				return err
+			}
+			for _, chunk := range cs.Chunks {
+				if err = s.addChunk(chunk); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// readSamplesResponse decodes snappy-compressed ReadResponse. It's a single message, so it has to be read as a whole.
+func (r *remoteReadResult) readSamplesResponse(body io.Reader) error {
+	b, err := ioutil.ReadAll(io.LimitReader(body, maxRemoteReadResponseSize+1))
+	if err != nil {
+		return errRemoteRead.WithMessage("failed to read response").WithCause(err)
+	}
+	if len(b) > maxRemoteReadResponseSize {
+		return errRemoteRead.WithMessage("response size exceeds the limit")
+	}
+	// decoded length comes from the response, it's checked before decoder allocates the buffer
+	n, err := snappy.DecodedLen(b)
+	if err != nil {
+		return errRemoteRead.WithCause(err)
+	}
+	if n > maxRemoteReadResponseSize {
+		return errRemoteRead.WithMessagef("decoded response size %v exceeds the limit", n)
+	}
+	data, err := snappy.Decode(nil, b)
+	if err != nil {
+		return errRemoteRead.WithCause(err)
+	}
+
+	var resp readResponse
+	if err = resp.unmarshal(data); err != nil {
+		return err
+	}
+	if len(resp.Results) > len(r.targets) {
+		return errRemoteRead.WithMessagef("got %v results for %v queries", len(resp.Results), len(r.targets))
+	}
+
+	for i := range resp.Results {
+		for _, ts := range resp.Results[i].Timeseries {
+			s := newRemoteReadSeries(ts.Labels, r.consolidation, &r.targets[i])
+			for _, sample := range ts.Samples {
+				s.add(sample.Timestamp, sample.Value)
+			}
+			r.series[i] = append(r.series[i], s)
+		}
+	}
+	return nil
+}
+
+// remoteReadResponseReader returns reader that consolidates samples of the response as it's read
+func (c *PrometheusGroup) remoteReadResponseReader(targets []remoteReadTarget) helper.ResponseReader {
+	return func(contentType string, body io.Reader) (interface{}, error) {
+		res := newRemoteReadResult(targets, c.remoteReadConsolidation)
+		var err error
+		if strings.HasPrefix(contentType, contentTypeStreamedProtobuf) {
+			err = res.readStreamedResponse(body)
+		} else {
+			err = res.readSamplesResponse(body)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return res, nil
+	}
+}
+
+func (c *PrometheusGroup) fetchRemoteRead(ctx context.Context, request *protov3.MultiFetchRequest) (*protov3.MultiFetchResponse, *types.Stats, merry.Error) {
+	logger := c.logger.With(zap.String("type", "fetch"), zap.String("mode", "remote_read"), zap.String("request", request.String()))
+	stats := &types.Stats{}
+
+	var r protov3.MultiFetchResponse
+	rr := &readRequest{
+		AcceptedResponseTypes: []int64{responseStreamedXORChunks, responseSamples},
+	}
+	targets := make([]remoteReadTarget, 0, len(request.Metrics))
+	addQuery := func(m protov3.FetchRequest, matchers []labelMatcher, step int64, name string) {
+		rr.Queries = append(rr.Queries, readQuery{
+			StartTimestampMs: m.StartTime * 1000,
+			EndTimestampMs:   m.StopTime * 1000,
+			Matchers:         matchers,
+			Hints: readHints{
+				StepMs:  step * 1000,
+				StartMs: m.StartTime * 1000,
+				EndMs:   m.StopTime * 1000,
+			},
+		})
+		targets = append(targets, remoteReadTarget{
+			pathExpression: m.PathExpression,
+			start:          m.StartTime,
+			stop:           m.StopTime,
+			step:           step,
+			name:           name,
+		})
+	}
+
+	for _, m := range request.Metrics {
+		step := adjustStep(m.StartTime, m.StopTime, c.maxPointsPerQuery, c.step)
+		if len(c.labelPaths) > 0 && !strings.HasPrefix(m.Name, "seriesByTag") {
+			nodes, err := c.findNodes(ctx, logger, stats, m.Name)
+			if err != nil {
+				stats.RenderErrors++
+				stats.FailedServers = []string{c.groupName}
+				return &r, stats, err.WithValue("target", m.Name)
+			}
+			for _, n := range nodes {
+				if n.IsLeaf {
+					addQuery(m, n.matchers(), step, n.Path)
+				}
+			}
+			continue
+		}
+
+		matchers, step, err := c.remoteReadMatchers(m.Name, step)
+		if err != nil {
+			stats.RenderErrors++
+			stats.FailedServers = []string{c.groupName}
+			return &r, stats, merry.Wrap(err).WithValue("target", m.Name)
+		}
+		addQuery(m, matchers, step, "")
+	}
+
+	if len(rr.Queries) == 0 {
+		return &r, stats, nil
+	}
+
+	stats.RenderRequests++
+	res, err := c.httpQuery.DoPostStreamQuery(ctx, logger, c.remoteReadPath, rr, remoteReadHeaders, c.remoteReadResponseReader(targets))
+	res.UpdateStats(stats)
+	if err != nil {
+		stats.RenderErrors++
+		if merry.Is(err, types.ErrTimeoutExceeded) {
+			stats.Timeouts++
+			stats.RenderTimeouts++
+		}
+		stats.FailedServers = []string{c.groupName}
+		logger.Error("errors occurred while getting results",
+			zap.Any("errors", err),
+		)
+		return &r, stats, err
+	}
+
+	result, ok := res.Data.(*remoteReadResult)
+	if !ok {
+		if len(res.Response) == 0 {
+			return &r, stats, nil
+		}
+		// errors are returned as plain text with 4xx code
+		stats.RenderErrors++
+		stats.FailedServers = []string{c.groupName}
+		e := errRemoteRead.WithMessage(strings.TrimSpace(string(res.Response)))
+		logger.Error("remote read request failed",
+			zap.Error(e),
+		)
+		return &r, stats, e
+	}
+
+	for i, t := range targets {
+		for _, s := range result.series[i] {
+			values := s.finish()
+			name := t.name
+			if name == "" {
+				name = c.promMetricToGraphite(labelsToMap(s.labels))
+			}
+			r.Metrics = append(r.Metrics, protov3.FetchResponse{
+				Name:              name,
+				PathExpression:    t.pathExpression,
+				ConsolidationFunc: c.remoteReadConsolidation,
+				StartTime:         s.start,
+				StopTime:          s.start + int64(len(values))*t.step,
+				StepTime:          t.step,
+				Values:            values,
+				XFilesFactor:      0.0,
+				RequestStartTime:  t.start,
+				RequestStopTime:   t.stop,
+			})
+		}
+	}
+
+	return &r, stats, nil
+}
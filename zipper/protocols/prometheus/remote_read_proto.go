@@ -0,0 +1,361 @@
+package prometheus
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// Minimal implementation of messages from prometheus/prompb (remote.proto and types.proto) that are required for
+// remote read. Only fields that carbonapi uses are encoded or decoded, everything else is skipped.
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// Types of label matchers, same values as prompb.LabelMatcher_Type
+const (
+	matchEqual int64 = iota
+	matchNotEqual
+	matchRegexp
+	matchNotRegexp
+)
+
+// Types of remote read response, same values as prompb.ReadRequest_ResponseType
+const (
+	responseSamples int64 = iota
+	responseStreamedXORChunks
+)
+
+const chunkEncodingXOR = 1
+
+var errInvalidProto = errors.New("invalid protobuf message")
+
+type labelMatcher struct {
+	Type  int64
+	Name  string
+	Value string
+}
+
+type readHints struct {
+	StepMs  int64
+	StartMs int64
+	EndMs   int64
+}
+
+type readQuery struct {
+	StartTimestampMs int64
+	EndTimestampMs   int64
+	Matchers         []labelMatcher
+	Hints            readHints
+}
+
+type readRequest struct {
+	Queries               []readQuery
+	AcceptedResponseTypes []int64
+}
+
+type promLabel struct {
+	Name  string
+	Value string
+}
+
+type promSample struct {
+	Value     float64
+	Timestamp int64
+}
+
+type promTimeSeries struct {
+	Labels  []promLabel
+	Samples []promSample
+}
+
+type queryResult struct {
+	Timeseries []promTimeSeries
+}
+
+type readResponse struct {
+	Results []queryResult
+}
+
+type promChunk struct {
+	MinTimeMs int64
+	MaxTimeMs int64
+	Type      int64
+	Data      []byte
+}
+
+type chunkedSeries struct {
+	Labels []promLabel
+	Chunks []promChunk
+}
+
+type chunkedReadResponse struct {
+	ChunkedSeries []chunkedSeries
+	QueryIndex    int64
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
+
+func appendTag(b []byte, field int, wireType int) []byte {
+	return appendUvarint(b, uint64(field)<<3|uint64(wireType))
+}
+
+func appendVarintField(b []byte, field int, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = appendTag(b, field, wireVarint)
+	return appendUvarint(b, uint64(v))
+}
+
+func appendBytesField(b []byte, field int, v []byte) []byte {
+	b = appendTag(b, field, wireBytes)
+	b = appendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendStringField(b []byte, field int, v string) []byte {
+	if v == "" {
+		return b
+	}
+	return appendBytesField(b, field, []byte(v))
+}
+
+func (m *labelMatcher) marshal(b []byte) []byte {
+	b = appendVarintField(b, 1, m.Type)
+	b = appendStringField(b, 2, m.Name)
+	return appendStringField(b, 3, m.Value)
+}
+
+func (h *readHints) marshal(b []byte) []byte {
+	b = appendVarintField(b, 1, h.StepMs)
+	b = appendVarintField(b, 3, h.StartMs)
+	return appendVarintField(b, 4, h.EndMs)
+}
+
+func (q *readQuery) marshal(b []byte) []byte {
+	b = appendVarintField(b, 1, q.StartTimestampMs)
+	b = appendVarintField(b, 2, q.EndTimestampMs)
+	for i := range q.Matchers {
+		b = appendBytesField(b, 3, q.Matchers[i].marshal(nil))
+	}
+	return appendBytesField(b, 4, q.Hints.marshal(nil))
+}
+
+func (r *readRequest) marshal() []byte {
+	var b []byte
+	for i := range r.Queries {
+		b = appendBytesField(b, 1, r.Queries[i].marshal(nil))
+	}
+	if len(r.AcceptedResponseTypes) > 0 {
+		var packed []byte
+		for _, t := range r.AcceptedResponseTypes {
+			packed = appendUvarint(packed, uint64(t))
+		}
+		b = appendBytesField(b, 2, packed)
+	}
+	return b
+}
+
+// protoReader iterates over fields of the message
+type protoReader struct {
+	b []byte
+
+	field    int
+	wireType int
+	varint   uint64
+	bytes    []byte
+}
+
+func (r *protoReader) next() (bool, error) {
+	if len(r.b) == 0 {
+		return false, nil
+	}
+
+	tag, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		return false, errInvalidProto
+	}
+	r.b = r.b[n:]
+	r.field = int(tag >> 3)
+	r.wireType = int(tag & 0x07)
+
+	switch r.wireType {
+	case wireVarint:
+		r.varint, n = binary.Uvarint(r.b)
+		if n <= 0 {
+			return false, errInvalidProto
+		}
+		r.b = r.b[n:]
+	case wireFixed64:
+		if len(r.b) < 8 {
+			return false, errInvalidProto
+		}
+		r.varint = binary.LittleEndian.Uint64(r.b)
+		r.b = r.b[8:]
+	case wireFixed32:
+		if len(r.b) < 4 {
+			return false, errInvalidProto
+		}
+		r.varint = uint64(binary.LittleEndian.Uint32(r.b))
+		r.b = r.b[4:]
+	case wireBytes:
+		l, n := binary.Uvarint(r.b)
+		if n <= 0 || uint64(len(r.b)-n) < l {
+			return false, errInvalidProto
+		}
+		r.bytes = r.b[n : n+int(l)]
+		r.b = r.b[n+int(l):]
+	default:
+		return false, errInvalidProto
+	}
+
+	return true, nil
+}
+
+// eachField calls f for every field of the message
+func eachField(b []byte, f func(r *protoReader) error) error {
+	r := protoReader{b: b}
+	for {
+		ok, err := r.next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+		if err = f(&r); err != nil {
+			return err
+		}
+	}
+}
+
+func (l *promLabel) unmarshal(b []byte) error {
+	return eachField(b, func(r *protoReader) error {
+		switch {
+		case r.field == 1 && r.wireType == wireBytes:
+			l.Name = string(r.bytes)
+		case r.field == 2 && r.wireType == wireBytes:
+			l.Value = string(r.bytes)
+		}
+		return nil
+	})
+}
+
+func (s *promSample) unmarshal(b []byte) error {
+	return eachField(b, func(r *protoReader) error {
+		switch {
+		case r.field == 1 && r.wireType == wireFixed64:
+			s.Value = math.Float64frombits(r.varint)
+		case r.field == 2 && r.wireType == wireVarint:
+			s.Timestamp = int64(r.varint)
+		}
+		return nil
+	})
+}
+
+func (ts *promTimeSeries) unmarshal(b []byte) error {
+	return eachField(b, func(r *protoReader) error {
+		switch {
+		case r.field == 1 && r.wireType == wireBytes:
+			var l promLabel
+			if err := l.unmarshal(r.bytes); err != nil {
+				return err
+			}
+			ts.Labels = append(ts.Labels, l)
+		case r.field == 2 && r.wireType == wireBytes:
+			var s promSample
+			if err := s.unmarshal(r.bytes); err != nil {
+				return err
+			}
+			ts.Samples = append(ts.Samples, s)
+		}
+		return nil
+	})
+}
+
+func (q *queryResult) unmarshal(b []byte) error {
+	return eachField(b, func(r *protoReader) error {
+		if r.field == 1 && r.wireType == wireBytes {
+			var ts promTimeSeries
+			if err := ts.unmarshal(r.bytes); err != nil {
+				return err
+			}
+			q.Timeseries = append(q.Timeseries, ts)
+		}
+		return nil
+	})
+}
+
+func (resp *readResponse) unmarshal(b []byte) error {
+	return eachField(b, func(r *protoReader) error {
+		if r.field == 1 && r.wireType == wireBytes {
+			var q queryResult
+			if err := q.unmarshal(r.bytes); err != nil {
+				return err
+			}
+			resp.Results = append(resp.Results, q)
+		}
+		return nil
+	})
+}
+
+func (c *promChunk) unmarshal(b []byte) error {
+	return eachField(b, func(r *protoReader) error {
+		switch {
+		case r.field == 1 && r.wireType == wireVarint:
+			c.MinTimeMs = int64(r.varint)
+		case r.field == 2 && r.wireType == wireVarint:
+			c.MaxTimeMs = int64(r.varint)
+		case r.field == 3 && r.wireType == wireVarint:
+			c.Type = int64(r.varint)
+		case r.field == 4 && r.wireType == wireBytes:
+			c.Data = r.bytes
+		}
+		return nil
+	})
+}
+
+func (s *chunkedSeries) unmarshal(b []byte) error {
+	return eachField(b, func(r *protoReader) error {
+		switch {
+		case r.field == 1 && r.wireType == wireBytes:
+			var l promLabel
+			if err := l.unmarshal(r.bytes); err != nil {
+				return err
+			}
+			s.Labels = append(s.Labels, l)
+		case r.field == 2 && r.wireType == wireBytes:
+			var c promChunk
+			if err := c.unmarshal(r.bytes); err != nil {
+				return err
+			}
+			s.Chunks = append(s.Chunks, c)
+		}
+		return nil
+	})
+}
+
+func (resp *chunkedReadResponse) unmarshal(b []byte) error {
+	return eachField(b, func(r *protoReader) error {
+		switch {
+		case r.field == 1 && r.wireType == wireBytes:
+			var s chunkedSeries
+			if err := s.unmarshal(r.bytes); err != nil {
+				return err
+			}
+			resp.ChunkedSeries = append(resp.ChunkedSeries, s)
+		case r.field == 2 && r.wireType == wireVarint:
+			resp.QueryIndex = int64(r.varint)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,333 @@
+package prometheus
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/limiter"
+	"github.com/go-graphite/carbonapi/zipper/types"
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"github.com/golang/snappy"
+	"github.com/prometheus/tsdb/chunkenc"
+	"go.uber.org/zap"
+)
+
+func encodeChunk(t *testing.T, samples []promSample) []byte {
+	c := chunkenc.NewXORChunk()
+	app, err := c.Appender()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, s := range samples {
+		app.Append(s.Timestamp, s.Value)
+	}
+	return c.Bytes()
+}
+
+func marshalLabels(b []byte, labels []promLabel) []byte {
+	for _, l := range labels {
+		var lb []byte
+		lb = appendStringField(lb, 1, l.Name)
+		lb = appendStringField(lb, 2, l.Value)
+		b = appendBytesField(b, 1, lb)
+	}
+	return b
+}
+
+// streamedFrame returns single frame of streamed response with one series in one chunk
+func streamedFrame(t *testing.T, queryIndex int64, labels []promLabel, samples []promSample) []byte {
+	var chunk []byte
+	chunk = appendVarintField(chunk, 3, chunkEncodingXOR)
+	chunk = appendBytesField(chunk, 4, encodeChunk(t, samples))
+
+	series := marshalLabels(nil, labels)
+	series = appendBytesField(series, 2, chunk)
+
+	var msg []byte
+	msg = appendBytesField(msg, 1, series)
+	msg = appendVarintField(msg, 2, queryIndex)
+
+	frame := appendUvarint(nil, uint64(len(msg)))
+	var crc [4]byte
+	binary.BigEndian.PutUint32(crc[:], crc32.Checksum(msg, castagnoliTable))
+	frame = append(frame, crc[:]...)
+	return append(frame, msg...)
+}
+
+// unmarshalReadRequest decodes request on the test server side
+func unmarshalReadRequest(t *testing.T, b []byte) readRequest {
+	var req readRequest
+	err := eachField(b, func(r *protoReader) error {
+		if r.field != 1 {
+			return nil
+		}
+		var q readQuery
+		err := eachField(r.bytes, func(r *protoReader) error {
+			switch r.field {
+			case 1:
+				q.StartTimestampMs = int64(r.varint)
+			case 2:
+				q.EndTimestampMs = int64(r.varint)
+			case 3:
+				var m labelMatcher
+				err := eachField(r.bytes, func(r *protoReader) error {
+					switch r.field {
+					case 1:
+						m.Type = int64(r.varint)
+					case 2:
+						m.Name = string(r.bytes)
+					case 3:
+						m.Value = string(r.bytes)
+					}
+					return nil
+				})
+				q.Matchers = append(q.Matchers, m)
+				return err
+			case 4:
+				return eachField(r.bytes, func(r *protoReader) error {
+					if r.field == 1 {
+						q.Hints.StepMs = int64(r.varint)
+					}
+					return nil
+				})
+			}
+			return nil
+		})
+		req.Queries = append(req.Queries, q)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to decode request: %v", err)
+	}
+	return req
+}
+
+func newTestGroup(t *testing.T, url string, options map[string]interface{}) *PrometheusGroup {
+	concurrencyLimit := 10
+	maxIdleConns := 1
+	keepAlive := time.Second
+	maxTries := 1
+	maxBatchSize := 100
+	config := types.BackendV2{
+		GroupName:           "prometheus",
+		Protocol:            "prometheus",
+		Servers:             []string{url},
+		Timeouts:            &types.Timeouts{Find: time.Second, Render: time.Second, Connect: time.Second},
+		ConcurrencyLimit:    &concurrencyLimit,
+		KeepAliveInterval:   &keepAlive,
+		MaxIdleConnsPerHost: &maxIdleConns,
+		MaxTries:            &maxTries,
+		MaxBatchSize:        &maxBatchSize,
+		BackendOptions:      options,
+	}
+
+	c, err := NewWithLimiter(zap.NewNop(), config, true, limiter.NoopLimiter{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return c.(*PrometheusGroup)
+}
+
+func TestReadStreamedResponse(t *testing.T) {
+	targets := []remoteReadTarget{{start: 0, stop: 119, step: 60}}
+	frame := streamedFrame(t, 0, []promLabel{{"__name__", "a"}}, []promSample{{Timestamp: 1000, Value: 1}})
+
+	tests := []struct {
+		name string
+		body []byte
+		err  string
+	}{
+		{
+			name: "oversized frame",
+			body: appendUvarint(nil, maxRemoteReadFrameSize+1),
+			err:  "exceeds the limit",
+		},
+		{
+			name: "truncated frame",
+			body: frame[:len(frame)-1],
+			err:  "failed to read frame",
+		},
+		{
+			name: "corrupted frame",
+			body: append(frame[:len(frame)-1:len(frame)-1], frame[len(frame)-1]^0xff),
+			err:  "checksum mismatch",
+		},
+		{
+			name: "unexpected query index",
+			body: streamedFrame(t, 1, []promLabel{{"__name__", "a"}}, []promSample{{Timestamp: 1000, Value: 1}}),
+			err:  "unexpected query index",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newRemoteReadResult(targets, "average").readStreamedResponse(bytes.NewReader(tt.body))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestReadSamplesResponseLimit(t *testing.T) {
+	// snappy block that claims to be bigger than the limit, it must be rejected before the buffer is allocated
+	body := appendUvarint(nil, maxRemoteReadResponseSize+1)
+	err := newRemoteReadResult(nil, "average").readSamplesResponse(bytes.NewReader(body))
+	if err == nil || !strings.Contains(err.Error(), "exceeds the limit") {
+		t.Errorf("got error %v, want size limit error", err)
+	}
+}
+
+func TestRemoteReadSeries(t *testing.T) {
+	samples := []promSample{
+		{Timestamp: 60000, Value: 1},
+		{Timestamp: 75000, Value: 3},
+		{Timestamp: 135000, Value: math.NaN()},
+		{Timestamp: 180000, Value: 4},
+		{Timestamp: 181000, Value: 2},
+		{Timestamp: 250000, Value: 5},
+	}
+
+	nan := math.NaN()
+	tests := []struct {
+		consolidation string
+		want          []float64
+	}{
+		{"average", []float64{2, nan, 3}},
+		{"sum", []float64{4, nan, 6}},
+		{"min", []float64{1, nan, 2}},
+		{"max", []float64{3, nan, 4}},
+		{"first", []float64{1, nan, 4}},
+		{"last", []float64{3, nan, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.consolidation, func(t *testing.T) {
+			s := newRemoteReadSeries(nil, tt.consolidation, &remoteReadTarget{start: 70, stop: 200, step: 60})
+			for _, sample := range samples {
+				s.add(sample.Timestamp, sample.Value)
+			}
+			if s.start != 60 {
+				t.Errorf("start = %v, want 60", s.start)
+			}
+			values := s.finish()
+			if len(values) != len(tt.want) {
+				t.Fatalf("got %v, want %v", values, tt.want)
+			}
+			for i := range tt.want {
+				if values[i] != tt.want[i] && !(math.IsNaN(values[i]) && math.IsNaN(tt.want[i])) {
+					t.Errorf("got %v, want %v", values, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestFetchRemoteRead(t *testing.T) {
+	var got readRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v1/read" || r.Header.Get("Content-Encoding") != "snappy" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		data, err := snappy.Decode(nil, body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		got = unmarshalReadRequest(t, data)
+
+		w.Header().Set("Content-Type", "application/x-streamed-protobuf; proto=prometheus.ChunkedReadResponse")
+		labels := []promLabel{{"__name__", "cpu"}, {"host", "a"}}
+		_, _ = w.Write(streamedFrame(t, 0, labels, []promSample{{Timestamp: 60000, Value: 1}, {Timestamp: 90000, Value: 3}}))
+		_, _ = w.Write(streamedFrame(t, 0, labels, []promSample{{Timestamp: 120000, Value: 5}}))
+		_, _ = w.Write(streamedFrame(t, 1, []promLabel{{"__name__", "mem"}}, []promSample{{Timestamp: 60000, Value: 7}}))
+	}))
+	defer srv.Close()
+
+	c := newTestGroup(t, srv.URL, map[string]interface{}{"remote_read": true, "step": "60"})
+
+	target := "seriesByTag('name=cpu', 'host=~a|b')"
+	res, _, err := c.Fetch(context.Background(), &protov3.MultiFetchRequest{
+		Metrics: []protov3.FetchRequest{
+			{Name: target, PathExpression: target, StartTime: 60, StopTime: 179},
+			{Name: "mem", PathExpression: "mem", StartTime: 60, StopTime: 179},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(got.Queries) != 2 {
+		t.Fatalf("got %v queries, want 2", len(got.Queries))
+	}
+	matchers := got.Queries[0].Matchers
+	sort.Slice(matchers, func(i, j int) bool { return matchers[i].Name < matchers[j].Name })
+	wantMatchers := []labelMatcher{{matchEqual, "__name__", "cpu"}, {matchRegexp, "host", "a|b"}}
+	if !reflect.DeepEqual(matchers, wantMatchers) {
+		t.Errorf("got matchers %v, want %v", matchers, wantMatchers)
+	}
+	if q := got.Queries[0]; q.StartTimestampMs != 60000 || q.EndTimestampMs != 179000 || q.Hints.StepMs != 60000 {
+		t.Errorf("unexpected query: %+v", q)
+	}
+
+	if len(res.Metrics) != 2 {
+		t.Fatalf("got %v series, want 2", len(res.Metrics))
+	}
+	m := res.Metrics[0]
+	if m.Name != "cpu;host=a" || m.PathExpression != target || m.StartTime != 60 || m.StepTime != 60 {
+		t.Errorf("unexpected series: %+v", m)
+	}
+	if !reflect.DeepEqual(m.Values, []float64{2, 5}) {
+		t.Errorf("got values %v, want %v", m.Values, []float64{2, 5})
+	}
+	if m := res.Metrics[1]; m.Name != "mem" || m.Values[0] != 7 || !math.IsNaN(m.Values[1]) {
+		t.Errorf("unexpected series: %+v", m)
+	}
+}
+
+func TestFetchRemoteReadSamples(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var sample []byte
+		sample = appendTag(sample, 1, wireFixed64)
+		var v [8]byte
+		binary.LittleEndian.PutUint64(v[:], math.Float64bits(42))
+		sample = append(sample, v[:]...)
+		sample = appendVarintField(sample, 2, 60000)
+
+		series := marshalLabels(nil, []promLabel{{"__name__", "a.b"}})
+		series = appendBytesField(series, 2, sample)
+
+		var resp []byte
+		resp = appendBytesField(resp, 1, appendBytesField(nil, 1, series))
+
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		_, _ = w.Write(snappy.Encode(nil, resp))
+	}))
+	defer srv.Close()
+
+	c := newTestGroup(t, srv.URL, map[string]interface{}{"remote_read": true, "step": "60", "remote_read_consolidation": "max"})
+
+	res, _, err := c.Fetch(context.Background(), &protov3.MultiFetchRequest{
+		Metrics: []protov3.FetchRequest{{Name: "a.*", PathExpression: "a.*", StartTime: 60, StopTime: 119}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(res.Metrics) != 1 || res.Metrics[0].Name != "a.b" || res.Metrics[0].ConsolidationFunc != "max" || !reflect.DeepEqual(res.Metrics[0].Values, []float64{42}) {
+		t.Errorf("unexpected response: %+v", res.Metrics)
+	}
+}
@@ -71,7 +71,7 @@ func NewWithLimiter(logger *zap.Logger, config types.BackendV2, tldCacheDisabled
 	}
 
 	httpLimiter := limiter.NewServerLimiter(config.Servers, *config.ConcurrencyLimit)
-	httpQuery := helper.NewHttpQuery(config.GroupName, config.Servers, *config.MaxTries, httpLimiter, httpClient, httpHeaders.ContentTypeCarbonAPIv2PB)
+	httpQuery := helper.NewHttpQueryWithBalancer(config.GroupName, config.Servers, *config.MaxTries, httpLimiter, httpClient, httpHeaders.ContentTypeCarbonAPIv2PB, helper.NewBalancer(config.GroupName, config.LBMethod, config.Servers), config.Hedging)
 
 	c := &ClientProtoV2Group{
 		groupName:            config.GroupName,
@@ -147,6 +147,7 @@ func (c *ClientProtoV2Group) Fetch(ctx context.Context, request *protov3.MultiFe
 		rewrite.RawQuery = v.Encode()
 		stats.RenderRequests += 1
 		res, err := c.httpQuery.DoQuery(ctx, logger, rewrite.RequestURI(), nil)
+		res.UpdateStats(stats)
 		if err != nil {
 			stats.RenderErrors += 1
 			if merry.Is(err, types.ErrTimeoutExceeded) {
@@ -222,6 +223,7 @@ func (c *ClientProtoV2Group) Find(ctx context.Context, request *protov3.MultiGlo
 		rewrite.RawQuery = v.Encode()
 		stats.FindRequests += 1
 		res, err := c.httpQuery.DoQuery(ctx, logger, rewrite.RequestURI(), nil)
+		res.UpdateStats(stats)
 		if err != nil {
 			stats.FindErrors += 1
 			if merry.Is(err, types.ErrTimeoutExceeded) {
@@ -293,6 +295,7 @@ func (c *ClientProtoV2Group) Info(ctx context.Context, request *protov3.MultiMet
 		rewrite.RawQuery = v.Encode()
 		stats.InfoRequests += 1
 		res, err := c.httpQuery.DoQuery(ctx, logger, rewrite.RequestURI(), nil)
+		res.UpdateStats(stats)
 		if err != nil {
 			stats.InfoErrors += 1
 			if merry.Is(err, types.ErrTimeoutExceeded) {
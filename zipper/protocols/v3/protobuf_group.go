@@ -78,7 +78,7 @@ func NewWithLimiter(logger *zap.Logger, config types.BackendV2, tldCacheDisabled
 
 	logger = logger.With(zap.String("type", "protoV3Group"), zap.String("name", config.GroupName))
 
-	httpQuery := helper.NewHttpQuery(config.GroupName, config.Servers, *config.MaxTries, limiter, httpClient, httpHeaders.ContentTypeCarbonAPIv3PB)
+	httpQuery := helper.NewHttpQueryWithBalancer(config.GroupName, config.Servers, *config.MaxTries, limiter, httpClient, httpHeaders.ContentTypeCarbonAPIv3PB, helper.NewBalancer(config.GroupName, config.LBMethod, config.Servers), config.Hedging)
 
 	c := &ClientProtoV3Group{
 		groupName:            config.GroupName,
@@ -121,6 +121,7 @@ func (c *ClientProtoV3Group) Fetch(ctx context.Context, request *protov3.MultiFe
 	rewrite.RawQuery = v.Encode()
 
 	res, err := c.httpQuery.DoQuery(ctx, logger, rewrite.RequestURI(), types.MultiFetchRequestV3{*request})
+	res.UpdateStats(stats)
 	if err != nil {
 		stats.RenderErrors = 1
 		if merry.Is(err, types.ErrTimeoutExceeded) {
@@ -158,6 +159,7 @@ func (c *ClientProtoV3Group) Find(ctx context.Context, request *protov3.MultiGlo
 	rewrite.RawQuery = v.Encode()
 
 	res, err := c.httpQuery.DoQuery(ctx, logger, rewrite.RequestURI(), types.MultiGlobRequestV3{*request})
+	res.UpdateStats(stats)
 	if err != nil {
 		stats.FindErrors = 1
 		if merry.Is(err, types.ErrTimeoutExceeded) {
@@ -194,6 +196,7 @@ func (c *ClientProtoV3Group) Info(ctx context.Context, request *protov3.MultiMet
 	rewrite.RawQuery = v.Encode()
 
 	res, err := c.httpQuery.DoQuery(ctx, logger, rewrite.RequestURI(), types.MultiMetricsInfoV3{*request})
+	res.UpdateStats(stats)
 	if err != nil {
 		stats.InfoErrors = 1
 		if merry.Is(err, types.ErrTimeoutExceeded) {
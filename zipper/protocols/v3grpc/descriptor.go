@@ -0,0 +1,94 @@
+package v3grpc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"path"
+
+	gogoproto "github.com/gogo/protobuf/proto"
+	"github.com/golang/protobuf/proto"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// gRPC reflection looks up file descriptors in the registry of golang/protobuf, but go-graphite/protocol is generated
+// by protoc-gen-gogo, that registers them in its own registry. Files of CarbonV1 service and its dependencies are
+// copied to golang/protobuf registry, so reflection can describe it. CarbonV1Stream and CarbonV1Tags are hand-written,
+// their files are built in place.
+
+// registerGogoFile copies file descriptor and its dependencies from gogo registry to golang/protobuf one and returns
+// the name it's registered with, or empty string if file is unknown
+func registerGogoFile(name string) string {
+	if proto.FileDescriptor(name) != nil {
+		return name
+	}
+	gz := gogoproto.FileDescriptor(name)
+	if gz == nil {
+		// imports contain full path of the file, e.x. "github.com/gogo/protobuf/gogoproto/gogo.proto", while
+		// gogo registry knows it as "gogo.proto"
+		if base := path.Base(name); base != name {
+			return registerGogoFile(base)
+		}
+		return ""
+	}
+	fd, err := decodeFileDescriptor(gz)
+	if err != nil {
+		return ""
+	}
+	registerFileDescriptor(fd)
+	return fd.GetName()
+}
+
+func decodeFileDescriptor(gz []byte) (*descriptorpb.FileDescriptorProto, error) {
+	r, err := gzip.NewReader(bytes.NewReader(gz))
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	fd := &descriptorpb.FileDescriptorProto{}
+	if err := proto.Unmarshal(b, fd); err != nil {
+		return nil, err
+	}
+	return fd, nil
+}
+
+// registerFileDescriptor registers descriptor in golang/protobuf registry, dependencies are copied from gogo registry
+// and renamed to match the names they are registered with
+func registerFileDescriptor(fd *descriptorpb.FileDescriptorProto) {
+	for i, dep := range fd.Dependency {
+		if name := registerGogoFile(dep); name != "" {
+			fd.Dependency[i] = name
+		}
+	}
+
+	b, err := proto.Marshal(fd)
+	if err != nil {
+		panic(err)
+	}
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, _ = w.Write(b)
+	_ = w.Close()
+	proto.RegisterFile(fd.GetName(), buf.Bytes())
+}
+
+// methodDescriptor describes rpc that takes and returns messages of the given fully-qualified types
+func methodDescriptor(name, input, output string, serverStreaming bool) *descriptorpb.MethodDescriptorProto {
+	m := &descriptorpb.MethodDescriptorProto{
+		Name:       proto.String(name),
+		InputType:  proto.String("." + input),
+		OutputType: proto.String("." + output),
+	}
+	if serverStreaming {
+		m.ServerStreaming = proto.Bool(true)
+	}
+	return m
+}
+
+func init() {
+	registerGogoFile("carbonapi_v3_grpc.proto")
+}
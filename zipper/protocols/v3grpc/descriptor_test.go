@@ -0,0 +1,114 @@
+package v3grpc
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestReflection(t *testing.T) {
+	addr, stop := startServer(t, &testServer{}, true)
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := grpc.DialContext(ctx, addr, grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	stream, err := rpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		t.Fatalf("failed to start reflection: %v", err)
+	}
+
+	tests := []struct {
+		symbol  string
+		methods []string
+	}{
+		{
+			symbol:  "carbonapi_v3_grpc.CarbonV1",
+			methods: []string{"FetchMetrics", "FindMetrics", "GetVersion", "ListMetrics", "MetricsInfo", "Stats"},
+		},
+		{
+			symbol:  "carbonapi_v3_grpc.CarbonV1Stream",
+			methods: []string{"FetchMetrics"},
+		},
+		{
+			symbol:  "carbonapi_v3_grpc.CarbonV1Tags",
+			methods: []string{"TagNames", "TagValues"},
+		},
+	}
+
+	// query sends reflection request and decodes returned file descriptors
+	query := func(t *testing.T, req *rpb.ServerReflectionRequest) []*descriptorpb.FileDescriptorProto {
+		if err := stream.Send(req); err != nil {
+			t.Fatalf("failed to send request: %v", err)
+		}
+		resp, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("failed to receive response: %v", err)
+		}
+		if e := resp.GetErrorResponse(); e != nil {
+			t.Fatalf("reflection error for %v: %v", req.GetMessageRequest(), e.GetErrorMessage())
+		}
+		var files []*descriptorpb.FileDescriptorProto
+		for _, b := range resp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			fd := &descriptorpb.FileDescriptorProto{}
+			if err := proto.Unmarshal(b, fd); err != nil {
+				t.Fatalf("failed to decode file descriptor: %v", err)
+			}
+			files = append(files, fd)
+		}
+		return files
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.symbol, func(t *testing.T) {
+			files := query(t, &rpb.ServerReflectionRequest{
+				MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: tt.symbol},
+			})
+
+			var methods []string
+			for _, fd := range files {
+				for _, svc := range fd.GetService() {
+					if fd.GetPackage()+"."+svc.GetName() != tt.symbol {
+						continue
+					}
+					for _, m := range svc.GetMethod() {
+						methods = append(methods, m.GetName())
+					}
+				}
+			}
+			sort.Strings(methods)
+			if !reflect.DeepEqual(methods, tt.methods) {
+				t.Fatalf("methods mismatch, got %v, expected %v", methods, tt.methods)
+			}
+
+			// client needs all dependencies to decode messages
+			seen := make(map[string]bool)
+			for len(files) > 0 {
+				fd := files[0]
+				files = files[1:]
+				seen[fd.GetName()] = true
+				for _, dep := range fd.GetDependency() {
+					if seen[dep] {
+						continue
+					}
+					files = append(files, query(t, &rpb.ServerReflectionRequest{
+						MessageRequest: &rpb.ServerReflectionRequest_FileByFilename{FileByFilename: dep},
+					})...)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,581 @@
+package v3grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/go-graphite/carbonapi/limiter"
+	util "github.com/go-graphite/carbonapi/util/ctx"
+	"github.com/go-graphite/carbonapi/zipper/metadata"
+	"github.com/go-graphite/carbonapi/zipper/types"
+	protov3grpc "github.com/go-graphite/protocol/carbonapi_v3_grpc"
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"github.com/golang/protobuf/ptypes/empty"
+	"go.uber.org/zap"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+	grpcMetadata "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultMaxMessageSize = 64 * 1024 * 1024
+)
+
+func init() {
+	aliases := []string{"carbonapi_v3_grpc", "proto_v3_grpc", "v3_grpc"}
+	metadata.Metadata.Lock()
+	for _, name := range aliases {
+		metadata.Metadata.SupportedProtocols[name] = struct{}{}
+		metadata.Metadata.ProtocolInits[name] = New
+		metadata.Metadata.ProtocolInitsWithLimiter[name] = NewWithLimiter
+	}
+	defer metadata.Metadata.Unlock()
+}
+
+// connPool keeps connections to a single server. gRPC multiplexes requests over the connection, several of them are
+// only needed to spread the load over more TCP connections.
+type connPool struct {
+	server  string
+	conns   []*grpc.ClientConn
+	clients []protov3grpc.CarbonV1Client
+	counter uint64
+
+	// streamUnsupported is set when server doesn't implement streaming fetch, unary FetchMetrics is used then
+	streamUnsupported int32
+}
+
+func (p *connPool) pick() (*grpc.ClientConn, protov3grpc.CarbonV1Client) {
+	if len(p.conns) == 1 {
+		return p.conns[0], p.clients[0]
+	}
+	idx := atomic.AddUint64(&p.counter, 1) % uint64(len(p.conns))
+	return p.conns[idx], p.clients[idx]
+}
+
+// ClientGRPCGroup talks to carbonapi_v3_grpc servers (e.x. carbonzipper with grpcListen), implements BackendServer
+// interface
+type ClientGRPCGroup struct {
+	groupName string
+	servers   []string
+
+	limiter              limiter.ServerLimiter
+	logger               *zap.Logger
+	timeout              types.Timeouts
+	maxTries             int
+	maxMetricsPerRequest int
+
+	pools   []*connPool
+	counter uint64
+}
+
+func (c *ClientGRPCGroup) Children() []types.BackendServer {
+	return []types.BackendServer{c}
+}
+
+func New(logger *zap.Logger, config types.BackendV2, tldCacheDisabled bool) (types.BackendServer, merry.Error) {
+	if config.ConcurrencyLimit == nil {
+		return nil, types.ErrConcurrencyLimitNotSet
+	}
+	if len(config.Servers) == 0 {
+		return nil, types.ErrNoServersSpecified
+	}
+	limiter := limiter.NewServerLimiter(config.Servers, *config.ConcurrencyLimit)
+
+	return NewWithLimiter(logger, config, tldCacheDisabled, limiter)
+}
+
+// serverAddress strips scheme from the server, so servers can be specified the same way as for http-based protocols
+func serverAddress(server string) string {
+	if idx := strings.Index(server, "://"); idx >= 0 {
+		server = server[idx+3:]
+	}
+	return strings.TrimSuffix(server, "/")
+}
+
+func intOption(logger *zap.Logger, config types.BackendV2, name string, defaultValue int) int {
+	vI, ok := config.BackendOptions[name]
+	if !ok {
+		return defaultValue
+	}
+	v, ok := vI.(int)
+	if !ok || v <= 0 {
+		logger.Fatal("failed to parse "+name,
+			zap.String("type_parsed", fmt.Sprintf("%T", vI)),
+			zap.String("type_expected", "positive int"),
+		)
+	}
+	return v
+}
+
+func stringOption(logger *zap.Logger, config types.BackendV2, name string) string {
+	vI, ok := config.BackendOptions[name]
+	if !ok {
+		return ""
+	}
+	v, ok := vI.(string)
+	if !ok {
+		logger.Fatal("failed to parse "+name,
+			zap.String("type_parsed", fmt.Sprintf("%T", vI)),
+			zap.String("type_expected", "string"),
+		)
+	}
+	return v
+}
+
+func boolOption(logger *zap.Logger, config types.BackendV2, name string) bool {
+	vI, ok := config.BackendOptions[name]
+	if !ok {
+		return false
+	}
+	v, ok := vI.(bool)
+	if !ok {
+		logger.Fatal("failed to parse "+name,
+			zap.String("type_parsed", fmt.Sprintf("%T", vI)),
+			zap.String("type_expected", "bool"),
+		)
+	}
+	return v
+}
+
+// transportCredentials returns TLS credentials if tls option is set, connections are not encrypted otherwise
+func transportCredentials(logger *zap.Logger, config types.BackendV2) (credentials.TransportCredentials, error) {
+	if !boolOption(logger, config, "tls") {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         stringOption(logger, config, "tls_server_name"),
+		InsecureSkipVerify: boolOption(logger, config, "tls_insecure_skip_verify"),
+	}
+
+	if caFile := stringOption(logger, config, "tls_ca_cert"); caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+	}
+
+	certFile, keyFile := stringOption(logger, config, "tls_cert"), stringOption(logger, config, "tls_key")
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+func NewWithLimiter(logger *zap.Logger, config types.BackendV2, tldCacheDisabled bool, limiter limiter.ServerLimiter) (types.BackendServer, merry.Error) {
+	logger = logger.With(zap.String("type", "grpcGroup"), zap.String("name", config.GroupName))
+
+	connections := intOption(logger, config, "connections_per_server", 1)
+	maxMessageSize := intOption(logger, config, "max_message_size", defaultMaxMessageSize)
+
+	creds, err := transportCredentials(logger, config)
+	if err != nil {
+		return nil, merry.Wrap(err).WithValue("group", config.GroupName)
+	}
+	transport := grpc.WithInsecure()
+	if creds != nil {
+		transport = grpc.WithTransportCredentials(creds)
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   config.Timeouts.Connect,
+		KeepAlive: *config.KeepAliveInterval,
+	}
+	opts := []grpc.DialOption{
+		transport,
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "tcp", addr)
+		}),
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(maxMessageSize), grpc.MaxCallSendMsgSize(maxMessageSize)),
+	}
+	if *config.KeepAliveInterval > 0 {
+		opts = append(opts, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:    *config.KeepAliveInterval,
+			Timeout: config.Timeouts.Connect,
+		}))
+	}
+
+	c := &ClientGRPCGroup{
+		groupName:            config.GroupName,
+		servers:              config.Servers,
+		timeout:              *config.Timeouts,
+		maxTries:             *config.MaxTries,
+		maxMetricsPerRequest: *config.MaxBatchSize,
+
+		limiter: limiter,
+		logger:  logger,
+	}
+
+	for _, server := range config.Servers {
+		p := &connPool{server: server}
+		for i := 0; i < connections; i++ {
+			// Dial doesn't block, connection is established in background and re-established when it's lost
+			conn, err := grpc.Dial(serverAddress(server), opts...)
+			if err != nil {
+				c.Close()
+				return nil, merry.Wrap(err).WithValue("server", server)
+			}
+			p.conns = append(p.conns, conn)
+			p.clients = append(p.clients, protov3grpc.NewCarbonV1Client(conn))
+		}
+		c.pools = append(c.pools, p)
+	}
+
+	return c, nil
+}
+
+// Close closes all connections of the group
+func (c *ClientGRPCGroup) Close() {
+	for _, p := range c.pools {
+		for _, conn := range p.conns {
+			_ = conn.Close()
+		}
+	}
+}
+
+func (c ClientGRPCGroup) MaxMetricsPerRequest() int {
+	return c.maxMetricsPerRequest
+}
+
+func (c ClientGRPCGroup) Name() string {
+	return c.groupName
+}
+
+func (c ClientGRPCGroup) Backends() []string {
+	return c.servers
+}
+
+func (c *ClientGRPCGroup) pickPool() *connPool {
+	if len(c.pools) == 1 {
+		return c.pools[0]
+	}
+	idx := atomic.AddUint64(&c.counter, 1) % uint64(len(c.pools))
+	return c.pools[idx]
+}
+
+// outgoingContext sets deadline of the request and passes request id and headers to the server as metadata
+func outgoingContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	md := grpcMetadata.MD{}
+	if uuid := util.GetUUID(ctx); uuid != "" {
+		md.Set(util.HeaderUUIDZipper, uuid)
+		md.Set(util.HeaderUUIDAPI, uuid)
+	}
+	for k, v := range util.GetPassHeaders(ctx) {
+		md.Set(k, v)
+	}
+	if len(md) > 0 {
+		ctx = grpcMetadata.NewOutgoingContext(ctx, md)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// doRequest calls f for servers of the group until it succeeds or maxTries is exceeded. Every call holds a slot of the
+// limiter for the server and has its own deadline, so a slow server doesn't eat the time of the next tries. NotFound is
+// not an error, f is expected to leave result empty in that case.
+func (c *ClientGRPCGroup) doRequest(ctx context.Context, logger *zap.Logger, timeout time.Duration, f func(ctx context.Context, p *connPool) error) (string, merry.Error) {
+	maxTries := c.maxTries
+	if len(c.pools) > maxTries {
+		maxTries = len(c.pools)
+	}
+
+	e := types.ErrFailedToFetch.WithValue("group", c.groupName)
+	timedOut := false
+	for try := 0; try < maxTries; try++ {
+		p := c.pickPool()
+		logger := logger.With(zap.String("server", p.server))
+
+		tryCtx, cancel := outgoingContext(ctx, timeout)
+		logger.Debug("trying to get slot")
+		if err := c.limiter.Enter(tryCtx, p.server); err != nil {
+			cancel()
+			logger.Debug("timeout waiting for a slot")
+			return p.server, types.ErrTimeoutExceeded.WithCause(err).WithValue("server", p.server)
+		}
+		err := f(tryCtx, p)
+		c.limiter.Leave(tryCtx, p.server)
+		cancel()
+
+		switch status.Code(err) {
+		case codes.OK, codes.NotFound:
+			return p.server, nil
+		case codes.DeadlineExceeded, codes.Canceled:
+			// request itself is canceled or out of time, there is no point to try other servers
+			if ctx.Err() != nil {
+				return p.server, types.ErrTimeoutExceeded.WithCause(err).WithValue("server", p.server)
+			}
+			timedOut = true
+		case codes.Unimplemented:
+			return p.server, types.ErrNotSupportedByBackend.WithCause(err).WithValue("server", p.server)
+		}
+
+		logger.Debug("have errors",
+			zap.Error(err),
+		)
+		e = e.WithCause(merry.Wrap(err).WithValue("server", p.server))
+	}
+
+	if timedOut {
+		return "", types.ErrTimeoutExceeded.WithCause(types.ErrMaxTriesExceeded.WithCause(e))
+	}
+	return "", types.ErrMaxTriesExceeded.WithCause(e)
+}
+
+// fetch receives response through streaming fetch, falls back to unary request if server doesn't support streaming
+func fetch(ctx context.Context, p *connPool, request *protov3.MultiFetchRequest) (*protov3.MultiFetchResponse, error) {
+	conn, client := p.pick()
+	if atomic.LoadInt32(&p.streamUnsupported) == 1 {
+		return client.FetchMetrics(ctx, request)
+	}
+
+	stream, err := fetchMetricsStream(ctx, conn, request)
+	if status.Code(err) == codes.Unimplemented {
+		atomic.StoreInt32(&p.streamUnsupported, 1)
+		return client.FetchMetrics(ctx, request)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r := &protov3.MultiFetchResponse{}
+	for {
+		part, err := stream.Recv()
+		if err == io.EOF {
+			return r, nil
+		}
+		if status.Code(err) == codes.Unimplemented {
+			atomic.StoreInt32(&p.streamUnsupported, 1)
+			return client.FetchMetrics(ctx, request)
+		}
+		if err != nil {
+			return nil, err
+		}
+		r.Metrics = append(r.Metrics, part.Metrics...)
+	}
+}
+
+func (c *ClientGRPCGroup) Fetch(ctx context.Context, request *protov3.MultiFetchRequest) (*protov3.MultiFetchResponse, *types.Stats, merry.Error) {
+	logger := c.logger.With(zap.String("type", "fetch"), zap.String("request", request.String()))
+	stats := &types.Stats{
+		RenderRequests: 1,
+	}
+
+	r := &protov3.MultiFetchResponse{}
+	server, err := c.doRequest(ctx, logger, c.timeout.Render, func(ctx context.Context, p *connPool) error {
+		res, err := fetch(ctx, p, request)
+		if err == nil {
+			r = res
+		}
+		return err
+	})
+	if err != nil {
+		stats.RenderErrors = 1
+		if merry.Is(err, types.ErrTimeoutExceeded) {
+			stats.Timeouts = 1
+			stats.RenderTimeouts = 1
+		}
+		stats.FailedServers = []string{c.groupName}
+		return nil, stats, err
+	}
+
+	stats.Servers = []string{server}
+	stats.MemoryUsage = int64(r.Size())
+	return r, stats, nil
+}
+
+func (c *ClientGRPCGroup) Find(ctx context.Context, request *protov3.MultiGlobRequest) (*protov3.MultiGlobResponse, *types.Stats, merry.Error) {
+	logger := c.logger.With(zap.String("type", "find"), zap.Strings("request", request.Metrics))
+	stats := &types.Stats{
+		FindRequests: 1,
+	}
+
+	r := &protov3.MultiGlobResponse{}
+	server, err := c.doRequest(ctx, logger, c.timeout.Find, func(ctx context.Context, p *connPool) error {
+		_, client := p.pick()
+		res, err := client.FindMetrics(ctx, request)
+		if err == nil {
+			r = res
+		}
+		return err
+	})
+	if err != nil {
+		stats.FindErrors = 1
+		if merry.Is(err, types.ErrTimeoutExceeded) {
+			stats.Timeouts = 1
+			stats.FindTimeouts = 1
+		}
+		stats.FailedServers = []string{c.groupName}
+		return nil, stats, err
+	}
+
+	stats.Servers = []string{server}
+	return r, stats, nil
+}
+
+func (c *ClientGRPCGroup) Info(ctx context.Context, request *protov3.MultiMetricsInfoRequest) (*protov3.ZipperInfoResponse, *types.Stats, merry.Error) {
+	logger := c.logger.With(zap.String("type", "info"), zap.String("request", request.String()))
+	stats := &types.Stats{
+		InfoRequests: 1,
+	}
+
+	infos := &protov3.MultiMetricsInfoResponse{}
+	server, err := c.doRequest(ctx, logger, c.timeout.Find, func(ctx context.Context, p *connPool) error {
+		_, client := p.pick()
+		res, err := client.MetricsInfo(ctx, request)
+		if err == nil {
+			infos = res
+		}
+		return err
+	})
+	if err != nil {
+		stats.InfoErrors = 1
+		if merry.Is(err, types.ErrTimeoutExceeded) {
+			stats.Timeouts = 1
+			stats.InfoTimeouts = 1
+		}
+		stats.FailedServers = []string{c.groupName}
+		return nil, stats, err
+	}
+
+	stats.Servers = []string{server}
+	stats.MemoryUsage = int64(infos.Size())
+
+	r := &protov3.ZipperInfoResponse{
+		Info: map[string]protov3.MultiMetricsInfoResponse{
+			c.Name(): *infos,
+		},
+	}
+	return r, stats, nil
+}
+
+func (c *ClientGRPCGroup) List(ctx context.Context) (*protov3.ListMetricsResponse, *types.Stats, merry.Error) {
+	logger := c.logger.With(zap.String("type", "list"))
+	stats := &types.Stats{}
+
+	r := &protov3.ListMetricsResponse{}
+	server, err := c.doRequest(ctx, logger, c.timeout.Find, func(ctx context.Context, p *connPool) error {
+		_, client := p.pick()
+		res, err := client.ListMetrics(ctx, &empty.Empty{})
+		if err == nil {
+			r = res
+		}
+		return err
+	})
+	if err != nil {
+		stats.FailedServers = []string{c.groupName}
+		return nil, stats, err
+	}
+
+	stats.Servers = []string{server}
+	return r, stats, nil
+}
+
+func (c *ClientGRPCGroup) Stats(ctx context.Context) (*protov3.MetricDetailsResponse, *types.Stats, merry.Error) {
+	logger := c.logger.With(zap.String("type", "stats"))
+	stats := &types.Stats{}
+
+	r := &protov3.MetricDetailsResponse{}
+	server, err := c.doRequest(ctx, logger, c.timeout.Find, func(ctx context.Context, p *connPool) error {
+		_, client := p.pick()
+		res, err := client.Stats(ctx, &empty.Empty{})
+		if err == nil {
+			r = res
+		}
+		return err
+	})
+	if err != nil {
+		stats.FailedServers = []string{c.groupName}
+		return nil, stats, err
+	}
+
+	stats.Servers = []string{server}
+	return r, stats, nil
+}
+
+func (c *ClientGRPCGroup) doTagQuery(ctx context.Context, isTagName bool, query string, limit int64) ([]string, merry.Error) {
+	logger := c.logger
+	method := tagNamesMethod
+	if isTagName {
+		logger = logger.With(zap.String("type", "tagName"))
+	} else {
+		logger = logger.With(zap.String("type", "tagValues"))
+		method = tagValuesMethod
+	}
+
+	var r []string
+	_, err := c.doRequest(ctx, logger, c.timeout.Find, func(ctx context.Context, p *connPool) error {
+		conn, _ := p.pick()
+		res, err := tagQuery(ctx, conn, method, &TagsRequest{Query: query, Limit: limit})
+		if err == nil {
+			r = res.Values
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debug("got client response",
+		zap.Strings("r", r),
+	)
+
+	return r, nil
+}
+
+func (c *ClientGRPCGroup) TagNames(ctx context.Context, query string, limit int64) ([]string, merry.Error) {
+	return c.doTagQuery(ctx, true, query, limit)
+}
+
+func (c *ClientGRPCGroup) TagValues(ctx context.Context, query string, limit int64) ([]string, merry.Error) {
+	return c.doTagQuery(ctx, false, query, limit)
+}
+
+func (c *ClientGRPCGroup) ProbeTLDs(ctx context.Context) ([]string, merry.Error) {
+	logger := c.logger.With(zap.String("function", "prober"))
+	req := &protov3.MultiGlobRequest{
+		Metrics: []string{"*"},
+	}
+
+	logger.Debug("doing request",
+		zap.Strings("request", req.Metrics),
+	)
+
+	res, _, err := c.Find(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var tlds []string
+	for _, m := range res.Metrics {
+		for _, v := range m.Matches {
+			tlds = append(tlds, v.Path)
+		}
+	}
+
+	logger.Debug("will return data",
+		zap.Strings("tlds", tlds),
+	)
+
+	return tlds, nil
+}
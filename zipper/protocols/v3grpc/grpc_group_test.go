@@ -0,0 +1,470 @@
+package v3grpc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ansel1/merry"
+	util "github.com/go-graphite/carbonapi/util/ctx"
+	"github.com/go-graphite/carbonapi/zipper/types"
+	protov3grpc "github.com/go-graphite/protocol/carbonapi_v3_grpc"
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"github.com/golang/protobuf/ptypes/empty"
+	"go.uber.org/zap"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	grpcMetadata "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+type testServer struct {
+	sync.Mutex
+	delay     time.Duration
+	deadlines []bool
+	uuids     []string
+}
+
+func (s *testServer) record(ctx context.Context) {
+	s.Lock()
+	defer s.Unlock()
+	_, ok := ctx.Deadline()
+	s.deadlines = append(s.deadlines, ok)
+	md, _ := grpcMetadata.FromIncomingContext(ctx)
+	s.uuids = append(s.uuids, md.Get(util.HeaderUUIDZipper)...)
+}
+
+func testResponse(request *protov3.MultiFetchRequest) *protov3.MultiFetchResponse {
+	r := &protov3.MultiFetchResponse{}
+	for _, m := range request.Metrics {
+		for _, suffix := range []string{".a", ".b", ".c"} {
+			r.Metrics = append(r.Metrics, protov3.FetchResponse{
+				Name:           m.Name + suffix,
+				PathExpression: m.PathExpression,
+				StartTime:      m.StartTime,
+				StopTime:       m.StopTime,
+				StepTime:       60,
+				Values:         []float64{1, 2, 3},
+			})
+		}
+	}
+	return r
+}
+
+func (s *testServer) GetVersion(ctx context.Context, in *empty.Empty) (*protov3grpc.ProtocolVersionResponse, error) {
+	return &protov3grpc.ProtocolVersionResponse{Version: 1}, nil
+}
+
+func (s *testServer) FetchMetrics(ctx context.Context, in *protov3.MultiFetchRequest) (*protov3.MultiFetchResponse, error) {
+	s.record(ctx)
+	select {
+	case <-time.After(s.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return testResponse(in), nil
+}
+
+func (s *testServer) FindMetrics(ctx context.Context, in *protov3.MultiGlobRequest) (*protov3.MultiGlobResponse, error) {
+	s.record(ctx)
+	if in.Metrics[0] == "missing" {
+		return nil, status.Error(codes.NotFound, "no data in response")
+	}
+	return &protov3.MultiGlobResponse{
+		Metrics: []protov3.GlobResponse{{Name: in.Metrics[0], Matches: []protov3.GlobMatch{{Path: "a", IsLeaf: true}}}},
+	}, nil
+}
+
+func (s *testServer) MetricsInfo(ctx context.Context, in *protov3.MultiMetricsInfoRequest) (*protov3.MultiMetricsInfoResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "not implemented")
+}
+
+func (s *testServer) ListMetrics(ctx context.Context, in *empty.Empty) (*protov3.ListMetricsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "not implemented")
+}
+
+func (s *testServer) Stats(ctx context.Context, in *empty.Empty) (*protov3.MetricDetailsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "not implemented")
+}
+
+func (s *testServer) TagNames(ctx context.Context, in *TagsRequest) (*TagsResponse, error) {
+	return &TagsResponse{Values: []string{"query=" + in.Query, "limit=" + strconv.FormatInt(in.Limit, 10)}}, nil
+}
+
+func (s *testServer) TagValues(ctx context.Context, in *TagsRequest) (*TagsResponse, error) {
+	return &TagsResponse{Values: []string{"value1", "value2"}}, nil
+}
+
+type testStreamServer struct {
+	*testServer
+}
+
+func (s *testStreamServer) FetchMetrics(in *protov3.MultiFetchRequest, stream CarbonV1Stream_FetchMetricsServer) error {
+	s.record(stream.Context())
+	// every series is bigger than 1 byte, so each of them is sent separately
+	return SendFetchResponse(stream, testResponse(in), 1)
+}
+
+func startServer(t *testing.T, srv *testServer, streaming bool, opts ...grpc.ServerOption) (string, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	s := grpc.NewServer(opts...)
+	protov3grpc.RegisterCarbonV1Server(s, srv)
+	RegisterCarbonV1TagsServer(s, srv)
+	if streaming {
+		RegisterCarbonV1StreamServer(s, &testStreamServer{testServer: srv})
+	}
+	reflection.Register(s)
+	go func() {
+		_ = s.Serve(listener)
+	}()
+	return listener.Addr().String(), s.Stop
+}
+
+// countingLimiter records servers that were entered and checks that all slots are released
+type countingLimiter struct {
+	sync.Mutex
+	entered map[string]int
+	active  int
+}
+
+func (l *countingLimiter) Capacity() int {
+	return 1
+}
+
+func (l *countingLimiter) Enter(ctx context.Context, s string) error {
+	l.Lock()
+	defer l.Unlock()
+	l.entered[s]++
+	l.active++
+	return nil
+}
+
+func (l *countingLimiter) Leave(ctx context.Context, s string) {
+	l.Lock()
+	defer l.Unlock()
+	l.active--
+}
+
+func newTestGroup(t *testing.T, servers []string, render time.Duration, l *countingLimiter) *ClientGRPCGroup {
+	return newTestGroupWithOptions(t, servers, render, l, nil)
+}
+
+func newTestGroupWithOptions(t *testing.T, servers []string, render time.Duration, l *countingLimiter, options map[string]interface{}) *ClientGRPCGroup {
+	concurrencyLimit := 10
+	keepAlive := time.Second
+	maxIdle := 10
+	maxTries := 1
+	maxBatchSize := 0
+	config := types.BackendV2{
+		GroupName:           "grpc",
+		Protocol:            "carbonapi_v3_grpc",
+		Servers:             servers,
+		ConcurrencyLimit:    &concurrencyLimit,
+		KeepAliveInterval:   &keepAlive,
+		MaxIdleConnsPerHost: &maxIdle,
+		MaxTries:            &maxTries,
+		MaxBatchSize:        &maxBatchSize,
+		Timeouts: &types.Timeouts{
+			Find:    time.Second,
+			Render:  render,
+			Connect: time.Second,
+		},
+		BackendOptions: map[string]interface{}{
+			"connections_per_server": 2,
+		},
+	}
+	for k, v := range options {
+		config.BackendOptions[k] = v
+	}
+
+	c, err := NewWithLimiter(zap.NewNop(), config, false, l)
+	if err != nil {
+		t.Fatalf("failed to create group: %v", err)
+	}
+	return c.(*ClientGRPCGroup)
+}
+
+func fetchRequest() *protov3.MultiFetchRequest {
+	return &protov3.MultiFetchRequest{
+		Metrics: []protov3.FetchRequest{
+			{Name: "foo", PathExpression: "foo", StartTime: 60, StopTime: 240},
+			{Name: "bar", PathExpression: "bar", StartTime: 60, StopTime: 240},
+		},
+	}
+}
+
+func TestFetch(t *testing.T) {
+	for _, streaming := range []bool{true, false} {
+		srv := &testServer{}
+		addr, stop := startServer(t, srv, streaming)
+
+		l := &countingLimiter{entered: make(map[string]int)}
+		server := "grpc://" + addr
+		c := newTestGroup(t, []string{server}, time.Second, l)
+
+		ctx := util.SetUUID(context.Background(), "test-uuid")
+		for i := 0; i < 2; i++ {
+			res, stats, err := c.Fetch(ctx, fetchRequest())
+			if err != nil {
+				t.Fatalf("streaming=%v: unexpected error: %v", streaming, err)
+			}
+			if got, want := res, testResponse(fetchRequest()); !reflect.DeepEqual(got, want) {
+				t.Errorf("streaming=%v: got %+v, want %+v", streaming, got, want)
+			}
+			if !reflect.DeepEqual(stats.Servers, []string{server}) || stats.RenderRequests != 1 {
+				t.Errorf("streaming=%v: unexpected stats %+v", streaming, stats)
+			}
+		}
+
+		if got := c.pools[0].streamUnsupported == 1; got == streaming {
+			t.Errorf("streaming=%v: got streamUnsupported=%v", streaming, got)
+		}
+		if l.entered[server] != 2 || l.active != 0 {
+			t.Errorf("streaming=%v: limiter was entered %v times with %v slots left taken", streaming, l.entered, l.active)
+		}
+		if want := []bool{true, true}; !reflect.DeepEqual(srv.deadlines, want) {
+			t.Errorf("streaming=%v: deadline wasn't propagated: %v", streaming, srv.deadlines)
+		}
+		if want := []string{"test-uuid", "test-uuid"}; !reflect.DeepEqual(srv.uuids, want) {
+			t.Errorf("streaming=%v: got uuids %v, want %v", streaming, srv.uuids, want)
+		}
+
+		c.Close()
+		stop()
+	}
+}
+
+func TestFetchTimeout(t *testing.T) {
+	srv := &testServer{delay: time.Second}
+	addr, stop := startServer(t, srv, false)
+	defer stop()
+
+	l := &countingLimiter{entered: make(map[string]int)}
+	c := newTestGroup(t, []string{addr}, 100*time.Millisecond, l)
+	defer c.Close()
+
+	_, stats, err := c.Fetch(context.Background(), fetchRequest())
+	if !merry.Is(err, types.ErrTimeoutExceeded) {
+		t.Fatalf("got error %v, want timeout", err)
+	}
+	if stats.RenderTimeouts != 1 || stats.RenderErrors != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestFetchTimeoutRetry(t *testing.T) {
+	slow := &testServer{delay: time.Second}
+	slowAddr, stopSlow := startServer(t, slow, false)
+	defer stopSlow()
+	fast := &testServer{}
+	fastAddr, stopFast := startServer(t, fast, false)
+	defer stopFast()
+
+	// servers are picked round-robin starting from the second one, so the slow server is tried first
+	l := &countingLimiter{entered: make(map[string]int)}
+	c := newTestGroup(t, []string{fastAddr, slowAddr}, 200*time.Millisecond, l)
+	defer c.Close()
+
+	res, stats, err := c.Fetch(context.Background(), fetchRequest())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(res, testResponse(fetchRequest())) || !reflect.DeepEqual(stats.Servers, []string{fastAddr}) {
+		t.Errorf("unexpected response %+v, stats %+v", res, stats)
+	}
+	if l.entered[slowAddr] != 1 || l.entered[fastAddr] != 1 {
+		t.Errorf("both servers should be tried once, got %v", l.entered)
+	}
+}
+
+// writeTestCertificate writes self-signed certificate for 127.0.0.1 and its key to dir
+func writeTestCertificate(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "carbonapi test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err = ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("failed to write certificate: %v", err)
+	}
+	if err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+	return certFile, keyFile
+}
+
+func TestTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "carbonapi-grpc-tls")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeTestCertificate(t, dir)
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("failed to load certificate: %v", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(mustParseCertificate(t, cert.Certificate[0]))
+	// server requires client certificate signed by the same CA
+	srv := &testServer{}
+	addr, stop := startServer(t, srv, true, grpc.Creds(credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})))
+	defer stop()
+
+	l := &countingLimiter{entered: make(map[string]int)}
+	c := newTestGroupWithOptions(t, []string{addr}, time.Second, l, map[string]interface{}{
+		"tls":         true,
+		"tls_ca_cert": certFile,
+		"tls_cert":    certFile,
+		"tls_key":     keyFile,
+	})
+	defer c.Close()
+
+	res, _, err := c.Fetch(context.Background(), fetchRequest())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(res, testResponse(fetchRequest())) {
+		t.Errorf("got %+v, want %+v", res, testResponse(fetchRequest()))
+	}
+
+	// plain text client can't talk to TLS server
+	plain := newTestGroup(t, []string{addr}, time.Second, l)
+	defer plain.Close()
+	if _, _, err = plain.Fetch(context.Background(), fetchRequest()); err == nil {
+		t.Errorf("expected error for plain text connection")
+	}
+}
+
+func mustParseCertificate(t *testing.T, der []byte) *x509.Certificate {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+	return cert
+}
+
+func TestFind(t *testing.T) {
+	srv := &testServer{}
+	addr, stop := startServer(t, srv, true)
+	defer stop()
+
+	l := &countingLimiter{entered: make(map[string]int)}
+	c := newTestGroup(t, []string{addr}, time.Second, l)
+	defer c.Close()
+
+	tlds, err := c.ProbeTLDs(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"a"}; !reflect.DeepEqual(tlds, want) {
+		t.Errorf("got %v, want %v", tlds, want)
+	}
+
+	res, _, err := c.Find(context.Background(), &protov3.MultiGlobRequest{Metrics: []string{"missing"}})
+	if err != nil {
+		t.Fatalf("not found shouldn't be an error, got %v", err)
+	}
+	if len(res.Metrics) != 0 {
+		t.Errorf("got %+v, want empty response", res)
+	}
+}
+
+func TestUnavailable(t *testing.T) {
+	// nothing listens on the port after listener is closed
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	addr := listener.Addr().String()
+	_ = listener.Close()
+
+	l := &countingLimiter{entered: make(map[string]int)}
+	c := newTestGroup(t, []string{addr}, time.Second, l)
+	defer c.Close()
+
+	_, stats, e := c.Fetch(context.Background(), fetchRequest())
+	if !merry.Is(e, types.ErrMaxTriesExceeded) {
+		t.Fatalf("got error %v, want max tries exceeded", e)
+	}
+	if !reflect.DeepEqual(stats.FailedServers, []string{"grpc"}) || l.active != 0 {
+		t.Errorf("unexpected stats %+v, %v slots are taken", stats, l.active)
+	}
+}
+
+func TestTags(t *testing.T) {
+	srv := &testServer{}
+	addr, stop := startServer(t, srv, true)
+	defer stop()
+
+	l := &countingLimiter{entered: make(map[string]int)}
+	c := newTestGroup(t, []string{addr}, time.Second, l)
+	defer c.Close()
+
+	names, err := c.TagNames(context.Background(), "tagPrefix=h", 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"query=tagPrefix=h", "limit=10"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got %v, want %v", names, want)
+	}
+
+	values, err := c.TagValues(context.Background(), "tag=host", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"value1", "value2"}; !reflect.DeepEqual(values, want) {
+		t.Errorf("got %v, want %v", values, want)
+	}
+
+	_, _, err = c.Info(context.Background(), &protov3.MultiMetricsInfoRequest{Names: []string{"foo"}})
+	if !merry.Is(err, types.ErrNotSupportedByBackend) {
+		t.Errorf("got error %v, want not supported", err)
+	}
+}
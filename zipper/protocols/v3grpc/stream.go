@@ -0,0 +1,145 @@
+package v3grpc
+
+import (
+	"context"
+
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// CarbonV1Stream is a companion of carbonapi_v3_grpc.CarbonV1 service, that isn't a part of go-graphite/protocol yet.
+// Code below is equivalent of what protoc-gen-gogo generates for
+//
+//	service CarbonV1Stream {
+//	    rpc FetchMetrics (carbonapi_v3_pb.MultiFetchRequest) returns (stream carbonapi_v3_pb.MultiFetchResponse) {}
+//	}
+//
+// Server sends response in parts, so big responses are not limited by maximum size of the message and client can
+// decode parts while rest of them are still being sent.
+const (
+	fetchStreamMethod = "/carbonapi_v3_grpc.CarbonV1Stream/FetchMetrics"
+	streamProtoFile   = "carbonapi_v3_grpc_stream.proto"
+)
+
+// CarbonV1StreamServer is the server API for CarbonV1Stream service
+type CarbonV1StreamServer interface {
+	FetchMetrics(*protov3.MultiFetchRequest, CarbonV1Stream_FetchMetricsServer) error
+}
+
+// CarbonV1Stream_FetchMetricsServer is used by server to send parts of the response
+type CarbonV1Stream_FetchMetricsServer interface {
+	Send(*protov3.MultiFetchResponse) error
+	grpc.ServerStream
+}
+
+type carbonV1StreamFetchMetricsServer struct {
+	grpc.ServerStream
+}
+
+func (x *carbonV1StreamFetchMetricsServer) Send(m *protov3.MultiFetchResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func fetchMetricsStreamHandler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(protov3.MultiFetchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CarbonV1StreamServer).FetchMetrics(m, &carbonV1StreamFetchMetricsServer{stream})
+}
+
+var carbonV1StreamServiceDesc = grpc.ServiceDesc{
+	ServiceName: "carbonapi_v3_grpc.CarbonV1Stream",
+	HandlerType: (*CarbonV1StreamServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "FetchMetrics",
+			Handler:       fetchMetricsStreamHandler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: streamProtoFile,
+}
+
+func init() {
+	registerFileDescriptor(&descriptorpb.FileDescriptorProto{
+		Name:       proto.String(streamProtoFile),
+		Package:    proto.String("carbonapi_v3_grpc"),
+		Dependency: []string{"carbonapi_v3_pb.proto"},
+		Service: []*descriptorpb.ServiceDescriptorProto{
+			{
+				Name: proto.String("CarbonV1Stream"),
+				Method: []*descriptorpb.MethodDescriptorProto{
+					methodDescriptor("FetchMetrics", "carbonapi_v3_pb.MultiFetchRequest", "carbonapi_v3_pb.MultiFetchResponse", true),
+				},
+			},
+		},
+		Syntax: proto.String("proto3"),
+	})
+}
+
+// RegisterCarbonV1StreamServer registers streaming fetch on the server
+func RegisterCarbonV1StreamServer(s *grpc.Server, srv CarbonV1StreamServer) {
+	s.RegisterService(&carbonV1StreamServiceDesc, srv)
+}
+
+// CarbonV1Stream_FetchMetricsClient is used by client to receive parts of the response
+type CarbonV1Stream_FetchMetricsClient interface {
+	Recv() (*protov3.MultiFetchResponse, error)
+	grpc.ClientStream
+}
+
+type carbonV1StreamFetchMetricsClient struct {
+	grpc.ClientStream
+}
+
+func (x *carbonV1StreamFetchMetricsClient) Recv() (*protov3.MultiFetchResponse, error) {
+	m := new(protov3.MultiFetchResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// fetchMetricsStream starts streaming fetch, parts of the response should be received until io.EOF
+func fetchMetricsStream(ctx context.Context, cc *grpc.ClientConn, in *protov3.MultiFetchRequest, opts ...grpc.CallOption) (CarbonV1Stream_FetchMetricsClient, error) {
+	stream, err := cc.NewStream(ctx, &carbonV1StreamServiceDesc.Streams[0], fetchStreamMethod, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &carbonV1StreamFetchMetricsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// SendFetchResponse sends response by parts, each part contains as many series as fit into partSize bytes, but at
+// least one
+func SendFetchResponse(stream CarbonV1Stream_FetchMetricsServer, r *protov3.MultiFetchResponse, partSize int) error {
+	part := &protov3.MultiFetchResponse{}
+	size := 0
+	for i := range r.Metrics {
+		s := r.Metrics[i].Size()
+		if len(part.Metrics) > 0 && size+s > partSize {
+			if err := stream.Send(part); err != nil {
+				return err
+			}
+			part = &protov3.MultiFetchResponse{}
+			size = 0
+		}
+		part.Metrics = append(part.Metrics, r.Metrics[i])
+		size += s
+	}
+	if len(part.Metrics) == 0 {
+		return nil
+	}
+	return stream.Send(part)
+}
@@ -0,0 +1,165 @@
+package v3grpc
+
+import (
+	"context"
+
+	"github.com/golang/protobuf/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// CarbonV1Tags provides tag autocompletion over gRPC, same as /tags/autoComplete/tags and /tags/autoComplete/values
+// do over HTTP. Like CarbonV1Stream it's not a part of go-graphite/protocol yet, code below is equivalent of what
+// protoc-gen-gogo generates for
+//
+//	message TagsRequest {
+//	    string query = 1;
+//	    int64 limit = 2;
+//	}
+//
+//	message TagsResponse {
+//	    repeated string values = 1;
+//	}
+//
+//	service CarbonV1Tags {
+//	    rpc TagNames (TagsRequest) returns (TagsResponse) {}
+//	    rpc TagValues (TagsRequest) returns (TagsResponse) {}
+//	}
+const (
+	tagNamesMethod  = "/carbonapi_v3_grpc.CarbonV1Tags/TagNames"
+	tagValuesMethod = "/carbonapi_v3_grpc.CarbonV1Tags/TagValues"
+	tagsProtoFile   = "carbonapi_v3_grpc_tags.proto"
+)
+
+// TagsRequest contains url-encoded parameters of autocompletion request, e.x. "tagPrefix=host&expr=name%3Dcpu"
+type TagsRequest struct {
+	Query string `protobuf:"bytes,1,opt,name=query,proto3" json:"query,omitempty"`
+	Limit int64  `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"`
+}
+
+func (m *TagsRequest) Reset()         { *m = TagsRequest{} }
+func (m *TagsRequest) String() string { return proto.CompactTextString(m) }
+func (*TagsRequest) ProtoMessage()    {}
+
+type TagsResponse struct {
+	Values []string `protobuf:"bytes,1,rep,name=values,proto3" json:"values,omitempty"`
+}
+
+func (m *TagsResponse) Reset()         { *m = TagsResponse{} }
+func (m *TagsResponse) String() string { return proto.CompactTextString(m) }
+func (*TagsResponse) ProtoMessage()    {}
+
+// CarbonV1TagsServer is the server API for CarbonV1Tags service
+type CarbonV1TagsServer interface {
+	TagNames(context.Context, *TagsRequest) (*TagsResponse, error)
+	TagValues(context.Context, *TagsRequest) (*TagsResponse, error)
+}
+
+func tagNamesHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TagsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CarbonV1TagsServer).TagNames(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: tagNamesMethod,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CarbonV1TagsServer).TagNames(ctx, req.(*TagsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func tagValuesHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TagsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CarbonV1TagsServer).TagValues(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: tagValuesMethod,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CarbonV1TagsServer).TagValues(ctx, req.(*TagsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var carbonV1TagsServiceDesc = grpc.ServiceDesc{
+	ServiceName: "carbonapi_v3_grpc.CarbonV1Tags",
+	HandlerType: (*CarbonV1TagsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "TagNames",
+			Handler:    tagNamesHandler,
+		},
+		{
+			MethodName: "TagValues",
+			Handler:    tagValuesHandler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: tagsProtoFile,
+}
+
+func init() {
+	field := func(name string, number int32, label descriptorpb.FieldDescriptorProto_Label, typ descriptorpb.FieldDescriptorProto_Type) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(number),
+			Label:    label.Enum(),
+			Type:     typ.Enum(),
+		}
+	}
+
+	registerFileDescriptor(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String(tagsProtoFile),
+		Package: proto.String("carbonapi_v3_grpc"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("TagsRequest"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("query", 1, descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+					field("limit", 2, descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, descriptorpb.FieldDescriptorProto_TYPE_INT64),
+				},
+			},
+			{
+				Name: proto.String("TagsResponse"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("values", 1, descriptorpb.FieldDescriptorProto_LABEL_REPEATED, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				},
+			},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{
+			{
+				Name: proto.String("CarbonV1Tags"),
+				Method: []*descriptorpb.MethodDescriptorProto{
+					methodDescriptor("TagNames", "carbonapi_v3_grpc.TagsRequest", "carbonapi_v3_grpc.TagsResponse", false),
+					methodDescriptor("TagValues", "carbonapi_v3_grpc.TagsRequest", "carbonapi_v3_grpc.TagsResponse", false),
+				},
+			},
+		},
+		Syntax: proto.String("proto3"),
+	})
+}
+
+// RegisterCarbonV1TagsServer registers tag autocompletion on the server
+func RegisterCarbonV1TagsServer(s *grpc.Server, srv CarbonV1TagsServer) {
+	s.RegisterService(&carbonV1TagsServiceDesc, srv)
+}
+
+func tagQuery(ctx context.Context, cc *grpc.ClientConn, method string, in *TagsRequest, opts ...grpc.CallOption) (*TagsResponse, error) {
+	out := new(TagsResponse)
+	if err := cc.Invoke(ctx, method, in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,373 @@
+package victoriametrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/ansel1/merry"
+
+	"github.com/go-graphite/carbonapi/limiter"
+	"github.com/go-graphite/carbonapi/zipper/helper"
+	"github.com/go-graphite/carbonapi/zipper/httpHeaders"
+	"github.com/go-graphite/carbonapi/zipper/metadata"
+	"github.com/go-graphite/carbonapi/zipper/types"
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+
+	"go.uber.org/zap"
+)
+
+func init() {
+	aliases := []string{"victoriametrics", "vm"}
+	metadata.Metadata.Lock()
+	for _, name := range aliases {
+		metadata.Metadata.SupportedProtocols[name] = struct{}{}
+		metadata.Metadata.ProtocolInits[name] = New
+		metadata.Metadata.ProtocolInitsWithLimiter[name] = NewWithLimiter
+	}
+	defer metadata.Metadata.Unlock()
+}
+
+// VictoriaMetricsGroup talks to Graphite API of VictoriaMetrics, implements BackendServer interface. Servers are URL
+// prefixes, so for cluster version they should include path to the tenant, e.x. http://vmselect:8481/select/0/graphite
+type VictoriaMetricsGroup struct {
+	groupName string
+	servers   []string
+	protocol  string
+
+	client *http.Client
+
+	limiter              limiter.ServerLimiter
+	logger               *zap.Logger
+	timeout              types.Timeouts
+	maxTries             int
+	maxMetricsPerRequest int
+
+	maxPointsPerQuery int64
+
+	httpQuery *helper.HttpQuery
+}
+
+func NewWithLimiter(logger *zap.Logger, config types.BackendV2, tldCacheDisabled bool, limiter limiter.ServerLimiter) (types.BackendServer, merry.Error) {
+	logger = logger.With(zap.String("type", "victoriametrics"), zap.String("protocol", config.Protocol), zap.String("name", config.GroupName))
+
+	httpClient := &http.Client{
+		Transport: &http.Transport{
+			MaxIdleConnsPerHost: *config.MaxIdleConnsPerHost,
+			DialContext: (&net.Dialer{
+				Timeout:   config.Timeouts.Connect,
+				KeepAlive: *config.KeepAliveInterval,
+			}).DialContext,
+		},
+	}
+
+	// 0 means that number of points is not limited by carbonapi
+	maxPointsPerQuery := int64(0)
+	mppqI, ok := config.BackendOptions["max_points_per_query"]
+	if ok {
+		mppq, ok := mppqI.(int)
+		if !ok || mppq < 0 {
+			logger.Fatal("failed to parse max_points_per_query",
+				zap.String("type_parsed", fmt.Sprintf("%T", mppqI)),
+				zap.String("type_expected", "int"),
+			)
+		}
+
+		maxPointsPerQuery = int64(mppq)
+	}
+
+	httpQuery := helper.NewHttpQueryWithBalancer(config.GroupName, config.Servers, *config.MaxTries, limiter, httpClient, httpHeaders.ContentTypeJSON, helper.NewBalancer(config.GroupName, config.LBMethod, config.Servers), config.Hedging)
+
+	c := &VictoriaMetricsGroup{
+		groupName:            config.GroupName,
+		servers:              config.Servers,
+		protocol:             config.Protocol,
+		timeout:              *config.Timeouts,
+		maxTries:             *config.MaxTries,
+		maxMetricsPerRequest: *config.MaxBatchSize,
+
+		maxPointsPerQuery: maxPointsPerQuery,
+
+		client:  httpClient,
+		limiter: limiter,
+		logger:  logger,
+
+		httpQuery: httpQuery,
+	}
+	return c, nil
+}
+
+func New(logger *zap.Logger, config types.BackendV2, tldCacheDisabled bool) (types.BackendServer, merry.Error) {
+	if config.ConcurrencyLimit == nil {
+		return nil, types.ErrConcurrencyLimitNotSet
+	}
+	if len(config.Servers) == 0 {
+		return nil, types.ErrNoServersSpecified
+	}
+	limiter := limiter.NewServerLimiter(config.Servers, *config.ConcurrencyLimit)
+
+	return NewWithLimiter(logger, config, tldCacheDisabled, limiter)
+}
+
+func (c *VictoriaMetricsGroup) Children() []types.BackendServer {
+	return []types.BackendServer{c}
+}
+
+func (c VictoriaMetricsGroup) MaxMetricsPerRequest() int {
+	return c.maxMetricsPerRequest
+}
+
+func (c VictoriaMetricsGroup) Name() string {
+	return c.groupName
+}
+
+func (c VictoriaMetricsGroup) Backends() []string {
+	return c.servers
+}
+
+// maxDataPoints returns number of points that should be requested for the target, request's own limit is used when
+// it's stricter than max_points_per_query
+func (c *VictoriaMetricsGroup) maxDataPoints(m *protov3.FetchRequest) int64 {
+	if c.maxPointsPerQuery == 0 || (m.MaxDataPoints > 0 && m.MaxDataPoints < c.maxPointsPerQuery) {
+		return m.MaxDataPoints
+	}
+	return c.maxPointsPerQuery
+}
+
+func (c *VictoriaMetricsGroup) Fetch(ctx context.Context, request *protov3.MultiFetchRequest) (*protov3.MultiFetchResponse, *types.Stats, merry.Error) {
+	logger := c.logger.With(zap.String("type", "fetch"), zap.String("request", request.String()))
+	stats := &types.Stats{}
+	rewrite, _ := url.Parse("http://127.0.0.1/render")
+
+	var r protov3.MultiFetchResponse
+	var e merry.Error
+	for i := range request.Metrics {
+		m := &request.Metrics[i]
+		v := url.Values{
+			"target": []string{m.Name},
+			"format": []string{"json"},
+			"from":   []string{strconv.FormatInt(m.StartTime, 10)},
+			"until":  []string{strconv.FormatInt(m.StopTime, 10)},
+		}
+		if mdp := c.maxDataPoints(m); mdp > 0 {
+			v.Set("maxDataPoints", strconv.FormatInt(mdp, 10))
+		}
+		rewrite.RawQuery = v.Encode()
+		stats.RenderRequests += 1
+		res, err := c.httpQuery.DoQuery(ctx, logger, rewrite.RequestURI(), nil)
+		res.UpdateStats(stats)
+		if err == nil {
+			err = parseError(res.Response)
+		}
+		if err != nil {
+			stats.RenderErrors += 1
+			if merry.Is(err, types.ErrTimeoutExceeded) {
+				stats.Timeouts += 1
+				stats.RenderTimeouts += 1
+			}
+			if e == nil {
+				e = err.WithValue("target", m.Name)
+			} else {
+				e = e.WithCause(err)
+			}
+			continue
+		}
+		if len(res.Response) == 0 {
+			continue
+		}
+
+		var series []vmRenderResponse
+		if marshalErr := json.Unmarshal(res.Response, &series); marshalErr != nil {
+			stats.RenderErrors += 1
+			if e == nil {
+				e = merry.Wrap(marshalErr).WithValue("target", m.Name)
+			} else {
+				e = e.WithCause(marshalErr)
+			}
+			continue
+		}
+
+		for j := range series {
+			r.Metrics = append(r.Metrics, series[j].toFetchResponse(m))
+		}
+	}
+
+	if e != nil {
+		stats.FailedServers = []string{c.groupName}
+		logger.Error("errors occurred while getting results",
+			zap.Any("errors", e),
+		)
+		return &r, stats, e
+	}
+	return &r, stats, nil
+}
+
+func (c *VictoriaMetricsGroup) Find(ctx context.Context, request *protov3.MultiGlobRequest) (*protov3.MultiGlobResponse, *types.Stats, merry.Error) {
+	logger := c.logger.With(zap.String("type", "find"), zap.Strings("request", request.Metrics))
+	stats := &types.Stats{}
+	rewrite, _ := url.Parse("http://127.0.0.1/metrics/find")
+
+	r := protov3.MultiGlobResponse{
+		Metrics: make([]protov3.GlobResponse, 0, len(request.Metrics)),
+	}
+	var e merry.Error
+	for _, query := range request.Metrics {
+		v := url.Values{
+			"query":  []string{query},
+			"format": []string{"treejson"},
+		}
+		if request.StartTime != 0 {
+			v.Set("from", strconv.FormatInt(request.StartTime, 10))
+		}
+		if request.StopTime != 0 {
+			v.Set("until", strconv.FormatInt(request.StopTime, 10))
+		}
+		rewrite.RawQuery = v.Encode()
+		stats.FindRequests += 1
+		res, err := c.httpQuery.DoQuery(ctx, logger, rewrite.RequestURI(), nil)
+		res.UpdateStats(stats)
+		if err == nil {
+			err = parseError(res.Response)
+		}
+		if err != nil {
+			stats.FindErrors += 1
+			if merry.Is(err, types.ErrTimeoutExceeded) {
+				stats.Timeouts += 1
+				stats.FindTimeouts += 1
+			}
+			if e == nil {
+				e = err.WithValue("query", query)
+			} else {
+				e = e.WithCause(err)
+			}
+			continue
+		}
+		stats.Servers = append(stats.Servers, res.Server)
+
+		var nodes []vmFindResponse
+		if len(res.Response) > 0 {
+			if marshalErr := json.Unmarshal(res.Response, &nodes); marshalErr != nil {
+				stats.FindErrors += 1
+				if e == nil {
+					e = merry.Wrap(marshalErr).WithValue("query", query)
+				} else {
+					e = e.WithCause(marshalErr)
+				}
+				continue
+			}
+		}
+
+		resp := protov3.GlobResponse{
+			Name:    query,
+			Matches: make([]protov3.GlobMatch, 0, len(nodes)),
+		}
+		for i := range nodes {
+			resp.Matches = append(resp.Matches, nodes[i].toGlobMatch())
+		}
+		r.Metrics = append(r.Metrics, resp)
+	}
+
+	if e != nil {
+		stats.FailedServers = []string{c.groupName}
+		logger.Error("errors occurred while getting results",
+			zap.Any("errors", e),
+		)
+		return &r, stats, e
+	}
+	return &r, stats, nil
+}
+
+func (c *VictoriaMetricsGroup) Info(ctx context.Context, request *protov3.MultiMetricsInfoRequest) (*protov3.ZipperInfoResponse, *types.Stats, merry.Error) {
+	return nil, nil, types.ErrNotSupportedByBackend
+}
+
+func (c *VictoriaMetricsGroup) List(ctx context.Context) (*protov3.ListMetricsResponse, *types.Stats, merry.Error) {
+	return nil, nil, types.ErrNotSupportedByBackend
+}
+func (c *VictoriaMetricsGroup) Stats(ctx context.Context) (*protov3.MetricDetailsResponse, *types.Stats, merry.Error) {
+	return nil, nil, types.ErrNotSupportedByBackend
+}
+
+func (c *VictoriaMetricsGroup) doTagQuery(ctx context.Context, isTagName bool, query string, limit int64) ([]string, merry.Error) {
+	logger := c.logger
+	var rewrite *url.URL
+	if isTagName {
+		logger = logger.With(zap.String("type", "tagName"))
+		rewrite, _ = url.Parse("http://127.0.0.1/tags/autoComplete/tags")
+	} else {
+		logger = logger.With(zap.String("type", "tagValues"))
+		rewrite, _ = url.Parse("http://127.0.0.1/tags/autoComplete/values")
+	}
+
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, merry.Wrap(err).WithValue("query", query)
+	}
+	if limit > 0 {
+		params.Set("limit", strconv.FormatInt(limit, 10))
+	}
+	rewrite.RawQuery = params.Encode()
+
+	var r []string
+	res, e := c.httpQuery.DoQuery(ctx, logger, rewrite.RequestURI(), nil)
+	if e == nil {
+		e = parseError(res.Response)
+	}
+	if e != nil {
+		return r, e
+	}
+	if len(res.Response) == 0 {
+		return r, nil
+	}
+
+	if err := json.Unmarshal(res.Response, &r); err != nil {
+		return r, merry.Wrap(err)
+	}
+
+	logger.Debug("got client response",
+		zap.Strings("r", r),
+	)
+
+	return r, nil
+}
+
+func (c *VictoriaMetricsGroup) TagNames(ctx context.Context, query string, limit int64) ([]string, merry.Error) {
+	return c.doTagQuery(ctx, true, query, limit)
+}
+
+func (c *VictoriaMetricsGroup) TagValues(ctx context.Context, query string, limit int64) ([]string, merry.Error) {
+	return c.doTagQuery(ctx, false, query, limit)
+}
+
+func (c *VictoriaMetricsGroup) ProbeTLDs(ctx context.Context) ([]string, merry.Error) {
+	logger := c.logger.With(zap.String("function", "prober"))
+	req := &protov3.MultiGlobRequest{
+		Metrics: []string{"*"},
+	}
+
+	logger.Debug("doing request",
+		zap.Strings("request", req.Metrics),
+	)
+
+	res, _, err := c.Find(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var tlds []string
+	for _, m := range res.Metrics {
+		for _, v := range m.Matches {
+			tlds = append(tlds, v.Path)
+		}
+	}
+
+	logger.Debug("will return data",
+		zap.Strings("tlds", tlds),
+	)
+
+	return tlds, nil
+}
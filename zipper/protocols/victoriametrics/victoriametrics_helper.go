@@ -0,0 +1,130 @@
+package victoriametrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/ansel1/merry"
+	"github.com/go-graphite/carbonapi/zipper/types"
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+)
+
+// vmRenderResponse is a single series of /render?format=json. Format is the same as graphite-web uses, but names of
+// tagged series don't always contain tags, they are passed separately
+type vmRenderResponse struct {
+	Target     string            `json:"target"`
+	Tags       map[string]string `json:"tags"`
+	Datapoints []vmDatapoint     `json:"datapoints"`
+}
+
+// vmDatapoint is [value, timestamp], value is null for absent points
+type vmDatapoint [2]*float64
+
+// vmFindResponse is a single node of /metrics/find?format=treejson
+type vmFindResponse struct {
+	ID   string `json:"id"`
+	Text string `json:"text"`
+	Leaf int    `json:"leaf"`
+}
+
+// vmErrorResponse is returned with 4xx codes instead of the data
+type vmErrorResponse struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType"`
+	Error     string `json:"error"`
+}
+
+// parseError checks if response is an error and converts it to merry.Error
+func parseError(b []byte) merry.Error {
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 || b[0] == '[' {
+		return nil
+	}
+	var r vmErrorResponse
+	if err := json.Unmarshal(b, &r); err != nil || r.Status != "error" {
+		return types.ErrFailedToFetch.WithMessage(string(b))
+	}
+	return types.ErrFailedToFetch.WithMessage(r.Error).WithValue("error_type", r.ErrorType).WithValue("error", r.Error)
+}
+
+// seriesName returns graphite name of the series. VictoriaMetrics can return name of tagged series without tags, in
+// that case they are restored from the tags map.
+func (r *vmRenderResponse) seriesName() string {
+	if strings.Contains(r.Target, ";") || len(r.Tags) == 0 {
+		return r.Target
+	}
+
+	name := r.Tags["name"]
+	if name == "" {
+		name = r.Target
+	}
+	keys := make([]string, 0, len(r.Tags))
+	for k := range r.Tags {
+		if k != "name" {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return name
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	sb.WriteString(name)
+	for _, k := range keys {
+		sb.WriteByte(';')
+		sb.WriteString(k)
+		sb.WriteByte('=')
+		sb.WriteString(r.Tags[k])
+	}
+	return sb.String()
+}
+
+// toFetchResponse converts series to carbonapi_v3_pb format. Step is guessed from the first two points, series with
+// less points get the whole requested interval as a step.
+func (r *vmRenderResponse) toFetchResponse(m *protov3.FetchRequest) protov3.FetchResponse {
+	values := make([]float64, len(r.Datapoints))
+	for i, p := range r.Datapoints {
+		if p[0] == nil {
+			values[i] = math.NaN()
+		} else {
+			values[i] = *p[0]
+		}
+	}
+
+	start := m.StartTime
+	if len(r.Datapoints) > 0 && r.Datapoints[0][1] != nil {
+		start = int64(*r.Datapoints[0][1])
+	}
+	step := m.StopTime - m.StartTime
+	if len(r.Datapoints) > 1 && r.Datapoints[1][1] != nil {
+		step = int64(*r.Datapoints[1][1]) - start
+	}
+	if step <= 0 {
+		step = 1
+	}
+
+	return protov3.FetchResponse{
+		Name:              r.seriesName(),
+		PathExpression:    m.PathExpression,
+		ConsolidationFunc: "Average",
+		StartTime:         start,
+		StopTime:          start + int64(len(values))*step,
+		StepTime:          step,
+		Values:            values,
+		XFilesFactor:      0.0,
+		RequestStartTime:  m.StartTime,
+		RequestStopTime:   m.StopTime,
+	}
+}
+
+// toGlobMatch converts treejson node to carbonapi_v3_pb format, ids of branches can have trailing dot
+func (r *vmFindResponse) toGlobMatch() protov3.GlobMatch {
+	return protov3.GlobMatch{
+		Path:   strings.TrimSuffix(r.ID, "."),
+		IsLeaf: r.Leaf == 1,
+	}
+}
@@ -0,0 +1,243 @@
+package victoriametrics
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/limiter"
+	"github.com/go-graphite/carbonapi/zipper/types"
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+
+	"go.uber.org/zap"
+)
+
+// newVictoriaMetricsStub returns server that answers the same way as mockbackend with victoriaMetrics flag does,
+// query strings of the requests are recorded by path
+func newVictoriaMetricsStub(requests map[string]url.Values) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path] = r.URL.Query()
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/select/0/graphite/render":
+			if r.URL.Query().Get("target") == "bad(" {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"status":"error","errorType":"422","error":"cannot parse target"}`))
+				return
+			}
+			_, _ = w.Write([]byte(`[` +
+				`{"target":"cpu.usage","tags":{"name":"cpu.usage","host":"host1","dc":"dc1"},"datapoints":[[10,60],[null,120],[30,180]]},` +
+				`{"target":"a.b;x=y","tags":{"name":"a.b","x":"y"},"datapoints":[[1,60]]},` +
+				`{"target":"a.c","tags":{"name":"a.c"},"datapoints":[]}]`))
+		case "/select/0/graphite/metrics/find":
+			_, _ = w.Write([]byte(`[` +
+				`{"id":"a.b.","text":"b","allowChildren":1,"expandable":1,"leaf":0,"context":{}},` +
+				`{"id":"a.c","text":"c","allowChildren":0,"expandable":0,"leaf":1,"context":{}}]`))
+		case "/select/0/graphite/tags/autoComplete/tags":
+			_, _ = w.Write([]byte(`["dc","host","name"]`))
+		case "/select/0/graphite/tags/autoComplete/values":
+			_, _ = w.Write([]byte(`["host1","host2"]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func newTestGroup(t *testing.T, server string, options map[string]interface{}) *VictoriaMetricsGroup {
+	concurrencyLimit := 10
+	keepAlive := time.Second
+	maxIdle := 10
+	maxTries := 1
+	maxBatchSize := 0
+	config := types.BackendV2{
+		GroupName:           "victoriametrics",
+		Protocol:            "victoriametrics",
+		Servers:             []string{server + "/select/0/graphite"},
+		ConcurrencyLimit:    &concurrencyLimit,
+		KeepAliveInterval:   &keepAlive,
+		MaxIdleConnsPerHost: &maxIdle,
+		MaxTries:            &maxTries,
+		MaxBatchSize:        &maxBatchSize,
+		Timeouts: &types.Timeouts{
+			Find:    time.Second,
+			Render:  time.Second,
+			Connect: time.Second,
+		},
+		BackendOptions: options,
+	}
+
+	c, err := NewWithLimiter(zap.NewNop(), config, false, limiter.NoopLimiter{})
+	if err != nil {
+		t.Fatalf("failed to create group: %v", err)
+	}
+	return c.(*VictoriaMetricsGroup)
+}
+
+func TestFetch(t *testing.T) {
+	requests := make(map[string]url.Values)
+	srv := newVictoriaMetricsStub(requests)
+	defer srv.Close()
+
+	c := newTestGroup(t, srv.URL, nil)
+
+	res, _, err := c.Fetch(context.Background(), &protov3.MultiFetchRequest{
+		Metrics: []protov3.FetchRequest{{Name: "seriesByTag('name=~.*')", PathExpression: "seriesByTag('name=~.*')", StartTime: 60, StopTime: 240}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	q := requests["/select/0/graphite/render"]
+	if q.Get("format") != "json" || q.Get("from") != "60" || q.Get("until") != "240" || q.Get("target") != "seriesByTag('name=~.*')" {
+		t.Errorf("unexpected request: %v", q)
+	}
+	if _, ok := q["maxDataPoints"]; ok {
+		t.Errorf("maxDataPoints shouldn't be passed without a limit: %v", q)
+	}
+
+	type series struct {
+		name              string
+		start, stop, step int64
+		values            []float64
+	}
+	want := []series{
+		{"cpu.usage;dc=dc1;host=host1", 60, 240, 60, []float64{10, math.NaN(), 30}},
+		{"a.b;x=y", 60, 240, 180, []float64{1}},
+		{"a.c", 60, 60, 180, []float64{}},
+	}
+	if len(res.Metrics) != len(want) {
+		t.Fatalf("got %v series, want %v", len(res.Metrics), len(want))
+	}
+	for i, w := range want {
+		m := res.Metrics[i]
+		if m.Name != w.name || m.StartTime != w.start || m.StopTime != w.stop || m.StepTime != w.step || m.PathExpression != "seriesByTag('name=~.*')" {
+			t.Errorf("series %v: got %+v, want %+v", i, m, w)
+			continue
+		}
+		if len(m.Values) != len(w.values) {
+			t.Errorf("series %v: got values %v, want %v", i, m.Values, w.values)
+			continue
+		}
+		for j := range w.values {
+			if m.Values[j] != w.values[j] && !(math.IsNaN(m.Values[j]) && math.IsNaN(w.values[j])) {
+				t.Errorf("series %v: got values %v, want %v", i, m.Values, w.values)
+				break
+			}
+		}
+	}
+}
+
+func TestFetchError(t *testing.T) {
+	requests := make(map[string]url.Values)
+	srv := newVictoriaMetricsStub(requests)
+	defer srv.Close()
+
+	c := newTestGroup(t, srv.URL, nil)
+
+	_, stats, err := c.Fetch(context.Background(), &protov3.MultiFetchRequest{
+		Metrics: []protov3.FetchRequest{{Name: "bad(", PathExpression: "bad(", StartTime: 60, StopTime: 240}},
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if stats.RenderErrors != 1 || !reflect.DeepEqual(stats.FailedServers, []string{"victoriametrics"}) {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestMaxDataPoints(t *testing.T) {
+	tests := []struct {
+		maxPointsPerQuery int
+		requested         int64
+		want              string
+	}{
+		{0, 0, ""},
+		{0, 100, "100"},
+		{1000, 0, "1000"},
+		{1000, 100, "100"},
+		{1000, 5000, "1000"},
+	}
+
+	for _, tt := range tests {
+		requests := make(map[string]url.Values)
+		srv := newVictoriaMetricsStub(requests)
+
+		var options map[string]interface{}
+		if tt.maxPointsPerQuery > 0 {
+			options = map[string]interface{}{"max_points_per_query": tt.maxPointsPerQuery}
+		}
+		c := newTestGroup(t, srv.URL, options)
+
+		_, _, err := c.Fetch(context.Background(), &protov3.MultiFetchRequest{
+			Metrics: []protov3.FetchRequest{{Name: "a.*", PathExpression: "a.*", StartTime: 60, StopTime: 240, MaxDataPoints: tt.requested}},
+		})
+		srv.Close()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := requests["/select/0/graphite/render"].Get("maxDataPoints"); got != tt.want {
+			t.Errorf("max_points_per_query=%v, maxDataPoints=%v: got %q, want %q", tt.maxPointsPerQuery, tt.requested, got, tt.want)
+		}
+	}
+}
+
+func TestFind(t *testing.T) {
+	requests := make(map[string]url.Values)
+	srv := newVictoriaMetricsStub(requests)
+	defer srv.Close()
+
+	c := newTestGroup(t, srv.URL, nil)
+
+	res, _, err := c.Find(context.Background(), &protov3.MultiGlobRequest{Metrics: []string{"a.*"}, StartTime: 60, StopTime: 240})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	q := requests["/select/0/graphite/metrics/find"]
+	if q.Get("query") != "a.*" || q.Get("format") != "treejson" || q.Get("from") != "60" || q.Get("until") != "240" {
+		t.Errorf("unexpected request: %v", q)
+	}
+
+	want := []protov3.GlobResponse{{
+		Name:    "a.*",
+		Matches: []protov3.GlobMatch{{Path: "a.b"}, {Path: "a.c", IsLeaf: true}},
+	}}
+	if !reflect.DeepEqual(res.Metrics, want) {
+		t.Errorf("got %+v, want %+v", res.Metrics, want)
+	}
+}
+
+func TestTags(t *testing.T) {
+	requests := make(map[string]url.Values)
+	srv := newVictoriaMetricsStub(requests)
+	defer srv.Close()
+
+	c := newTestGroup(t, srv.URL, nil)
+
+	names, err := c.TagNames(context.Background(), "tagPrefix=h&expr=name%3Dcpu.usage", 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"dc", "host", "name"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got %v, want %v", names, want)
+	}
+	if want := (url.Values{"tagPrefix": {"h"}, "expr": {"name=cpu.usage"}, "limit": {"10"}}); !reflect.DeepEqual(requests["/select/0/graphite/tags/autoComplete/tags"], want) {
+		t.Errorf("got request %v, want %v", requests["/select/0/graphite/tags/autoComplete/tags"], want)
+	}
+
+	values, err := c.TagValues(context.Background(), "tag=host", -1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"host1", "host2"}; !reflect.DeepEqual(values, want) {
+		t.Errorf("got %v, want %v", values, want)
+	}
+	if want := (url.Values{"tag": {"host"}}); !reflect.DeepEqual(requests["/select/0/graphite/tags/autoComplete/values"], want) {
+		t.Errorf("got request %v, want %v", requests["/select/0/graphite/tags/autoComplete/values"], want)
+	}
+}
@@ -17,7 +17,8 @@ type BackendsV2 struct {
 type BackendV2 struct {
 	GroupName           string                 `mapstructure:"groupName"`
 	Protocol            string                 `mapstructure:"protocol"`
-	LBMethod            string                 `mapstructure:"lbMethod"` // Valid: rr/roundrobin, broadcast/all
+	LBMethod            string                 `mapstructure:"lbMethod"`          // Valid: rr/roundrobin, broadcast/all, least_latency/p2c, carbon_ch, fnv1a_ch, jump_fnv1a
+	ReplicationFactor   int                    `mapstructure:"replicationFactor"` // Number of servers that have each metric, only for hashing lbMethods
 	Servers             []string               `mapstructure:"servers"`
 	Timeouts            *Timeouts              `mapstructure:"timeouts"`
 	ConcurrencyLimit    *int                   `mapstructure:"concurrencyLimit"`
@@ -25,9 +26,16 @@ type BackendV2 struct {
 	MaxIdleConnsPerHost *int                   `mapstructure:"maxIdleConnsPerHost"`
 	MaxTries            *int                   `mapstructure:"maxTries"`
 	MaxBatchSize        *int                   `mapstructure:"maxBatchSize"`
+	Hedging             *Hedging               `mapstructure:"hedging"` // Only for rr/roundrobin and least_latency/p2c lbMethods
 	BackendOptions      map[string]interface{} `mapstructure:"backendOptions"`
 }
 
+// Hedging configures sending second request to another server of the group if the first one is slow to respond
+type Hedging struct {
+	Percentile float64       `mapstructure:"percentile"` // Request is hedged after this percentile of recent response times, 0 disables hedging
+	MinDelay   time.Duration `mapstructure:"minDelay"`   // Request is never hedged earlier than that
+}
+
 func (b *BackendV2) FillDefaults() {
 	if b.Timeouts == nil {
 		b.Timeouts = &Timeouts{}
@@ -13,6 +13,10 @@ type LBMethod int
 const (
 	RoundRobinLB LBMethod = iota
 	BroadcastLB
+	CarbonCHLB
+	FNV1aCHLB
+	JumpFNV1aLB
+	LeastLatencyLB
 )
 
 func (p LBMethod) keys(m map[string]LBMethod) []string {
@@ -29,6 +33,19 @@ var supportedLBMethods = map[string]LBMethod{
 	"any":        RoundRobinLB,
 	"broadcast":  BroadcastLB,
 	"all":        BroadcastLB,
+
+	"carbon_ch":     CarbonCHLB,
+	"fnv1a_ch":      FNV1aCHLB,
+	"jump_fnv1a":    JumpFNV1aLB,
+	"jump_fnv1a_ch": JumpFNV1aLB,
+
+	"least_latency": LeastLatencyLB,
+	"p2c":           LeastLatencyLB,
+}
+
+// IsConsistentHash tells if metrics are distributed between servers by one of carbon-c-relay's hashing algorithms
+func (m LBMethod) IsConsistentHash() bool {
+	return m == CarbonCHLB || m == FNV1aCHLB || m == JumpFNV1aLB
 }
 
 func (m *LBMethod) FromString(method string) error {
@@ -60,6 +77,14 @@ func (m LBMethod) MarshalJSON() ([]byte, error) {
 		return json.Marshal("RoundRobin")
 	case BroadcastLB:
 		return json.Marshal("Broadcast")
+	case CarbonCHLB:
+		return json.Marshal("CarbonCH")
+	case FNV1aCHLB:
+		return json.Marshal("FNV1aCH")
+	case JumpFNV1aLB:
+		return json.Marshal("JumpFNV1a")
+	case LeastLatencyLB:
+		return json.Marshal("LeastLatency")
 	}
 
 	return nil, fmt.Errorf(ErrUnknownLBMethodFmt, m, m.keys(supportedLBMethods))
@@ -23,6 +23,9 @@ type Stats struct {
 	CacheMisses int64
 	CacheHits   int64
 
+	HedgesSent int64
+	HedgesWon  int64
+
 	Servers       []string
 	FailedServers []string
 }
@@ -44,6 +47,8 @@ func (s *Stats) Merge(stats *Stats) {
 	s.MemoryUsage += stats.MemoryUsage
 	s.CacheMisses += stats.CacheMisses
 	s.CacheHits += stats.CacheHits
+	s.HedgesSent += stats.HedgesSent
+	s.HedgesWon += stats.HedgesWon
 
 	s.Servers = append(s.Servers, stats.Servers...)
 	s.FailedServers = append(s.FailedServers, stats.FailedServers...)
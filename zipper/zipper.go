@@ -9,18 +9,28 @@ import (
 	"github.com/ansel1/merry"
 	"github.com/go-graphite/carbonapi/zipper/broadcast"
 	"github.com/go-graphite/carbonapi/zipper/config"
+	"github.com/go-graphite/carbonapi/zipper/consistenthash"
 	"github.com/go-graphite/carbonapi/zipper/metadata"
 	"github.com/go-graphite/carbonapi/zipper/types"
 	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
 	"go.uber.org/zap"
 
 	_ "github.com/go-graphite/carbonapi/zipper/protocols/auto"
+	_ "github.com/go-graphite/carbonapi/zipper/protocols/clickhouse"
 	_ "github.com/go-graphite/carbonapi/zipper/protocols/graphite"
 	_ "github.com/go-graphite/carbonapi/zipper/protocols/prometheus"
 	_ "github.com/go-graphite/carbonapi/zipper/protocols/v2"
 	_ "github.com/go-graphite/carbonapi/zipper/protocols/v3"
+	_ "github.com/go-graphite/carbonapi/zipper/protocols/v3grpc"
+	_ "github.com/go-graphite/carbonapi/zipper/protocols/victoriametrics"
 )
 
+var hashTypes = map[types.LBMethod]consistenthash.HashType{
+	types.CarbonCHLB:  consistenthash.CarbonCH,
+	types.FNV1aCHLB:   consistenthash.FNV1aCH,
+	types.JumpFNV1aLB: consistenthash.JumpFNV1a,
+}
+
 // Zipper provides interface to Zipper-related functions
 type Zipper struct {
 	probeTicker *time.Ticker
@@ -107,7 +117,31 @@ func createBackendsV2(logger *zap.Logger, backends types.BackendsV2, expireDelay
 				zap.Error(err),
 			)
 		}
-		if lbMethod == types.RoundRobinLB {
+		if lbMethod.IsConsistentHash() {
+			config := backend
+
+			backends := make([]types.BackendServer, 0, len(backend.Servers))
+			nodes := make([]consistenthash.Node, 0, len(backend.Servers))
+			for _, s := range backend.Servers {
+				server, node, err := consistenthash.ParseServer(s)
+				if err != nil {
+					return nil, merry.Wrap(err)
+				}
+				config.Servers = []string{server}
+				config.GroupName = server
+				client, e = backendInit(logger, config, tldCacheDisabled)
+				if e != nil {
+					return nil, e
+				}
+				backends = append(backends, client)
+				nodes = append(nodes, node)
+			}
+
+			client, e = consistenthash.NewConsistentHashGroup(logger, backend.GroupName, hashTypes[lbMethod], backend.ReplicationFactor, backends, nodes, expireDelaySec, *backend.ConcurrencyLimit, *backend.MaxBatchSize, timeouts, tldCacheDisabled)
+			if e != nil {
+				return nil, e
+			}
+		} else if lbMethod == types.RoundRobinLB || lbMethod == types.LeastLatencyLB {
 			client, e = backendInit(logger, backend, tldCacheDisabled)
 			if e != nil {
 				return nil, e
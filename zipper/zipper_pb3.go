@@ -12,10 +12,13 @@ import (
 	"go.uber.org/zap"
 
 	_ "github.com/go-graphite/carbonapi/zipper/protocols/auto"
+	_ "github.com/go-graphite/carbonapi/zipper/protocols/clickhouse"
 	_ "github.com/go-graphite/carbonapi/zipper/protocols/graphite"
 	_ "github.com/go-graphite/carbonapi/zipper/protocols/prometheus"
 	_ "github.com/go-graphite/carbonapi/zipper/protocols/v2"
 	_ "github.com/go-graphite/carbonapi/zipper/protocols/v3"
+	_ "github.com/go-graphite/carbonapi/zipper/protocols/v3grpc"
+	_ "github.com/go-graphite/carbonapi/zipper/protocols/victoriametrics"
 )
 
 // DEPRECATED